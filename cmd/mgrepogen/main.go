@@ -0,0 +1,295 @@
+// Command mgrepogen generates typed repositories with named finders for model structs.
+//
+// Fields tagged with repo get finders on the field, options are comma separated:
+//
+//	type User struct {
+//		ID     primitive.ObjectID `bson:"_id,omitempty"`
+//		Email  string             `bson:"email" repo:"find"`
+//		Status Status             `bson:"status" repo:"list,paged"`
+//	}
+//
+// generates UserRepository with FindByEmail, ListByStatus and ListByStatusPaged built on
+// mongodb.Repository. The field value parameters are named by + field (byEmail), so they never
+// collide with the other parameters and variables of the finders. Run it with go generate:
+//
+//	//go:generate mgrepogen -type User
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// finder is a generated method on one field
+type finder struct {
+	Field     string
+	BSON      string
+	Param     string
+	ParamType string
+	Find      bool
+	List      bool
+	Paged     bool
+}
+
+// model is a struct a repository is generated for
+type model struct {
+	Name    string
+	Finders []finder
+}
+
+func main() {
+	types := flag.String("type", "", "comma separated model struct names")
+	output := flag.String("output", "", "output file, <input>_repo.go by default")
+	flag.Parse()
+
+	input := flag.Arg(0)
+	if input == "" {
+		input = os.Getenv("GOFILE")
+	}
+	if *types == "" || input == "" {
+		fmt.Fprintln(os.Stderr, "usage: mgrepogen -type T[,T...] [-output file] [file.go]")
+		os.Exit(2)
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(input, ".go") + "_repo.go"
+	}
+
+	src, err := generate(input, strings.Split(*types, ","))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mgrepogen: %s\n", err)
+		os.Exit(1)
+	}
+	err = os.WriteFile(*output, src, 0o644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mgrepogen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// generate returns the formatted repository source of types declared in the file input
+func generate(input string, types []string) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, input, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	imports := map[string]string{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := filepath.Base(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		imports[name] = path
+	}
+
+	used := map[string]bool{}
+	var models []model
+	for _, name := range types {
+		spec := findStruct(file, name)
+		if spec == nil {
+			return nil, fmt.Errorf("failed to find struct %s in %s", name, input)
+		}
+		m := model{Name: name}
+		for _, field := range spec.Fields.List {
+			if field.Tag == nil || len(field.Names) == 0 {
+				continue
+			}
+			tag := reflect.StructTag(strings.Trim(field.Tag.Value, "`"))
+			options, ok := tag.Lookup("repo")
+			if !ok {
+				continue
+			}
+			var typ bytes.Buffer
+			err = printer.Fprint(&typ, fset, field.Type)
+			if err != nil {
+				return nil, err
+			}
+			ast.Inspect(field.Type, func(n ast.Node) bool {
+				if sel, ok := n.(*ast.SelectorExpr); ok {
+					if pkg, ok := sel.X.(*ast.Ident); ok {
+						used[pkg.Name] = true
+					}
+				}
+				return true
+			})
+			for _, fieldName := range field.Names {
+				f := finder{
+					Field:     fieldName.Name,
+					BSON:      bsonName(tag, fieldName.Name),
+					Param:     paramName(fieldName.Name),
+					ParamType: typ.String(),
+				}
+				for _, option := range strings.Split(options, ",") {
+					switch strings.TrimSpace(option) {
+					case "find":
+						f.Find = true
+					case "list":
+						f.List = true
+					case "paged":
+						f.Paged = true
+					default:
+						return nil, fmt.Errorf("failed to parse repo tag of %s.%s: unknown option %q", name, fieldName.Name, option)
+					}
+				}
+				m.Finders = append(m.Finders, f)
+			}
+		}
+		models = append(models, m)
+	}
+
+	var std, extra []string
+	for pkg := range used {
+		path, ok := imports[pkg]
+		if !ok {
+			return nil, fmt.Errorf("failed to resolve package %s", pkg)
+		}
+		spec := strconv.Quote(path)
+		if filepath.Base(path) != pkg {
+			spec = pkg + " " + spec
+		}
+		// standard library paths have no dot in their first element
+		if strings.Contains(strings.Split(path, "/")[0], ".") {
+			extra = append(extra, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(extra)
+	paged := false
+	for _, m := range models {
+		for _, f := range m.Finders {
+			paged = paged || f.Paged
+		}
+	}
+
+	var buf bytes.Buffer
+	err = repoTemplate.Execute(&buf, map[string]any{
+		"Package": file.Name.Name,
+		"Std":     std,
+		"Imports": extra,
+		"Models":  models,
+		"Paged":   paged,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+// findStruct returns the struct type declared as name in file
+func findStruct(file *ast.File, name string) *ast.StructType {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if st, ok := ts.Type.(*ast.StructType); ok && ts.Name.Name == name {
+				return st
+			}
+		}
+	}
+	return nil
+}
+
+// bsonName returns the bson key of a field like the driver does
+func bsonName(tag reflect.StructTag, field string) string {
+	name := strings.Split(tag.Get("bson"), ",")[0]
+	if name == "" || name == "-" {
+		return strings.ToLower(field)
+	}
+	return name
+}
+
+// paramName returns the parameter name of the value of field, e.g. byUserID for UserID.
+// The prefix keeps it apart from the other identifiers of the finders, e.g. page for Page.
+func paramName(field string) string {
+	runes := []rune(field)
+	runes[0] = unicode.ToUpper(runes[0])
+	return "by" + string(runes)
+}
+
+var repoTemplate = template.Must(template.New("repo").Parse(`// Code generated by mgrepogen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+{{- range .Std}}
+	{{.}}
+{{- end}}
+
+	"github.com/blocktech-kg/go-mongodb-generic/mongodb"
+{{- if .Paged}}
+	"go.mongodb.org/mongo-driver/bson"
+{{- end}}
+	"go.mongodb.org/mongo-driver/mongo"
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{range $m := .Models}}
+// {{$m.Name}}Repository is the typed repository of {{$m.Name}}
+type {{$m.Name}}Repository struct {
+	mongodb.Repository[{{$m.Name}}]
+}
+
+// New{{$m.Name}}Repository creates a {{$m.Name}}Repository on dbCollection, opts are the controller options
+func New{{$m.Name}}Repository(dbCollection *mongo.Collection, opts ...mongodb.Option) *{{$m.Name}}Repository {
+	return &{{$m.Name}}Repository{Repository: mongodb.NewRepository[{{$m.Name}}](dbCollection, opts...)}
+}
+{{range $f := $m.Finders}}{{if $f.Find}}
+// FindBy{{$f.Field}} returns the {{$m.Name}} with {{$f.BSON}} equal to {{$f.Param}}
+// if not found, return *mongodb.NotFoundError
+// if some failed, return err
+func (r *{{$m.Name}}Repository) FindBy{{$f.Field}}(ctx context.Context, {{$f.Param}} {{$f.ParamType}}) (*{{$m.Name}}, error) {
+	return r.Find(ctx, mongodb.Query{Filter: map[string]any{"{{$f.BSON}}": {{$f.Param}}}})
+}
+{{end}}{{if $f.List}}
+// ListBy{{$f.Field}} returns the {{$m.Name}} items with {{$f.BSON}} equal to {{$f.Param}}
+// if some failed, return err
+func (r *{{$m.Name}}Repository) ListBy{{$f.Field}}(ctx context.Context, {{$f.Param}} {{$f.ParamType}}) ([]{{$m.Name}}, error) {
+	return r.List(ctx, mongodb.Query{Filter: map[string]any{"{{$f.BSON}}": {{$f.Param}}}})
+}
+{{end}}{{if $f.Paged}}
+// ListBy{{$f.Field}}Paged returns a page of the {{$m.Name}} items with {{$f.BSON}} equal to {{$f.Param}}
+// ordered by sort (_id when empty), page is 1-based
+// if some failed, return err
+func (r *{{$m.Name}}Repository) ListBy{{$f.Field}}Paged(ctx context.Context, {{$f.Param}} {{$f.ParamType}}, sort bson.D, page int64, pageSize int64) (*mongodb.Page[{{$m.Name}}], error) {
+	if page < 1 {
+		page = 1
+	}
+	if len(sort) == 0 {
+		sort = bson.D{{"{{"}}Key: "_id", Value: 1{{"}}"}}
+	}
+	q := mongodb.Query{Filter: map[string]any{"{{$f.BSON}}": {{$f.Param}}}, Sort: sort}
+	total, err := r.Count(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	q.Skip = (page - 1) * pageSize
+	q.Limit = pageSize
+	items, err := r.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return &mongodb.Page[{{$m.Name}}]{Items: items, Total: total, Page: page, PageSize: pageSize}, nil
+}
+{{end}}{{end}}{{end}}`))
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+func TestParamName(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{field: "Email", want: "byEmail"},
+		{field: "UserID", want: "byUserID"},
+		{field: "ID", want: "byID"},
+		{field: "Type", want: "byType"},
+		{field: "Page", want: "byPage"},
+		{field: "x", want: "byX"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			if got := paramName(tt.field); got != tt.want {
+				t.Errorf("paramName(%q) = %q, want %q", tt.field, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBSONName(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{tag: `bson:"email"`, want: "email"},
+		{tag: `bson:"_id,omitempty"`, want: "_id"},
+		{tag: `bson:",omitempty"`, want: "userid"},
+		{tag: `bson:"-"`, want: "userid"},
+		{tag: `json:"user_id"`, want: "userid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := bsonName(reflect.StructTag(tt.tag), "UserID"); got != tt.want {
+				t.Errorf("bsonName(%s) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		types   []string
+		want    []string
+		absent  []string
+		wantErr string
+	}{
+		{
+			name: "finders",
+			src: `package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type User struct {
+	ID     primitive.ObjectID ` + "`bson:\"_id,omitempty\" repo:\"find\"`" + `
+	Email  string             ` + "`bson:\"email\" repo:\"find,list\"`" + `
+	Status string             ` + "`bson:\"status\" repo:\"paged\"`" + `
+	Name   string             ` + "`bson:\"name\"`" + `
+}
+`,
+			types: []string{"User"},
+			want: []string{
+				"package models",
+				`"go.mongodb.org/mongo-driver/bson/primitive"`,
+				"type UserRepository struct",
+				"func NewUserRepository(dbCollection *mongo.Collection, opts ...mongodb.Option) *UserRepository",
+				"func (r *UserRepository) FindByID(ctx context.Context, byID primitive.ObjectID) (*User, error)",
+				`map[string]any{"_id": byID}`,
+				"func (r *UserRepository) FindByEmail(ctx context.Context, byEmail string) (*User, error)",
+				"func (r *UserRepository) ListByEmail(ctx context.Context, byEmail string) ([]User, error)",
+				"func (r *UserRepository) ListByStatusPaged(",
+			},
+			absent: []string{"ByName", "ListByStatus(", "FindByStatus"},
+		},
+		{
+			name: "no paged finder imports no bson",
+			src: `package models
+
+import "time"
+
+type Event struct {
+	At time.Time ` + "`repo:\"list\"`" + `
+}
+`,
+			types:  []string{"Event"},
+			want:   []string{`"time"`, "func (r *EventRepository) ListByAt(ctx context.Context, byAt time.Time) ([]Event, error)", `map[string]any{"at": byAt}`},
+			absent: []string{`"go.mongodb.org/mongo-driver/bson"`},
+		},
+		{
+			name:    "unknown option",
+			src:     "package models\n\ntype A struct {\n\tB string `repo:\"sort\"`\n}\n",
+			types:   []string{"A"},
+			wantErr: `unknown option "sort"`,
+		},
+		{
+			name:    "missing type",
+			src:     "package models\n\ntype A struct{}\n",
+			types:   []string{"B"},
+			wantErr: "failed to find struct B",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := filepath.Join(t.TempDir(), "models.go")
+			if err := os.WriteFile(input, []byte(tt.src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			src, err := generate(input, tt.types)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("generate() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("generate() error = %v", err)
+			}
+			if _, err = parser.ParseFile(token.NewFileSet(), "repo.go", src, 0); err != nil {
+				t.Fatalf("generated source does not parse: %v\n%s", err, src)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(src), want) {
+					t.Errorf("generated source lacks %q:\n%s", want, src)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(string(src), absent) {
+					t.Errorf("generated source has %q:\n%s", absent, src)
+				}
+			}
+		})
+	}
+}
+
+// TestGenerateGolden compares the repositories generated for testdata/models.go with
+// testdata/models_repo.golden (go test -update rewrites it) and type checks them unless -short
+func TestGenerateGolden(t *testing.T) {
+	input := filepath.Join("testdata", "models.go")
+	golden := filepath.Join("testdata", "models_repo.golden")
+	src, err := generate(input, []string{"User", "Listing"})
+	if err != nil {
+		t.Fatalf("generate() error = %v", err)
+	}
+	if *update {
+		if err = os.WriteFile(golden, src, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, want) {
+		t.Errorf("generated source differs from %s, run go test -update:\n%s", golden, src)
+	}
+
+	if testing.Short() {
+		return
+	}
+	fset := token.NewFileSet()
+	models, err := parser.ParseFile(fset, input, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := parser.ParseFile(fset, "models_repo.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err = conf.Check("models", fset, []*ast.File{models, repo}, nil); err != nil {
+		t.Errorf("generated source does not compile: %v", err)
+	}
+}
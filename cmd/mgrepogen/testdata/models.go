@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type User struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" repo:"find"`
+	Email  string             `bson:"email" repo:"find,list"`
+	Status string             `bson:"status" repo:"list,paged"`
+	Name   string             `bson:"name"`
+}
+
+// Listing has fields named like the parameters and variables of the finders
+type Listing struct {
+	Page     int64     `bson:"page" repo:"paged"`
+	Sort     string    `bson:"sort" repo:"paged"`
+	Items    int       `bson:"items" repo:"paged"`
+	PageSize int64     `bson:"page_size" repo:"paged"`
+	Total    int64     `bson:"total" repo:"paged"`
+	Type     string    `bson:"type" repo:"find"`
+	Ctx      string    `bson:"ctx" repo:"list"`
+	At       time.Time `repo:"list"`
+}
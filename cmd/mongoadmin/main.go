@@ -0,0 +1,376 @@
+// Command mongoadmin runs common operations of the mongodb package against any environment
+// without one-off Go programs:
+//
+//	mongoadmin -uri mongodb://... -db shop indexes -file indexes.json
+//	mongoadmin -db shop export -collection orders -filter '{"status": "paid"}' -out orders.ndjson
+//	mongoadmin -db shop import -collection orders -in orders.ndjson
+//	mongoadmin -db shop dump -out shop.bson
+//	mongoadmin -db shop restore -in shop.bson -yes
+//	mongoadmin -db shop migrate -target-uri mongodb://... -collections orders,users -tail
+//	mongoadmin -db shop purge -collection events -field created_at -older-than 2160h -dry-run
+//	mongoadmin -db shop selfcheck -min-version 6.0
+//
+// Destructive commands (restore, purge) only run with -yes, purge -dry-run reports what it would delete.
+// The connection string defaults to $MONGODB_URI. Index files are extended JSON:
+//
+//	{"indexes": [{"collection": "users", "keys": {"email": 1}, "unique": true}]}
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/blocktech-kg/go-mongodb-generic/mongoarrow"
+	"github.com/blocktech-kg/go-mongodb-generic/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// command is a subcommand run with its own flags on the connected database
+type command struct {
+	usage string
+	run   func(ctx context.Context, db *mongo.Database, args []string) error
+}
+
+var commands = map[string]command{
+	"indexes":   {"-file indexes.json", runIndexes},
+	"export":    {"-collection c [-filter json] [-format ndjson|bson|parquet] [-out file]", runExport},
+	"import":    {"-collection c [-format ndjson|bson|parquet] [-in file]", runImport},
+	"dump":      {"[-out file]", runDump},
+	"restore":   {"[-in file] -yes", runRestore},
+	"migrate":   {"-target-uri uri [-target-db db] [-collections a,b] [-tail]", runMigrate},
+	"purge":     {"-collection c -field f -older-than duration [-batch n] -yes|-dry-run", runPurge},
+	"selfcheck": {"[-min-version v]", runSelfCheck},
+}
+
+func main() {
+	uri := flag.String("uri", os.Getenv("MONGODB_URI"), "connection string")
+	database := flag.String("db", "", "database name")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok || *uri == "" || *database == "" {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	conn, err := mongodb.ConnectWithConfig(ctx, mongodb.ConnectConfig{URI: *uri, Database: *database})
+	if err != nil {
+		fail(err)
+	}
+	defer conn.Close(context.Background())
+
+	if err = cmd.run(ctx, conn.Database(), flag.Args()[1:]); err != nil {
+		fail(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: mongoadmin [-uri uri] -db db <command> [flags]")
+	for _, name := range []string{"indexes", "export", "import", "dump", "restore", "migrate", "purge", "selfcheck"} {
+		fmt.Fprintf(os.Stderr, "  %s %s\n", name, commands[name].usage)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "mongoadmin: %s\n", err)
+	os.Exit(1)
+}
+
+// confirm rejects a destructive command run without -yes
+func confirm(yes bool, action string) error {
+	if !yes {
+		return fmt.Errorf("%s, rerun with -yes to confirm", action)
+	}
+	return nil
+}
+
+// requireCollection checks the -collection flag of a command
+func requireCollection(collection string) error {
+	if collection == "" {
+		return fmt.Errorf("-collection is required")
+	}
+	return nil
+}
+
+func format(name string) (mongodb.Format, error) {
+	switch name {
+	case "ndjson":
+		return mongodb.FormatNDJSON, nil
+	case "bson":
+		return mongodb.FormatBSON, nil
+	case "parquet":
+		return mongoarrow.FormatParquet(), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", name)
+}
+
+// output opens path for writing, stdout for "" or "-"
+func output(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+// input opens path for reading, stdin for "" or "-"
+func input(path string) (io.ReadCloser, error) {
+	if path == "" || path == "-" {
+		return os.Stdin, nil
+	}
+	return os.Open(path)
+}
+
+func runIndexes(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("indexes", flag.ExitOnError)
+	file := flags.String("file", "", "extended JSON index file")
+	_ = flags.Parse(args)
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	var spec struct {
+		Indexes []struct {
+			Collection              string `bson:"collection"`
+			Name                    string `bson:"name"`
+			Keys                    bson.D `bson:"keys"`
+			Unique                  bool   `bson:"unique"`
+			Sparse                  bool   `bson:"sparse"`
+			PartialFilterExpression bson.D `bson:"partialFilterExpression"`
+		} `bson:"indexes"`
+	}
+	if err = bson.UnmarshalExtJSON(data, false, &spec); err != nil {
+		return fmt.Errorf("failed to parse %s: %s", *file, err)
+	}
+	byCollection := map[string][]mongodb.IndexSpec{}
+	var order []string
+	for _, index := range spec.Indexes {
+		if index.Collection == "" {
+			return fmt.Errorf("index %v has no collection", index.Keys)
+		}
+		if _, ok := byCollection[index.Collection]; !ok {
+			order = append(order, index.Collection)
+		}
+		s := mongodb.IndexSpec{Name: index.Name, Keys: index.Keys, Unique: index.Unique, Sparse: index.Sparse}
+		if index.PartialFilterExpression != nil {
+			s.PartialFilterExpression = index.PartialFilterExpression
+		}
+		byCollection[index.Collection] = append(byCollection[index.Collection], s)
+	}
+	for _, collection := range order {
+		c := mongodb.NewGenericObjectDBCtrl[bson.M](db.Collection(collection))
+		if err = c.EnsureIndexes(ctx, byCollection[collection]...); err != nil {
+			return fmt.Errorf("failed to ensure indexes of %s: %s", collection, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d indexes ensured\n", collection, len(byCollection[collection]))
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	collection := flags.String("collection", "", "collection to export")
+	filter := flags.String("filter", "{}", "extended JSON filter")
+	formatName := flags.String("format", "ndjson", "ndjson, bson or parquet")
+	out := flags.String("out", "", "output file, stdout by default")
+	_ = flags.Parse(args)
+
+	if err := requireCollection(*collection); err != nil {
+		return err
+	}
+	c := mongodb.NewGenericObjectDBCtrl[bson.M](db.Collection(*collection))
+	f, err := format(*formatName)
+	if err != nil {
+		return err
+	}
+	var sels map[string]any
+	if err = bson.UnmarshalExtJSON([]byte(*filter), false, &sels); err != nil {
+		return fmt.Errorf("failed to parse filter: %s", err)
+	}
+	w, err := output(*out)
+	if err != nil {
+		return err
+	}
+	count, err := c.Export(ctx, w, sels, mongodb.WithFormat(f))
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d documents exported\n", *collection, count)
+	return err
+}
+
+func runImport(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	collection := flags.String("collection", "", "collection to import into")
+	formatName := flags.String("format", "ndjson", "ndjson, bson or parquet")
+	in := flags.String("in", "", "input file, stdin by default")
+	_ = flags.Parse(args)
+
+	if err := requireCollection(*collection); err != nil {
+		return err
+	}
+	c := mongodb.NewGenericObjectDBCtrl[bson.M](db.Collection(*collection))
+	f, err := format(*formatName)
+	if err != nil {
+		return err
+	}
+	r, err := input(*in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	count, err := c.Import(ctx, r, mongodb.WithFormat(f))
+	fmt.Fprintf(os.Stderr, "%s: %d documents imported\n", *collection, count)
+	return err
+}
+
+func runDump(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("dump", flag.ExitOnError)
+	out := flags.String("out", "", "output file, stdout by default")
+	_ = flags.Parse(args)
+
+	w, err := output(*out)
+	if err != nil {
+		return err
+	}
+	err = mongodb.DumpDatabase(ctx, db, w)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func runRestore(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := flags.String("in", "", "input file, stdin by default")
+	yes := flags.Bool("yes", false, "confirm dropping the collections of the archive in the database")
+	_ = flags.Parse(args)
+
+	if err := confirm(*yes, fmt.Sprintf("restore drops the collections of the archive in %s", db.Name())); err != nil {
+		return err
+	}
+	r, err := input(*in)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return mongodb.RestoreDatabase(ctx, db, r)
+}
+
+func runMigrate(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	targetURI := flags.String("target-uri", "", "connection string of the target cluster")
+	targetDB := flags.String("target-db", db.Name(), "target database name")
+	collections := flags.String("collections", "", "comma separated collections, all by default")
+	tail := flags.Bool("tail", false, "apply changes made during and after the copy until interrupted")
+	_ = flags.Parse(args)
+
+	if *targetURI == "" {
+		return fmt.Errorf("-target-uri is required")
+	}
+	target, err := mongodb.ConnectWithConfig(ctx, mongodb.ConnectConfig{URI: *targetURI, Database: *targetDB})
+	if err != nil {
+		return err
+	}
+	defer target.Close(context.Background())
+
+	m := &mongodb.Migrator{
+		Source: db,
+		Target: target.Database(),
+		OnProgress: func(p mongodb.MigrationProgress) {
+			fmt.Fprintf(os.Stderr, "%s: %d\n", p.Collection, p.Applied)
+		},
+	}
+	if *collections != "" {
+		m.Collections = strings.Split(*collections, ",")
+	}
+	token, err := m.Copy(ctx)
+	if err != nil {
+		return err
+	}
+	if *tail {
+		fmt.Fprintln(os.Stderr, "copied, tailing changes until interrupted")
+		if err = m.Tail(ctx, token); err != nil {
+			return err
+		}
+		ctx = context.Background()
+	}
+	diffs, err := m.Verify(ctx)
+	if err != nil {
+		return err
+	}
+	for _, diff := range diffs {
+		fmt.Fprintf(os.Stderr, "%s differs: %d documents (%s) in source, %d (%s) in target\n",
+			diff.Collection, diff.SourceCount, diff.SourceChecksum, diff.TargetCount, diff.TargetChecksum)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%d collections differ", len(diffs))
+	}
+	return nil
+}
+
+func runPurge(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("purge", flag.ExitOnError)
+	collection := flags.String("collection", "", "collection to purge")
+	field := flags.String("field", "", "date field")
+	olderThan := flags.Duration("older-than", 0, "delete documents whose field is older than this")
+	batch := flags.Int("batch", 1000, "documents deleted per batch")
+	pause := flags.Duration("pause", 0, "pause between batches")
+	yes := flags.Bool("yes", false, "confirm deleting the documents")
+	dryRun := flags.Bool("dry-run", false, "only count the documents that would be deleted")
+	_ = flags.Parse(args)
+
+	if err := requireCollection(*collection); err != nil {
+		return err
+	}
+	c := mongodb.NewGenericObjectDBCtrl[bson.M](db.Collection(*collection))
+	if *field == "" || *olderThan <= 0 {
+		return fmt.Errorf("-field and a positive -older-than are required")
+	}
+	cutoff := time.Now().Add(-*olderThan)
+	sels := map[string]any{*field: bson.M{"$lt": cutoff}}
+	if *dryRun {
+		count, err := db.Collection(*collection).CountDocuments(ctx, sels)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%s: %d documents older than %s would be purged\n", *collection, count, cutoff.Format(time.RFC3339))
+		return nil
+	}
+	if err := confirm(*yes, fmt.Sprintf("purge deletes documents of %s", *collection)); err != nil {
+		return err
+	}
+	deleted, err := c.DeleteRangeBatched(ctx, sels, *batch, *pause, func(deleted int64) {
+		fmt.Fprintf(os.Stderr, "%s: %d deleted\n", *collection, deleted)
+	})
+	fmt.Fprintf(os.Stderr, "%s: %d documents older than %s purged\n", *collection, deleted, cutoff.Format(time.RFC3339))
+	return err
+}
+
+func runSelfCheck(ctx context.Context, db *mongo.Database, args []string) error {
+	flags := flag.NewFlagSet("selfcheck", flag.ExitOnError)
+	minVersion := flags.String("min-version", "", "oldest supported server version")
+	_ = flags.Parse(args)
+
+	report, err := mongodb.SelfCheck(ctx, db, mongodb.SelfCheckOptions{MinVersion: *minVersion})
+	if report != nil {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+	}
+	if err != nil {
+		return err
+	}
+	return report.Err()
+}
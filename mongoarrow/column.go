@@ -0,0 +1,271 @@
+// Package mongoarrow converts documents read with the mongodb package to Apache Arrow record
+// batches and Parquet files for analytical engines
+package mongoarrow
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/blocktech-kg/go-mongodb-generic/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Column maps the field at dot path Path to a typed column, flattened by the rules of
+// mongodb.CSVColumn. Type is the Arrow type of the column: String (the default when nil) renders
+// values like FormatCSVMapped, Int32, Int64, Float64, Boolean and Binary take matching bson values,
+// Timestamp takes dates, and a List of one of them takes an array element by element.
+// Arrays in other columns follow Array: ArrayFirst takes the first element (null if empty),
+// ArrayCount the number of elements, ArrayJSON and ArrayJoin need a String column.
+type Column struct {
+	mongodb.CSVColumn
+	Type arrow.DataType
+}
+
+// StringColumns returns string columns of the fields at paths
+func StringColumns(paths ...string) []Column {
+	columns := make([]Column, 0, len(paths))
+	for _, path := range paths {
+		columns = append(columns, Column{CSVColumn: mongodb.CSVColumn{Path: path}})
+	}
+	return columns
+}
+
+func (c Column) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Path
+}
+
+func (c Column) dataType() arrow.DataType {
+	if c.Type == nil {
+		return arrow.BinaryTypes.String
+	}
+	return c.Type
+}
+
+// Schema returns the Arrow schema of columns, all of them nullable
+// if a column type is not supported, return err
+func Schema(columns []Column) (*arrow.Schema, error) {
+	fields := make([]arrow.Field, 0, len(columns))
+	for _, column := range columns {
+		if !supported(column.dataType()) {
+			return nil, fmt.Errorf("unsupported type %s of column %s", column.dataType(), column.Path)
+		}
+		fields = append(fields, arrow.Field{Name: column.name(), Type: column.dataType(), Nullable: true})
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+func supported(t arrow.DataType) bool {
+	if list, ok := t.(*arrow.ListType); ok {
+		t = list.Elem()
+		return t.ID() != arrow.LIST && supported(t)
+	}
+	switch t.ID() {
+	case arrow.STRING, arrow.INT32, arrow.INT64, arrow.FLOAT64, arrow.BOOL, arrow.BINARY, arrow.TIMESTAMP:
+		return true
+	}
+	return false
+}
+
+// topLevelColumns returns string columns of the top level fields of doc
+func topLevelColumns(doc bson.Raw) ([]Column, error) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(elements))
+	for _, e := range elements {
+		paths = append(paths, e.Key())
+	}
+	return StringColumns(paths...), nil
+}
+
+// recordBuilder appends documents as rows of a record batch
+type recordBuilder struct {
+	columns []Column
+	b       *array.RecordBuilder
+	rows    int
+}
+
+func newRecordBuilder(mem memory.Allocator, columns []Column) (*recordBuilder, error) {
+	schema, err := Schema(columns)
+	if err != nil {
+		return nil, err
+	}
+	return &recordBuilder{columns: columns, b: array.NewRecordBuilder(mem, schema)}, nil
+}
+
+// append adds doc as a row, missing and null fields are null
+func (b *recordBuilder) append(doc bson.Raw) error {
+	for i, column := range b.columns {
+		value, err := doc.LookupErr(strings.Split(column.Path, ".")...)
+		if err != nil {
+			value = bson.RawValue{Type: bsontype.Null}
+		}
+		if err = appendValue(b.b.Field(i), column, value); err != nil {
+			return fmt.Errorf("failed to convert %s: %s", column.Path, err)
+		}
+	}
+	b.rows++
+	return nil
+}
+
+// record returns the appended rows as a record batch and resets the builder
+func (b *recordBuilder) record() arrow.Record {
+	b.rows = 0
+	return b.b.NewRecord()
+}
+
+func (b *recordBuilder) release() {
+	b.b.Release()
+}
+
+// appendValue appends v converted to the type of column to builder
+func appendValue(builder array.Builder, column Column, v bson.RawValue) error {
+	if v.Type == bsontype.Null || v.Type == bsontype.Undefined {
+		builder.AppendNull()
+		return nil
+	}
+	if b, ok := builder.(*array.StringBuilder); ok {
+		cell, err := column.Cell(v)
+		if err != nil {
+			return err
+		}
+		b.Append(cell)
+		return nil
+	}
+	if b, ok := builder.(*array.ListBuilder); ok {
+		return appendList(b, column, v)
+	}
+	v, err := scalar(column, v)
+	if err != nil {
+		return err
+	}
+	if v.Type == bsontype.Null {
+		builder.AppendNull()
+		return nil
+	}
+	switch b := builder.(type) {
+	case *array.Int64Builder:
+		n, err := integer(v)
+		if err != nil {
+			return err
+		}
+		b.Append(n)
+	case *array.Int32Builder:
+		n, err := integer(v)
+		if err != nil {
+			return err
+		}
+		if n < math.MinInt32 || n > math.MaxInt32 {
+			return fmt.Errorf("%d overflows int32", n)
+		}
+		b.Append(int32(n))
+	case *array.Float64Builder:
+		switch v.Type {
+		case bsontype.Double:
+			b.Append(v.Double())
+		case bsontype.Int32, bsontype.Int64:
+			n, _ := integer(v)
+			b.Append(float64(n))
+		default:
+			return fmt.Errorf("%s is not a number", v.Type)
+		}
+	case *array.BooleanBuilder:
+		flag, ok := v.BooleanOK()
+		if !ok {
+			return fmt.Errorf("%s is not a boolean", v.Type)
+		}
+		b.Append(flag)
+	case *array.BinaryBuilder:
+		switch v.Type {
+		case bsontype.Binary:
+			_, data := v.Binary()
+			b.Append(data)
+		case bsontype.ObjectID:
+			id := v.ObjectID()
+			b.Append(id[:])
+		default:
+			return fmt.Errorf("%s is not binary", v.Type)
+		}
+	case *array.TimestampBuilder:
+		if v.Type != bsontype.DateTime {
+			return fmt.Errorf("%s is not a date", v.Type)
+		}
+		ts, err := arrow.TimestampFromTime(v.Time(), b.Type().(*arrow.TimestampType).Unit)
+		if err != nil {
+			return err
+		}
+		b.Append(ts)
+	default:
+		return fmt.Errorf("unsupported column type %s", builder.Type())
+	}
+	return nil
+}
+
+// appendList appends the elements of array v to a list column, a single value as a list of one
+func appendList(b *array.ListBuilder, column Column, v bson.RawValue) error {
+	values := []bson.RawValue{v}
+	if v.Type == bsontype.Array {
+		var err error
+		values, err = v.Array().Values()
+		if err != nil {
+			return err
+		}
+	}
+	// elements are converted as they are, not flattened again
+	column.Array = mongodb.ArrayJSON
+	b.Append(true)
+	for _, value := range values {
+		if err := appendValue(b.ValueBuilder(), column, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scalar applies the array strategy of column to an array value
+func scalar(column Column, v bson.RawValue) (bson.RawValue, error) {
+	if v.Type != bsontype.Array {
+		return v, nil
+	}
+	values, err := v.Array().Values()
+	if err != nil {
+		return v, err
+	}
+	switch column.Array {
+	case mongodb.ArrayFirst:
+		if len(values) == 0 {
+			return bson.RawValue{Type: bsontype.Null}, nil
+		}
+		return values[0], nil
+	case mongodb.ArrayCount:
+		t, data, err := bson.MarshalValue(int64(len(values)))
+		return bson.RawValue{Type: t, Value: data}, err
+	}
+	return v, fmt.Errorf("array in %s column", column.dataType())
+}
+
+// integer returns an integral number of v, doubles must not have a fraction
+func integer(v bson.RawValue) (int64, error) {
+	switch v.Type {
+	case bsontype.Int32:
+		return int64(v.Int32()), nil
+	case bsontype.Int64:
+		return v.Int64(), nil
+	case bsontype.Double:
+		f := v.Double()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not an integer", f)
+		}
+		return int64(f), nil
+	}
+	return 0, fmt.Errorf("%s is not an integer", v.Type)
+}
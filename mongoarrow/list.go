@@ -0,0 +1,78 @@
+package mongoarrow
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/blocktech-kg/go-mongodb-generic/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DefaultBatchSize is the number of rows per record batch when ListArrow is given 0
+const DefaultBatchSize = 64 * 1024
+
+// RawSource streams stored documents, implemented by the controllers of the mongodb package
+type RawSource interface {
+	IterateRaw(ctx context.Context, sels map[string]any, fn func(doc bson.Raw) error, opts ...mongodb.IterateOption) error
+}
+
+// ListArrow lists items of source identified by sels (logical AND) as Arrow record batches of up
+// to batchSize rows with the schema of columns, skipping the decode into structs.
+// The caller releases the records.
+// if some failed, return err
+func ListArrow(ctx context.Context, source RawSource, sels map[string]any, columns []Column, batchSize int) ([]arrow.Record, error) {
+	records := []arrow.Record{}
+	err := StreamArrow(ctx, source, sels, columns, batchSize, func(record arrow.Record) error {
+		record.Retain()
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		for _, record := range records {
+			record.Release()
+		}
+		return nil, err
+	}
+	return records, nil
+}
+
+// StreamArrow is ListArrow handing each record batch to fn instead of collecting them,
+// the batch is released when fn returns. Streaming stops at the first error returned by fn.
+// if some failed, return err
+func StreamArrow(ctx context.Context, source RawSource, sels map[string]any, columns []Column, batchSize int, fn func(record arrow.Record) error) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("failed to list arrow records: no columns")
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	b, err := newRecordBuilder(memory.DefaultAllocator, columns)
+	if err != nil {
+		return err
+	}
+	defer b.release()
+	emit := func() error {
+		record := b.record()
+		defer record.Release()
+		return fn(record)
+	}
+
+	err = source.IterateRaw(ctx, sels, func(doc bson.Raw) error {
+		if err := b.append(doc); err != nil {
+			return err
+		}
+		if b.rows >= batchSize {
+			return emit()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if b.rows > 0 {
+		return emit()
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+package mongoarrow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apache/arrow/go/v17/arrow"
+	"github.com/apache/arrow/go/v17/arrow/array"
+	"github.com/apache/arrow/go/v17/arrow/memory"
+	"github.com/apache/arrow/go/v17/parquet"
+	"github.com/apache/arrow/go/v17/parquet/compress"
+	"github.com/apache/arrow/go/v17/parquet/file"
+	"github.com/apache/arrow/go/v17/parquet/pqarrow"
+	"github.com/blocktech-kg/go-mongodb-generic/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// rowGroupSize is the number of rows buffered before a Parquet row group is written
+const rowGroupSize = 64 * 1024
+
+// FormatParquet is a Parquet file of typed columns, snappy compressed, for mongodb.WithFormat.
+// The string columns of the top level fields of the first document are written when columns
+// is empty, and nothing at all when there are no documents either.
+// Parquet keeps its footer at the end, so the decoder reads the whole input into memory first.
+// Imported columns are stored under their Path, null values are omitted, and _id values that
+// are 24 hex digit strings or 12 byte binaries are imported as ObjectIDs.
+func FormatParquet(columns ...Column) mongodb.Format {
+	return parquetFormat{columns: columns}
+}
+
+type parquetFormat struct {
+	columns []Column
+}
+
+func (f parquetFormat) NewEncoder(w io.Writer) mongodb.Encoder {
+	// the file writer closes its sink, which is the caller's to close
+	return &parquetEncoder{w: struct{ io.Writer }{w}, columns: f.columns}
+}
+
+func (f parquetFormat) NewDecoder(r io.Reader) mongodb.Decoder {
+	paths := map[string]string{}
+	for _, column := range f.columns {
+		paths[column.name()] = column.Path
+	}
+	return &parquetDecoder{r: r, paths: paths}
+}
+
+type parquetEncoder struct {
+	w       io.Writer
+	columns []Column
+	b       *recordBuilder
+	fw      *pqarrow.FileWriter
+}
+
+func (e *parquetEncoder) Encode(doc bson.Raw) error {
+	if e.b == nil {
+		if len(e.columns) == 0 {
+			columns, err := topLevelColumns(doc)
+			if err != nil {
+				return err
+			}
+			e.columns = columns
+		}
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	if err := e.b.append(doc); err != nil {
+		return err
+	}
+	if e.b.rows >= rowGroupSize {
+		return e.write()
+	}
+	return nil
+}
+
+func (e *parquetEncoder) start() error {
+	b, err := newRecordBuilder(memory.DefaultAllocator, e.columns)
+	if err != nil {
+		return err
+	}
+	props := parquet.NewWriterProperties(parquet.WithCompression(compress.Codecs.Snappy))
+	fw, err := pqarrow.NewFileWriter(b.b.Schema(), e.w, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		b.release()
+		return err
+	}
+	e.b, e.fw = b, fw
+	return nil
+}
+
+// write writes the buffered rows as a row group
+func (e *parquetEncoder) write() error {
+	record := e.b.record()
+	defer record.Release()
+	return e.fw.Write(record)
+}
+
+func (e *parquetEncoder) Flush() error {
+	if e.b == nil {
+		if len(e.columns) == 0 {
+			return nil
+		}
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	defer e.b.release()
+	if e.b.rows > 0 {
+		if err := e.write(); err != nil {
+			return err
+		}
+	}
+	return e.fw.Close()
+}
+
+type parquetDecoder struct {
+	r      io.Reader
+	paths  map[string]string
+	reader pqarrow.RecordReader
+	record arrow.Record
+	row    int
+	done   bool
+}
+
+func (d *parquetDecoder) Decode() (bson.Raw, error) {
+	if d.done {
+		return nil, io.EOF
+	}
+	if d.reader == nil {
+		if err := d.open(); err != nil {
+			return nil, err
+		}
+	}
+	for d.record == nil || d.row >= int(d.record.NumRows()) {
+		if !d.reader.Next() {
+			d.done = true
+			d.reader.Release()
+			if err := d.reader.Err(); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		d.record, d.row = d.reader.Record(), 0
+	}
+
+	doc := bson.D{}
+	for i, field := range d.record.Schema().Fields() {
+		value, err := valueAt(d.record.Column(i), d.row)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %s", field.Name, err)
+		}
+		if value == nil {
+			continue
+		}
+		path, ok := d.paths[field.Name]
+		if !ok {
+			path = field.Name
+		}
+		if path == "_id" {
+			value = objectID(value)
+		}
+		doc = setPath(doc, strings.Split(path, "."), value)
+	}
+	d.row++
+	return bson.Marshal(doc)
+}
+
+func (d *parquetDecoder) open() error {
+	data, err := io.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return io.EOF
+	}
+	pf, err := file.NewParquetReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	fr, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: 1024}, memory.DefaultAllocator)
+	if err != nil {
+		return err
+	}
+	d.reader, err = fr.GetRecordReader(context.Background(), nil, nil)
+	return err
+}
+
+// valueAt returns the value at row i of column as a bson value, nil when null
+func valueAt(column arrow.Array, i int) (any, error) {
+	if column.IsNull(i) {
+		return nil, nil
+	}
+	switch a := column.(type) {
+	case *array.String:
+		return a.Value(i), nil
+	case *array.Int32:
+		return a.Value(i), nil
+	case *array.Int64:
+		return a.Value(i), nil
+	case *array.Float64:
+		return a.Value(i), nil
+	case *array.Boolean:
+		return a.Value(i), nil
+	case *array.Binary:
+		return bytes.Clone(a.Value(i)), nil
+	case *array.Timestamp:
+		return a.Value(i).ToTime(a.DataType().(*arrow.TimestampType).Unit), nil
+	case *array.List:
+		start, end := a.ValueOffsets(i)
+		values := bson.A{}
+		for j := start; j < end; j++ {
+			value, err := valueAt(a.ListValues(), int(j))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unsupported column type %s", column.DataType())
+}
+
+// objectID returns value as an ObjectID if it is one in hex or binary form
+func objectID(value any) any {
+	switch v := value.(type) {
+	case string:
+		if id, err := primitive.ObjectIDFromHex(v); err == nil {
+			return id
+		}
+	case []byte:
+		if len(v) == len(primitive.ObjectID{}) {
+			return primitive.ObjectID(v)
+		}
+	}
+	return value
+}
+
+// setPath sets the dot path of doc to value, creating nested documents
+func setPath(doc bson.D, path []string, value any) bson.D {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			doc[i].Value = value
+			return doc
+		}
+		nested, _ := e.Value.(bson.D)
+		doc[i].Value = setPath(nested, path[1:], value)
+		return doc
+	}
+	if len(path) == 1 {
+		return append(doc, bson.E{Key: path[0], Value: value})
+	}
+	return append(doc, bson.E{Key: path[0], Value: setPath(bson.D{}, path[1:], value)})
+}
@@ -0,0 +1,277 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// accessSampleSize is the number of documents sampled to estimate field selectivity
+const accessSampleSize = 1000
+
+// rangeOperators are the query operators making a field a range predicate
+var rangeOperators = map[string]bool{
+	"$gt": true, "$gte": true, "$lt": true, "$lte": true, "$ne": true, "$nin": true,
+	"$regex": true, "$exists": true, "$not": true,
+}
+
+// AccessPattern is the shape of queries recorded by an AccessRecorder
+type AccessPattern struct {
+	Database   string
+	Collection string
+	// Equality are the fields compared for equality (or $in)
+	Equality []string
+	// Range are the fields with range predicates
+	Range []string
+	Sort  bson.D
+	// Count is the number of sampled queries of the shape
+	Count int64
+}
+
+func (p AccessPattern) key() string {
+	return fmt.Sprintf("%s.%s|%s|%s|%v", p.Database, p.Collection, strings.Join(p.Equality, ","), strings.Join(p.Range, ","), p.Sort)
+}
+
+// IndexSuggestion is an index derived from a recorded access pattern, pass Spec to EnsureIndexes
+type IndexSuggestion struct {
+	Database   string
+	Collection string
+	Spec       IndexSpec
+	// Count is the number of sampled queries the index serves
+	Count int64
+}
+
+// AccessRecorder samples the filters and sorts executed by controllers using it (see WithAccessRecorder)
+// and suggests indexes for them
+type AccessRecorder struct {
+	rate float64
+
+	mu       sync.Mutex
+	patterns map[string]*AccessPattern
+}
+
+// NewAccessRecorder creates a recorder sampling the share rate of queries, in (0, 1]
+func NewAccessRecorder(rate float64) *AccessRecorder {
+	return &AccessRecorder{rate: rate, patterns: map[string]*AccessPattern{}}
+}
+
+// WithAccessRecorder records the filters and sorts of the List, Find, ListPage and Iterate calls
+// of the controller in rec
+func WithAccessRecorder(rec *AccessRecorder) Option {
+	return func(o *ctrlOptions) {
+		o.accessRecorder = rec
+	}
+}
+
+// Record samples a query on collection of database with sels filter and order sort
+func (r *AccessRecorder) Record(database string, collection string, sels map[string]any, order bson.D) {
+	if r.rate < 1 && rand.Float64() >= r.rate {
+		return
+	}
+	p := AccessPattern{Database: database, Collection: collection, Sort: order}
+	for key, value := range sels {
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+		if isRangePredicate(value) {
+			p.Range = append(p.Range, key)
+		} else {
+			p.Equality = append(p.Equality, key)
+		}
+	}
+	if len(p.Equality) == 0 && len(p.Range) == 0 && len(p.Sort) == 0 {
+		return
+	}
+	sort.Strings(p.Equality)
+	sort.Strings(p.Range)
+
+	key := p.key()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.patterns[key]; ok {
+		existing.Count++
+		return
+	}
+	p.Count = 1
+	r.patterns[key] = &p
+}
+
+// Patterns returns the recorded access patterns, most frequent first
+func (r *AccessRecorder) Patterns() []AccessPattern {
+	r.mu.Lock()
+	patterns := make([]AccessPattern, 0, len(r.patterns))
+	for _, p := range r.patterns {
+		patterns = append(patterns, *p)
+	}
+	r.mu.Unlock()
+	sort.Slice(patterns, func(i, j int) bool {
+		if patterns[i].Count != patterns[j].Count {
+			return patterns[i].Count > patterns[j].Count
+		}
+		return patterns[i].key() < patterns[j].key()
+	})
+	return patterns
+}
+
+// Reset drops the recorded access patterns
+func (r *AccessRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = map[string]*AccessPattern{}
+}
+
+// SuggestIndexes derives an index for every pattern recorded at least minCount times, following the
+// equality, sort, range rule with equality fields ordered by selectivity estimated on a sample of
+// the collection. Patterns served by a prefix of an existing index are skipped.
+// if some failed, return err
+func (r *AccessRecorder) SuggestIndexes(ctx context.Context, client *mongo.Client, minCount int64) ([]IndexSuggestion, error) {
+	log.Debug("DB DEBUG: Started AccessRecorder.SuggestIndexes")
+	defer log.Debug("DB DEBUG: finished AccessRecorder.SuggestIndexes")
+
+	var suggestions []IndexSuggestion
+	seen := map[string]bool{}
+	for _, p := range r.Patterns() {
+		if p.Count < minCount {
+			continue
+		}
+		coll := client.Database(p.Database).Collection(p.Collection)
+		equality, err := orderBySelectivity(ctx, coll, p.Equality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to estimate selectivity on %s: %s", p.Collection, err)
+		}
+
+		keys := bson.D{}
+		used := map[string]bool{}
+		add := func(field string, direction any) {
+			if !used[field] {
+				used[field] = true
+				keys = append(keys, bson.E{Key: field, Value: direction})
+			}
+		}
+		for _, field := range equality {
+			add(field, 1)
+		}
+		for _, e := range p.Sort {
+			add(e.Key, e.Value)
+		}
+		for _, field := range p.Range {
+			add(field, 1)
+		}
+
+		spec := IndexSpec{Keys: keys}
+		id := p.Database + "." + p.Collection + "." + spec.IndexName()
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		covered, err := hasIndexPrefix(ctx, coll, keys)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes of %s: %s", p.Collection, err)
+		}
+		if covered {
+			continue
+		}
+		suggestions = append(suggestions, IndexSuggestion{Database: p.Database, Collection: p.Collection, Spec: spec, Count: p.Count})
+	}
+	return suggestions, nil
+}
+
+// recordAccess records a query of the controller in its AccessRecorder
+func (c *genericObjectDBCtrl[T]) recordAccess(sels map[string]any, sort bson.D) {
+	if c.opts.accessRecorder != nil {
+		c.opts.accessRecorder.Record(c.db.Database().Name(), c.db.Name(), sels, sort)
+	}
+}
+
+// isRangePredicate reports whether a selector value uses a range operator
+func isRangePredicate(v any) bool {
+	switch v := v.(type) {
+	case map[string]any:
+		for k := range v {
+			if rangeOperators[k] {
+				return true
+			}
+		}
+	case bson.M:
+		return isRangePredicate(map[string]any(v))
+	case bson.D:
+		for _, e := range v {
+			if rangeOperators[e.Key] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// orderBySelectivity orders fields by the number of distinct values in a sample, most distinct first
+func orderBySelectivity(ctx context.Context, coll *mongo.Collection, fields []string) ([]string, error) {
+	if len(fields) < 2 {
+		return fields, nil
+	}
+	group := bson.D{{Key: "_id", Value: nil}}
+	project := bson.D{{Key: "_id", Value: 0}}
+	for i, field := range fields {
+		name := fmt.Sprintf("f%d", i)
+		group = append(group, bson.E{Key: name, Value: bson.M{"$addToSet": "$" + field}})
+		project = append(project, bson.E{Key: name, Value: bson.M{"$size": "$" + name}})
+	}
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sample", Value: bson.M{"size": accessSampleSize}}},
+		{{Key: "$group", Value: group}},
+		{{Key: "$project", Value: project}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var results []map[string]int64
+	err = cursor.All(ctx, &results)
+	if err != nil || len(results) == 0 {
+		return fields, err
+	}
+	ordered := append([]string(nil), fields...)
+	distinct := map[string]int64{}
+	for i, field := range fields {
+		distinct[field] = results[0][fmt.Sprintf("f%d", i)]
+	}
+	sort.SliceStable(ordered, func(i, j int) bool { return distinct[ordered[i]] > distinct[ordered[j]] })
+	return ordered, nil
+}
+
+// hasIndexPrefix reports whether keys are a prefix of an index of coll
+func hasIndexPrefix(ctx context.Context, coll *mongo.Collection, keys bson.D) (bool, error) {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return false, err
+	}
+	var indexes []struct {
+		Key bson.D `bson:"key"`
+	}
+	err = cursor.All(ctx, &indexes)
+	if err != nil {
+		return false, err
+	}
+	for _, index := range indexes {
+		if len(index.Key) < len(keys) {
+			continue
+		}
+		prefix := true
+		for i, k := range keys {
+			if index.Key[i].Key != k.Key || fmt.Sprint(index.Key[i].Value) != fmt.Sprint(k.Value) {
+				prefix = false
+				break
+			}
+		}
+		if prefix {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,251 @@
+package mongodb
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrForbidden is returned by AdminAPI calls without a valid token granting the capability
+var ErrForbidden = errors.New("forbidden")
+
+// Capability is an operation AdminAPI grants by token
+type Capability string
+
+const (
+	CapRead    Capability = "read"
+	CapExport  Capability = "export"
+	CapIndexes Capability = "indexes"
+)
+
+// adminReadLimit bounds the documents returned by AdminAPI.Read
+const adminReadLimit = 1000
+
+// adminTokenDomain prefixes the signed payload of capability tokens, so a token MAC is never
+// valid as a session cookie MAC of the same key and vice versa
+const adminTokenDomain = "admin-token:"
+
+// CapabilityClaims are the grants of a capability token
+type CapabilityClaims struct {
+	Subject      string       `json:"sub"`
+	Capabilities []Capability `json:"caps"`
+	// Collections limits the grants to these collections, all when empty
+	Collections []string  `json:"colls,omitempty"`
+	ExpiresAt   time.Time `json:"exp"`
+}
+
+func (c *CapabilityClaims) allows(capability Capability, collection string) bool {
+	if time.Now().After(c.ExpiresAt) {
+		return false
+	}
+	granted := false
+	for _, g := range c.Capabilities {
+		granted = granted || g == capability
+	}
+	if !granted || len(c.Collections) == 0 {
+		return granted
+	}
+	for _, name := range c.Collections {
+		if name == collection {
+			return true
+		}
+	}
+	return false
+}
+
+type capabilityTokenKey struct{}
+
+// WithCapabilityToken binds a token issued by AdminAPI.IssueToken to the returned context
+func WithCapabilityToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, capabilityTokenKey{}, token)
+}
+
+// AdminAPI exposes the read only operations support tools need (reading, exporting and inspecting
+// indexes of the collections of a database) to holders of signed capability tokens, without
+// handing them the database credentials. Filters are checked by CompileFilter, so they can't run
+// server side JavaScript. system.* collections and the internal collections of this package
+// (names starting with "_") are not exposed. Every call is logged with the token subject.
+type AdminAPI struct {
+	db   *mongo.Database
+	keys [][]byte
+}
+
+// NewAdminAPI creates an AdminAPI over db verifying tokens with keys, the first key signs new
+// tokens and the others are accepted for rotation
+// if no key is given, return err
+func NewAdminAPI(db *mongo.Database, keys ...[]byte) (*AdminAPI, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one token key is required")
+	}
+	return &AdminAPI{db: db, keys: keys}, nil
+}
+
+// tokenMAC returns the MAC of the token payload with key
+func tokenMAC(key []byte, payload string) string {
+	return sessionMAC(key, adminTokenDomain+payload)
+}
+
+// adminHidden reports whether collection is not exposed by AdminAPI
+func adminHidden(collection string) bool {
+	return strings.HasPrefix(collection, "system.") || strings.HasPrefix(collection, "_")
+}
+
+// IssueToken returns a token granting claims
+// if some failed, return err
+func (a *AdminAPI) IssueToken(claims CapabilityClaims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + tokenMAC(a.keys[0], payload), nil
+}
+
+// authorize returns the claims of the context token if they grant capability on collection
+func (a *AdminAPI) authorize(ctx context.Context, capability Capability, collection string) (*CapabilityClaims, error) {
+	claims, err := a.claims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if adminHidden(collection) || !claims.allows(capability, collection) {
+		log.Warnf("DB WARN: admin %s denied %s on %s", claims.Subject, capability, collection)
+		return nil, errors.Wrapf(ErrForbidden, "%s on %s not granted", capability, collection)
+	}
+	log.Infof("DB INFO: admin %s %s on %s", claims.Subject, capability, collection)
+	return claims, nil
+}
+
+// claims returns the claims of the context token if it is signed with any key
+func (a *AdminAPI) claims(ctx context.Context) (*CapabilityClaims, error) {
+	token, _ := ctx.Value(capabilityTokenKey{}).(string)
+	payload, mac, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errors.Wrap(ErrForbidden, "no capability token")
+	}
+	valid := false
+	for _, key := range a.keys {
+		valid = valid || hmac.Equal([]byte(mac), []byte(tokenMAC(key, payload)))
+	}
+	if !valid {
+		return nil, errors.Wrap(ErrForbidden, "invalid capability token")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.Wrap(ErrForbidden, "invalid capability token")
+	}
+	claims := &CapabilityClaims{}
+	if err = json.Unmarshal(data, claims); err != nil {
+		return nil, errors.Wrap(ErrForbidden, "invalid capability token")
+	}
+	return claims, nil
+}
+
+// Collections returns the names of the collections the token may read
+// if some failed, return err
+func (a *AdminAPI) Collections(ctx context.Context) ([]string, error) {
+	claims, err := a.claims(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names, err := a.db.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	readable := []string{}
+	for _, name := range names {
+		if !adminHidden(name) && claims.allows(CapRead, name) {
+			readable = append(readable, name)
+		}
+	}
+	return readable, nil
+}
+
+// Read returns up to limit documents (at most 1000) of collection matched by sels
+// if sels are rejected by CompileFilter, return ErrInvalidQuery
+// if some failed, return err
+func (a *AdminAPI) Read(ctx context.Context, collection string, sels map[string]any, limit int64) ([]bson.M, error) {
+	if _, err := a.authorize(ctx, CapRead, collection); err != nil {
+		return nil, err
+	}
+	filter, err := CompileFilter(sels)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > adminReadLimit {
+		limit = adminReadLimit
+	}
+	cursor, err := a.db.Collection(collection).Find(ctx, filter, options.Find().SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	docs := []bson.M{}
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// Export writes the documents of collection matched by sels to w as newline delimited relaxed
+// extended JSON and returns their number
+// if sels are rejected by CompileFilter, return ErrInvalidQuery
+// if some failed, return the number of exported documents and err
+func (a *AdminAPI) Export(ctx context.Context, collection string, sels map[string]any, w io.Writer) (int64, error) {
+	if _, err := a.authorize(ctx, CapExport, collection); err != nil {
+		return 0, err
+	}
+	filter, err := CompileFilter(sels)
+	if err != nil {
+		return 0, err
+	}
+	cursor, err := a.db.Collection(collection).Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	bw := bufio.NewWriter(w)
+	var count int64
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, false, false)
+		if err != nil {
+			return count, err
+		}
+		if _, err = bw.Write(append(line, '\n')); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return count, err
+	}
+	return count, bw.Flush()
+}
+
+// Indexes returns the index specs of collection
+// if some failed, return err
+func (a *AdminAPI) Indexes(ctx context.Context, collection string) ([]bson.M, error) {
+	if _, err := a.authorize(ctx, CapIndexes, collection); err != nil {
+		return nil, err
+	}
+	cursor, err := a.db.Collection(collection).Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	specs := []bson.M{}
+	err = cursor.All(ctx, &specs)
+	if err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewAdminAPIRequiresKey(t *testing.T) {
+	if _, err := NewAdminAPI(nil); err == nil {
+		t.Error("NewAdminAPI() without keys returned no error")
+	}
+}
+
+func TestAdminAPITokens(t *testing.T) {
+	old, err := NewAdminAPI(nil, []byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := NewAdminAPI(nil, []byte("new"), []byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := CapabilityClaims{Subject: "support", Capabilities: []Capability{CapRead}, ExpiresAt: time.Now().Add(time.Hour)}
+	token, err := old.IssueToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithCapabilityToken(context.Background(), token)
+	if _, err = api.authorize(ctx, CapRead, "orders"); err != nil {
+		t.Errorf("authorize() with a rotated key = %v", err)
+	}
+	for _, collection := range []string{"system.users", "_sessions"} {
+		if _, err = api.authorize(ctx, CapRead, collection); !errors.Is(err, ErrForbidden) {
+			t.Errorf("authorize(%s) = %v, want ErrForbidden", collection, err)
+		}
+	}
+	if _, err = api.authorize(ctx, CapExport, "orders"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("authorize() of an ungranted capability = %v, want ErrForbidden", err)
+	}
+
+	// a session cookie MAC of the same key is not a valid token
+	payload, _, _ := strings.Cut(token, ".")
+	forged := WithCapabilityToken(context.Background(), payload+"."+sessionMAC([]byte("old"), payload))
+	if _, err = api.authorize(forged, CapRead, "orders"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("authorize() with a session MAC = %v, want ErrForbidden", err)
+	}
+}
+
+func TestAdminAPIRejectsJavaScript(t *testing.T) {
+	api, err := NewAdminAPI(nil, []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := CapabilityClaims{Subject: "support", Capabilities: []Capability{CapRead, CapExport}, ExpiresAt: time.Now().Add(time.Hour)}
+	token, err := api.IssueToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithCapabilityToken(context.Background(), token)
+	sels := map[string]any{"$or": []bson.M{{"$where": "sleep(1000)"}}}
+	if _, err = api.Read(ctx, "orders", sels, 10); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Read() with $where in a typed slice = %v, want ErrInvalidQuery", err)
+	}
+	if _, err = api.Export(ctx, "orders", sels, &bytes.Buffer{}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("Export() with $where in a typed slice = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestForbiddenMessage(t *testing.T) {
+	for _, lang := range []string{"en", "ru"} {
+		if Message(ErrForbidden, lang) == "" {
+			t.Errorf("Message(ErrForbidden, %s) is empty", lang)
+		}
+	}
+}
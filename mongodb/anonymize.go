@@ -0,0 +1,142 @@
+package mongodb
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Transformer rewrites a document on its way through Export or CopyTo
+type Transformer func(doc bson.D) (bson.D, error)
+
+// AnonymizeFunc returns the pseudonymized replacement of a field value
+type AnonymizeFunc func(value any) any
+
+var (
+	fakeFirstNames = []string{"Alex", "Sam", "Jordan", "Taylor", "Morgan", "Casey", "Riley", "Jamie", "Avery", "Quinn"}
+	fakeLastNames  = []string{"Smith", "Ivanov", "Garcia", "Chen", "Muller", "Kim", "Rossi", "Novak", "Silva", "Sato"}
+)
+
+// WithTransform applies transformers, in order, to every exported or copied document
+func WithTransform(transformers ...Transformer) ExportOption {
+	return func(o *exportOptions) {
+		o.transformers = append(o.transformers, transformers...)
+	}
+}
+
+// Anonymize returns a Transformer replacing values at dotted paths with their anonymized versions.
+// Paths traverse embedded documents and arrays of documents, missing fields are left absent.
+func Anonymize(rules map[string]AnonymizeFunc) Transformer {
+	return func(doc bson.D) (bson.D, error) {
+		for path, fn := range rules {
+			doc = anonymizePath(doc, strings.Split(path, "."), fn)
+		}
+		return doc, nil
+	}
+}
+
+// AnonymizeTagged builds an Anonymize transformer from `mganon` tags of T:
+// "hash" (salted SHA-256, emails keep their domain), "name" (deterministic fake name) or "redact"
+func AnonymizeTagged[T any](salt string) (Transformer, error) {
+	rules := map[string]AnonymizeFunc{}
+	for _, f := range modelFields(reflect.TypeOf((*T)(nil))) {
+		kind, ok := f.Tag.Lookup("mganon")
+		if !ok {
+			continue
+		}
+		switch kind {
+		case "hash":
+			rules[f.BSONName] = HashValue(salt)
+		case "name":
+			rules[f.BSONName] = FakeName(salt)
+		case "redact":
+			rules[f.BSONName] = Redact("REDACTED")
+		default:
+			return nil, fmt.Errorf("unknown mganon kind %q of %s", kind, f.Name)
+		}
+	}
+	return Anonymize(rules), nil
+}
+
+// HashValue replaces values with their salted SHA-256 hex digest, equal values stay equal
+// so joins on pseudonymized fields keep working. Emails keep their domain.
+func HashValue(salt string) AnonymizeFunc {
+	return func(value any) any {
+		s := fmt.Sprint(value)
+		if local, domain, ok := strings.Cut(s, "@"); ok {
+			return saltedHash(salt, local)[:16] + "@" + domain
+		}
+		return saltedHash(salt, s)
+	}
+}
+
+// FakeName replaces values with a fake full name chosen deterministically from the value
+func FakeName(salt string) AnonymizeFunc {
+	return func(value any) any {
+		sum := sha256.Sum256([]byte(salt + fmt.Sprint(value)))
+		n := binary.BigEndian.Uint64(sum[:8])
+		return fakeFirstNames[n%uint64(len(fakeFirstNames))] + " " + fakeLastNames[(n/uint64(len(fakeFirstNames)))%uint64(len(fakeLastNames))]
+	}
+}
+
+// Redact replaces values with replacement
+func Redact(replacement any) AnonymizeFunc {
+	return func(any) any {
+		return replacement
+	}
+}
+
+func saltedHash(salt string, s string) string {
+	sum := sha256.Sum256([]byte(salt + s))
+	return hex.EncodeToString(sum[:])
+}
+
+func anonymizePath(doc bson.D, path []string, fn AnonymizeFunc) bson.D {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			if e.Value != nil {
+				doc[i].Value = fn(e.Value)
+			}
+			continue
+		}
+		doc[i].Value = anonymizeValue(e.Value, path[1:], fn)
+	}
+	return doc
+}
+
+func anonymizeValue(value any, path []string, fn AnonymizeFunc) any {
+	switch v := value.(type) {
+	case bson.D:
+		return anonymizePath(v, path, fn)
+	case bson.A:
+		for i := range v {
+			v[i] = anonymizeValue(v[i], path, fn)
+		}
+		return v
+	}
+	return value
+}
+
+// applyTransformers decodes raw and passes it through transformers
+func applyTransformers(raw bson.Raw, transformers []Transformer) (bson.D, error) {
+	var doc bson.D
+	err := bson.Unmarshal(raw, &doc)
+	if err != nil {
+		return nil, err
+	}
+	for _, transform := range transformers {
+		doc, err = transform(doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
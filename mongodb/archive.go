@@ -0,0 +1,155 @@
+package mongodb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"io"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// archiveDeleteBatch is the number of archived documents deleted per DeleteMany
+const archiveDeleteBatch = 1000
+
+// archiveViewPrefix names the temporary collections of LoadArchive
+const archiveViewPrefix = "_archive_"
+
+// ObjectWriter is an object storage, e.g. an S3-compatible bucket, archives are written to.
+// The object key is complete when Close of the returned writer succeeds.
+type ObjectWriter interface {
+	NewObject(ctx context.Context, key string) (io.WriteCloser, error)
+}
+
+// Archive moves items identified by sels (e.g. expired ones) to cold storage: they are written
+// to the object key of store as gzip compressed newline delimited canonical extended JSON,
+// and deleted once the object is complete. Items inserted meanwhile are not deleted, items checked
+// out by another holder (see WithCheckOutLocks) or fenced off are neither archived nor deleted.
+// The archive can be read back with LoadArchive or Import after gunzipping.
+// if a CascadeRestrict dependent references one of the items, return ErrStillReferenced
+// if some failed, return the number of archived items and err, nothing is deleted if the upload failed
+func (c *genericObjectDBCtrl[T]) Archive(ctx context.Context, store ObjectWriter, key string, sels map[string]any) (_ int64, err error) {
+	defer c.recoverPanic(ctx, "Archive", &err)
+	sels = c.internalSels(sels)
+	if err = c.guardWrite(ctx); err != nil {
+		return 0, err
+	}
+	log.Debug("DB DEBUG: Started c.Archive")
+	defer log.Debug("DB DEBUG: finished c.Archive")
+	err = c.checkRestrictedDelete(ctx, c.writeFilter(ctx, filterFromSels(sels)))
+	if err != nil {
+		return 0, err
+	}
+
+	object, err := store.NewObject(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := c.writeArchive(ctx, object, sels)
+	if err != nil {
+		object.Close()
+		return 0, err
+	}
+	err = object.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(ids); start += archiveDeleteBatch {
+		end := min(start+archiveDeleteBatch, len(ids))
+		_, err = c.db.DeleteMany(ctx, c.writeFilter(ctx, bson.D{{Key: "_id", Value: bson.M{"$in": ids[start:end]}}}))
+		if err != nil {
+			return int64(start), err
+		}
+	}
+	return int64(len(ids)), nil
+}
+
+// writeArchive writes the compressed items to w and returns their ids
+func (c *genericObjectDBCtrl[T]) writeArchive(ctx context.Context, w io.Writer, sels map[string]any) ([]any, error) {
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+
+	cursor, err := c.db.Find(ctx, c.writeFilter(ctx, filterFromSels(sels)))
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	ids := []any{}
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, true, false)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = bw.Write(append(line, '\n')); err != nil {
+			return nil, err
+		}
+		ids = append(ids, cursor.Current.Lookup("_id"))
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	if err = bw.Flush(); err != nil {
+		return nil, err
+	}
+	return ids, zw.Close()
+}
+
+// ObjectReader is an object storage archives are read back from
+type ObjectReader interface {
+	OpenObject(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// ArchiveView is an archive loaded into a temporary collection and queried with the controller
+// methods, call Drop when done with it
+type ArchiveView[T any] struct {
+	*genericObjectDBCtrl[T]
+}
+
+// LoadArchive loads the archive key written by Archive from store into a temporary collection
+// of db, so cold items can be queried like hot ones. opts configure the controller of the view.
+// if some failed, return err, the temporary collection is dropped
+func LoadArchive[T any](ctx context.Context, db *mongo.Database, store ObjectReader, key string, opts ...Option) (*ArchiveView[T], error) {
+	log.Debug("DB DEBUG: Started LoadArchive")
+	defer log.Debug("DB DEBUG: finished LoadArchive")
+
+	object, err := store.OpenObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	zr, err := gzip.NewReader(object)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &ArchiveView[T]{
+		genericObjectDBCtrl: NewGenericObjectDBCtrl[T](db.Collection(archiveViewPrefix+primitive.NewObjectID().Hex()), opts...),
+	}
+	_, err = view.Import(ctx, zr)
+	if err == nil {
+		err = zr.Close()
+	}
+	if err != nil {
+		if dropErr := view.Drop(ctx); dropErr != nil {
+			log.Warnf("DB WARN: failed to drop archive view %s: %s", view.db.Name(), dropErr)
+		}
+		return nil, err
+	}
+	return view, nil
+}
+
+// Drop drops the temporary collection of the view
+// if some failed, return err
+func (v *ArchiveView[T]) Drop(ctx context.Context) error {
+	err := v.db.Drop(ctx)
+	if err != nil {
+		return err
+	}
+	unregisterModel(v.db.Database().Name() + "." + v.db.Name())
+	return nil
+}
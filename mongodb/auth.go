@@ -0,0 +1,137 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// authentication mechanisms configured by ConnectConfig
+const (
+	AuthMechanismAWS  = "MONGODB-AWS"
+	AuthMechanismX509 = "MONGODB-X509"
+)
+
+// AWSCredentials are IAM credentials used by MONGODB-AWS authentication
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials (assumed roles, STS)
+	SessionToken string
+}
+
+// AWSAuth configures MONGODB-AWS authentication.
+// Without Provider the driver takes credentials from the environment, ECS task role or EC2 instance profile.
+type AWSAuth struct {
+	// Provider (optional) returns the credentials, called on every dial.
+	// Combine with ConnectConfig.RefreshInterval to pick up rotated session tokens.
+	Provider func(ctx context.Context) (AWSCredentials, error)
+}
+
+// X509Auth configures MONGODB-X509 authentication, the user is derived from the client certificate subject.
+// Files are read on every dial, so a certificate renewed on disk is picked up by Conn.Reconnect.
+type X509Auth struct {
+	// CertificateKeyFile is a PEM file holding the client certificate and its private key
+	CertificateKeyFile string
+	// CertFile and KeyFile hold the client certificate and its private key in separate PEM files
+	CertFile string
+	KeyFile  string
+	// Certificate is used instead of the files when set
+	Certificate *tls.Certificate
+	// CAFile (optional) is a PEM file with the authorities trusted to sign the server certificate
+	CAFile string
+}
+
+// dialAuth is the authentication resolved for a dial, compared to detect rotated credentials
+type dialAuth struct {
+	credential *options.Credential
+	// certificate is the DER client certificate of X509
+	certificate []byte
+}
+
+// resolveAuth resolves the authentication of the connection configuration, applying TLS settings of X509
+// to clientOptions. The credential is nil when the configuration has no authentication settings.
+func (c *Conn) resolveAuth(ctx context.Context, clientOptions *options.ClientOptions) (dialAuth, error) {
+	switch {
+	case c.cfg.Credentials != nil:
+		creds, err := c.cfg.Credentials(ctx)
+		if err != nil {
+			return dialAuth{}, fmt.Errorf("failed to resolve credentials: %s", err)
+		}
+		return dialAuth{credential: &options.Credential{
+			Username:      creds.Username,
+			Password:      creds.Password,
+			AuthSource:    creds.AuthSource,
+			AuthMechanism: creds.AuthMechanism,
+		}}, nil
+
+	case c.cfg.AWS != nil:
+		auth := &options.Credential{AuthMechanism: AuthMechanismAWS, AuthSource: "$external"}
+		if c.cfg.AWS.Provider == nil {
+			return dialAuth{credential: auth}, nil
+		}
+		creds, err := c.cfg.AWS.Provider(ctx)
+		if err != nil {
+			return dialAuth{}, fmt.Errorf("failed to resolve AWS credentials: %s", err)
+		}
+		auth.Username = creds.AccessKeyID
+		auth.Password = creds.SecretAccessKey
+		if creds.SessionToken != "" {
+			auth.AuthMechanismProperties = map[string]string{"AWS_SESSION_TOKEN": creds.SessionToken}
+		}
+		return dialAuth{credential: auth}, nil
+
+	case c.cfg.X509 != nil:
+		tlsConfig, err := c.cfg.X509.tlsConfig()
+		if err != nil {
+			return dialAuth{}, err
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+		return dialAuth{
+			credential:  &options.Credential{AuthMechanism: AuthMechanismX509, AuthSource: "$external"},
+			certificate: tlsConfig.Certificates[0].Certificate[0],
+		}, nil
+	}
+	return dialAuth{}, nil
+}
+
+// tlsConfig loads the client certificate and trusted authorities
+func (a *X509Auth) tlsConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case a.Certificate != nil:
+		cert = *a.Certificate
+	case a.CertificateKeyFile != "":
+		cert, err = tls.LoadX509KeyPair(a.CertificateKeyFile, a.CertificateKeyFile)
+	default:
+		cert, err = tls.LoadX509KeyPair(a.CertFile, a.KeyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %s", err)
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("failed to load client certificate: no certificate")
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if a.CAFile != "" {
+		pem, err := os.ReadFile(a.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to parse CA file %s", a.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
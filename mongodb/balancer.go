@@ -0,0 +1,180 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// balancerSettingsID is the _id of the balancer document in config.settings
+const balancerSettingsID = "balancer"
+
+// BalancerWindow is the daily time range of the cluster balancer in "HH:MM" of the config server
+// time zone, Stop may be before Start for a window spanning midnight
+type BalancerWindow struct {
+	Start string `bson:"start" json:"start"`
+	Stop  string `bson:"stop" json:"stop"`
+}
+
+// BalancerState is the state of the balancer of a sharded cluster
+type BalancerState struct {
+	// Mode is "full" when the balancer is enabled and "off" when it is stopped
+	Mode              string `bson:"mode" json:"mode"`
+	InBalancerRound   bool   `bson:"inBalancerRound" json:"in_balancer_round"`
+	NumBalancerRounds int64  `bson:"numBalancerRounds" json:"num_balancer_rounds"`
+}
+
+// ShardChunks is the number of chunks of a collection on a shard
+type ShardChunks struct {
+	Shard  string `bson:"_id" json:"shard"`
+	Chunks int64  `bson:"chunks" json:"chunks"`
+}
+
+func balancerSettings(client *mongo.Client) *mongo.Collection {
+	return client.Database("config").Collection("settings")
+}
+
+// GetBalancerWindow returns the balancer window, nil when the balancer may run at any time
+// if some failed, return err
+func GetBalancerWindow(ctx context.Context, client *mongo.Client) (*BalancerWindow, error) {
+	var settings struct {
+		ActiveWindow *BalancerWindow `bson:"activeWindow"`
+	}
+	err := balancerSettings(client).FindOne(ctx, bson.M{"_id": balancerSettingsID}).Decode(&settings)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return settings.ActiveWindow, nil
+}
+
+// SetBalancerWindow limits balancing to window, e.g. to nights after retention jobs ran
+// if some failed, return err
+func SetBalancerWindow(ctx context.Context, client *mongo.Client, window BalancerWindow) error {
+	log.Debug("DB DEBUG: Started SetBalancerWindow")
+	defer log.Debug("DB DEBUG: finished SetBalancerWindow")
+	for _, clock := range []string{window.Start, window.Stop} {
+		if _, err := time.Parse("15:04", clock); err != nil {
+			return fmt.Errorf("failed to set balancer window: %q is not HH:MM", clock)
+		}
+	}
+	_, err := balancerSettings(client).UpdateOne(ctx,
+		bson.M{"_id": balancerSettingsID},
+		bson.M{"$set": bson.M{"activeWindow": window}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// ClearBalancerWindow lets the balancer run at any time
+// if some failed, return err
+func ClearBalancerWindow(ctx context.Context, client *mongo.Client) error {
+	_, err := balancerSettings(client).UpdateOne(ctx,
+		bson.M{"_id": balancerSettingsID},
+		bson.M{"$unset": bson.M{"activeWindow": ""}},
+	)
+	return err
+}
+
+// GetBalancerState returns the state of the balancer
+// if some failed, return err
+func GetBalancerState(ctx context.Context, client *mongo.Client) (*BalancerState, error) {
+	return RunCommand[BalancerState](ctx, client.Database("admin"), bson.D{{Key: "balancerStatus", Value: 1}})
+}
+
+// StartBalancer enables the balancer
+// if some failed, return err
+func StartBalancer(ctx context.Context, client *mongo.Client) error {
+	return client.Database("admin").RunCommand(ctx, bson.D{{Key: "balancerStart", Value: 1}}).Err()
+}
+
+// StopBalancer disables the balancer, waiting for a round in progress to end
+// if some failed, return err
+func StopBalancer(ctx context.Context, client *mongo.Client) error {
+	return client.Database("admin").RunCommand(ctx, bson.D{{Key: "balancerStop", Value: 1}}).Err()
+}
+
+// ChunkDistribution returns the number of chunks of collection of database per shard, most first.
+// Shards without chunks of the collection are included with 0, except draining ones.
+// An unsharded collection has none.
+// if some failed, return err
+func ChunkDistribution(ctx context.Context, client *mongo.Client, database string, collection string) ([]ShardChunks, error) {
+	log.Debug("DB DEBUG: Started ChunkDistribution")
+	defer log.Debug("DB DEBUG: finished ChunkDistribution")
+	ns := database + "." + collection
+	config := client.Database("config")
+
+	// chunks reference their collection by uuid since 5.0 and by ns before
+	match := bson.A{bson.M{"ns": ns}}
+	var meta struct {
+		UUID bson.RawValue `bson:"uuid"`
+	}
+	err := config.Collection("collections").FindOne(ctx, bson.M{"_id": ns}).Decode(&meta)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return []ShardChunks{}, nil
+	case err != nil:
+		return nil, err
+	case meta.UUID.Type != 0:
+		match = append(match, bson.M{"uuid": meta.UUID})
+	}
+
+	cursor, err := config.Collection("chunks").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"$or": match}}},
+		{{Key: "$group", Value: bson.M{"_id": "$shard", "chunks": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	distribution := []ShardChunks{}
+	if err = cursor.All(ctx, &distribution); err != nil {
+		return nil, err
+	}
+
+	// shards holding no chunk, e.g. newly added ones, are missing from the chunks
+	shardCursor, err := config.Collection("shards").Find(ctx, bson.M{"draining": bson.M{"$ne": true}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(shardCursor))
+	var shards []struct {
+		ID string `bson:"_id"`
+	}
+	if err = shardCursor.All(ctx, &shards); err != nil {
+		return nil, err
+	}
+	counted := make(map[string]bool, len(distribution))
+	for _, shard := range distribution {
+		counted[shard.Shard] = true
+	}
+	for _, shard := range shards {
+		if !counted[shard.ID] {
+			distribution = append(distribution, ShardChunks{Shard: shard.ID})
+		}
+	}
+	sort.Slice(distribution, func(i, j int) bool { return distribution[i].Chunks > distribution[j].Chunks })
+	return distribution, nil
+}
+
+// ChunkImbalance returns the difference between the most and the least chunks on a shard of
+// distribution, the balancer migrates chunks while it exceeds its migration threshold
+func ChunkImbalance(distribution []ShardChunks) int64 {
+	if len(distribution) == 0 {
+		return 0
+	}
+	most, least := distribution[0].Chunks, distribution[0].Chunks
+	for _, shard := range distribution[1:] {
+		most, least = max(most, shard.Chunks), min(least, shard.Chunks)
+	}
+	return most - least
+}
@@ -0,0 +1,194 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeleteRangeBatched deletes items identified by sels in batches of batchSize ranged by _id,
+// so a huge delete does not hold locks for the whole collection at once.
+// pause is slept between batches, onProgress (optional) receives the total deleted so far.
+// Items checked out by another holder (see WithCheckOutLocks) or fenced off are skipped.
+// if a CascadeRestrict dependent references an item of a batch, return ErrStillReferenced
+// if some failed, return the number of deleted items and err
+func (c *genericObjectDBCtrl[T]) DeleteRangeBatched(ctx context.Context, sels map[string]any, batchSize int, pause time.Duration, onProgress func(deleted int64)) (_ int64, err error) {
+	defer c.recoverPanic(ctx, "DeleteRangeBatched", &err)
+	sels = c.internalSels(sels)
+	if err = c.guardWrite(ctx); err != nil {
+		return 0, err
+	}
+	log.Debug("DB DEBUG: Started c.DeleteRangeBatched")
+	defer log.Debug("DB DEBUG: finished c.DeleteRangeBatched")
+
+	var deleted int64
+	var lastID any
+	for {
+		ids, err := c.nextIDBatch(ctx, sels, lastID, batchSize)
+		if err != nil {
+			return deleted, err
+		}
+		if len(ids) == 0 {
+			return deleted, nil
+		}
+
+		filter := c.writeFilter(ctx, andFilter(filterFromSels(sels), bson.D{{Key: "_id", Value: bson.M{"$gte": ids[0], "$lte": ids[len(ids)-1]}}}))
+		err = c.checkRestrictedDelete(ctx, filter)
+		if err != nil {
+			return deleted, err
+		}
+		result, err := c.db.DeleteMany(ctx, filter)
+		if err != nil {
+			return deleted, err
+		}
+		deleted += result.DeletedCount
+		lastID = ids[len(ids)-1]
+		if onProgress != nil {
+			onProgress(deleted)
+		}
+
+		if len(ids) < batchSize {
+			return deleted, nil
+		}
+		if err = sleepCtx(ctx, pause); err != nil {
+			return deleted, err
+		}
+	}
+}
+
+// nextIDBatch returns up to batchSize ids of items identified by sels with _id greater than afterID
+func (c *genericObjectDBCtrl[T]) nextIDBatch(ctx context.Context, sels map[string]any, afterID any, batchSize int) ([]any, error) {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	filter := filterFromSels(sels)
+	if afterID != nil {
+		filter = andFilter(filter, bson.D{{Key: "_id", Value: bson.M{"$gt": afterID}}})
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetSort(bson.M{"_id": 1}).
+		SetLimit(int64(batchSize))
+	cursor, err := c.db.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID any `bson:"_id"`
+	}
+	err = cursor.All(ctx, &docs)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]any, 0, len(docs))
+	for _, doc := range docs {
+		ids = append(ids, doc.ID)
+	}
+	return ids, nil
+}
+
+// andFilter combines filters with $and, so keys repeated in several filters are not lost
+func andFilter(filters ...bson.D) bson.D {
+	return bson.D{{Key: "$and", Value: filters}}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// UpdateAttributesBatched updates attributes 'attrs' of items identified by sels in batches of batchSize
+// ranged by _id. Progress is saved as a checkpoint under job name after every batch,
+// so rerunning the same job after a crash resumes from the last processed batch.
+// The checkpoint is removed when the job completes. Items checked out by another holder
+// (see WithCheckOutLocks) or fenced off are skipped.
+// if some failed, return the number of updated items and err
+func (c *genericObjectDBCtrl[T]) UpdateAttributesBatched(ctx context.Context, job string, sels map[string]any, attrs map[string]any, batchSize int, pause time.Duration, onProgress func(updated int64)) (_ int64, err error) {
+	defer c.recoverPanic(ctx, "UpdateAttributesBatched", &err)
+	sels = c.internalSels(sels)
+	if err = c.guardWrite(ctx); err != nil {
+		return 0, err
+	}
+	log.Debug("DB DEBUG: Started c.UpdateAttributesBatched")
+	defer log.Debug("DB DEBUG: finished c.UpdateAttributesBatched")
+
+	err = validateAttrs[T](attrs)
+	if err != nil {
+		return 0, err
+	}
+	err = checkImmutable[T](attrs)
+	if err != nil {
+		return 0, err
+	}
+	err = c.checkForeignKeyAttrs(ctx, attrs)
+	if err != nil {
+		return 0, err
+	}
+	checkpoints := NewCheckpointer(c.db.Database())
+	var progress struct {
+		LastID  any   `bson:"last_id"`
+		Updated int64 `bson:"updated"`
+	}
+	_, err = checkpoints.Load(ctx, job, &progress)
+	if err != nil {
+		return 0, err
+	}
+
+	update := bson.M{}
+	for k, v := range attrs {
+		update[k] = v
+	}
+	c.stampFence(update)
+	for {
+		ids, err := c.nextIDBatch(ctx, sels, progress.LastID, batchSize)
+		if err != nil {
+			return progress.Updated, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		update[updatedAtKey[T]()] = time.Now()
+		filter := c.writeFilter(ctx, andFilter(filterFromSels(sels), bson.D{{Key: "_id", Value: bson.M{"$gte": ids[0], "$lte": ids[len(ids)-1]}}}))
+		modifier := bson.D{{Key: "$set", Value: update}}
+		if c.opts.concurrency == ConcurrencyVersion {
+			modifier = append(modifier, bson.E{Key: "$inc", Value: bson.M{versionKey[T](): 1}})
+		}
+		result, err := c.db.UpdateMany(ctx, filter, modifier)
+		if err != nil {
+			return progress.Updated, err
+		}
+		progress.Updated += result.ModifiedCount
+		progress.LastID = ids[len(ids)-1]
+		err = checkpoints.Save(ctx, job, progress)
+		if err != nil {
+			return progress.Updated, err
+		}
+		if onProgress != nil {
+			onProgress(progress.Updated)
+		}
+
+		if len(ids) < batchSize {
+			break
+		}
+		if err = sleepCtx(ctx, pause); err != nil {
+			return progress.Updated, err
+		}
+	}
+
+	return progress.Updated, checkpoints.Clear(ctx, job)
+}
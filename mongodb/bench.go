@@ -0,0 +1,143 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Workload describes a read/write mix executed by Bench
+type Workload[T any] struct {
+	// Operations is the total number of operations to run
+	Operations int
+	// Concurrency is the number of parallel workers, 1 if not set
+	Concurrency int
+	// ReadRatio is the share of reads in [0, 1], the rest are writes
+	ReadRatio float64
+	// NewItem builds an item for the i-th write operation
+	NewItem func(i int) *T
+	// ReadFilter builds the List filter for the i-th read operation
+	ReadFilter func(i int) map[string]any
+}
+
+// LatencyStats holds latency percentiles for one kind of operation
+type LatencyStats struct {
+	Count int
+	Min   time.Duration
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// BenchReport is the result of Bench
+type BenchReport struct {
+	Operations int
+	Errors     int64
+	Duration   time.Duration
+	// Throughput is operations per second
+	Throughput float64
+	Reads      LatencyStats
+	Writes     LatencyStats
+}
+
+// Bench runs the workload against ctrl and reports throughput and latency percentiles.
+// It is intended for comparing index or schema options from Go tests and benchmarks.
+// if the workload has neither NewItem nor ReadFilter, return err
+// if ctx is canceled, Bench stops and returns ctx.Err()
+func Bench[T any](ctx context.Context, ctrl CRUDDBService[T], workload Workload[T]) (*BenchReport, error) {
+	if workload.NewItem == nil && workload.ReadFilter == nil {
+		return nil, fmt.Errorf("failed to bench: workload has neither NewItem nor ReadFilter")
+	}
+	concurrency := workload.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		next     int64 = -1
+		errCount int64
+		mu       sync.Mutex
+		reads    []time.Duration
+		writes   []time.Duration
+		wg       sync.WaitGroup
+	)
+
+	started := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= workload.Operations || ctx.Err() != nil {
+					return
+				}
+
+				isRead := workload.ReadFilter != nil && (workload.NewItem == nil || rnd.Float64() < workload.ReadRatio)
+				opStarted := time.Now()
+				var err error
+				if isRead {
+					_, err = ctrl.List(ctx, workload.ReadFilter(i))
+				} else {
+					err = ctrl.Create(ctx, workload.NewItem(i))
+				}
+				elapsed := time.Since(opStarted)
+				if err != nil {
+					atomic.AddInt64(&errCount, 1)
+				}
+
+				mu.Lock()
+				if isRead {
+					reads = append(reads, elapsed)
+				} else {
+					writes = append(writes, elapsed)
+				}
+				mu.Unlock()
+			}
+		}(started.UnixNano() + int64(w))
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	duration := time.Since(started)
+	report := &BenchReport{
+		Operations: len(reads) + len(writes),
+		Errors:     errCount,
+		Duration:   duration,
+		Reads:      latencyStats(reads),
+		Writes:     latencyStats(writes),
+	}
+	if duration > 0 {
+		report.Throughput = float64(report.Operations) / duration.Seconds()
+	}
+
+	return report, nil
+}
+
+func latencyStats(samples []time.Duration) LatencyStats {
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	percentile := func(p float64) time.Duration {
+		return samples[int(p*float64(len(samples)-1))]
+	}
+
+	return LatencyStats{
+		Count: len(samples),
+		Min:   samples[0],
+		P50:   percentile(0.50),
+		P90:   percentile(0.90),
+		P99:   percentile(0.99),
+		Max:   samples[len(samples)-1],
+	}
+}
@@ -0,0 +1,160 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultBucketSize is the maximal number of measurements kept in one bucket
+const defaultBucketSize = 3600
+
+// Measurement is a timestamped value of a device
+type Measurement[M any] struct {
+	Device string    `bson:"-" json:"device"`
+	At     time.Time `bson:"at" json:"at"`
+	Value  M         `bson:"value" json:"value"`
+}
+
+// Bucket is the document holding the measurements of a device in one period
+type Bucket[M any] struct {
+	Device       string           `bson:"device" json:"device"`
+	Start        time.Time        `bson:"start" json:"start"`
+	Count        int64            `bson:"count" json:"count"`
+	First        time.Time        `bson:"first" json:"first"`
+	Last         time.Time        `bson:"last" json:"last"`
+	Measurements []Measurement[M] `bson:"measurements" json:"measurements"`
+}
+
+// BucketWriter groups high-frequency measurements into one document per device and period
+// (an hour by default) with $push, reducing document count and index size of telemetry.
+// A bucket keeps the latest size measurements, older ones are dropped by $slice.
+type BucketWriter[M any] struct {
+	db     *mongo.Collection
+	period time.Duration
+	size   int
+}
+
+// NewBucketWriter creates a BucketWriter on collection and ensures the unique bucket index,
+// period 0 is an hour and size 0 keeps up to 3600 measurements per bucket
+// if some failed, return err
+func NewBucketWriter[M any](ctx context.Context, collection *mongo.Collection, period time.Duration, size int) (*BucketWriter[M], error) {
+	if period <= 0 {
+		period = time.Hour
+	}
+	if size <= 0 {
+		size = defaultBucketSize
+	}
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "device", Value: 1}, {Key: "start", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BucketWriter[M]{db: collection, period: period, size: size}, nil
+}
+
+// Write appends a measurement of device to its bucket
+// if some failed, return err
+func (w *BucketWriter[M]) Write(ctx context.Context, device string, at time.Time, value M) error {
+	return w.WriteMany(ctx, []Measurement[M]{{Device: device, At: at, Value: value}})
+}
+
+// WriteMany appends measurements to their buckets with one unordered bulk write,
+// measurements of the same bucket are pushed in one update
+// if some failed, return err
+func (w *BucketWriter[M]) WriteMany(ctx context.Context, measurements []Measurement[M]) error {
+	log.Debug("DB DEBUG: Started c.db.BulkWrite(ctx, models) buckets")
+	defer log.Debug("DB DEBUG: finished c.db.BulkWrite(ctx, models) buckets")
+	if err := checkWritable(ctx); err != nil {
+		return err
+	}
+	if len(measurements) == 0 {
+		return nil
+	}
+
+	type bucketKey struct {
+		device string
+		start  time.Time
+	}
+	var order []bucketKey
+	groups := map[bucketKey][]Measurement[M]{}
+	for _, m := range measurements {
+		key := bucketKey{device: m.Device, start: m.At.UTC().Truncate(w.period)}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], m)
+	}
+
+	models := make([]mongo.WriteModel, 0, len(order))
+	for _, key := range order {
+		group := groups[key]
+		first, last := group[0].At, group[0].At
+		for _, m := range group {
+			if m.At.Before(first) {
+				first = m.At
+			}
+			if m.At.After(last) {
+				last = m.At
+			}
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"device": key.device, "start": key.start}).
+			SetUpdate(bson.M{
+				"$push": bson.M{"measurements": bson.M{
+					"$each":  group,
+					"$sort":  bson.M{"at": 1},
+					"$slice": -w.size,
+				}},
+				"$inc": bson.M{"count": len(group)},
+				"$min": bson.M{"first": first},
+				"$max": bson.M{"last": last},
+			}).
+			SetUpsert(true))
+	}
+	_, err := w.db.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// Read returns measurements of device in [from, to) in time order
+// if some failed, return err
+func (w *BucketWriter[M]) Read(ctx context.Context, device string, from time.Time, to time.Time) ([]Measurement[M], error) {
+	cursor, err := w.db.Find(
+		ctx,
+		bson.M{
+			"device": device,
+			"start":  bson.M{"$gte": from.UTC().Truncate(w.period), "$lt": to},
+		},
+		options.Find().SetSort(bson.D{{Key: "start", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	results := []Measurement[M]{}
+	for cursor.Next(ctx) {
+		var bucket Bucket[M]
+		err = cursor.Decode(&bucket)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range bucket.Measurements {
+			if m.At.Before(from) || !m.At.Before(to) {
+				continue
+			}
+			m.Device = device
+			results = append(results, m)
+		}
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,93 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrBudgetExceeded is returned by controller calls made after the budget of WithBudget ran out,
+// or failing because it ran out during the call
+var ErrBudgetExceeded = errors.New("db time budget exceeded")
+
+// budget is the database time left to the calls of a request
+type budget struct {
+	mu        sync.Mutex
+	remaining time.Duration
+}
+
+type budgetKey struct{}
+
+// WithBudget returns a context whose controller calls share total database time: every call
+// spends its duration, bounds its deadline by what is left and fails fast with ErrBudgetExceeded
+// once nothing is, keeping the latency of a request bounded however many calls it makes.
+// A budget set on a parent context is replaced.
+func WithBudget(ctx context.Context, total time.Duration) context.Context {
+	return context.WithValue(ctx, budgetKey{}, &budget{remaining: total})
+}
+
+// BudgetRemaining returns the database time left by the budget of WithBudget
+func BudgetRemaining(ctx context.Context) (time.Duration, bool) {
+	b := budgetFrom(ctx)
+	if b == nil {
+		return 0, false
+	}
+	return b.left(), true
+}
+
+func budgetFrom(ctx context.Context) *budget {
+	b, _ := ctx.Value(budgetKey{}).(*budget)
+	return b
+}
+
+func (b *budget) left() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.remaining
+}
+
+func (b *budget) spend(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remaining -= d
+}
+
+// begin bounds the deadline of a call by the budget left and the profile timeout, the returned
+// cancel spends the duration of the call. With no budget left ctx is returned cancelled.
+func (b *budget) begin(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	left := b.left()
+	if left <= 0 {
+		ctx, cancel := context.WithCancelCause(ctx)
+		cancel(ErrBudgetExceeded)
+		return ctx, func() {}
+	}
+	var cancel context.CancelFunc
+	if timeout > 0 && timeout < left {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithTimeoutCause(ctx, left, ErrBudgetExceeded)
+	}
+	start := time.Now()
+	return ctx, func() {
+		b.spend(time.Since(start))
+		cancel()
+	}
+}
+
+// budgetErr reports err of a call with ctx as ErrBudgetExceeded when the call ran out of budget
+func budgetErr(ctx context.Context, err error) error {
+	if err == nil || errors.Is(err, ErrBudgetExceeded) {
+		return err
+	}
+	b := budgetFrom(ctx)
+	if b == nil || b.left() > 0 {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err) {
+		return errors.Wrap(ErrBudgetExceeded, err.Error())
+	}
+	return err
+}
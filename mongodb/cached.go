@@ -0,0 +1,346 @@
+package mongodb
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Cached is a Repository with an in-process LRU cache of items by id in front of a controller.
+// Get is served from the cache, writes by id through Cached invalidate their item and filter based
+// writes purge the cache. Writes made elsewhere are seen once entries expire after ttl.
+// Items are cached by internal id (see WithIDCodec) and copied in and out of the cache,
+// so callers never share maps or slices with it.
+type Cached[T any] struct {
+	Repository[T]
+
+	c    *genericObjectDBCtrl[T]
+	size int
+	ttl  time.Duration
+	// serializer encodes cached items, see WithCacheSerializer
+	serializer Serializer
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	hits    map[string]*accessCount
+	// generation counts invalidations, an item read before one is not stored
+	generation uint64
+}
+
+type cacheEntry[T any] struct {
+	key  string
+	item T
+	// data is item encoded by the cache serializer, item is zero then
+	data    []byte
+	expires time.Time
+}
+
+// CacheOption configures NewCached
+type CacheOption func(*cacheOptions)
+
+type cacheOptions struct {
+	serializer Serializer
+}
+
+// WithCacheSerializer stores cached items encoded by s instead of as values copied by the
+// controller codec, e.g. for compact entries of large items.
+func WithCacheSerializer(s Serializer) CacheOption {
+	return func(o *cacheOptions) {
+		o.serializer = s
+	}
+}
+
+// accessLogFactor bounds the access counts kept to a multiple of the cache size
+const accessLogFactor = 10
+
+type accessCount struct {
+	id   any
+	hits int64
+}
+
+// NewCached creates a cache of at most size items in front of c, entries expire after ttl (never when 0)
+func NewCached[T any](c *genericObjectDBCtrl[T], size int, ttl time.Duration, opts ...CacheOption) *Cached[T] {
+	var o cacheOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Cached[T]{
+		Repository: AsRepository(c),
+		c:          c,
+		size:       size,
+		ttl:        ttl,
+		serializer: o.serializer,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		hits:       map[string]*accessCount{},
+	}
+}
+
+// Get returns the item by id from the cache, loading it on a miss
+// if not found, return *NotFoundError
+// if some failed, return err
+func (r *Cached[T]) Get(ctx context.Context, id any) (*T, error) {
+	key := r.key(id)
+	if item, ok := r.lookup(key, id); ok {
+		return item, nil
+	}
+	generation := r.currentGeneration()
+	item, err := r.Repository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	r.store(key, *item, generation)
+	return item, nil
+}
+
+// key returns the cache key of the item by external or internal id
+func (r *Cached[T]) key(id any) string {
+	return refKey(r.c.internalID(id))
+}
+
+func (r *Cached[T]) currentGeneration() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.generation
+}
+
+func (r *Cached[T]) Update(ctx context.Context, id any, item *T) (*UpdateResult, error) {
+	defer r.Invalidate(id)
+	return r.Repository.Update(ctx, id, item)
+}
+
+func (r *Cached[T]) UpdateAttributes(ctx context.Context, q Query, attrs map[string]any) (*UpdateResult, error) {
+	defer r.Purge()
+	return r.Repository.UpdateAttributes(ctx, q, attrs)
+}
+
+func (r *Cached[T]) Delete(ctx context.Context, id any) (*DeleteResult, error) {
+	defer r.Invalidate(id)
+	return r.Repository.Delete(ctx, id)
+}
+
+func (r *Cached[T]) DeleteRange(ctx context.Context, q Query) (*DeleteResult, error) {
+	defer r.Purge()
+	return r.Repository.DeleteRange(ctx, q)
+}
+
+// Invalidate drops the item by id from the cache
+func (r *Cached[T]) Invalidate(id any) {
+	key := r.key(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+	if e, ok := r.entries[key]; ok {
+		r.lru.Remove(e)
+		delete(r.entries, key)
+	}
+}
+
+// Purge drops all items from the cache, access counts are kept
+func (r *Cached[T]) Purge() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.generation++
+	r.entries = map[string]*list.Element{}
+	r.lru.Init()
+}
+
+// Preload bulk loads the items selected by sels into the cache, at most the cache size,
+// smoothing latency after deploys. It returns the number of loaded items.
+// if some failed, return err
+func (r *Cached[T]) Preload(ctx context.Context, sels map[string]any) (int, error) {
+	log.Debug("DB DEBUG: Started Cached.Preload")
+	defer log.Debug("DB DEBUG: finished Cached.Preload")
+	generation := r.currentGeneration()
+	items, err := r.Repository.List(ctx, Query{Filter: sels, Limit: int64(r.size)})
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		data, err := r.c.marshal(&item)
+		if err != nil {
+			return 0, err
+		}
+		r.store(refKey(bson.Raw(data).Lookup("_id")), item, generation)
+	}
+	return len(items), nil
+}
+
+// PreloadIDs bulk loads the items by ids into the cache, e.g. the hot ids of ReadAccessLog.
+// It returns the number of loaded items, missing ids are skipped.
+// if some failed, return err
+func (r *Cached[T]) PreloadIDs(ctx context.Context, ids []any) (int, error) {
+	log.Debug("DB DEBUG: Started Cached.PreloadIDs")
+	defer log.Debug("DB DEBUG: finished Cached.PreloadIDs")
+	if len(ids) > r.size {
+		ids = ids[:r.size]
+	}
+	generation := r.currentGeneration()
+	result, err := r.c.GetManyDetailed(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range result.Items {
+		data, err := r.c.marshal(&item)
+		if err != nil {
+			return 0, err
+		}
+		r.store(refKey(bson.Raw(data).Lookup("_id")), item, generation)
+	}
+	return len(result.Items), nil
+}
+
+// HotIDs returns the ids of the n most requested items by Get since creation, all when n <= 0
+func (r *Cached[T]) HotIDs(n int) []any {
+	counts := r.accessCounts()
+	if n > 0 && n < len(counts) {
+		counts = counts[:n]
+	}
+	ids := make([]any, len(counts))
+	for i, count := range counts {
+		ids[i] = count.id
+	}
+	return ids
+}
+
+// WriteAccessLog writes the access counts of Get as extended JSON lines {"_id": ..., "hits": ...},
+// most requested first, to drive PreloadIDs of the next process via ReadAccessLog
+// if some failed, return err
+func (r *Cached[T]) WriteAccessLog(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, count := range r.accessCounts() {
+		line, err := bson.MarshalExtJSON(bson.D{{Key: "_id", Value: count.id}, {Key: "hits", Value: count.hits}}, true, false)
+		if err != nil {
+			return err
+		}
+		if _, err = bw.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadAccessLog returns the ids of an access log written by WriteAccessLog in its order
+// if some failed, return err
+func ReadAccessLog(rd io.Reader) ([]any, error) {
+	var ids []any
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry struct {
+			ID any `bson:"_id"`
+		}
+		err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &entry)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, entry.ID)
+	}
+	return ids, scanner.Err()
+}
+
+// lookup returns a copy of the cached item of key and counts the access of id
+func (r *Cached[T]) lookup(key string, id any) (*T, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// access counts are bounded, ids first requested once the bound is reached are not counted
+	if count, ok := r.hits[key]; ok {
+		count.hits++
+	} else if len(r.hits) < accessLogFactor*r.size {
+		r.hits[key] = &accessCount{id: id, hits: 1}
+	}
+
+	e, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*cacheEntry[T])
+	if r.ttl > 0 && time.Now().After(entry.expires) {
+		r.lru.Remove(e)
+		delete(r.entries, key)
+		return nil, false
+	}
+	r.lru.MoveToFront(e)
+	var item T
+	var err error
+	if r.serializer != nil {
+		err = r.serializer.Unmarshal(entry.data, &item)
+	} else {
+		item, err = r.copy(entry.item)
+	}
+	if err != nil {
+		log.Warnf("DB WARN: failed to decode cached item %s: %s", key, err)
+		r.lru.Remove(e)
+		delete(r.entries, key)
+		return nil, false
+	}
+	return &item, true
+}
+
+// copy returns a deep copy of item made by the controller codec
+func (r *Cached[T]) copy(item T) (T, error) {
+	var copied T
+	data, err := r.c.marshal(&item)
+	if err != nil {
+		return copied, err
+	}
+	err = r.c.unmarshal(data, &copied)
+	return copied, err
+}
+
+// store caches item as key, evicting the least recently used item when full. The item is dropped
+// if the cache was invalidated since generation, when it was read, as it may be stale.
+func (r *Cached[T]) store(key string, item T, generation uint64) {
+	if r.size <= 0 {
+		return
+	}
+	entry := &cacheEntry[T]{key: key, expires: time.Now().Add(r.ttl)}
+	var err error
+	if r.serializer != nil {
+		entry.data, err = r.serializer.Marshal(item)
+	} else {
+		entry.item, err = r.copy(item)
+	}
+	if err != nil {
+		log.Warnf("DB WARN: failed to encode cached item %s: %s", key, err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.generation != generation {
+		return
+	}
+	if e, ok := r.entries[key]; ok {
+		e.Value = entry
+		r.lru.MoveToFront(e)
+		return
+	}
+	r.entries[key] = r.lru.PushFront(entry)
+	for r.lru.Len() > r.size {
+		oldest := r.lru.Back()
+		r.lru.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cacheEntry[T]).key)
+	}
+}
+
+// accessCounts returns the access counts, most requested first
+func (r *Cached[T]) accessCounts() []accessCount {
+	r.mu.Lock()
+	counts := make([]accessCount, 0, len(r.hits))
+	for _, count := range r.hits {
+		counts = append(counts, *count)
+	}
+	r.mu.Unlock()
+	sort.Slice(counts, func(i, j int) bool { return counts[i].hits > counts[j].hits })
+	return counts
+}
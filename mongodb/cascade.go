@@ -0,0 +1,161 @@
+package mongodb
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CascadeAction defines what DeleteCascade does with dependent documents
+type CascadeAction int
+
+const (
+	// CascadeDelete deletes dependent documents
+	CascadeDelete CascadeAction = iota
+	// CascadeNullify sets the reference field of dependent documents to null
+	CascadeNullify
+	// CascadeRestrict rejects deletes of items dependent documents reference with ErrStillReferenced,
+	// also for Delete, DeleteRange, DeleteRangeBatched and Archive
+	CascadeRestrict
+)
+
+// Dependent declares documents of Collection referencing the controller items by Field
+type Dependent struct {
+	Collection string
+	Field      string
+	Action     CascadeAction
+}
+
+// CascadeEntry reports the documents affected in one dependent collection
+type CascadeEntry struct {
+	Dependent
+	Affected int64
+}
+
+// CascadeReport lists what DeleteCascade deleted or nullified, or would in dry-run mode
+type CascadeReport struct {
+	DryRun  bool
+	Deleted int64
+	Entries []CascadeEntry
+}
+
+// WithDependents declares collections referencing the controller items for DeleteCascade
+func WithDependents(dependents ...Dependent) Option {
+	return func(o *ctrlOptions) {
+		o.dependents = append(o.dependents, dependents...)
+	}
+}
+
+// DependentsOf builds Dependents from the `mgref` tags of model C stored in collection
+// that reference parentCollection
+func DependentsOf[C any](collection string, parentCollection string, action CascadeAction) ([]Dependent, error) {
+	relations, err := modelRelations(reflect.TypeOf((*C)(nil)))
+	if err != nil {
+		return nil, err
+	}
+	var dependents []Dependent
+	for _, rel := range relations {
+		if rel.collection == parentCollection {
+			dependents = append(dependents, Dependent{Collection: collection, Field: rel.field.BSONName, Action: action})
+		}
+	}
+	return dependents, nil
+}
+
+// DeleteCascade deletes the item identified by id and deletes or nullifies its dependents
+// declared with WithDependents inside one transaction (requires a replica set).
+// With dryRun nothing is changed and the report lists what would be affected.
+// Only direct dependents are processed, dependents of dependents are not.
+// if the item is checked out by another holder, return ErrLocked, if it is fenced off, return ErrFenced
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) DeleteCascade(ctx context.Context, id any, dryRun bool) (_ *CascadeReport, err error) {
+	defer c.recoverPanic(ctx, "DeleteCascade", &err)
+	if !dryRun {
+		if err = c.guardWrite(ctx); err != nil {
+			return nil, err
+		}
+	}
+	id = c.internalID(id)
+	log.Debug("DB DEBUG: Started c.DeleteCascade")
+	defer log.Debug("DB DEBUG: finished c.DeleteCascade")
+
+	db := c.db.Database()
+	if dryRun {
+		report := &CascadeReport{DryRun: true}
+		count, err := c.db.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return nil, err
+		}
+		report.Deleted = count
+		for _, dep := range c.opts.dependents {
+			affected, err := db.Collection(dep.Collection).CountDocuments(ctx, bson.M{dep.Field: id})
+			if err != nil {
+				return nil, err
+			}
+			report.Entries = append(report.Entries, CascadeEntry{Dependent: dep, Affected: affected})
+		}
+		return report, nil
+	}
+
+	if err = c.requireFeature(FeatureTransactions); err != nil {
+		return nil, err
+	}
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		report := &CascadeReport{}
+		for _, dep := range c.opts.dependents {
+			collection := db.Collection(dep.Collection)
+			filter := bson.M{dep.Field: id}
+			entry := CascadeEntry{Dependent: dep}
+			switch dep.Action {
+			case CascadeNullify:
+				res, err := collection.UpdateMany(sc, filter, bson.M{"$set": bson.M{dep.Field: nil}})
+				if err != nil {
+					return nil, err
+				}
+				entry.Affected = res.ModifiedCount
+			case CascadeRestrict:
+				count, err := collection.CountDocuments(sc, filter)
+				if err != nil {
+					return nil, err
+				}
+				if count > 0 {
+					return nil, errors.Wrapf(ErrStillReferenced, "referenced by %s.%s", dep.Collection, dep.Field)
+				}
+			default:
+				res, err := collection.DeleteMany(sc, filter)
+				if err != nil {
+					return nil, err
+				}
+				entry.Affected = res.DeletedCount
+			}
+			report.Entries = append(report.Entries, entry)
+		}
+
+		res, err := c.db.DeleteOne(sc, c.writeFilter(sc, bson.D{{Key: "_id", Value: id}}))
+		if err != nil {
+			return nil, err
+		}
+		if res.DeletedCount == 0 {
+			// dependents must not change when the item is checked out or fenced off
+			if err = c.writeConflict(sc, id); err != nil {
+				return nil, err
+			}
+		}
+		report.Deleted = res.DeletedCount
+		return report, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*CascadeReport), nil
+}
@@ -0,0 +1,200 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// checkoutKey is the field of an item holding its lease, see CheckOut
+const checkoutKey = "_checkout"
+
+// checkoutAttempts is the number of tries of CheckOut when the lease it collided with expired meanwhile
+const checkoutAttempts = 3
+
+// ErrLocked is returned when an item is checked out by another owner, see CheckOut
+var ErrLocked = errors.New("item is checked out")
+
+// Checkout is the lease of an item checked out for editing
+type Checkout struct {
+	Owner     string    `bson:"owner" json:"owner"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+type lockOwnerKey struct{}
+
+// WithLockOwner returns a context whose writes act for owner, so items owner checked out stay
+// writable, see WithCheckOutLocks
+func WithLockOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, lockOwnerKey{}, owner)
+}
+
+// WithCheckOutLocks makes writes skip items checked out by an owner other than the one of
+// WithLockOwner: the lease is a condition of the write filter, so a lease taken concurrently is
+// never overwritten. Writes of one item by _id (Update, Delete, UpdateIfMatch, UpdateAttributes
+// and UnsetAttrs by _id) report the skipped item with ErrLocked, filter based writes leave
+// checked out items out silently.
+func WithCheckOutLocks() Option {
+	return func(o *ctrlOptions) {
+		o.checkOutLocks = true
+	}
+}
+
+// unlocked returns the condition matching items writable for owner: not checked out, lease
+// expired or held by owner
+func unlocked(owner string, now time.Time) bson.M {
+	conds := bson.A{
+		bson.M{checkoutKey: bson.M{"$exists": false}},
+		bson.M{checkoutKey + ".expires_at": bson.M{"$lte": now}},
+	}
+	if owner != "" {
+		conds = append(conds, bson.M{checkoutKey + ".owner": owner})
+	}
+	return bson.M{"$or": conds}
+}
+
+// CheckOut leases the item by id to owner for ttl, e.g. while a user edits it. The lease is stored
+// in the item (field _checkout). Checking out an item owner already holds renews the lease, expired
+// leases are taken over. Leases end by CheckIn or expire after ttl.
+// if another owner holds the item, return ErrLocked
+// if the item does not exist, return mongo.ErrNoDocuments
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) CheckOut(ctx context.Context, id any, owner string, ttl time.Duration) (_ *Checkout, err error) {
+	defer c.recoverPanic(ctx, "CheckOut", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	log.Debug("DB DEBUG: Started c.CheckOut")
+	defer log.Debug("DB DEBUG: finished c.CheckOut")
+	id = c.internalID(id)
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+
+	for attempt := 0; attempt < checkoutAttempts; attempt++ {
+		now := time.Now()
+		lease := &Checkout{Owner: owner, ExpiresAt: now.Add(ttl)}
+		filter := bson.D{{Key: "_id", Value: id}, {Key: "$or", Value: unlocked(owner, now)["$or"]}}
+		result, err := c.db.UpdateOne(ctx, filter, bson.M{"$set": bson.M{checkoutKey: lease}})
+		if err != nil {
+			return nil, err
+		}
+		if result.MatchedCount > 0 {
+			return lease, nil
+		}
+		held, err := c.lease(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if held != nil {
+			return nil, lockedError(id, held)
+		}
+		// the lease expired since the update, or the item does not exist
+		count, err := c.db.CountDocuments(ctx, bson.M{"_id": id})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			c.lintWrite(ctx, "CheckOut", filter, 0, 0)
+			return nil, mongo.ErrNoDocuments
+		}
+	}
+	return nil, errors.Wrapf(ErrLocked, "%v is contended", id)
+}
+
+// CheckIn ends the lease of owner on the item by id, an item not checked out is no error
+// if another owner holds the item, return ErrLocked
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) CheckIn(ctx context.Context, id any, owner string) (err error) {
+	defer c.recoverPanic(ctx, "CheckIn", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return err
+	}
+	id = c.internalID(id)
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+
+	filter := bson.D{{Key: "_id", Value: id}, {Key: checkoutKey + ".owner", Value: owner}}
+	result, err := c.db.UpdateOne(ctx, filter, bson.M{"$unset": bson.M{checkoutKey: ""}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	held, err := c.lease(ctx, id)
+	if err != nil {
+		return err
+	}
+	if held == nil {
+		c.lintWrite(ctx, "CheckIn", filter, 0, 0)
+		return nil
+	}
+	return lockedError(id, held)
+}
+
+// CheckedOut returns the lease of the item by id, nil when it is not checked out
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) CheckedOut(ctx context.Context, id any) (_ *Checkout, err error) {
+	defer c.recoverPanic(ctx, "CheckedOut", &err)
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+	return c.lease(ctx, c.internalID(id))
+}
+
+// lease returns the unexpired lease of the item by internal id, nil for none. It reads the
+// primary, as it explains a write that just matched nothing.
+func (c *genericObjectDBCtrl[T]) lease(ctx context.Context, id any) (*Checkout, error) {
+	var doc struct {
+		Checkout *Checkout `bson:"_checkout"`
+	}
+	err := c.db.FindOne(ctx,
+		bson.M{"_id": id, checkoutKey + ".expires_at": bson.M{"$gt": time.Now()}},
+		options.FindOne().SetProjection(bson.M{checkoutKey: 1}),
+	).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Checkout, nil
+}
+
+func lockedError(id any, lease *Checkout) error {
+	return errors.Wrapf(ErrLocked, "%v checked out by %s until %s", id, lease.Owner, lease.ExpiresAt.Format(time.RFC3339))
+}
+
+// writeFilter adds the WithFence and WithCheckOutLocks conditions to the filter of a write
+func (c *genericObjectDBCtrl[T]) writeFilter(ctx context.Context, filter bson.D) bson.D {
+	filter = c.fenceFilter(filter)
+	if !c.opts.checkOutLocks {
+		return filter
+	}
+	owner, _ := ctx.Value(lockOwnerKey{}).(string)
+	return bson.D{{Key: "$and", Value: bson.A{filter, unlocked(owner, time.Now())}}}
+}
+
+// writeConflict explains a write of the item by internal id filtered by writeFilter which matched
+// nothing: ErrFenced if a newer generation wrote the item, ErrLocked if another owner holds it,
+// nil otherwise
+func (c *genericObjectDBCtrl[T]) writeConflict(ctx context.Context, id any) error {
+	if err := c.fenceConflict(ctx, id); err != nil {
+		return err
+	}
+	if !c.opts.checkOutLocks {
+		return nil
+	}
+	held, err := c.lease(ctx, id)
+	if err != nil || held == nil {
+		return err
+	}
+	if owner, _ := ctx.Value(lockOwnerKey{}).(string); owner == held.Owner {
+		return nil
+	}
+	return lockedError(id, held)
+}
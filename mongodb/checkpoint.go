@@ -0,0 +1,68 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// checkpointCollection stores progress of resumable jobs
+const checkpointCollection = "_checkpoints"
+
+// Checkpointer saves and loads progress of long-running jobs by job name,
+// so custom migration loops can resume after crashes.
+// It is the same primitive used by the batched operations of the controller.
+type Checkpointer struct {
+	db *mongo.Collection
+}
+
+// NewCheckpointer creates a Checkpointer storing progress in the database checkpoints collection
+func NewCheckpointer(db *mongo.Database) *Checkpointer {
+	return &Checkpointer{
+		db: db.Collection(checkpointCollection),
+	}
+}
+
+// Save stores progress for job, replacing any previously saved progress
+// progress SHOULD BE a bson marshallable struct or map
+// if some failed, return err
+func (c *Checkpointer) Save(ctx context.Context, job string, progress any) error {
+	_, err := c.db.UpdateOne(
+		ctx,
+		bson.M{"_id": job},
+		bson.D{
+			bson.E{Key: "$set", Value: bson.M{"progress": progress, "updated_at": time.Now()}},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// Load decodes saved progress of job into progress
+// if nothing saved return found=false and progress is left untouched
+// if some failed, return err
+func (c *Checkpointer) Load(ctx context.Context, job string, progress any) (found bool, err error) {
+	var doc struct {
+		Progress bson.Raw `bson:"progress"`
+	}
+	err = c.db.FindOne(ctx, bson.M{"_id": job}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, bson.Unmarshal(doc.Progress, progress)
+}
+
+// Clear removes saved progress of job, usually after the job completes
+// if some failed, return err
+func (c *Checkpointer) Clear(ctx context.Context, job string) error {
+	_, err := c.db.DeleteOne(ctx, bson.M{"_id": job})
+	return err
+}
@@ -0,0 +1,75 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// QueryChecksum computes a stable hash over the items identified by sels, so cache layers and sync jobs
+// can cheaply detect whether the data changed since the last fetch. Items are hashed in _id order
+// with only fields (all fields when empty), field values are hashed in the given order so
+// the result does not depend on the stored field order.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) QueryChecksum(ctx context.Context, sels map[string]any, fields ...string) (checksum string, count int64, err error) {
+	defer c.recoverPanic(ctx, "QueryChecksum", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.QueryChecksum")
+	defer log.Debug("DB DEBUG: finished c.QueryChecksum")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	opts := profile.findOptions().SetSort(bson.D{{Key: "_id", Value: 1}})
+	if len(fields) > 0 {
+		projection := bson.D{{Key: "_id", Value: 1}}
+		for _, f := range fields {
+			projection = append(projection, bson.E{Key: f, Value: 1})
+		}
+		opts.SetProjection(projection)
+	}
+	cursor, err := c.db.Find(ctx, filterFromSels(sels), opts)
+	if err != nil {
+		return "", 0, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	digest := sha256.New()
+	for cursor.Next(ctx) {
+		count++
+		if len(fields) == 0 {
+			writeHashed(digest, cursor.Current)
+			continue
+		}
+		id := cursor.Current.Lookup("_id")
+		digest.Write([]byte{byte(id.Type)})
+		writeHashed(digest, id.Value)
+		for _, f := range fields {
+			value, err := cursor.Current.LookupErr(strings.Split(f, ".")...)
+			if err != nil {
+				// a missing field hashes differently from any present value
+				digest.Write([]byte{0})
+				continue
+			}
+			digest.Write([]byte{byte(value.Type)})
+			writeHashed(digest, value.Value)
+		}
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), count, nil
+}
+
+// writeHashed writes data prefixed with its length, so concatenated values can't collide
+func writeHashed(digest hash.Hash, data []byte) {
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(data)))
+	digest.Write(size[:])
+	digest.Write(data)
+}
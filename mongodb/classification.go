@@ -0,0 +1,57 @@
+package mongodb
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// DataClassification lists the data classes of a stored field, e.g. "pii" or "pci",
+// declared with `mgdata:"pii,pci"` tags on model fields
+type DataClassification struct {
+	Collection string   `json:"collection"`
+	Field      string   `json:"field"`
+	Classes    []string `json:"classes"`
+}
+
+// DataInventory reports which collections and fields hold classified data according to
+// the registered models, to feed privacy reviews from code. Nested structs are traversed
+// and reported with dotted paths.
+func DataInventory() []DataClassification {
+	names, models := registeredModels()
+	var inventory []DataClassification
+	for _, collection := range names {
+		inventory = appendClassified(inventory, collection, "", models[collection], map[reflect.Type]bool{})
+	}
+	return inventory
+}
+
+func appendClassified(inventory []DataClassification, collection string, prefix string, t reflect.Type, visiting map[reflect.Type]bool) []DataClassification {
+	if visiting[t] {
+		return inventory
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	for _, f := range modelFields(t) {
+		path := prefix + f.BSONName
+		if tag, ok := f.Tag.Lookup("mgdata"); ok {
+			inventory = append(inventory, DataClassification{
+				Collection: collection,
+				Field:      path,
+				Classes:    strings.Split(tag, ","),
+			})
+		}
+
+		nested := f.Type
+		for nested.Kind() == reflect.Pointer || nested.Kind() == reflect.Slice || nested.Kind() == reflect.Array {
+			nested = nested.Elem()
+		}
+		if nested.Kind() == reflect.Struct && nested != timeType {
+			inventory = appendClassified(inventory, collection, path+".", nested, visiting)
+		}
+	}
+	return inventory
+}
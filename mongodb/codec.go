@@ -0,0 +1,134 @@
+package mongodb
+
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// WithRegistry sets the bson registry the controller encodes and decodes items with
+func WithRegistry(registry *bsoncodec.Registry) Option {
+	return func(o *ctrlOptions) {
+		o.registry = registry
+	}
+}
+
+// WithZeroTimeAsNull stores zero time.Time values as null instead of 0001-01-01 dates,
+// which break range queries. null is decoded back into the zero value.
+func WithZeroTimeAsNull() Option {
+	return func(o *ctrlOptions) {
+		o.registryHooks = append(o.registryHooks, RegisterZeroTimeAsNull)
+	}
+}
+
+// RegisterZeroTimeAsNull registers a time.Time encoder writing zero times as null into registry
+func RegisterZeroTimeAsNull(registry *bsoncodec.Registry) {
+	t := reflect.TypeOf(time.Time{})
+	timeEncoder, _ := registry.LookupEncoder(t)
+	registry.RegisterTypeEncoder(t, bsoncodec.ValueEncoderFunc(func(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+		if val.IsValid() && val.Interface().(time.Time).IsZero() {
+			return vw.WriteNull()
+		}
+		return timeEncoder.EncodeValue(ec, vw, val)
+	}))
+}
+
+// buildRegistry registers the codecs of options into a registry of the controller once all
+// options are applied, so their order doesn't matter. A WithRegistry registry is not modified,
+// it is shared by the caller and possibly other controllers: the codecs go into a registry
+// derived from it.
+func (o *ctrlOptions) buildRegistry() {
+	if len(o.registryHooks) == 0 {
+		return
+	}
+	registry := bson.NewRegistry()
+	if o.registry != nil {
+		registry = deriveRegistry(o.registry)
+	}
+	for _, register := range o.registryHooks {
+		register(registry)
+	}
+	o.registry = registry
+}
+
+// registryTypes are the bson types whose type map entries deriveRegistry copies,
+// 0 is the type of top level documents
+var registryTypes = []bsontype.Type{
+	0, bsontype.Double, bsontype.String, bsontype.EmbeddedDocument, bsontype.Array, bsontype.Binary,
+	bsontype.Undefined, bsontype.ObjectID, bsontype.Boolean, bsontype.DateTime, bsontype.Null,
+	bsontype.Regex, bsontype.DBPointer, bsontype.JavaScript, bsontype.Symbol, bsontype.CodeWithScope,
+	bsontype.Int32, bsontype.Timestamp, bsontype.Int64, bsontype.Decimal128, bsontype.MinKey, bsontype.MaxKey,
+}
+
+// deriveRegistry returns a registry looking up the codecs of base for every type, codecs
+// registered into it take precedence and base stays untouched. Nested values are looked up in
+// the derived registry again, so its codecs apply inside the documents base encodes.
+// The struct and pointer codecs cache the codecs of nested fields per type, so the derived
+// registry uses its own ones instead of those of base.
+func deriveRegistry(base *bsoncodec.Registry) *bsoncodec.Registry {
+	derived := bsoncodec.NewRegistry()
+	structCodec, _ := bsoncodec.NewStructCodec(bsoncodec.DefaultStructTagParser)
+	pointerCodec := bsoncodec.NewPointerCodec()
+	encoder := bsoncodec.ValueEncoderFunc(func(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+		if !val.IsValid() {
+			return vw.WriteNull()
+		}
+		enc, err := base.LookupEncoder(val.Type())
+		if err != nil {
+			return err
+		}
+		switch enc.(type) {
+		case *bsoncodec.StructCodec:
+			enc = structCodec
+		case *bsoncodec.PointerCodec:
+			enc = pointerCodec
+		}
+		return enc.EncodeValue(ec, vw, val)
+	})
+	decoder := bsoncodec.ValueDecoderFunc(func(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+		if !val.IsValid() {
+			return bsoncodec.ValueDecoderError{Name: "derivedDecoder", Received: val}
+		}
+		dec, err := base.LookupDecoder(val.Type())
+		if err != nil {
+			return err
+		}
+		switch dec.(type) {
+		case *bsoncodec.StructCodec:
+			dec = structCodec
+		case *bsoncodec.PointerCodec:
+			dec = pointerCodec
+		}
+		return dec.DecodeValue(dc, vr, val)
+	})
+	for kind := reflect.Bool; kind <= reflect.UnsafePointer; kind++ {
+		derived.RegisterKindEncoder(kind, encoder)
+		derived.RegisterKindDecoder(kind, decoder)
+	}
+	for _, t := range registryTypes {
+		if rt, err := base.LookupTypeMapEntry(t); err == nil {
+			derived.RegisterTypeMapEntry(t, rt)
+		}
+	}
+	return derived
+}
+
+// marshal encodes v with the controller registry
+func (c *genericObjectDBCtrl[T]) marshal(v any) ([]byte, error) {
+	if c.opts.registry != nil {
+		return bson.MarshalWithRegistry(c.opts.registry, v)
+	}
+	return bson.Marshal(v)
+}
+
+// unmarshal decodes data into v with the controller registry
+func (c *genericObjectDBCtrl[T]) unmarshal(data []byte, v any) error {
+	if c.opts.registry != nil {
+		return bson.UnmarshalWithRegistry(c.opts.registry, data, v)
+	}
+	return bson.Unmarshal(data, v)
+}
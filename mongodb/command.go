@@ -0,0 +1,109 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// server error codes classified by CommandError
+const (
+	serverBadValue            = 2
+	serverFailedToParse       = 9
+	serverUnauthorized        = 13
+	serverNamespaceNotFound   = 26
+	serverExceededTimeLimit   = 50
+	serverCommandNotFound     = 59
+	serverWriteConflict       = 112
+	serverCommandNotSupported = 115
+	serverDuplicateKey        = 11000
+)
+
+// CommandError is returned by RunCommand when the server rejects a command.
+// errors.Is reports ErrForbidden for authorization failures and ErrUnsupported for unknown
+// commands, errors.As reaches the driver's mongo.CommandError.
+type CommandError struct {
+	Command string
+	// ServerCode and ServerName are the server error code and its name, e.g. 26 "NamespaceNotFound"
+	ServerCode int32
+	ServerName string
+	Message    string
+	Labels     []string
+
+	err mongo.CommandError
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("command %s failed: %s (%s %d)", e.Command, e.Message, e.ServerName, e.ServerCode)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.err
+}
+
+func (e *CommandError) Is(target error) bool {
+	switch e.ServerCode {
+	case serverUnauthorized:
+		return target == ErrForbidden
+	case serverCommandNotFound, serverCommandNotSupported:
+		return target == ErrUnsupported
+	}
+	return false
+}
+
+// Code implements Coder
+func (e *CommandError) Code() ErrorCode {
+	switch e.ServerCode {
+	case serverUnauthorized:
+		return CodeForbidden
+	case serverNamespaceNotFound:
+		return CodeNotFound
+	case serverBadValue, serverFailedToParse:
+		return CodeValidation
+	case serverExceededTimeLimit:
+		return CodeTimeout
+	case serverWriteConflict:
+		return CodeConflict
+	case serverDuplicateKey:
+		return CodeDupKey
+	}
+	if e.err.HasErrorLabel("TransientTransactionError") || e.err.HasErrorLabel("RetryableWriteError") {
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
+
+// RunCommand runs cmd (a bson.D whose first key names the command) on db and decodes the reply
+// into R, the typed escape hatch for server commands the package does not wrap.
+// if the server rejects cmd, return *CommandError
+// if some failed, return err
+func RunCommand[R any](ctx context.Context, db *mongo.Database, cmd bson.D) (*R, error) {
+	name := ""
+	if len(cmd) > 0 {
+		name = cmd[0].Key
+	}
+	log.Debugf("DB DEBUG: Started db.RunCommand(ctx, %s)", name)
+	defer log.Debugf("DB DEBUG: finished db.RunCommand(ctx, %s)", name)
+
+	result := new(R)
+	err := db.RunCommand(ctx, cmd).Decode(result)
+	if err != nil {
+		var commandErr mongo.CommandError
+		if errors.As(err, &commandErr) {
+			return nil, &CommandError{
+				Command:    name,
+				ServerCode: commandErr.Code,
+				ServerName: commandErr.Name,
+				Message:    commandErr.Message,
+				Labels:     commandErr.Labels,
+				err:        commandErr,
+			}
+		}
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,89 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Comment fields set by WithRequestID and WithTraceID
+const (
+	CommentRequestID = "request_id"
+	CommentTraceID   = "trace_id"
+	CommentWorkload  = "workload"
+)
+
+// CommentExtractor returns comment fields carried by ctx, e.g. the ids of a tracing library
+type CommentExtractor func(ctx context.Context) map[string]any
+
+type commentFieldsKey struct{}
+
+// WithContextComments attaches comment fields of the call context (see WithCommentField)
+// as a JSON $comment to the find queries of the controller, so slow operations found in server logs
+// or the profiler can be correlated back to application requests. extractors add fields
+// kept elsewhere in the context, e.g. by a tracing library.
+func WithContextComments(extractors ...CommentExtractor) Option {
+	return func(o *ctrlOptions) {
+		o.commentExtractors = append(o.commentExtractors, contextCommentFields)
+		o.commentExtractors = append(o.commentExtractors, extractors...)
+	}
+}
+
+// WithCommentField returns a context whose controller queries carry key: value in $comment,
+// see WithContextComments
+func WithCommentField(ctx context.Context, key string, value any) context.Context {
+	parent, _ := ctx.Value(commentFieldsKey{}).(map[string]any)
+	fields := make(map[string]any, len(parent)+1)
+	for k, v := range parent {
+		fields[k] = v
+	}
+	fields[key] = value
+	return context.WithValue(ctx, commentFieldsKey{}, fields)
+}
+
+// WithRequestID returns a context whose controller queries carry the request id in $comment
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return WithCommentField(ctx, CommentRequestID, id)
+}
+
+// WithTraceID returns a context whose controller queries carry the trace id in $comment
+func WithTraceID(ctx context.Context, id string) context.Context {
+	return WithCommentField(ctx, CommentTraceID, id)
+}
+
+func contextCommentFields(ctx context.Context) map[string]any {
+	fields, _ := ctx.Value(commentFieldsKey{}).(map[string]any)
+	return fields
+}
+
+// comment returns the $comment of a call as a JSON object with sorted keys, empty without fields
+func (c *genericObjectDBCtrl[T]) comment(ctx context.Context) string {
+	if len(c.opts.commentExtractors) == 0 && c.opts.workload == "" {
+		if _, ok := WorkloadLabel(ctx); !ok {
+			return ""
+		}
+	}
+	fields := map[string]any{}
+	if c.opts.workload != "" {
+		fields[CommentWorkload] = c.opts.workload
+	}
+	if label, ok := WorkloadLabel(ctx); ok {
+		fields[CommentWorkload] = label
+	}
+	for _, extract := range c.opts.commentExtractors {
+		for k, v := range extract(ctx) {
+			fields[k] = v
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	// encoding/json sorts map keys, so comments of the same request stay grep-able
+	data, err := json.Marshal(fields)
+	if err != nil {
+		log.Warnf("DB WARN: failed to encode comment of %s: %s", c.db.Name(), err)
+		return ""
+	}
+	return string(data)
+}
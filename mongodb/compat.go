@@ -0,0 +1,153 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrUnsupported is returned when a feature is not available on the server, see WithCompatibility
+var ErrUnsupported = errors.New("feature not supported by the server")
+
+// Flavor is a MongoDB compatible server implementation
+type Flavor string
+
+const (
+	FlavorMongoDB    Flavor = "mongodb"
+	FlavorDocumentDB Flavor = "documentdb"
+	FlavorCosmos     Flavor = "cosmos"
+	FlavorFerretDB   Flavor = "ferretdb"
+)
+
+// Feature is a server feature not every flavor has
+type Feature string
+
+const (
+	FeatureChangeStreams Feature = "change streams"
+	FeatureTransactions  Feature = "transactions"
+	FeatureTextSearch    Feature = "$text search"
+	// FeatureAtlasSearch covers $search, $vectorSearch and search indexes
+	FeatureAtlasSearch Feature = "Atlas Search"
+	FeatureMerge       Feature = "$merge"
+	FeatureCollation   Feature = "collation"
+)
+
+// Capabilities are the features available on a server
+type Capabilities struct {
+	Flavor   Flavor
+	Version  string
+	Features map[Feature]bool
+}
+
+// Supports reports whether feature is available
+func (c *Capabilities) Supports(feature Feature) bool {
+	return c == nil || c.Features[feature]
+}
+
+// Require returns ErrUnsupported naming feature and the flavor if feature is not available
+func (c *Capabilities) Require(feature Feature) error {
+	if c.Supports(feature) {
+		return nil
+	}
+	return errors.Wrapf(ErrUnsupported, "%s on %s %s", feature, c.Flavor, c.Version)
+}
+
+// flavorFeatures are the features of a flavor when the server can't be probed.
+// MongoDB change streams and transactions additionally need a replica set or sharded cluster.
+var flavorFeatures = map[Flavor][]Feature{
+	FlavorMongoDB:    {FeatureChangeStreams, FeatureTransactions, FeatureTextSearch, FeatureAtlasSearch, FeatureMerge, FeatureCollation},
+	FlavorDocumentDB: {FeatureTransactions},
+	FlavorCosmos:     {FeatureTransactions},
+	FlavorFerretDB:   {},
+}
+
+// FlavorCapabilities returns the conservative capabilities of flavor
+func FlavorCapabilities(flavor Flavor) *Capabilities {
+	caps := &Capabilities{Flavor: flavor, Features: map[Feature]bool{}}
+	for _, feature := range flavorFeatures[flavor] {
+		caps.Features[feature] = true
+	}
+	return caps
+}
+
+// WithCompatibility makes the controller avoid features caps lacks: calls needing them
+// return ErrUnsupported instead of a server error, and VectorSearch uses the exact search
+// without Atlas Search. Use FlavorCapabilities or DetectCapabilities for caps.
+// Helpers taking a collection or database, e.g. NewCountsCache, Migrator or Rollup, use the
+// capabilities of a controller of the same database.
+func WithCompatibility(caps *Capabilities) Option {
+	return func(o *ctrlOptions) {
+		o.compat = caps
+	}
+}
+
+// DetectCapabilities identifies the server behind db and probes change streams. FerretDB is
+// recognized by its build info, DocumentDB and Cosmos DB by the host names of their members,
+// use FlavorCapabilities where that fails. Atlas Search is assumed on MongoDB, as it can't be
+// probed without an index.
+// if some failed, return err
+func DetectCapabilities(ctx context.Context, db *mongo.Database) (*Capabilities, error) {
+	log.Debug("DB DEBUG: Started DetectCapabilities")
+	defer log.Debug("DB DEBUG: finished DetectCapabilities")
+
+	var info bson.M
+	err := db.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get build info: %s", err)
+	}
+	var hello bson.M
+	err = db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hello: %s", err)
+	}
+
+	flavor := FlavorMongoDB
+	switch {
+	case info["ferretdbVersion"] != nil || info["ferretdb"] != nil:
+		flavor = FlavorFerretDB
+	case strings.Contains(fmt.Sprint(hello["me"]), ".docdb.amazonaws.com"):
+		flavor = FlavorDocumentDB
+	case strings.Contains(fmt.Sprint(hello["me"]), ".cosmos.azure.com"):
+		flavor = FlavorCosmos
+	}
+	caps := FlavorCapabilities(flavor)
+	caps.Version = fmt.Sprint(info["version"])
+	if flavor != FlavorMongoDB {
+		return caps, nil
+	}
+
+	_, replicaSet := hello["setName"]
+	clustered := replicaSet || hello["msg"] == "isdbgrid"
+	caps.Features[FeatureTransactions] = clustered
+	caps.Features[FeatureChangeStreams] = clustered && probeChangeStream(ctx, db)
+	return caps, nil
+}
+
+// probeChangeStream reports whether a change stream can be opened on db
+func probeChangeStream(ctx context.Context, db *mongo.Database) bool {
+	stream, err := db.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetMaxAwaitTime(time.Millisecond))
+	if err != nil {
+		log.Debugf("DB DEBUG: change streams unavailable: %s", err)
+		return false
+	}
+	_ = stream.Close(ctx)
+	return true
+}
+
+// requireFeature returns ErrUnsupported if the compatibility capabilities of the controller lack feature
+func (c *genericObjectDBCtrl[T]) requireFeature(feature Feature) error {
+	return c.opts.compat.Require(feature)
+}
+
+// requireCompat is requireFeature for helpers working on a collection rather than a controller,
+// with the capabilities registered by the controllers of its database
+func requireCompat(db *mongo.Database, collection string, feature Feature) error {
+	return registeredCompat(db, collection).Require(feature)
+}
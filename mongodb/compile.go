@@ -0,0 +1,168 @@
+package mongodb
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrInvalidQuery is returned when a filter or update can not be compiled to BSON
+var ErrInvalidQuery = errors.New("invalid query")
+
+// maxQueryDepth is the nesting limit of compiled documents, below the server limit of 100
+const maxQueryDepth = 64
+
+// filterOperators are the query operators CompileFilter accepts. Server side JavaScript
+// ($where, $function, $accumulator) is left out on purpose.
+var filterOperators = map[string]bool{
+	"$and": true, "$or": true, "$nor": true, "$not": true, "$expr": true, "$comment": true,
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true, "$type": true, "$regex": true, "$options": true,
+	"$all": true, "$elemMatch": true, "$size": true, "$mod": true, "$text": true, "$search": true,
+	"$language": true, "$caseSensitive": true, "$diacriticSensitive": true,
+	"$bitsAllSet": true, "$bitsAllClear": true, "$bitsAnySet": true, "$bitsAnyClear": true,
+	"$geoWithin": true, "$geoIntersects": true, "$near": true, "$nearSphere": true,
+	"$geometry": true, "$maxDistance": true, "$minDistance": true, "$box": true,
+	"$polygon": true, "$center": true, "$centerSphere": true,
+}
+
+// CompileFilter compiles sels, as accepted by the controller methods, into the BSON filter sent
+// to the server. Use it to check user supplied selectors, e.g. of HTTP requests, before querying.
+// Keys are sorted so equal sels compile to equal bytes.
+// if sels has empty keys, NUL bytes, unknown operators or nest too deep, return ErrInvalidQuery
+// if some value can not be marshaled, return err
+func CompileFilter(sels map[string]any) (bson.Raw, error) {
+	err := checkQueryValue("", sels, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	filter := filterFromSels(sels)
+	sort.Slice(filter, func(i, j int) bool { return filter[i].Key < filter[j].Key })
+	return marshalQuery(filter)
+}
+
+// CompileUpdate compiles attrs, as accepted by UpdateAttributes, into the $set update document.
+// Keys are dot paths of fields, they may not be operators. Keys are sorted so equal attrs
+// compile to equal bytes. Controller specifics like updated_at are not added.
+// if attrs has empty keys or path elements, NUL bytes, operators or nest too deep, return ErrInvalidQuery
+// if some value can not be marshaled, return err
+func CompileUpdate(attrs map[string]any) (bson.Raw, error) {
+	if len(attrs) == 0 {
+		return nil, errors.Wrap(ErrInvalidQuery, "empty update")
+	}
+	set := make(bson.D, 0, len(attrs))
+	for key, value := range attrs {
+		for _, part := range strings.Split(key, ".") {
+			if part == "" {
+				return nil, errors.Wrapf(ErrInvalidQuery, "%q: empty path element", key)
+			}
+		}
+		err := checkQueryValue(key, map[string]any{key: value}, 0, false)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, bson.E{Key: key, Value: value})
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].Key < set[j].Key })
+	return marshalQuery(bson.D{{Key: "$set", Value: set}})
+}
+
+var elementType = reflect.TypeOf(bson.E{})
+
+// checkQueryValue checks the keys of v at path recursively, operators allows query operators as keys
+func checkQueryValue(path string, v any, depth int, operators bool) error {
+	if depth > maxQueryDepth {
+		return errors.Wrapf(ErrInvalidQuery, "%q: nested deeper than %d", path, maxQueryDepth)
+	}
+	checkKey := func(key string, value any) error {
+		switch {
+		case key == "":
+			return errors.Wrapf(ErrInvalidQuery, "%q: empty key", path)
+		case strings.IndexByte(key, 0) >= 0:
+			return errors.Wrapf(ErrInvalidQuery, "%q: NUL byte in key", path)
+		case strings.HasPrefix(key, "$") && !operators:
+			return errors.Wrapf(ErrInvalidQuery, "%q: operator %s not allowed", path, key)
+		case strings.HasPrefix(key, "$") && !filterOperators[key]:
+			return errors.Wrapf(ErrInvalidQuery, "%q: unknown operator %s", path, key)
+		}
+		return checkQueryValue(joinPath(path, key), value, depth+1, operators)
+	}
+
+	switch v := v.(type) {
+	case bson.Raw:
+		var doc bson.D
+		if err := bson.Unmarshal(v, &doc); err != nil {
+			return errors.Wrapf(ErrInvalidQuery, "%q: %s", path, err)
+		}
+		return checkQueryValue(path, doc, depth, operators)
+	case []byte:
+		return nil
+	}
+
+	// typed containers ([]bson.M, map[string]string, ...) are walked like their untyped forms
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := checkKey(iter.Key().String(), iter.Value().Interface()); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		elem := rv.Type().Elem()
+		if elem.Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if elem == elementType {
+				e := rv.Index(i).Interface().(bson.E)
+				if err := checkKey(e.Key, e.Value); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := checkQueryValue(path, rv.Index(i).Interface(), depth+1, operators); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if strings.IndexByte(rv.String(), 0) >= 0 && strings.HasSuffix(path, "$regex") {
+			return errors.Wrapf(ErrInvalidQuery, "%q: NUL byte in pattern", path)
+		}
+	}
+	return nil
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// marshalQuery marshals doc and validates the result
+func marshalQuery(doc bson.D) (bson.Raw, error) {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	raw := bson.Raw(data)
+	err = raw.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
@@ -0,0 +1,149 @@
+package mongodb
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCompileFilter(t *testing.T) {
+	where, err := bson.Marshal(bson.M{"$where": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		sels    map[string]any
+		want    string
+		invalid bool
+	}{
+		{name: "empty", sels: map[string]any{}, want: `{}`},
+		{name: "sorted keys", sels: map[string]any{"b": 1, "a": "x"}, want: `{"a": "x","b": {"$numberInt":"1"}}`},
+		{name: "operator", sels: map[string]any{"age": bson.M{"$gte": 18}}, want: `{"age": {"$gte": {"$numberInt":"18"}}}`},
+		{name: "logical", sels: map[string]any{"$or": []any{bson.M{"a": 1}, bson.D{{Key: "b", Value: 2}}}}, want: `{"$or": [{"a": {"$numberInt":"1"}},{"b": {"$numberInt":"2"}}]}`},
+		{name: "empty key", sels: map[string]any{"": 1}, invalid: true},
+		{name: "NUL byte", sels: map[string]any{"a\x00b": 1}, invalid: true},
+		{name: "unknown operator", sels: map[string]any{"a": bson.M{"$foo": 1}}, invalid: true},
+		{name: "javascript", sels: map[string]any{"$where": "true"}, invalid: true},
+		{name: "nested javascript", sels: map[string]any{"$and": bson.A{bson.M{"$where": "true"}}}, invalid: true},
+		{name: "typed slice of bson.M", sels: map[string]any{"$or": []bson.M{{"$where": "sleep(1000)"}}}, invalid: true},
+		{name: "typed slice of maps", sels: map[string]any{"$or": []map[string]any{{"$where": "1"}}}, invalid: true},
+		{name: "typed slice of bson.D", sels: map[string]any{"$or": []bson.D{{{Key: "$where", Value: "1"}}}}, invalid: true},
+		{name: "array of bson.M", sels: map[string]any{"$or": [1]bson.M{{"$where": "1"}}}, invalid: true},
+		{name: "typed map", sels: map[string]any{"a": map[string]string{"$where": "1"}}, invalid: true},
+		{name: "pointer to map", sels: map[string]any{"a": &bson.M{"$function": "1"}}, invalid: true},
+		{name: "raw document", sels: map[string]any{"$and": bson.A{bson.Raw(where)}}, invalid: true},
+		{name: "typed slice", sels: map[string]any{"$or": []bson.M{{"a": 1}}, "tags": bson.M{"$in": []string{"x", "y"}}}, want: `{"$or": [{"a": {"$numberInt":"1"}}],"tags": {"$in": ["x","y"]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := CompileFilter(tt.sels)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Fatalf("CompileFilter() error = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompileFilter() error = %v", err)
+			}
+			if got := raw.String(); got != tt.want {
+				t.Errorf("CompileFilter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileFilterDepth(t *testing.T) {
+	var sels any = 1
+	for i := 0; i <= maxQueryDepth; i++ {
+		sels = bson.M{"a": sels}
+	}
+	_, err := CompileFilter(sels.(bson.M))
+	if !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("CompileFilter() error = %v, want ErrInvalidQuery", err)
+	}
+}
+
+func TestCompileUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		attrs   map[string]any
+		want    string
+		invalid bool
+	}{
+		{name: "set", attrs: map[string]any{"b": 1, "a.c": "x"}, want: `{"$set": {"a.c": "x","b": {"$numberInt":"1"}}}`},
+		{name: "empty", attrs: map[string]any{}, invalid: true},
+		{name: "empty path element", attrs: map[string]any{"a..b": 1}, invalid: true},
+		{name: "operator key", attrs: map[string]any{"$inc": bson.M{"a": 1}}, invalid: true},
+		{name: "operator in value", attrs: map[string]any{"a": bson.M{"$gt": 1}}, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := CompileUpdate(tt.attrs)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Fatalf("CompileUpdate() error = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompileUpdate() error = %v", err)
+			}
+			if got := raw.String(); got != tt.want {
+				t.Errorf("CompileUpdate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// compileSeeds are extended JSON documents seeding the fuzz targets
+var compileSeeds = []string{
+	`{}`,
+	`{"name": "x", "age": {"$gte": 18}}`,
+	`{"$or": [{"a": 1}, {"b": {"$in": [1, 2, "3"]}}]}`,
+	`{"tags": {"$elemMatch": {"k": "a", "v": {"$exists": true}}}}`,
+	`{"a.b": {"$not": {"$regex": "^x", "$options": "i"}}}`,
+	`{"_id": {"$oid": "5f1d7a9e8c3b2a1d0e9f8a7b"}}`,
+	`{"$where": "sleep(1000)"}`,
+	`{"": 1}`,
+}
+
+func FuzzCompileFilter(f *testing.F) {
+	for _, seed := range compileSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var sels map[string]any
+		if bson.UnmarshalExtJSON(data, false, &sels) != nil {
+			t.Skip()
+		}
+		checkCompiled(t, sels)(CompileFilter(sels))
+	})
+}
+
+func FuzzCompileUpdate(f *testing.F) {
+	for _, seed := range compileSeeds {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var attrs map[string]any
+		if bson.UnmarshalExtJSON(data, false, &attrs) != nil {
+			t.Skip()
+		}
+		checkCompiled(t, attrs)(CompileUpdate(attrs))
+	})
+}
+
+// checkCompiled fails t when a compiled document is not valid BSON
+func checkCompiled(t *testing.T, input map[string]any) func(bson.Raw, error) {
+	return func(raw bson.Raw, err error) {
+		if err != nil {
+			return
+		}
+		if err = raw.Validate(); err != nil {
+			t.Fatalf("compiled %v to invalid BSON: %s", input, err)
+		}
+	}
+}
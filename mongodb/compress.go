@@ -0,0 +1,240 @@
+package mongodb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// compression algorithms of the `mgcompress` tag
+const (
+	CompressGzip = "gzip"
+	CompressZstd = "zstd"
+)
+
+// defaultCompressThreshold is the size above which fields tagged `mgcompress` are compressed
+const defaultCompressThreshold = 1024
+
+// maxDecompressedSize caps the content of a compressed field, so a corrupt or crafted value
+// can't exhaust memory on read, compressing a larger content fails
+const maxDecompressedSize = 4 * MaxBSONDocumentSize
+
+// compressedSubtype is the user defined binary subtype compressed fields are stored with,
+// the first data byte is the algorithm and the second one tells a string from bytes
+const compressedSubtype = 0x80
+
+const (
+	compressedGzip   = 'g'
+	compressedZstd   = 'z'
+	compressedString = 's'
+	compressedBytes  = 'b'
+)
+
+// WithFieldCompression compresses string and []byte fields tagged `mgcompress:"algorithm[,threshold]"`
+// (gzip or zstd, threshold in bytes, 1KB when omitted) whose size exceeds the threshold before storage
+// and decompresses them on read, shrinking log-like payload fields.
+// Note: only top level fields are compressed, fields tagged `mgoffload` are not compressed.
+// Compressed fields can't be queried by value.
+func WithFieldCompression() Option {
+	return func(o *ctrlOptions) {
+		o.compress = true
+	}
+}
+
+type compressField struct {
+	name      string
+	algorithm byte
+	threshold int
+}
+
+// compressFields returns the top level fields of T tagged with `mgcompress`
+func compressFields[T any]() []compressField {
+	var fields []compressField
+	for _, f := range modelFields(reflect.TypeOf((*T)(nil))) {
+		tag, ok := f.Tag.Lookup("mgcompress")
+		if !ok || strings.Contains(f.BSONName, ".") {
+			continue
+		}
+		if _, offloaded := f.Tag.Lookup("mgoffload"); offloaded {
+			continue
+		}
+		algorithm, thresholdTag, _ := strings.Cut(tag, ",")
+		field := compressField{name: f.BSONName, algorithm: compressedGzip, threshold: defaultCompressThreshold}
+		if algorithm == CompressZstd {
+			field.algorithm = compressedZstd
+		}
+		if threshold, err := strconv.Atoi(thresholdTag); err == nil && threshold > 0 {
+			field.threshold = threshold
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// compressValue returns value compressed as a binary when it is a string or bytes over the threshold
+func compressValue(f compressField, value any) (any, error) {
+	var data []byte
+	kind := byte(compressedBytes)
+	switch v := value.(type) {
+	case string:
+		data, kind = []byte(v), compressedString
+	case []byte:
+		data = v
+	case primitive.Binary:
+		if v.Subtype != bsontype.BinaryGeneric {
+			return value, nil
+		}
+		data = v.Data
+	default:
+		return value, nil
+	}
+	if len(data) <= f.threshold {
+		return value, nil
+	}
+	if len(data) > maxDecompressedSize {
+		return nil, fmt.Errorf("failed to compress %s: content exceeds %d bytes", f.name, maxDecompressedSize)
+	}
+
+	buf := bytes.NewBuffer([]byte{f.algorithm, kind})
+	var w io.WriteCloser
+	var err error
+	if f.algorithm == compressedZstd {
+		w, err = zstd.NewWriter(buf)
+	} else {
+		w = gzip.NewWriter(buf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress %s: %s", f.name, err)
+	}
+	if err = w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress %s: %s", f.name, err)
+	}
+	return primitive.Binary{Subtype: compressedSubtype, Data: buf.Bytes()}, nil
+}
+
+// decompressValue returns the content of a compressed binary
+func decompressValue(name string, data []byte) (any, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("failed to decompress %s: truncated", name)
+	}
+	var r io.Reader
+	switch data[0] {
+	case compressedZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data[2:]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %s", name, err)
+		}
+		defer zr.Close()
+		r = zr
+	case compressedGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data[2:]))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %s", name, err)
+		}
+		r = gr
+	default:
+		return nil, fmt.Errorf("failed to decompress %s: unknown algorithm %q", name, data[0])
+	}
+	content, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %s", name, err)
+	}
+	if len(content) > maxDecompressedSize {
+		return nil, fmt.Errorf("failed to decompress %s: content exceeds %d bytes", name, maxDecompressedSize)
+	}
+	if data[1] == compressedString {
+		return string(content), nil
+	}
+	return content, nil
+}
+
+// compressDoc compresses the tagged fields of the encoded item doc
+func (c *genericObjectDBCtrl[T]) compressDoc(doc bson.Raw) (bson.Raw, error) {
+	fields := compressFields[T]()
+	if !c.opts.compress || len(fields) == 0 {
+		return doc, nil
+	}
+	var d bson.D
+	err := c.unmarshal(doc, &d)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		for i := range d {
+			if d[i].Key != f.name {
+				continue
+			}
+			d[i].Value, err = compressValue(f, d[i].Value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c.marshal(d)
+}
+
+// compressUpdate compresses the tagged fields of the $set document update
+func (c *genericObjectDBCtrl[T]) compressUpdate(update bson.M) error {
+	if !c.opts.compress {
+		return nil
+	}
+	for _, f := range compressFields[T]() {
+		value, ok := update[f.name]
+		if !ok {
+			continue
+		}
+		compressed, err := compressValue(f, value)
+		if err != nil {
+			return err
+		}
+		update[f.name] = compressed
+	}
+	return nil
+}
+
+// decompress replaces compressed fields of raw with their content
+func (c *genericObjectDBCtrl[T]) decompress(raw bson.Raw) (bson.Raw, error) {
+	if !c.opts.compress {
+		return raw, nil
+	}
+	var compressed []compressField
+	for _, f := range compressFields[T]() {
+		if subtype, _, ok := raw.Lookup(f.name).BinaryOK(); ok && subtype == compressedSubtype {
+			compressed = append(compressed, f)
+		}
+	}
+	if len(compressed) == 0 {
+		return raw, nil
+	}
+
+	var d bson.D
+	err := c.unmarshal(raw, &d)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range compressed {
+		_, data := raw.Lookup(f.name).Binary()
+		value, err := decompressValue(f.name, data)
+		if err != nil {
+			return nil, err
+		}
+		for i := range d {
+			if d[i].Key == f.name {
+				d[i].Value = value
+			}
+		}
+	}
+	return c.marshal(d)
+}
@@ -0,0 +1,37 @@
+package mongodb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDecompressValue(t *testing.T) {
+	content := strings.Repeat("log line\n", 1000)
+	for _, algorithm := range []byte{compressedGzip, compressedZstd} {
+		compressed, err := compressValue(compressField{name: "log", algorithm: algorithm}, content)
+		if err != nil {
+			t.Fatalf("compressValue(%c) error = %v", algorithm, err)
+		}
+		got, err := decompressValue("log", compressed.(primitive.Binary).Data)
+		if err != nil || got != content {
+			t.Errorf("decompressValue(%c) = %.20q, %v", algorithm, got, err)
+		}
+	}
+
+	// a small value expanding beyond the cap is rejected instead of read into memory
+	buf := bytes.NewBuffer([]byte{compressedGzip, compressedBytes})
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(make([]byte, maxDecompressedSize+1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decompressValue("log", buf.Bytes()); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("decompressValue(bomb) error = %v", err)
+	}
+}
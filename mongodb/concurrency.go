@@ -0,0 +1,82 @@
+package mongodb
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrConflict is returned by Update when the item was changed concurrently
+var ErrConflict = errors.New("item was modified concurrently")
+
+// ConcurrencyPolicy defines how Update resolves concurrent modifications
+type ConcurrencyPolicy int
+
+const (
+	// ConcurrencyNone is last-write-wins, the default
+	ConcurrencyNone ConcurrencyPolicy = iota
+	// ConcurrencyVersion compares and increments the integer Version field of the model
+	ConcurrencyVersion
+	// ConcurrencyUpdatedAt compares the UpdatedAt field of the model with the stored updated_at
+	ConcurrencyUpdatedAt
+)
+
+// WithConcurrencyPolicy sets the policy Update uses on concurrent modifications.
+// With ConcurrencyVersion or ConcurrencyUpdatedAt a stale item is rejected with ErrConflict.
+func WithConcurrencyPolicy(policy ConcurrencyPolicy) Option {
+	return func(o *ctrlOptions) {
+		o.concurrency = policy
+	}
+}
+
+// versionKey returns the key the integer Version field of T is stored under, "version" when T has none
+func versionKey[T any]() string {
+	for _, f := range modelFields(reflect.TypeOf((*T)(nil))) {
+		if f.Name == "Version" && reflect.Zero(f.Type).CanInt() {
+			return f.BSONName
+		}
+	}
+	return "version"
+}
+
+// concurrencyGuard extends the Update filter and returns the values to $set for the configured policy,
+// it must be called before UpdatedAt of item is bumped
+// apply is called after a successful update to store the new version into item
+func (c *genericObjectDBCtrl[T]) concurrencyGuard(item *T, filter bson.D) (bson.D, bson.M, func()) {
+	v := reflect.ValueOf(item).Elem()
+	switch c.opts.concurrency {
+	case ConcurrencyVersion:
+		field := v.FieldByName("Version")
+		if !field.IsValid() || !field.CanInt() {
+			return filter, nil, func() {}
+		}
+		current := field.Int()
+		key := versionKey[T]()
+		filter = append(filter, bson.E{Key: key, Value: current})
+		return filter, bson.M{key: current + 1}, func() { field.SetInt(current + 1) }
+	case ConcurrencyUpdatedAt:
+		if current, ok := getTimestamp(item, "UpdatedAt"); ok {
+			// stored dates have millisecond precision
+			filter = append(filter, bson.E{Key: updatedAtKey[T](), Value: current.Truncate(time.Millisecond)})
+		}
+	}
+	return filter, nil, func() {}
+}
+
+// resolveUnmatched tells a concurrent modification from a missing item after an update matched nothing
+func (c *genericObjectDBCtrl[T]) resolveUnmatched(ctx context.Context, id any) error {
+	if c.opts.concurrency == ConcurrencyNone {
+		return nil
+	}
+	count, err := c.db.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrConflict
+	}
+	return nil
+}
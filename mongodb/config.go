@@ -0,0 +1,214 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Profile holds operational settings applied to a controller call
+type Profile struct {
+	// Timeout bounds the whole call on the client side, 0 means no deadline
+	Timeout time.Duration
+	// ReadTimeout, WriteTimeout and DDLTimeout override Timeout for reads, writes
+	// and index/DDL operations respectively
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	DDLTimeout   time.Duration
+	// MaxTime bounds query execution on the server, 0 means no limit
+	MaxTime time.Duration
+	// AllowDiskUse lets queries spill sorts to disk
+	AllowDiskUse bool
+	// BatchSize is the cursor batch size, 0 means the server default
+	BatchSize int32
+	// comment is the $comment of the call, see WithContextComments
+	comment string
+	// collation is the collation of the call, see WithLocaleCollation
+	collation *options.Collation
+}
+
+// Profile names of DefaultConfig
+const (
+	ProfileInteractive = "interactive"
+	ProfileBatch       = "batch"
+)
+
+// Config is a set of named profiles. Default is used for calls without a profile in context.
+type Config struct {
+	Default  string
+	Profiles map[string]Profile
+}
+
+// DefaultConfig has an "interactive" profile with low timeouts used by default
+// and a "batch" profile with long timeouts and disk use allowed
+var DefaultConfig = Config{
+	Default: ProfileInteractive,
+	Profiles: map[string]Profile{
+		ProfileInteractive: {Timeout: 5 * time.Second, MaxTime: 2 * time.Second, DDLTimeout: 10 * time.Minute},
+		ProfileBatch:       {Timeout: 30 * time.Minute, AllowDiskUse: true, BatchSize: 1000},
+	},
+}
+
+var (
+	globalConfigMu sync.RWMutex
+	globalConfig   *Config
+)
+
+// SetConfig sets the configuration used by controllers created without WithConfig, nil disables profiles
+func SetConfig(cfg *Config) {
+	globalConfigMu.Lock()
+	defer globalConfigMu.Unlock()
+	globalConfig = cfg
+}
+
+// WithConfig sets the configuration of the controller, overriding the global one set by SetConfig
+func WithConfig(cfg Config) Option {
+	return func(o *ctrlOptions) {
+		o.config = &cfg
+	}
+}
+
+type profileKey struct{}
+
+// WithProfile selects the named profile for controller calls made with the returned context
+func WithProfile(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, profileKey{}, name)
+}
+
+// ProfileName returns the profile name selected by WithProfile
+func ProfileName(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(profileKey{}).(string)
+	return name, ok
+}
+
+// config returns the controller configuration or the global one
+func (c *genericObjectDBCtrl[T]) config() *Config {
+	if c.opts.config != nil {
+		return c.opts.config
+	}
+	globalConfigMu.RLock()
+	defer globalConfigMu.RUnlock()
+	return globalConfig
+}
+
+// profile resolves the profile of the call, unknown names resolve to the zero Profile
+func (c *genericObjectDBCtrl[T]) profile(ctx context.Context) Profile {
+	cfg := c.config()
+	if cfg == nil {
+		return Profile{}
+	}
+	name, ok := ProfileName(ctx)
+	if !ok {
+		name = cfg.Default
+	}
+	return cfg.Profiles[name]
+}
+
+// opKind is the kind of a controller call, selecting its timeout
+type opKind int
+
+const (
+	opRead opKind = iota
+	opWrite
+	opDDL
+)
+
+// timeout returns the deadline of an op of kind in p
+func (p Profile) timeout(kind opKind) time.Duration {
+	var d time.Duration
+	switch kind {
+	case opRead:
+		d = p.ReadTimeout
+	case opWrite:
+		d = p.WriteTimeout
+	case opDDL:
+		d = p.DDLTimeout
+	}
+	if d > 0 {
+		return d
+	}
+	return p.Timeout
+}
+
+// begin applies the profile of the call to ctx, the returned cancel must be called when the call ends.
+// Without a profile timeout the controller timeouts of WithTimeouts apply.
+func (c *genericObjectDBCtrl[T]) begin(ctx context.Context, kind opKind) (context.Context, context.CancelFunc, Profile) {
+	p := c.profile(ctx)
+	p.comment = c.comment(ctx)
+	p.collation = c.collation(ctx)
+	timeout := p.timeout(kind)
+	if timeout <= 0 {
+		timeout = c.opts.timeouts.timeout(kind)
+	}
+	var cancel context.CancelFunc = func() {}
+	if budget := budgetFrom(ctx); budget != nil {
+		ctx, cancel = budget.begin(ctx, timeout)
+	} else if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	if c.opts.scheduler != nil {
+		ctx, cancel = c.opts.scheduler.begin(ctx, cancel)
+	}
+	return ctx, cancel, p
+}
+
+// WithTimeouts sets default deadlines of controller reads, writes and index/DDL operations, 0 means no deadline.
+// Timeouts of the call profile (see Config) take precedence.
+func WithTimeouts(read, write, ddl time.Duration) Option {
+	return func(o *ctrlOptions) {
+		o.timeouts = Profile{ReadTimeout: read, WriteTimeout: write, DDLTimeout: ddl}
+	}
+}
+
+// findOptions returns find options carrying the server side settings of p
+func (p Profile) findOptions() *options.FindOptions {
+	opts := options.Find()
+	if p.MaxTime > 0 {
+		opts.SetMaxTime(p.MaxTime)
+	}
+	if p.AllowDiskUse {
+		opts.SetAllowDiskUse(true)
+	}
+	if p.BatchSize > 0 {
+		opts.SetBatchSize(p.BatchSize)
+	}
+	if p.comment != "" {
+		opts.SetComment(p.comment)
+	}
+	if p.collation != nil {
+		opts.SetCollation(p.collation)
+	}
+	return opts
+}
+
+// findOneOptions returns find one options carrying the server side settings of p
+func (p Profile) findOneOptions() *options.FindOneOptions {
+	opts := options.FindOne()
+	if p.MaxTime > 0 {
+		opts.SetMaxTime(p.MaxTime)
+	}
+	if p.comment != "" {
+		opts.SetComment(p.comment)
+	}
+	if p.collation != nil {
+		opts.SetCollation(p.collation)
+	}
+	return opts
+}
+
+// countOptions returns count options carrying the server side settings of p
+func (p Profile) countOptions() *options.CountOptions {
+	opts := options.Count()
+	if p.MaxTime > 0 {
+		opts.SetMaxTime(p.MaxTime)
+	}
+	if p.comment != "" {
+		opts.SetComment(p.comment)
+	}
+	if p.collation != nil {
+		opts.SetCollation(p.collation)
+	}
+	return opts
+}
@@ -0,0 +1,201 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Credentials are the authentication settings resolved at dial time
+type Credentials struct {
+	Username      string
+	Password      string
+	AuthSource    string
+	AuthMechanism string
+}
+
+// CredentialsResolver returns the current credentials, e.g. read from Vault,
+// AWS Secrets Manager or a mounted k8s secret
+type CredentialsResolver func(ctx context.Context) (Credentials, error)
+
+// ConnectConfig configures ConnectWithConfig
+type ConnectConfig struct {
+	// URI is the connection string, credentials in it are overridden by Credentials
+	URI string
+	// Database is the name of the database returned by Conn.Database
+	Database string
+	// Credentials (optional) is called on every dial to resolve the credentials
+	Credentials CredentialsResolver
+	// RefreshInterval (optional) re-resolves credentials periodically and reconnects when they change
+	RefreshInterval time.Duration
+	// ConnectTimeout (optional) bounds establishing a connection to a server, independent of operation timeouts
+	ConnectTimeout time.Duration
+	// DrainTimeout is how long a replaced client is kept open for operations in flight, 30s by default
+	DrainTimeout time.Duration
+	// AWS (optional) enables MONGODB-AWS authentication
+	AWS *AWSAuth
+	// X509 (optional) enables MONGODB-X509 authentication with a client certificate
+	X509 *X509Auth
+	// Payloads (optional) records the wire sizes of commands, a command monitor set in
+	// ClientOptions replaces it
+	Payloads *PayloadMonitor
+	// ClientOptions are applied after URI and authentication settings
+	ClientOptions []*options.ClientOptions
+}
+
+// Conn is a connection that can be re-established with fresh credentials without restarting the process.
+// Handles obtained from Client or Database before a reconnect keep working until the old client is drained,
+// so long-lived users should obtain them from Conn per use.
+type Conn struct {
+	cfg ConnectConfig
+
+	mu     sync.RWMutex
+	client *mongo.Client
+	auth   dialAuth
+
+	topology topologyFeed
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// ConnectWithConfig dials the server resolving credentials with cfg.Credentials, cfg.AWS or cfg.X509 and pings it
+// if some failed, return err
+func ConnectWithConfig(ctx context.Context, cfg ConnectConfig) (*Conn, error) {
+	if cfg.DrainTimeout <= 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	conn := &Conn{cfg: cfg, stop: make(chan struct{})}
+	conn.topology.events = make(chan TopologyEvent, topologyEventsBuffer)
+	client, auth, err := conn.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn.client, conn.auth = client, auth
+
+	conn.done.Add(1)
+	go conn.dispatchTopology()
+
+	if cfg.RefreshInterval > 0 && (cfg.Credentials != nil || cfg.AWS != nil || cfg.X509 != nil) {
+		conn.done.Add(1)
+		go conn.refresh()
+	}
+	return conn, nil
+}
+
+// dial resolves credentials and connects a new client
+func (c *Conn) dial(ctx context.Context) (*mongo.Client, dialAuth, error) {
+	clientOptions := options.Client().ApplyURI(c.cfg.URI).SetServerMonitor(c.serverMonitor())
+
+	auth, err := c.resolveAuth(ctx, clientOptions)
+	if err != nil {
+		return nil, auth, err
+	}
+	if auth.credential != nil {
+		clientOptions.SetAuth(*auth.credential)
+	}
+	if c.cfg.ConnectTimeout > 0 {
+		clientOptions.SetConnectTimeout(c.cfg.ConnectTimeout)
+	}
+	if c.cfg.Payloads != nil {
+		clientOptions.SetMonitor(c.cfg.Payloads.Monitor())
+	}
+
+	client, err := mongo.Connect(ctx, append([]*options.ClientOptions{clientOptions}, c.cfg.ClientOptions...)...)
+	if err != nil {
+		return nil, auth, fmt.Errorf("failed to mongo.Connect: %s", err)
+	}
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, auth, fmt.Errorf("failed to dbClient.Ping: %s", err)
+	}
+	return client, auth, nil
+}
+
+// Client returns the current client
+func (c *Conn) Client() *mongo.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// Database returns the configured database of the current client
+func (c *Conn) Database() *mongo.Database {
+	return c.Client().Database(c.cfg.Database)
+}
+
+// Reconnect dials a new client with freshly resolved credentials and replaces the current one,
+// the old client is disconnected after DrainTimeout
+// if some failed, return err and keep the current client
+func (c *Conn) Reconnect(ctx context.Context) error {
+	client, auth, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	c.swap(client, auth)
+	return nil
+}
+
+func (c *Conn) swap(client *mongo.Client, auth dialAuth) {
+	c.mu.Lock()
+	old := c.client
+	c.client, c.auth = client, auth
+	c.mu.Unlock()
+
+	log.Debug("DB DEBUG: connection replaced")
+	time.AfterFunc(c.cfg.DrainTimeout, func() {
+		_ = old.Disconnect(context.Background())
+	})
+}
+
+// refresh re-resolves credentials every RefreshInterval and reconnects when they change,
+// certificates of X509 are reloaded on every reconnect
+func (c *Conn) refresh() {
+	defer c.done.Done()
+	ticker := time.NewTicker(c.cfg.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.cfg.RefreshInterval)
+		auth, err := c.resolveAuth(ctx, options.Client())
+		c.mu.RLock()
+		changed := err == nil && !reflect.DeepEqual(auth, c.auth)
+		c.mu.RUnlock()
+		if err != nil {
+			log.Errorf("DB ERROR: %s", err)
+		} else if changed {
+			if err = c.Reconnect(ctx); err != nil {
+				log.Errorf("DB ERROR: failed to reconnect with rotated credentials: %s", err)
+			}
+		}
+		cancel()
+	}
+}
+
+// Close stops credential refresh and disconnects the current client,
+// in dev mode cursors left open are reported first (see CursorLeakDetector)
+// if some failed, return err
+func (c *Conn) Close(ctx context.Context) error {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+	}
+	c.done.Wait()
+	if DevMode() {
+		Cursors().Report(0)
+	}
+	return c.Client().Disconnect(ctx)
+}
@@ -0,0 +1,133 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrQueryTooExpensive is returned by List and DeleteRange when WithCostGuard rejects a collection scan
+var ErrQueryTooExpensive = errors.New("query too expensive")
+
+// CostEstimate is the explain-based cost of a filter
+type CostEstimate struct {
+	// CollectionScan reports whether the winning plan scans the collection
+	CollectionScan bool
+	// Indexes are the indexes used by the winning plan
+	Indexes []string
+	// DocsExamined estimates the documents examined, the collection size for a collection scan
+	// and 0 when an index bounds the scan
+	DocsExamined int64
+}
+
+// WithCostGuard explains List and DeleteRange filters before running them and rejects
+// (ErrQueryTooExpensive) or, when reject is false, logs collection scans examining more than
+// maxDocs documents. It costs an explain round trip per call, so it is meant for production
+// deployments protecting shared clusters from accidental unindexed queries.
+func WithCostGuard(maxDocs int64, reject bool) Option {
+	return func(o *ctrlOptions) {
+		o.costMaxDocs = maxDocs
+		o.costReject = reject
+	}
+}
+
+// EstimateCost explains sels filter (logical AND) with the query planner without running it
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) EstimateCost(ctx context.Context, sels map[string]any) (_ *CostEstimate, err error) {
+	defer c.recoverPanic(ctx, "EstimateCost", &err)
+	sels = c.internalSels(sels)
+	return c.estimateCost(ctx, filterFromSels(sels))
+}
+
+func (c *genericObjectDBCtrl[T]) estimateCost(ctx context.Context, filter bson.D) (*CostEstimate, error) {
+	log.Debug("DB DEBUG: Started c.db.RunCommand(ctx, explain)")
+	defer log.Debug("DB DEBUG: finished c.db.RunCommand(ctx, explain)")
+
+	var result struct {
+		QueryPlanner struct {
+			WinningPlan bson.Raw `bson:"winningPlan"`
+		} `bson:"queryPlanner"`
+	}
+	err := c.db.Database().RunCommand(ctx, bson.D{
+		{Key: "explain", Value: bson.D{
+			{Key: "find", Value: c.db.Name()},
+			{Key: "filter", Value: filter},
+		}},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	estimate := &CostEstimate{}
+	walkPlan(result.QueryPlanner.WinningPlan, estimate)
+	if estimate.CollectionScan {
+		estimate.DocsExamined, err = c.db.EstimatedDocumentCount(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return estimate, nil
+}
+
+// walkPlan collects the scans of a plan stage tree, classic (inputStage) and SBE (queryPlan) shapes
+func walkPlan(stage bson.Raw, estimate *CostEstimate) {
+	if stage == nil {
+		return
+	}
+	name, _ := stage.Lookup("stage").StringValueOK()
+	switch name {
+	case "COLLSCAN":
+		estimate.CollectionScan = true
+	case "IXSCAN":
+		if name, ok := stage.Lookup("indexName").StringValueOK(); ok {
+			estimate.Indexes = append(estimate.Indexes, name)
+		}
+	}
+	for _, key := range []string{"inputStage", "queryPlan", "outerStage", "innerStage"} {
+		if child, ok := stage.Lookup(key).DocumentOK(); ok {
+			walkPlan(child, estimate)
+		}
+	}
+	if children, ok := stage.Lookup("inputStages").ArrayOK(); ok {
+		values, _ := children.Values()
+		for _, child := range values {
+			if doc, ok := child.DocumentOK(); ok {
+				walkPlan(doc, estimate)
+			}
+		}
+	}
+	// sharded plans hold the winning plan of every shard
+	if shards, ok := stage.Lookup("shards").ArrayOK(); ok {
+		values, _ := shards.Values()
+		for _, shard := range values {
+			if doc, ok := shard.DocumentOK(); ok {
+				if plan, ok := doc.Lookup("winningPlan").DocumentOK(); ok {
+					walkPlan(plan, estimate)
+				}
+			}
+		}
+	}
+}
+
+// guardCost applies WithCostGuard to filter of operation op
+func (c *genericObjectDBCtrl[T]) guardCost(ctx context.Context, op string, filter bson.D) error {
+	if c.opts.costMaxDocs <= 0 {
+		return nil
+	}
+	estimate, err := c.estimateCost(ctx, filter)
+	if err != nil {
+		log.Warnf("DB WARN: failed to estimate cost of %s on %s: %s", op, c.db.Name(), err)
+		return nil
+	}
+	if !estimate.CollectionScan || estimate.DocsExamined <= c.opts.costMaxDocs {
+		return nil
+	}
+	if c.opts.costReject {
+		return errors.Wrapf(ErrQueryTooExpensive, "%s on %s scans about %d documents", op, c.db.Name(), estimate.DocsExamined)
+	}
+	log.Warnf("DB WARN: %s on %s scans about %d documents, filter %v", op, c.db.Name(), estimate.DocsExamined, filter)
+	return nil
+}
@@ -0,0 +1,92 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// counterCollection stores named counters
+const counterCollection = "_counters"
+
+// Counter keeps atomic named counters, e.g. rate counters and usage metering, updated with $inc
+type Counter struct {
+	db *mongo.Collection
+}
+
+// NewCounter creates a Counter storing values in the database counters collection
+func NewCounter(db *mongo.Database) *Counter {
+	return &Counter{
+		db: db.Collection(counterCollection),
+	}
+}
+
+// IncrBy atomically adds n to the counter key, creating it from 0, and returns the new value
+// if some failed, return err
+func (c *Counter) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	var doc struct {
+		Value int64 `bson:"value"`
+	}
+	err := c.db.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		bson.D{
+			bson.E{Key: "$inc", Value: bson.M{"value": n}},
+			bson.E{Key: "$set", Value: bson.M{"updated_at": time.Now()}},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return 0, err
+	}
+	return doc.Value, nil
+}
+
+// DecrBy atomically subtracts n from the counter key and returns the new value
+// if some failed, return err
+func (c *Counter) DecrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return c.IncrBy(ctx, key, -n)
+}
+
+// Get returns the value of the counter key, 0 if it does not exist
+// if some failed, return err
+func (c *Counter) Get(ctx context.Context, key string) (int64, error) {
+	var doc struct {
+		Value int64 `bson:"value"`
+	}
+	err := c.db.FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return doc.Value, nil
+}
+
+// Reset sets the counter key to 0 and returns its previous value
+// if some failed, return err
+func (c *Counter) Reset(ctx context.Context, key string) (int64, error) {
+	var doc struct {
+		Value int64 `bson:"value"`
+	}
+	err := c.db.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		bson.D{
+			bson.E{Key: "$set", Value: bson.M{"value": int64(0), "updated_at": time.Now()}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return doc.Value, nil
+}
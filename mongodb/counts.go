@@ -0,0 +1,329 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// countsRetry is the pause before a failed counts change stream is reopened
+const countsRetry = 5 * time.Second
+
+// GroupCount is the number of items of one group of a CountsCache
+type GroupCount struct {
+	Value any
+	Count int64
+}
+
+// CountsCache maintains the number of items matching a filter per value of a group field
+// (e.g. open tickets per team) in memory, updated incrementally from a change stream and
+// reconciled periodically, instead of repeated CountDocuments on large collections.
+// It keeps the ids of the matching items, so it is meant for filters matching a working set.
+type CountsCache struct {
+	db        *mongo.Collection
+	filter    bson.D
+	groupBy   string
+	reconcile time.Duration
+
+	mu      sync.RWMutex
+	members map[string]string // item id -> group key
+	counts  map[string]*GroupCount
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewCountsCache loads the counts of items of collection matching sels grouped by the groupBy
+// field (one group when empty) and starts following changes, call Close to stop it.
+// sels are equality matches, as they are evaluated on changed documents locally.
+// reconcile is the period of full recounts correcting drift, 0 disables them.
+// if sels use operators, return err
+// if some failed, return err
+func NewCountsCache(ctx context.Context, collection *mongo.Collection, sels map[string]any, groupBy string, reconcile time.Duration) (*CountsCache, error) {
+	for key, value := range sels {
+		if strings.HasPrefix(key, "$") || isOperatorValue(value) {
+			return nil, fmt.Errorf("failed to create counts cache: %s is not an equality match", key)
+		}
+	}
+	filter := filterFromSels(sels)
+	sort.Slice(filter, func(i, j int) bool { return filter[i].Key < filter[j].Key })
+	c := &CountsCache{
+		db:        collection,
+		filter:    filter,
+		groupBy:   groupBy,
+		reconcile: reconcile,
+		done:      make(chan struct{}),
+	}
+	if err := requireCompat(collection.Database(), collection.Name(), FeatureChangeStreams); err != nil {
+		return nil, err
+	}
+	// the stream is opened before the initial load, so no change between them is missed
+	stream, err := collection.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return nil, err
+	}
+	err = c.Reconcile(ctx)
+	if err != nil {
+		stream.Close(context.Background())
+		return nil, err
+	}
+	watchCtx, stop := context.WithCancel(context.Background())
+	c.stop = stop
+	go c.run(watchCtx, stream)
+	return c, nil
+}
+
+// Close stops following changes and waits for a running reconcile
+func (c *CountsCache) Close() {
+	c.stop()
+	<-c.done
+}
+
+// Count returns the number of matching items whose group field equals value
+func (c *CountsCache) Count(value any) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if g, ok := c.counts[groupKey(value)]; ok {
+		return g.Count
+	}
+	return 0
+}
+
+// Total returns the number of matching items
+func (c *CountsCache) Total() int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return int64(len(c.members))
+}
+
+// Counts returns the non empty groups, largest first
+func (c *CountsCache) Counts() []GroupCount {
+	c.mu.RLock()
+	counts := make([]GroupCount, 0, len(c.counts))
+	for _, g := range c.counts {
+		counts = append(counts, *g)
+	}
+	c.mu.RUnlock()
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+	return counts
+}
+
+// Reconcile recounts the matching items from the collection
+// if some failed, return err
+func (c *CountsCache) Reconcile(ctx context.Context) error {
+	log.Debug("DB DEBUG: Started CountsCache.Reconcile")
+	defer log.Debug("DB DEBUG: finished CountsCache.Reconcile")
+	projection := bson.M{"_id": 1}
+	if c.groupBy != "" {
+		projection[c.groupBy] = 1
+	}
+	cursor, err := c.db.Find(ctx, c.filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(cursor))
+	members := map[string]string{}
+	counts := map[string]*GroupCount{}
+	for cursor.Next(ctx) {
+		id, key, value := c.group(cursor.Current)
+		members[id] = key
+		addGroupCount(counts, key, value, 1)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.members = members
+	c.counts = counts
+	c.mu.Unlock()
+	return nil
+}
+
+// run applies changes of stream and reconciles periodically until ctx is done
+func (c *CountsCache) run(ctx context.Context, stream *mongo.ChangeStream) {
+	defer close(c.done)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	if c.reconcile > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticker := time.NewTicker(c.reconcile)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := c.Reconcile(ctx); err != nil && ctx.Err() == nil {
+						log.Warnf("DB WARN: failed to reconcile counts of %s: %s", c.db.Name(), err)
+					}
+				}
+			}
+		}()
+	}
+	for {
+		err := c.follow(ctx, stream)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnf("DB WARN: counts change stream of %s failed: %s", c.db.Name(), err)
+		if sleepCtx(ctx, countsRetry) != nil {
+			return
+		}
+		// changes missed while the stream was down are recovered by a recount
+		stream, err = c.db.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+		if err != nil {
+			continue
+		}
+		if err = c.Reconcile(ctx); err != nil {
+			log.Warnf("DB WARN: failed to reconcile counts of %s: %s", c.db.Name(), err)
+		}
+	}
+}
+
+func (c *CountsCache) follow(ctx context.Context, stream *mongo.ChangeStream) error {
+	defer stream.Close(context.Background())
+	for stream.Next(ctx) {
+		var event struct {
+			OperationType string   `bson:"operationType"`
+			DocumentKey   bson.Raw `bson:"documentKey"`
+			FullDocument  bson.Raw `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			log.Errorf("DB ERROR: failed to decode counts change: %s", err)
+			continue
+		}
+		id := refKey(event.DocumentKey.Lookup("_id"))
+		matches := event.FullDocument != nil && event.OperationType != "delete" && c.matches(event.FullDocument)
+		c.apply(id, event.FullDocument, matches)
+	}
+	return stream.Err()
+}
+
+// apply moves item id to the group of doc if it matches, out of its previous group otherwise
+func (c *CountsCache) apply(id string, doc bson.Raw, matches bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if previous, ok := c.members[id]; ok {
+		delete(c.members, id)
+		addGroupCount(c.counts, previous, nil, -1)
+	}
+	if matches {
+		_, key, value := c.group(doc)
+		c.members[id] = key
+		addGroupCount(c.counts, key, value, 1)
+	}
+}
+
+// matches reports whether doc satisfies the equality filter like the server evaluates it
+func (c *CountsCache) matches(doc bson.Raw) bool {
+	for _, e := range c.filter {
+		value, err := doc.LookupErr(strings.Split(e.Key, ".")...)
+		if err != nil {
+			if e.Value != nil {
+				return false
+			}
+			continue
+		}
+		if !equalValue(value, e.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// group returns the id, group key and group value of doc
+func (c *CountsCache) group(doc bson.Raw) (id string, key string, value any) {
+	id = refKey(doc.Lookup("_id"))
+	if c.groupBy == "" {
+		return id, "", nil
+	}
+	raw, err := doc.LookupErr(strings.Split(c.groupBy, ".")...)
+	if err != nil {
+		return id, refKey(nil), nil
+	}
+	_ = raw.Unmarshal(&value)
+	return id, groupKey(raw), value
+}
+
+// equalValue reports whether value matches want like a server equality match: numbers of any type
+// are equal by value, and an array matches when it or one of its elements equals want
+func equalValue(value bson.RawValue, want any) bool {
+	expected := bson.RawValue{Type: bsontype.Null}
+	if want != nil {
+		t, data, err := bson.MarshalValue(want)
+		if err != nil {
+			return false
+		}
+		expected = bson.RawValue{Type: t, Value: data}
+	}
+	if compareRawValues(value, expected) == 0 {
+		return true
+	}
+	if array, ok := value.ArrayOK(); ok {
+		elements, _ := array.Values()
+		for _, element := range elements {
+			if compareRawValues(element, expected) == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// groupKey returns the key of the group of value, numbers of any type with equal values share a group
+func groupKey(value any) string {
+	raw, ok := value.(bson.RawValue)
+	if !ok {
+		if t, data, err := bson.MarshalValue(value); err == nil {
+			raw, ok = bson.RawValue{Type: t, Value: data}, true
+		}
+	}
+	if ok && bsonTypeRank(raw.Type) == 2 {
+		return refKey(rawNumber(raw))
+	}
+	return refKey(value)
+}
+
+func addGroupCount(counts map[string]*GroupCount, key string, value any, delta int64) {
+	g, ok := counts[key]
+	if !ok {
+		g = &GroupCount{Value: value}
+		counts[key] = g
+	}
+	g.Count += delta
+	if g.Count <= 0 {
+		delete(counts, key)
+	}
+}
+
+// isOperatorValue reports whether a selector value is an operator document
+func isOperatorValue(v any) bool {
+	switch v := v.(type) {
+	case map[string]any:
+		for k := range v {
+			if strings.HasPrefix(k, "$") {
+				return true
+			}
+		}
+	case bson.M:
+		return isOperatorValue(map[string]any(v))
+	case bson.D:
+		for _, e := range v {
+			if strings.HasPrefix(e.Key, "$") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestEqualValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  any
+		equal bool
+	}{
+		{name: "int32 and int64", value: int32(5), want: int64(5), equal: true},
+		{name: "int and double", value: 5, want: 5.0, equal: true},
+		{name: "different numbers", value: int32(5), want: int64(6)},
+		{name: "number and string", value: 5, want: "5"},
+		{name: "strings", value: "open", want: "open", equal: true},
+		{name: "array element", value: bson.A{"a", int32(2)}, want: int64(2), equal: true},
+		{name: "array without element", value: bson.A{"a", "b"}, want: "c"},
+		{name: "null", value: nil, want: nil, equal: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := equalValue(rawValue(t, tt.value), tt.want)
+			if got != tt.equal {
+				t.Errorf("equalValue(%v, %v) = %v, want %v", tt.value, tt.want, got, tt.equal)
+			}
+		})
+	}
+}
+
+func TestGroupKey(t *testing.T) {
+	if groupKey(rawValue(t, int32(7))) != groupKey(int64(7)) || groupKey(7) != groupKey(7.0) {
+		t.Error("groupKey() differs for equal numbers of different types")
+	}
+	if groupKey("7") == groupKey(7) {
+		t.Error("groupKey() is equal for a string and a number")
+	}
+	if groupKey(rawValue(t, "team")) != groupKey("team") {
+		t.Error("groupKey() differs for a raw and a plain string")
+	}
+}
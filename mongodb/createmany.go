@@ -0,0 +1,80 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// duplicateKeyCode is the server error code of a unique index violation
+const duplicateKeyCode = 11000
+
+// CreateManyResult is the outcome of CreateManySkipDuplicates
+type CreateManyResult struct {
+	Inserted int
+	// Skipped are the indexes of the items skipped as duplicates
+	Skipped []int
+}
+
+// CreateManySkipDuplicates creates items with one unordered insert, skipping items violating a unique index
+// (e.g. an _id already ingested) instead of failing, for idempotent ingestion of event streams.
+// Items are prepared like by Create, but not buffered by WithWriteBuffer, as skipped items are reported.
+// if some failed for another reason than a duplicate, return err
+func (c *genericObjectDBCtrl[T]) CreateManySkipDuplicates(ctx context.Context, items []*T) (_ *CreateManyResult, err error) {
+	defer c.recoverPanic(ctx, "CreateManySkipDuplicates", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	log.Debug("DB DEBUG: Started c.db.InsertMany(ctx, items)")
+	defer log.Debug("DB DEBUG: finished c.db.InsertMany(ctx, items)")
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+
+	result := &CreateManyResult{}
+	if len(items) == 0 {
+		return result, nil
+	}
+	now := time.Now()
+	docs := make([]any, 0, len(items))
+	offloaded := make([]*offloadWrite, 0, len(items))
+	for _, item := range items {
+		doc, w, err := c.prepareCreate(ctx, item, now)
+		if err != nil {
+			for _, w := range offloaded {
+				w.rollback()
+			}
+			return nil, err
+		}
+		docs = append(docs, doc)
+		offloaded = append(offloaded, w)
+	}
+
+	inserted, err := c.db.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if inserted != nil {
+		result.Inserted = len(inserted.InsertedIDs)
+	}
+	if err == nil {
+		return result, nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return result, err
+	}
+	// the files of items not inserted belong to no document
+	for _, writeErr := range bulkErr.WriteErrors {
+		offloaded[writeErr.Index].rollback()
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != duplicateKeyCode {
+			return result, err
+		}
+		result.Skipped = append(result.Skipped, writeErr.Index)
+	}
+	result.Inserted = len(items) - len(result.Skipped)
+	return result, nil
+}
@@ -0,0 +1,142 @@
+package mongodb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed five field cron expression: minute hour day-of-month month day-of-week
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny and dowAny record "*" day fields: when both day fields are restricted,
+	// a day matches either of them as in classic cron
+	domAny, dowAny bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression with lists, ranges and steps ("*/15 9-17 * * 1-5")
+// or one of the @yearly, @monthly, @weekly, @daily and @hourly macros. Day of week 7 is Sunday.
+// if some failed, return err
+func ParseCron(expr string) (*CronSchedule, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("failed to parse cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	var s CronSchedule
+	var err error
+	bounds := [5][2]uint{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	targets := [5]*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		*targets[i], err = parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse cron %q: %s", expr, err)
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domAny = fields[2] == "*" || fields[2] == "?"
+	s.dowAny = fields[4] == "*" || fields[4] == "?"
+	return &s, nil
+}
+
+// parseCronField returns the bitset of values of a comma separated list of a, a-b, * with optional /step
+func parseCronField(field string, lo uint, hi uint) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := uint(1)
+		if hasStep {
+			n, err := strconv.ParseUint(stepStr, 10, 8)
+			if err != nil || n == 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			}
+			step = uint(n)
+		}
+
+		from, to := lo, hi
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			x, err := strconv.ParseUint(a, 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("bad range %q", part)
+			}
+			y, err := strconv.ParseUint(b, 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("bad range %q", part)
+			}
+			from, to = uint(x), uint(y)
+		default:
+			x, err := strconv.ParseUint(rng, 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			from = uint(x)
+			if !hasStep {
+				to = from
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("value %q out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after t matching the schedule, in the location of t,
+// or the zero time if there is none within five years
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
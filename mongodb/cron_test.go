@@ -0,0 +1,70 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		invalid bool
+	}{
+		{expr: "* * * * *"},
+		{expr: "*/15 9-17 * * 1-5"},
+		{expr: "0,30 0 1 1,6 ?"},
+		{expr: "5/10 * * * 7"},
+		{expr: "@daily"},
+		{expr: " @hourly "},
+		{expr: "* * * *", invalid: true},
+		{expr: "* * * * * *", invalid: true},
+		{expr: "60 * * * *", invalid: true},
+		{expr: "* 24 * * *", invalid: true},
+		{expr: "* * 0 * *", invalid: true},
+		{expr: "* * * 13 *", invalid: true},
+		{expr: "* * * * 8", invalid: true},
+		{expr: "5-1 * * * *", invalid: true},
+		{expr: "*/0 * * * *", invalid: true},
+		{expr: "a * * * *", invalid: true},
+		{expr: "@often", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseCron(tt.expr)
+			if (err != nil) != tt.invalid {
+				t.Errorf("ParseCron(%q) error = %v, invalid %v", tt.expr, err, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// a Wednesday
+	from := time.Date(2024, 1, 10, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{expr: "* * * * *", want: time.Date(2024, 1, 10, 10, 8, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", want: time.Date(2024, 1, 10, 10, 15, 0, 0, time.UTC)},
+		{expr: "0 9-17 * * 1-5", want: time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{expr: "@daily", want: time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", want: time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", want: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		// both day fields restricted: either matches
+		{expr: "0 0 20 * 5", want: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", want: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", want: time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+			}
+			if got := s.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
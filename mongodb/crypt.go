@@ -0,0 +1,215 @@
+package mongodb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// encrypted stream layout: magic, nonce prefix, then chunks of [flag][ciphertext length][ciphertext].
+// Chunk nonces are the prefix followed by the chunk counter, the flag is authenticated and marks
+// the last chunk, whose plaintext is the SHA-256 checksum of all preceding plaintext.
+const (
+	cryptMagic       = "MGX1"
+	cryptPrefixSize  = 8
+	cryptChunkSize   = 64 * 1024
+	cryptFlagData    = 0
+	cryptFlagLast    = 1
+	cryptChunkHeader = 5
+)
+
+// ErrChecksumMismatch is returned when an encrypted stream is truncated or its checksum does not match
+var ErrChecksumMismatch = errors.New("encrypted stream checksum mismatch")
+
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	sum     hash.Hash
+	closed  bool
+}
+
+// NewEncryptWriter returns a writer AES-GCM encrypting everything written to it into w.
+// key is 16, 24 or 32 bytes long. Close MUST be called to write the final checksum chunk,
+// without it the stream is rejected by NewDecryptReader as truncated.
+func NewEncryptWriter(w io.Writer, key []byte) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, cryptPrefixSize)
+	if _, err = rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(append([]byte(cryptMagic), prefix...)); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		prefix: prefix,
+		buf:    make([]byte, 0, cryptChunkSize),
+		sum:    sha256.New(),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, fmt.Errorf("write to closed encrypt writer")
+	}
+	e.sum.Write(p)
+	written := 0
+	for len(p) > 0 {
+		n := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		if len(e.buf) == cap(e.buf) {
+			if err := e.writeChunk(cryptFlagData, e.buf); err != nil {
+				return written, err
+			}
+			e.buf = e.buf[:0]
+		}
+	}
+	return written, nil
+}
+
+// Close flushes buffered data and writes the final checksum chunk, it does not close the underlying writer
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if len(e.buf) > 0 {
+		if err := e.writeChunk(cryptFlagData, e.buf); err != nil {
+			return err
+		}
+	}
+	return e.writeChunk(cryptFlagLast, e.sum.Sum(nil))
+}
+
+func (e *encryptWriter) writeChunk(flag byte, plaintext []byte) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter), plaintext, []byte{flag})
+	e.counter++
+
+	header := make([]byte, cryptChunkHeader)
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(sealed)))
+	if _, err := e.w.Write(header); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+type decryptReader struct {
+	r       io.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	sum     hash.Hash
+	done    bool
+}
+
+// NewDecryptReader returns a reader decrypting a stream written by NewEncryptWriter with the same key.
+// Reads fail with ErrChecksumMismatch when the stream is truncated or tampered with.
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(cryptMagic)+cryptPrefixSize)
+	if _, err = io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if string(head[:len(cryptMagic)]) != cryptMagic {
+		return nil, fmt.Errorf("not an encrypted stream")
+	}
+
+	return &decryptReader{
+		r:      r,
+		aead:   aead,
+		prefix: head[len(cryptMagic):],
+		sum:    sha256.New(),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func (d *decryptReader) readChunk() error {
+	header := make([]byte, cryptChunkHeader)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrChecksumMismatch
+		}
+		return err
+	}
+	flag := header[0]
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > cryptChunkSize+uint32(d.aead.Overhead()) {
+		return ErrChecksumMismatch
+	}
+	sealed := make([]byte, size)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrChecksumMismatch
+		}
+		return err
+	}
+
+	plaintext, err := d.aead.Open(nil, chunkNonce(d.prefix, d.counter), sealed, []byte{flag})
+	if err != nil {
+		return ErrChecksumMismatch
+	}
+	d.counter++
+
+	if flag == cryptFlagLast {
+		d.done = true
+		if subtle.ConstantTimeCompare(plaintext, d.sum.Sum(nil)) != 1 {
+			return ErrChecksumMismatch
+		}
+		return nil
+	}
+	d.sum.Write(plaintext)
+	d.buf = plaintext
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint32) []byte {
+	nonce := make([]byte, cryptPrefixSize+4)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[cryptPrefixSize:], counter)
+	return nonce
+}
@@ -0,0 +1,68 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CurrentOp is an in-progress operation reported by $currentOp
+type CurrentOp struct {
+	// OpID is an int on replica sets and a "shard:id" string on sharded clusters
+	OpID             any      `bson:"opid"`
+	Op               string   `bson:"op"`
+	Namespace        string   `bson:"ns"`
+	Active           bool     `bson:"active"`
+	SecsRunning      int64    `bson:"secs_running"`
+	MicrosecsRunning int64    `bson:"microsecs_running"`
+	Command          bson.Raw `bson:"command"`
+	PlanSummary      string   `bson:"planSummary"`
+	Client           string   `bson:"client"`
+	AppName          string   `bson:"appName"`
+	Desc             string   `bson:"desc"`
+	Msg              string   `bson:"msg"`
+	Progress         struct {
+		Done  int64 `bson:"done"`
+		Total int64 `bson:"total"`
+	} `bson:"progress"`
+}
+
+// CurrentOps returns operations in progress on the deployment matching filter
+// (fields of CurrentOp, e.g. {"secs_running": {"$gt": 60}, "ns": "app.orders"}).
+// if some failed, return err
+func CurrentOps(ctx context.Context, db *mongo.Database, filter map[string]any) ([]CurrentOp, error) {
+	log.Debug("DB DEBUG: Started admin.Aggregate(ctx, $currentOp)")
+	defer log.Debug("DB DEBUG: finished admin.Aggregate(ctx, $currentOp)")
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$currentOp", Value: bson.M{"allUsers": true}}},
+	}
+	if len(filter) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filterFromSels(filter)}})
+	}
+
+	cursor, err := db.Client().Database("admin").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	ops := []CurrentOp{}
+	err = cursor.All(ctx, &ops)
+	if err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// KillOp terminates the operation with opID as reported by CurrentOps
+// if some failed, return err
+func KillOp(ctx context.Context, db *mongo.Database, opID any) error {
+	log.Debug("DB DEBUG: Started admin.RunCommand(ctx, killOp)")
+	defer log.Debug("DB DEBUG: finished admin.RunCommand(ctx, killOp)")
+
+	return db.Client().Database("admin").RunCommand(ctx, bson.D{
+		{Key: "killOp", Value: 1},
+		{Key: "op", Value: opID},
+	}).Err()
+}
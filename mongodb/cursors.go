@@ -0,0 +1,149 @@
+package mongodb
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// cursorCloseTimeout bounds closing a cursor whose operation context is already canceled
+const cursorCloseTimeout = 5 * time.Second
+
+var devMode atomic.Bool
+
+// SetDevMode enables development checks that cost too much for production,
+// e.g. tracking of open cursors by the CursorLeakDetector
+func SetDevMode(enabled bool) {
+	devMode.Store(enabled)
+}
+
+// DevMode reports whether development checks are enabled
+func DevMode() bool {
+	return devMode.Load()
+}
+
+// CursorLeak is a cursor opened by the package and not closed yet
+type CursorLeak struct {
+	OpenedAt time.Time
+	Stack    string
+	// Collected reports the cursor was garbage collected with its server side cursor still open,
+	// which the server only times out after 10 minutes of inactivity
+	Collected bool
+}
+
+// CursorLeakDetector tracks cursors opened by the package while dev mode is enabled, from their
+// creation until they are closed, whichever way they are closed. Cursors are not kept reachable
+// by the detector: one garbage collected without being closed is logged at once and reported by
+// Leaks from then on.
+type CursorLeakDetector struct {
+	mu sync.Mutex
+	// open is keyed by cursor address, so tracking doesn't keep cursors from being collected
+	open      map[uintptr]CursorLeak
+	collected []CursorLeak
+}
+
+var cursorLeaks = &CursorLeakDetector{open: map[uintptr]CursorLeak{}}
+
+// Cursors returns the detector of cursors opened by the package
+func Cursors() *CursorLeakDetector {
+	return cursorLeaks
+}
+
+// Leaks returns cursors open for longer than olderThan and cursors collected without being
+// closed, oldest first
+func (d *CursorLeakDetector) Leaks(olderThan time.Duration) []CursorLeak {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cutoff := time.Now().Add(-olderThan)
+	leaks := append([]CursorLeak(nil), d.collected...)
+	for _, leak := range d.open {
+		if leak.OpenedAt.Before(cutoff) {
+			leaks = append(leaks, leak)
+		}
+	}
+	sort.Slice(leaks, func(i, j int) bool { return leaks[i].OpenedAt.Before(leaks[j].OpenedAt) })
+	return leaks
+}
+
+// Report logs the Leaks with the stacks that opened them and returns their number,
+// Conn.Close reports all open cursors in dev mode
+func (d *CursorLeakDetector) Report(olderThan time.Duration) int {
+	leaks := d.Leaks(olderThan)
+	for _, leak := range leaks {
+		if leak.Collected {
+			log.Warnf("DB WARN: cursor collected without Close, opened at %s:\n%s", leak.OpenedAt.Format(time.RFC3339), leak.Stack)
+			continue
+		}
+		log.Warnf("DB WARN: cursor open since %s, opened at:\n%s", leak.OpenedAt.Format(time.RFC3339), leak.Stack)
+	}
+	return len(leaks)
+}
+
+// trackCursor registers cursor in the leak detector when dev mode is enabled,
+// it is called where the cursor is created
+func trackCursor(cursor *mongo.Cursor) *mongo.Cursor {
+	if !DevMode() || cursor == nil {
+		return cursor
+	}
+	key := reflect.ValueOf(cursor).Pointer()
+	cursorLeaks.mu.Lock()
+	defer cursorLeaks.mu.Unlock()
+	if _, ok := cursorLeaks.open[key]; ok {
+		return cursor
+	}
+	cursorLeaks.open[key] = CursorLeak{OpenedAt: time.Now(), Stack: string(debug.Stack())}
+	runtime.SetFinalizer(cursor, func(cursor *mongo.Cursor) {
+		cursorLeaks.collect(key, cursor)
+	})
+	return cursor
+}
+
+// collect untracks a garbage collected cursor, recording it as a leak if it was left open.
+// A cursor closed or exhausted without closeCursor, e.g. by Cursor.All, has no server side id.
+func (d *CursorLeakDetector) collect(key uintptr, cursor *mongo.Cursor) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	leak, ok := d.open[key]
+	delete(d.open, key)
+	if !ok || cursor.ID() == 0 {
+		return
+	}
+	leak.Collected = true
+	d.collected = append(d.collected, leak)
+	log.Warnf("DB WARN: cursor collected without Close, opened at:\n%s", leak.Stack)
+}
+
+// closeCursor closes cursor even when the operation context is canceled,
+// so the server-side cursor is killed promptly, and untracks it
+func closeCursor(cursor *mongo.Cursor) {
+	key := reflect.ValueOf(cursor).Pointer()
+	cursorLeaks.mu.Lock()
+	if _, ok := cursorLeaks.open[key]; ok {
+		delete(cursorLeaks.open, key)
+		runtime.SetFinalizer(cursor, nil)
+	}
+	cursorLeaks.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cursorCloseTimeout)
+	defer cancel()
+	if err := cursor.Close(ctx); err != nil {
+		log.Debugf("DB DEBUG: failed to close cursor: %s", err)
+	}
+}
+
+// cursorErr returns ctx.Err() when iteration stopped because ctx is done,
+// so callers can tell cancellation from driver errors, otherwise cursor.Err()
+func cursorErr(ctx context.Context, cursor *mongo.Cursor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,63 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Sum returns the sum of numeric field among items matched by sels (logical AND) as a decimal.
+// Values are converted to Decimal128 before they are added, so amounts stored as Decimal128
+// (e.g. money) are summed exactly and doubles don't accumulate binary rounding errors.
+// With no values the sum is 0.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) Sum(ctx context.Context, field string, sels map[string]any) (_ primitive.Decimal128, err error) {
+	defer c.recoverPanic(ctx, "Sum", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $sum)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $sum)")
+	return c.decimalAccumulate(ctx, "$sum", field, sels)
+}
+
+// Avg returns the average of numeric field among items matched by sels (logical AND) as a
+// decimal, accumulated like Sum. With no values the average is 0.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) Avg(ctx context.Context, field string, sels map[string]any) (_ primitive.Decimal128, err error) {
+	defer c.recoverPanic(ctx, "Avg", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $avg)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $avg)")
+	return c.decimalAccumulate(ctx, "$avg", field, sels)
+}
+
+// decimalAccumulate applies accumulator op to field converted to Decimal128
+func (c *genericObjectDBCtrl[T]) decimalAccumulate(ctx context.Context, op string, field string, sels map[string]any) (primitive.Decimal128, error) {
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+
+	cursor, err := c.reader().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: typedFilter(sels, field, "number")}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "value", Value: bson.M{op: bson.M{"$toDecimal": "$" + field}}},
+		}}},
+	})
+	if err != nil {
+		return primitive.Decimal128{}, err
+	}
+	var results []struct {
+		Value primitive.Decimal128 `bson:"value"`
+	}
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return primitive.Decimal128{}, err
+	}
+	if len(results) == 0 {
+		zero, _ := primitive.ParseDecimal128("0")
+		return zero, nil
+	}
+	return results[0].Value, nil
+}
@@ -0,0 +1,95 @@
+package mongodb
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Defaulter is implemented by models that fill their own defaults before Create
+type Defaulter interface {
+	SetDefaults()
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyDefaults fills zero-valued fields of item tagged with `mgdefault:"..."`
+// and calls SetDefaults if item implements Defaulter
+func applyDefaults(item any) error {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return nil
+	}
+
+	for _, f := range modelFields(v.Type()) {
+		def, ok := f.Tag.Lookup("mgdefault")
+		if !ok {
+			continue
+		}
+		field := fieldByIndex(v.Elem(), f.Index, true)
+		if !field.IsValid() || !field.CanSet() || !field.IsZero() {
+			continue
+		}
+		if field.Kind() == reflect.Pointer {
+			value := reflect.New(field.Type().Elem())
+			if err := setFromString(value.Elem(), def); err != nil {
+				return fmt.Errorf("failed to set default of %s: %s", f.Name, err)
+			}
+			field.Set(value)
+			continue
+		}
+		if err := setFromString(field, def); err != nil {
+			return fmt.Errorf("failed to set default of %s: %s", f.Name, err)
+		}
+	}
+
+	if defaulter, ok := item.(Defaulter); ok {
+		defaulter.SetDefaults()
+	}
+	return nil
+}
+
+// setFromString parses s according to the kind of v and stores it in v
+func setFromString(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported kind %s", v.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// hllPrecision is the number of index bits of HyperLogLog, 2^14 registers give about 0.8% standard error
+const hllPrecision = 14
+
+// HyperLogLog is a cardinality sketch of a fixed 16KB size. It is maintained incrementally
+// by Add, merged across shards or time ranges by Merge and persisted by MarshalBinary,
+// e.g. as a binary field of a summary document updated as items are created.
+type HyperLogLog struct {
+	registers []uint8
+}
+
+// NewHyperLogLog returns an empty sketch
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// Add adds value to the sketch, values are compared by their BSON encoding,
+// so an int32 and an int64 of the same number count as two values
+func (h *HyperLogLog) Add(value any) {
+	h.addHash(hashValue(refKey(value)))
+}
+
+func (h *HyperLogLog) addHash(hash uint64) {
+	index := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Merge adds the values of other to the sketch
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, rank := range other.registers {
+		if rank > h.registers[i] {
+			h.registers[i] = rank
+		}
+	}
+}
+
+// Count returns the estimated number of distinct values added
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.registers))
+	var sum float64
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// linear counting is more accurate for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// MarshalBinary returns the registers of the sketch
+func (h *HyperLogLog) MarshalBinary() ([]byte, error) {
+	return append([]byte(nil), h.registers...), nil
+}
+
+// UnmarshalBinary restores a sketch returned by MarshalBinary
+// if data is not a sketch, return err
+func (h *HyperLogLog) UnmarshalBinary(data []byte) error {
+	if len(data) != 1<<hllPrecision {
+		return fmt.Errorf("failed to unmarshal hyperloglog: %d bytes, expected %d", len(data), 1<<hllPrecision)
+	}
+	h.registers = append([]uint8(nil), data...)
+	return nil
+}
+
+// hashValue hashes a value key with FNV-1a and a 64 bit finalizer, so sketches are stable across processes
+func hashValue(key string) uint64 {
+	f := fnv.New64a()
+	_, _ = f.Write([]byte(key))
+	x := f.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// approxDistinctSample is the number of documents ApproxDistinct samples
+const approxDistinctSample = 100000
+
+// ApproxDistinct estimates the number of distinct values of field among items matched by sels
+// (logical AND) from a $sample of 100000 items, so its cost does not grow with the collection.
+// The count is exact when the collection is smaller than the sample, otherwise the sampled
+// values are scaled with the GEE estimator, whose error depends on how skewed the values are.
+// sels are applied to the sample, so very selective sels leave few items to estimate from.
+// Keep a DistinctSketch up to date on writes when a bounded error is needed.
+// Elements of array values are counted separately, like Distinct.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ApproxDistinct(ctx context.Context, field string, sels map[string]any) (_ uint64, err error) {
+	defer c.recoverPanic(ctx, "ApproxDistinct", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $sample) approx distinct")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $sample) approx distinct")
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+
+	total, err := c.reader().EstimatedDocumentCount(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// $sample first lets the server pick random documents instead of scanning the matches
+	cursor, err := c.reader().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sample", Value: bson.M{"size": approxDistinctSample}}},
+		{{Key: "$match", Value: filterFromSels(sels)}},
+		{{Key: "$project", Value: distinctProjection(field)}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	frequencies := map[string]int{}
+	path := strings.Split(field, ".")
+	for cursor.Next(ctx) {
+		value, err := cursor.Current.LookupErr(path...)
+		if err != nil {
+			continue
+		}
+		if value.Type == bsontype.Array {
+			elements, _ := value.Array().Values()
+			for _, element := range elements {
+				frequencies[refKey(element)]++
+			}
+			continue
+		}
+		frequencies[refKey(value)]++
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return 0, err
+	}
+	if total <= approxDistinctSample {
+		return uint64(len(frequencies)), nil
+	}
+	return estimateDistinct(frequencies, float64(total)/approxDistinctSample), nil
+}
+
+// estimateDistinct scales the distinct values of a sample holding 1/ratio of the population
+// with the GEE estimator: values seen once stand for sqrt(ratio) values each, the others for one
+func estimateDistinct(frequencies map[string]int, ratio float64) uint64 {
+	once := 0
+	for _, n := range frequencies {
+		if n == 1 {
+			once++
+		}
+	}
+	return uint64(math.Sqrt(ratio)*float64(once)+0.5) + uint64(len(frequencies)-once)
+}
+
+// distinctProjection projects only field
+func distinctProjection(field string) bson.D {
+	projection := bson.D{{Key: field, Value: 1}}
+	if field != "_id" {
+		projection = append(projection, bson.E{Key: "_id", Value: 0})
+	}
+	return projection
+}
+
+// DistinctSketch returns the HyperLogLog sketch of field values among items matched by sels,
+// to be kept up to date by adding the values of new items. It reads every matched item once,
+// so build it once and persist it (see HyperLogLog) rather than on each query.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) DistinctSketch(ctx context.Context, field string, sels map[string]any) (_ *HyperLogLog, err error) {
+	defer c.recoverPanic(ctx, "DistinctSketch", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter) distinct sketch")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter) distinct sketch")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	opts := profile.findOptions().SetProjection(distinctProjection(field)).SetBatchSize(10000)
+	cursor, err := c.reader().Find(ctx, filterFromSels(sels), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	sketch := NewHyperLogLog()
+	path := strings.Split(field, ".")
+	for cursor.Next(ctx) {
+		value, err := cursor.Current.LookupErr(path...)
+		if err != nil {
+			continue
+		}
+		if value.Type == bsontype.Array {
+			elements, _ := value.Array().Values()
+			for _, element := range elements {
+				sketch.Add(element)
+			}
+			continue
+		}
+		sketch.Add(value)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return sketch, nil
+}
@@ -0,0 +1,90 @@
+package mongodb
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLogCount(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10000, 200000} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			h := NewHyperLogLog()
+			for i := 0; i < n; i++ {
+				h.Add(fmt.Sprintf("value-%d", i))
+				// duplicates don't count
+				h.Add(fmt.Sprintf("value-%d", i))
+			}
+			got := float64(h.Count())
+			if diff := math.Abs(got - float64(n)); diff > 0.03*float64(n)+0.5 {
+				t.Errorf("Count() = %v, want %d within 3%%", got, n)
+			}
+		})
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, b := NewHyperLogLog(), NewHyperLogLog()
+	for i := 0; i < 6000; i++ {
+		a.Add(i)
+	}
+	for i := 4000; i < 10000; i++ {
+		b.Add(i)
+	}
+	a.Merge(b)
+	if got := float64(a.Count()); math.Abs(got-10000) > 300 {
+		t.Errorf("Count() after Merge = %v, want about 10000", got)
+	}
+}
+
+func TestHyperLogLogMarshalBinary(t *testing.T) {
+	h := NewHyperLogLog()
+	for i := 0; i < 1000; i++ {
+		h.Add(i)
+	}
+	data, err := h.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	restored := &HyperLogLog{}
+	if err = restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	if restored.Count() != h.Count() {
+		t.Errorf("restored Count() = %d, want %d", restored.Count(), h.Count())
+	}
+	if err = restored.UnmarshalBinary(data[:10]); err == nil {
+		t.Errorf("UnmarshalBinary(short) error = nil")
+	}
+}
+
+func TestHyperLogLogBSONTypes(t *testing.T) {
+	h := NewHyperLogLog()
+	h.Add(int32(1))
+	h.Add(int64(1))
+	h.Add("1")
+	if got := h.Count(); got != 3 {
+		t.Errorf("Count() = %d, want 3", got)
+	}
+}
+
+func TestEstimateDistinct(t *testing.T) {
+	tests := []struct {
+		name        string
+		frequencies map[string]int
+		ratio       float64
+		want        uint64
+	}{
+		{name: "empty", frequencies: map[string]int{}, ratio: 100, want: 0},
+		{name: "all repeated", frequencies: map[string]int{"a": 5, "b": 2}, ratio: 100, want: 2},
+		{name: "all once", frequencies: map[string]int{"a": 1, "b": 1, "c": 1, "d": 1}, ratio: 100, want: 40},
+		{name: "mixed", frequencies: map[string]int{"a": 1, "b": 3}, ratio: 4, want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := estimateDistinct(tt.frequencies, tt.ratio); got != tt.want {
+				t.Errorf("estimateDistinct() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package mongodb
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MaxBSONDocumentSize is the server limit of a stored document
+const MaxBSONDocumentSize = 16 * 1024 * 1024
+
+// documentSizeWarnRatio is the share of the limit above which writes are logged with their biggest fields
+const documentSizeWarnRatio = 0.9
+
+// documentSizeTopFields is the number of biggest fields reported
+const documentSizeTopFields = 5
+
+// FieldSize is the encoded size of a top level field of a document
+type FieldSize struct {
+	Name string
+	Size int
+}
+
+// DocumentTooLargeError is returned by Create and Update when the encoded item exceeds the size limit
+type DocumentTooLargeError struct {
+	Size  int
+	Limit int
+	// Fields are the biggest fields of the item, largest first
+	Fields []FieldSize
+}
+
+func (e *DocumentTooLargeError) Error() string {
+	return fmt.Sprintf("document of %d bytes exceeds the limit of %d bytes, biggest fields: %v", e.Size, e.Limit, e.Fields)
+}
+
+// WithDocumentSizeGuard checks the encoded size of items before Create and Update, rejecting items
+// over limit (MaxBSONDocumentSize when 0) with *DocumentTooLargeError instead of an opaque driver error,
+// and logging a warning with the biggest fields for items over 90% of it
+func WithDocumentSizeGuard(limit int) Option {
+	return func(o *ctrlOptions) {
+		if limit <= 0 || limit > MaxBSONDocumentSize {
+			limit = MaxBSONDocumentSize
+		}
+		o.maxDocumentSize = limit
+	}
+}
+
+// checkDocumentSize validates the size of the encoded document doc against the configured guard
+func (c *genericObjectDBCtrl[T]) checkDocumentSize(doc bson.Raw) error {
+	limit := c.opts.maxDocumentSize
+	if limit == 0 {
+		return nil
+	}
+	size := len(doc)
+	if size > limit {
+		return &DocumentTooLargeError{Size: size, Limit: limit, Fields: biggestFields(doc)}
+	}
+	if float64(size) > float64(limit)*documentSizeWarnRatio {
+		log.Warnf("DB WARN: document of %d bytes in %s is close to the limit of %d bytes, biggest fields: %v", size, c.db.Name(), limit, biggestFields(doc))
+	}
+	return nil
+}
+
+// biggestFields returns the largest top level fields of doc
+func biggestFields(doc bson.Raw) []FieldSize {
+	elements, err := doc.Elements()
+	if err != nil {
+		return nil
+	}
+	fields := make([]FieldSize, 0, len(elements))
+	for _, e := range elements {
+		fields = append(fields, FieldSize{Name: e.Key(), Size: len(e)})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Size > fields[j].Size })
+	if len(fields) > documentSizeTopFields {
+		fields = fields[:documentSizeTopFields]
+	}
+	return fields
+}
@@ -0,0 +1,305 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FieldDiff is a field differing between the primary and the secondary result of a DualRead,
+// values are relaxed extended JSON, "" for a missing field
+type FieldDiff struct {
+	Path      string `json:"path"`
+	Primary   string `json:"primary"`
+	Secondary string `json:"secondary"`
+}
+
+// DualReadMismatch is a read whose secondary result differs from the primary one
+type DualReadMismatch struct {
+	Op    string      `json:"op"`
+	Query any         `json:"query"`
+	Diffs []FieldDiff `json:"diffs"`
+}
+
+// DualReadStats counts the reads compared by a DualRead
+type DualReadStats struct {
+	Compared   int64 `json:"compared"`
+	Mismatched int64 `json:"mismatched"`
+	// SecondaryFailed reads failed on the secondary only and were not compared
+	SecondaryFailed int64 `json:"secondary_failed"`
+}
+
+// defaultDualReadTimeout bounds the secondary read of a DualRead
+const defaultDualReadTimeout = time.Second
+
+// DualRead is a Repository reading from both a primary and a secondary Repository, e.g. the old
+// and the new collection or cluster of a migration (see Migrator), comparing the results and
+// reporting mismatches with their field diffs. Results and errors are always the primary's and
+// returned without waiting for the secondary, which is read concurrently and compared in the
+// background; its failures and timeouts are only counted. Lists are compared by _id of their
+// items, so a different order is not a mismatch. Writes go to the primary only.
+type DualRead[T any] struct {
+	Repository[T]
+	// Timeout bounds the secondary read, a second by default
+	Timeout time.Duration
+
+	secondary  Repository[T]
+	onMismatch func(ctx context.Context, mismatch DualReadMismatch)
+
+	compared        atomic.Int64
+	mismatched      atomic.Int64
+	secondaryFailed atomic.Int64
+}
+
+// NewDualRead compares the reads of primary with secondary, onMismatch (optional) is called for
+// every mismatch, they are logged otherwise
+func NewDualRead[T any](primary Repository[T], secondary Repository[T], onMismatch func(ctx context.Context, mismatch DualReadMismatch)) *DualRead[T] {
+	if onMismatch == nil {
+		onMismatch = logMismatch
+	}
+	return &DualRead[T]{Repository: primary, Timeout: defaultDualReadTimeout, secondary: secondary, onMismatch: onMismatch}
+}
+
+func logMismatch(_ context.Context, mismatch DualReadMismatch) {
+	for _, diff := range mismatch.Diffs {
+		log.Warnf("DB WARN: dual read %s %v mismatch at %s: primary %s, secondary %s",
+			mismatch.Op, mismatch.Query, diff.Path, diff.Primary, diff.Secondary)
+	}
+}
+
+// Stats returns the comparison counts
+func (d *DualRead[T]) Stats() DualReadStats {
+	return DualReadStats{Compared: d.compared.Load(), Mismatched: d.mismatched.Load(), SecondaryFailed: d.secondaryFailed.Load()}
+}
+
+func (d *DualRead[T]) Get(ctx context.Context, id any) (*T, error) {
+	secondary := dualReadAsync(ctx, d.Timeout, func(ctx context.Context) (*T, error) { return d.secondary.Get(ctx, id) })
+	item, err := d.Repository.Get(ctx, id)
+	d.compare(ctx, "Get", id, optional(item), err, secondary)
+	return item, err
+}
+
+func (d *DualRead[T]) Find(ctx context.Context, q Query) (*T, error) {
+	secondary := dualReadAsync(ctx, d.Timeout, func(ctx context.Context) (*T, error) { return d.secondary.Find(ctx, q) })
+	item, err := d.Repository.Find(ctx, q)
+	d.compare(ctx, "Find", q, optional(item), err, secondary)
+	return item, err
+}
+
+func (d *DualRead[T]) List(ctx context.Context, q Query) ([]T, error) {
+	secondary := dualReadAsync(ctx, d.Timeout, func(ctx context.Context) ([]T, error) { return d.secondary.List(ctx, q) })
+	items, err := d.Repository.List(ctx, q)
+	d.compare(ctx, "List", q, items, err, secondary)
+	return items, err
+}
+
+func (d *DualRead[T]) Count(ctx context.Context, q Query) (int64, error) {
+	secondary := dualReadAsync(ctx, d.Timeout, func(ctx context.Context) (int64, error) { return d.secondary.Count(ctx, q) })
+	count, err := d.Repository.Count(ctx, q)
+	d.compare(ctx, "Count", q, count, err, secondary)
+	return count, err
+}
+
+// optional maps a missing item to nil so it compares as a missing value
+func optional[T any](item *T) any {
+	if item == nil {
+		return nil
+	}
+	return item
+}
+
+type dualReadResult struct {
+	value any
+	err   error
+}
+
+// dualReadAsync runs read concurrently, bounded by timeout but not canceled with ctx as the
+// comparison outlives the call, and returns the channel of its result
+func dualReadAsync[R any](ctx context.Context, timeout time.Duration, read func(ctx context.Context) (R, error)) <-chan dualReadResult {
+	result := make(chan dualReadResult, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+		defer cancel()
+		value, err := read(ctx)
+		result <- dualReadResult{value: value, err: err}
+	}()
+	return result
+}
+
+// compare reports a mismatch of the secondary result with the primary one in the background.
+// The primary result is encoded first, as the caller may modify it once it is returned.
+func (d *DualRead[T]) compare(ctx context.Context, op string, query any, value any, err error, secondary <-chan dualReadResult) {
+	notFound := func(err error) bool { return errors.Is(err, mongo.ErrNoDocuments) }
+	if err != nil && !notFound(err) {
+		return
+	}
+	primary, marshalErr := marshalResult(value)
+	if marshalErr != nil {
+		log.Warnf("DB WARN: failed to compare dual read %s: %s", op, marshalErr)
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		other := <-secondary
+		if p, ok := other.value.(*T); ok {
+			other.value = optional(p)
+		}
+		if other.err != nil && !notFound(other.err) {
+			d.secondaryFailed.Add(1)
+			log.Warnf("DB WARN: dual read %s failed on the secondary: %s", op, other.err)
+			return
+		}
+		d.compared.Add(1)
+		diffs, diffErr := diffValues(primary, other.value, op == "List")
+		if diffErr != nil {
+			log.Warnf("DB WARN: failed to compare dual read %s: %s", op, diffErr)
+			return
+		}
+		if len(diffs) > 0 {
+			d.mismatched.Add(1)
+			d.onMismatch(ctx, DualReadMismatch{Op: op, Query: query, Diffs: diffs})
+		}
+	}()
+}
+
+// diffValues returns the differing fields of the encoded primary result and the secondary one,
+// lists of items byID match their items by _id rather than by position
+func diffValues(primary bson.Raw, secondary any, byID bool) ([]FieldDiff, error) {
+	b, err := marshalResult(secondary)
+	if err != nil {
+		return nil, err
+	}
+	var diffs []FieldDiff
+	if byID && diffByID(primary.Lookup("v"), b.Lookup("v"), &diffs) {
+		return diffs, nil
+	}
+	diffRaw("", primary.Lookup("v"), b.Lookup("v"), &diffs)
+	return diffs, nil
+}
+
+// diffByID appends the differences of two arrays of items matched by _id, paths start with
+// [id], and reports false if an item has no _id
+func diffByID(a bson.RawValue, b bson.RawValue, diffs *[]FieldDiff) bool {
+	aItems, aOrder, ok := itemsByID(a)
+	if !ok {
+		return false
+	}
+	bItems, bOrder, ok := itemsByID(b)
+	if !ok {
+		return false
+	}
+	for _, key := range aOrder {
+		diffRaw("["+key+"]", aItems[key], bItems[key], diffs)
+	}
+	for _, key := range bOrder {
+		if _, ok := aItems[key]; !ok {
+			diffRaw("["+key+"]", bson.RawValue{}, bItems[key], diffs)
+		}
+	}
+	return true
+}
+
+// itemsByID returns the documents of array v by the relaxed extended JSON of their _id, in order
+func itemsByID(v bson.RawValue) (map[string]bson.RawValue, []string, bool) {
+	items := map[string]bson.RawValue{}
+	var order []string
+	if v.Type == 0 {
+		return items, order, true
+	}
+	array, ok := v.ArrayOK()
+	if !ok {
+		return nil, nil, false
+	}
+	values, err := array.Values()
+	if err != nil {
+		return nil, nil, false
+	}
+	for _, value := range values {
+		doc, ok := value.DocumentOK()
+		if !ok {
+			return nil, nil, false
+		}
+		id, err := doc.LookupErr("_id")
+		if err != nil {
+			return nil, nil, false
+		}
+		key := diffValue(id)
+		items[key] = value
+		order = append(order, key)
+	}
+	return items, order, true
+}
+
+// marshalResult wraps a result in a document so items, lists and counts compare alike
+func marshalResult(v any) (bson.Raw, error) {
+	if v == nil {
+		return bson.Marshal(bson.D{})
+	}
+	return bson.Marshal(bson.D{{Key: "v", Value: v}})
+}
+
+// diffRaw appends the differences of a and b at path, a zero value is a missing one
+func diffRaw(path string, a bson.RawValue, b bson.RawValue, diffs *[]FieldDiff) {
+	if a.Type == b.Type && bytes.Equal(a.Value, b.Value) {
+		return
+	}
+	aDoc, aIsDoc := rawContainer(a)
+	bDoc, bIsDoc := rawContainer(b)
+	if aIsDoc && bIsDoc && a.Type == b.Type {
+		keys := map[string]bool{}
+		var order []string
+		for _, doc := range []bson.Raw{aDoc, bDoc} {
+			elements, _ := doc.Elements()
+			for _, e := range elements {
+				if !keys[e.Key()] {
+					keys[e.Key()] = true
+					order = append(order, e.Key())
+				}
+			}
+		}
+		for _, key := range order {
+			child := path + "." + key
+			if a.Type == bson.TypeArray {
+				child = path + "[" + key + "]"
+			}
+			diffRaw(child, aDoc.Lookup(key), bDoc.Lookup(key), diffs)
+		}
+		return
+	}
+	*diffs = append(*diffs, FieldDiff{Path: trimPath(path), Primary: diffValue(a), Secondary: diffValue(b)})
+}
+
+func rawContainer(v bson.RawValue) (bson.Raw, bool) {
+	switch v.Type {
+	case bson.TypeEmbeddedDocument, bson.TypeArray:
+		return v.Value, true
+	}
+	return nil, false
+}
+
+func trimPath(path string) string {
+	if len(path) > 0 && path[0] == '.' {
+		return path[1:]
+	}
+	return path
+}
+
+func diffValue(v bson.RawValue) string {
+	if v.Type == 0 {
+		return ""
+	}
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, false, false)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	// strip the {"v": ...} wrapper
+	return strings.TrimSuffix(strings.TrimPrefix(string(data), `{"v":`), "}")
+}
@@ -0,0 +1,220 @@
+package mongodb
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// dumpFormatVersion is written into the archive header
+const dumpFormatVersion = 1
+
+// restoreBatchSize is the number of documents inserted per InsertMany on restore
+const restoreBatchSize = 1000
+
+// dumpRecord is one bson document of a dump archive:
+// a header, an index spec ("i") or a document ("d") of collection "c".
+// Tenant archives have the tenant id ("t") in the header and announce every collection
+// with its tenant field ("f") before its documents.
+type dumpRecord struct {
+	Version   int           `bson:"v,omitempty"`
+	Database  string        `bson:"db,omitempty"`
+	CreatedAt time.Time     `bson:"at,omitempty"`
+	Tenant    bson.RawValue `bson:"t,omitempty"`
+
+	Collection string   `bson:"c,omitempty"`
+	Field      string   `bson:"f,omitempty"`
+	Index      bson.Raw `bson:"i,omitempty"`
+	Document   bson.Raw `bson:"d,omitempty"`
+}
+
+// DumpDatabase writes all collections of db with their indexes to w as a stream of bson documents.
+// It is meant for pre-migration snapshots and local environment refreshes of modest databases,
+// not as an enterprise backup: there is no point-in-time consistency across collections.
+// if some failed, return err
+func DumpDatabase(ctx context.Context, db *mongo.Database, w io.Writer) error {
+	log.Debug("DB DEBUG: Started DumpDatabase")
+	defer log.Debug("DB DEBUG: finished DumpDatabase")
+
+	bw := bufio.NewWriter(w)
+	err := writeRecord(bw, dumpRecord{Version: dumpFormatVersion, Database: db.Name(), CreatedAt: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	names, err := db.ListCollectionNames(ctx, bson.M{"type": "collection", "name": bson.M{"$not": bson.M{"$regex": "^system\\."}}})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		err = dumpCollection(ctx, db.Collection(name), bw)
+		if err != nil {
+			return fmt.Errorf("failed to dump %s: %s", name, err)
+		}
+	}
+	return bw.Flush()
+}
+
+func dumpCollection(ctx context.Context, collection *mongo.Collection, w io.Writer) error {
+	indexes, err := collection.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(indexes))
+	for indexes.Next(ctx) {
+		if name, _ := indexes.Current.Lookup("name").StringValueOK(); name == "_id_" {
+			continue
+		}
+		err = writeRecord(w, dumpRecord{Collection: collection.Name(), Index: indexes.Current})
+		if err != nil {
+			return err
+		}
+	}
+
+	cursor, err := collection.Find(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(cursor))
+	for cursor.Next(ctx) {
+		err = writeRecord(w, dumpRecord{Collection: collection.Name(), Document: cursor.Current})
+		if err != nil {
+			return err
+		}
+	}
+	return cursorErr(ctx, cursor)
+}
+
+// RestoreDatabase restores an archive written by DumpDatabase into db.
+// Collections present in the archive are dropped before their documents are inserted.
+// if some failed, return err
+func RestoreDatabase(ctx context.Context, db *mongo.Database, r io.Reader) error {
+	log.Debug("DB DEBUG: Started RestoreDatabase")
+	defer log.Debug("DB DEBUG: finished RestoreDatabase")
+	if err := checkWritable(ctx); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	var header dumpRecord
+	err := readRecord(br, &header)
+	if err != nil {
+		return fmt.Errorf("failed to read archive header: %s", err)
+	}
+	if header.Version != dumpFormatVersion {
+		return fmt.Errorf("unsupported archive version %d", header.Version)
+	}
+	if header.Tenant.Type != 0 {
+		return fmt.Errorf("failed to restore: tenant archive, use ImportTenant")
+	}
+
+	dropped := map[string]bool{}
+	batches := map[string][]any{}
+	flush := func(name string) error {
+		if len(batches[name]) == 0 {
+			return nil
+		}
+		_, err := db.Collection(name).InsertMany(ctx, batches[name])
+		batches[name] = batches[name][:0]
+		return err
+	}
+
+	for {
+		var record dumpRecord
+		err = readRecord(br, &record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := record.Collection
+		if !dropped[name] {
+			if err = db.Collection(name).Drop(ctx); err != nil {
+				return err
+			}
+			dropped[name] = true
+		}
+
+		if record.Index != nil {
+			err = createIndexFromSpec(ctx, db, name, record.Index)
+			if err != nil {
+				return fmt.Errorf("failed to restore index of %s: %s", name, err)
+			}
+			continue
+		}
+		batches[name] = append(batches[name], record.Document)
+		if len(batches[name]) >= restoreBatchSize {
+			if err = flush(name); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name := range batches {
+		if err = flush(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createIndexFromSpec creates an index from a spec as returned by listIndexes
+func createIndexFromSpec(ctx context.Context, db *mongo.Database, collection string, spec bson.Raw) error {
+	var index bson.D
+	err := bson.Unmarshal(spec, &index)
+	if err != nil {
+		return err
+	}
+	cleaned := bson.D{}
+	for _, e := range index {
+		if e.Key != "v" && e.Key != "ns" {
+			cleaned = append(cleaned, e)
+		}
+	}
+	return db.RunCommand(ctx, bson.D{
+		{Key: "createIndexes", Value: collection},
+		{Key: "indexes", Value: bson.A{cleaned}},
+	}).Err()
+}
+
+func writeRecord(w io.Writer, record any) error {
+	data, err := bson.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readRecord reads one length-prefixed bson document from r and decodes it into record,
+// io.EOF is returned only when r ends between documents
+func readRecord(r io.Reader, record any) error {
+	var size [4]byte
+	_, err := io.ReadFull(r, size[:])
+	if err != nil {
+		return err
+	}
+	length := binary.LittleEndian.Uint32(size[:])
+	if length < 5 {
+		return fmt.Errorf("invalid bson document length %d", length)
+	}
+	data := make([]byte, length)
+	copy(data, size[:])
+	_, err = io.ReadFull(r, data[4:])
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return bson.Unmarshal(data, record)
+}
@@ -0,0 +1,241 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DuplicateGroup is a set of items sharing the values of the key fields
+type DuplicateGroup struct {
+	Key bson.M `bson:"_id"`
+	// IDs are the _id values of the items in ascending order
+	IDs   []any `bson:"ids"`
+	Count int64 `bson:"count"`
+}
+
+// MergeStrategy defines how MergeDocuments combines the fields of the merged items
+type MergeStrategy int
+
+const (
+	// MergeFillMissing keeps the fields of the kept item and takes fields it lacks or holds null in
+	// from the dropped items, earlier ones first
+	MergeFillMissing MergeStrategy = iota
+	// MergeOverwrite applies the fields of the dropped items over the kept item, later ones last
+	MergeOverwrite
+	// MergeKeepOnly keeps the kept item unchanged, only references are repointed
+	MergeKeepOnly
+)
+
+// MergeReport lists what MergeDocuments deleted and repointed
+type MergeReport struct {
+	Deleted int64
+	Entries []CascadeEntry
+}
+
+// FindDuplicates returns the groups of items with equal values of keyFields, largest groups first.
+// Items lacking a key field group under null for it.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) FindDuplicates(ctx context.Context, keyFields ...string) (_ []DuplicateGroup, err error) {
+	defer c.recoverPanic(ctx, "FindDuplicates", &err)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $group) duplicates")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $group) duplicates")
+	if len(keyFields) == 0 {
+		return nil, fmt.Errorf("failed to find duplicates: no key fields")
+	}
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+
+	key := bson.D{}
+	for _, field := range keyFields {
+		key = append(key, bson.E{Key: field, Value: "$" + field})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: key},
+			{Key: "ids", Value: bson.M{"$push": "$_id"}},
+			{Key: "count", Value: bson.M{"$sum": 1}},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}}}},
+	}
+	cursor, err := c.reader().Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	groups := []DuplicateGroup{}
+	err = cursor.All(ctx, &groups)
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// MergeDocuments merges the items dropIDs into the item keepID by strategy, deletes them and
+// repoints the references of the dependents declared with WithDependents from them to keepID,
+// inside one transaction (requires a replica set). Only scalar reference fields are repointed.
+// if keepID is one of dropIDs, return ErrInvalidQuery
+// if keepID or one of dropIDs does not exist, return *NotFoundError
+// if one of them is checked out by another holder, return ErrLocked, if it is fenced off, return ErrFenced
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) MergeDocuments(ctx context.Context, keepID any, dropIDs []any, strategy MergeStrategy) (_ *MergeReport, err error) {
+	defer c.recoverPanic(ctx, "MergeDocuments", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	log.Debug("DB DEBUG: Started c.MergeDocuments")
+	defer log.Debug("DB DEBUG: finished c.MergeDocuments")
+	keepID = c.internalID(keepID)
+	dropIDs = c.internalID(dropIDs).([]any)
+	for _, id := range dropIDs {
+		if refKey(id) == refKey(keepID) {
+			return nil, errors.Wrapf(ErrInvalidQuery, "kept item %v is also dropped", keepID)
+		}
+	}
+	if err = c.requireFeature(FeatureTransactions); err != nil {
+		return nil, err
+	}
+
+	session, err := c.db.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		keep, err := c.db.FindOne(sc, bson.M{"_id": keepID}).Raw()
+		if err == mongo.ErrNoDocuments {
+			return nil, &NotFoundError{Collection: c.db.Name(), ID: keepID}
+		}
+		if err != nil {
+			return nil, err
+		}
+		merged, err := rawToD(keep)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range dropIDs {
+			drop, err := c.db.FindOne(sc, bson.M{"_id": id}).Raw()
+			if err == mongo.ErrNoDocuments {
+				return nil, &NotFoundError{Collection: c.db.Name(), ID: id}
+			}
+			if err != nil {
+				return nil, err
+			}
+			merged, err = mergeFields(merged, drop, strategy)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		report := &MergeReport{}
+		// dropped items go first, so unique indexes accept their values on the kept item
+		res, err := c.db.DeleteMany(sc, c.writeFilter(sc, bson.D{{Key: "_id", Value: bson.M{"$in": dropIDs}}}))
+		if err != nil {
+			return nil, err
+		}
+		if res.DeletedCount < int64(len(dropIDs)) {
+			for _, id := range dropIDs {
+				if err = c.writeConflict(sc, id); err != nil {
+					return nil, err
+				}
+			}
+		}
+		report.Deleted = res.DeletedCount
+		if strategy != MergeKeepOnly {
+			res, err := c.db.ReplaceOne(sc, c.writeFilter(sc, bson.D{{Key: "_id", Value: keepID}}), c.stampFenceD(merged))
+			if err != nil {
+				return nil, err
+			}
+			if res.MatchedCount == 0 {
+				if err = c.writeConflict(sc, keepID); err != nil {
+					return nil, err
+				}
+				return nil, &NotFoundError{Collection: c.db.Name(), ID: keepID}
+			}
+		}
+
+		db := c.db.Database()
+		for _, dep := range c.opts.dependents {
+			res, err := db.Collection(dep.Collection).UpdateMany(sc,
+				bson.M{dep.Field: bson.M{"$in": dropIDs}},
+				bson.M{"$set": bson.M{dep.Field: keepID}})
+			if err != nil {
+				return nil, err
+			}
+			report.Entries = append(report.Entries, CascadeEntry{Dependent: dep, Affected: res.ModifiedCount})
+		}
+		return report, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// files offloaded by the dropped items are not part of the transaction
+	for _, id := range dropIDs {
+		if err = c.removeOffloaded(ctx, id); err != nil {
+			log.Warnf("DB WARN: failed to remove offloaded files of merged item %v: %s", id, err)
+		}
+	}
+	return result.(*MergeReport), nil
+}
+
+// mergeFields merges the top level fields of drop into merged by strategy, _id is kept
+func mergeFields(merged bson.D, drop bson.Raw, strategy MergeStrategy) (bson.D, error) {
+	if strategy == MergeKeepOnly {
+		return merged, nil
+	}
+	elements, err := drop.Elements()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range elements {
+		key, value := e.Key(), e.Value()
+		if key == "_id" {
+			continue
+		}
+		i := indexOfKey(merged, key)
+		switch {
+		case i < 0:
+			merged = append(merged, bson.E{Key: key, Value: value})
+		case strategy == MergeOverwrite:
+			merged[i].Value = value
+		case isNullValue(merged[i].Value) && value.Type != bsontype.Null:
+			merged[i].Value = value
+		}
+	}
+	return merged, nil
+}
+
+func indexOfKey(d bson.D, key string) int {
+	for i, e := range d {
+		if e.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func isNullValue(v any) bool {
+	raw, ok := v.(bson.RawValue)
+	return v == nil || ok && raw.Type == bsontype.Null
+}
+
+// rawToD returns the top level fields of doc as a bson.D of raw values
+func rawToD(doc bson.Raw) (bson.D, error) {
+	elements, err := doc.Elements()
+	if err != nil {
+		return nil, err
+	}
+	d := make(bson.D, 0, len(elements))
+	for _, e := range elements {
+		d = append(d, bson.E{Key: e.Key(), Value: e.Value()})
+	}
+	return d, nil
+}
@@ -0,0 +1,163 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// keyEscaper escapes the characters map keys can't hold in dot paths, keyUnescaper reverts it
+var (
+	keyEscaper   = strings.NewReplacer("%", "%25", ".", "%2E", "$", "%24")
+	keyUnescaper = strings.NewReplacer("%2E", ".", "%24", "$", "%25", "%")
+)
+
+// EscapeKey escapes "." and "$" of a dynamic map key, so it is one element of a dot path.
+// Store keys of attribute maps escaped (see EscapeKeys) to query them by AttrPath.
+func EscapeKey(key string) string {
+	return keyEscaper.Replace(key)
+}
+
+// UnescapeKey reverts EscapeKey
+func UnescapeKey(key string) string {
+	return keyUnescaper.Replace(key)
+}
+
+// EscapeKeys returns a copy of m with escaped keys, see EscapeKey
+func EscapeKeys[V any](m map[string]V) map[string]V {
+	escaped := make(map[string]V, len(m))
+	for k, v := range m {
+		escaped[EscapeKey(k)] = v
+	}
+	return escaped
+}
+
+// UnescapeKeys returns a copy of m with unescaped keys, see UnescapeKey
+func UnescapeKeys[V any](m map[string]V) map[string]V {
+	unescaped := make(map[string]V, len(m))
+	for k, v := range m {
+		unescaped[UnescapeKey(k)] = v
+	}
+	return unescaped
+}
+
+// AttrPath returns the dot path of key in the attribute map field
+func AttrPath(field string, key string) string {
+	return field + "." + EscapeKey(key)
+}
+
+// AttrFilter returns a selector matching items whose attribute key of map field equals value
+func AttrFilter(field string, key string, value any) map[string]any {
+	return map[string]any{AttrPath(field, key): value}
+}
+
+// SetAttrs sets attributes of the map field of the item by id, keys are escaped.
+// It goes through UpdateAttributes, so hooks, timestamps and versions apply.
+// if field is not a map field of T, return err
+// if not found, return mongo.ErrNoDocuments
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) SetAttrs(ctx context.Context, id any, field string, attrs map[string]any) (err error) {
+	defer c.recoverPanic(ctx, "SetAttrs", &err)
+	err = checkDynamicField[T](field)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]any, len(attrs))
+	for k, v := range attrs {
+		set[AttrPath(field, k)] = v
+	}
+	result, err := c.UpdateAttributesDetailed(c.nested(ctx), map[string]any{"_id": id}, set)
+	if err != nil {
+		return err
+	}
+	if result.Matched == 0 && writeBufferFrom(ctx) == nil {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// UnsetAttrs removes attributes keys of the map field of the item by id, keys are escaped.
+// It goes through UpdateAttributes, so hooks, timestamps and versions apply.
+// if field is not a map field of T, return err
+// if not found, return mongo.ErrNoDocuments
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) UnsetAttrs(ctx context.Context, id any, field string, keys ...string) (err error) {
+	defer c.recoverPanic(ctx, "UnsetAttrs", &err)
+	err = checkDynamicField[T](field)
+	if err != nil {
+		return err
+	}
+	unset := make([]string, 0, len(keys))
+	for _, key := range keys {
+		unset = append(unset, AttrPath(field, key))
+	}
+	result, err := c.updateAttributes(ctx, map[string]any{"_id": id}, map[string]any{}, unset)
+	if err != nil {
+		return err
+	}
+	if result.Matched == 0 && writeBufferFrom(ctx) == nil {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// GetAttr loads only the attribute key of the map field of the item by id into V
+// if the item or attribute is missing, return false
+// if some failed, return err
+func GetAttr[T any, V any](ctx context.Context, c *genericObjectDBCtrl[T], id any, field string, key string) (V, bool, error) {
+	log.Debug("DB DEBUG: Started c.db.FindOne(ctx, filter) attr")
+	defer log.Debug("DB DEBUG: finished c.db.FindOne(ctx, filter) attr")
+	var value V
+	err := checkDynamicField[T](field)
+	if err != nil {
+		return value, false, err
+	}
+	id = c.internalID(id)
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	path := AttrPath(field, key)
+	raw, err := c.reader().FindOne(ctx, bson.D{{Key: "_id", Value: id}}, profile.findOneOptions().SetProjection(bson.M{path: 1})).Raw()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, err
+	}
+	attr, err := raw.LookupErr(field, EscapeKey(key))
+	if err != nil {
+		return value, false, nil
+	}
+	err = attr.Unmarshal(&value)
+	if err != nil {
+		return value, false, fmt.Errorf("failed to decode %s: %s", path, err)
+	}
+	return value, true, nil
+}
+
+// EnsureAttrIndex creates the wildcard index (see WildcardIndex) serving AttrFilter queries on the map field
+// if field is not a map field of T, return err
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) EnsureAttrIndex(ctx context.Context, field string) (err error) {
+	defer c.recoverPanic(ctx, "EnsureAttrIndex", &err)
+	err = checkDynamicField[T](field)
+	if err != nil {
+		return err
+	}
+	return c.EnsureIndexes(c.nested(ctx), WildcardIndex(field))
+}
+
+// checkDynamicField returns an error if field is not a map field of T
+func checkDynamicField[T any](field string) error {
+	for _, name := range dynamicFields[T]() {
+		if name == field {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to address attributes of %s: not a map field", field)
+}
@@ -0,0 +1,39 @@
+package mongodb
+
+import "testing"
+
+func TestEscapeKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "plain", want: "plain"},
+		{key: "a.b", want: "a%2Eb"},
+		{key: "$price", want: "%24price"},
+		{key: "100%", want: "100%25"},
+		{key: "%2E", want: "%252E"},
+		{key: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got := EscapeKey(tt.key)
+			if got != tt.want {
+				t.Errorf("EscapeKey(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+			if back := UnescapeKey(got); back != tt.key {
+				t.Errorf("UnescapeKey(%q) = %q, want %q", got, back, tt.key)
+			}
+		})
+	}
+}
+
+func TestEscapeKeys(t *testing.T) {
+	m := map[string]int{"a.b": 1, "c": 2}
+	escaped := EscapeKeys(m)
+	if escaped["a%2Eb"] != 1 || escaped["c"] != 2 || len(escaped) != 2 {
+		t.Errorf("EscapeKeys() = %v", escaped)
+	}
+	if back := UnescapeKeys(escaped); back["a.b"] != 1 || len(back) != 2 {
+		t.Errorf("UnescapeKeys() = %v", back)
+	}
+}
@@ -0,0 +1,148 @@
+package mongodb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bson binary subtype and dtype of packed float32 vectors
+const (
+	binaryVectorSubtype = 0x09
+	float32VectorDType  = 0x27
+)
+
+// Embedding is a vector stored as an array of doubles, usable both by Atlas $vectorSearch
+// and by the exact VectorSearch fallback.
+// Fields can be tagged with `mgdim:"N"` to reject vectors of another dimension on writes.
+type Embedding []float32
+
+// PackedEmbedding is a vector stored compactly as a bson binary vector (float32),
+// taking half the space of Embedding. Only Atlas $vectorSearch can query it.
+type PackedEmbedding []float32
+
+// DimensionError is returned when a vector does not match the dimension declared with `mgdim`
+type DimensionError struct {
+	Field string
+	Got   int
+	Want  int
+}
+
+func (e *DimensionError) Error() string {
+	return fmt.Sprintf("field %s has vector of dimension %d, want %d", e.Field, e.Got, e.Want)
+}
+
+func (e Embedding) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	values := make(bson.A, len(e))
+	for i, x := range e {
+		values[i] = float64(x)
+	}
+	return bson.MarshalValue(values)
+}
+
+func (e *Embedding) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	values, err := unmarshalVector(t, data)
+	if err != nil {
+		return err
+	}
+	*e = values
+	return nil
+}
+
+func (e PackedEmbedding) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	data := make([]byte, 2+4*len(e))
+	data[0] = float32VectorDType
+	for i, x := range e {
+		binary.LittleEndian.PutUint32(data[2+4*i:], math.Float32bits(x))
+	}
+	return bson.MarshalValue(primitive.Binary{Subtype: binaryVectorSubtype, Data: data})
+}
+
+func (e *PackedEmbedding) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	values, err := unmarshalVector(t, data)
+	if err != nil {
+		return err
+	}
+	*e = values
+	return nil
+}
+
+// unmarshalVector decodes both numeric arrays and packed float32 binary vectors
+func unmarshalVector(t bsontype.Type, data []byte) ([]float32, error) {
+	raw := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bsontype.Null:
+		return nil, nil
+	case bsontype.Array:
+		elems, err := raw.Array().Values()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]float32, len(elems))
+		for i, elem := range elems {
+			switch elem.Type {
+			case bsontype.Double:
+				values[i] = float32(elem.Double())
+			case bsontype.Int32:
+				values[i] = float32(elem.Int32())
+			case bsontype.Int64:
+				values[i] = float32(elem.Int64())
+			default:
+				return nil, fmt.Errorf("vector element %d is %s, not a number", i, elem.Type)
+			}
+		}
+		return values, nil
+	case bsontype.Binary:
+		subtype, bin := raw.Binary()
+		if subtype != binaryVectorSubtype || len(bin) < 2 || bin[0] != float32VectorDType || (len(bin)-2)%4 != 0 {
+			return nil, fmt.Errorf("binary subtype %d is not a float32 vector", subtype)
+		}
+		values := make([]float32, (len(bin)-2)/4)
+		for i := range values {
+			values[i] = math.Float32frombits(binary.LittleEndian.Uint32(bin[2+4*i:]))
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("cannot decode %s into a vector", t)
+}
+
+// checkDimension validates the length of v against the `mgdim` tag of f
+func checkDimension(f modelField, v reflect.Value) error {
+	tag, ok := f.Tag.Lookup("mgdim")
+	if !ok {
+		return nil
+	}
+	want, err := strconv.Atoi(tag)
+	if err != nil {
+		return fmt.Errorf("invalid mgdim tag of %s: %s", f.Name, err)
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice || v.Len() == 0 {
+		return nil
+	}
+	if v.Len() != want {
+		return &DimensionError{Field: f.BSONName, Got: v.Len(), Want: want}
+	}
+	return nil
+}
+
+// declaredDimension returns the `mgdim` dimension of the T field stored under bsonName
+func declaredDimension[T any](bsonName string) (modelField, bool) {
+	for _, f := range modelFields(reflect.TypeOf((*T)(nil))) {
+		if _, ok := f.Tag.Lookup("mgdim"); ok && f.BSONName == bsonName {
+			return f, true
+		}
+	}
+	return modelField{}, false
+}
@@ -0,0 +1,145 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErasureMode defines how EraseSubject erases the documents of a subject
+type ErasureMode int
+
+const (
+	// ErasureDelete deletes the documents
+	ErasureDelete ErasureMode = iota
+	// ErasureAnonymize rewrites the fields listed in ErasureTarget.Anonymize
+	ErasureAnonymize
+)
+
+// ErasureTarget is a collection holding documents of data subjects
+type ErasureTarget struct {
+	Collection *mongo.Collection
+	// SubjectField overrides the subject field passed to EraseSubject for this collection
+	SubjectField string
+	Mode         ErasureMode
+	// Anonymize maps dotted paths to their anonymizers for ErasureAnonymize
+	Anonymize map[string]AnonymizeFunc
+}
+
+// ErasureEntry reports the erased documents of one collection
+type ErasureEntry struct {
+	Collection string `bson:"collection"`
+	Deleted    int64  `bson:"deleted"`
+	Anonymized int64  `bson:"anonymized"`
+}
+
+// ErasureReport is the record of an erasure kept for compliance
+type ErasureReport struct {
+	SubjectField string         `bson:"subject_field"`
+	SubjectID    any            `bson:"subject_id"`
+	ErasedAt     time.Time      `bson:"erased_at"`
+	Entries      []ErasureEntry `bson:"entries"`
+}
+
+// Eraser erases data subjects across a registered set of collections (GDPR right to erasure)
+type Eraser struct {
+	client  *mongo.Client
+	mu      sync.RWMutex
+	targets []ErasureTarget
+}
+
+// NewEraser creates an Eraser running its transactions on client
+func NewEraser(client *mongo.Client) *Eraser {
+	return &Eraser{client: client}
+}
+
+// Register adds collections to erase subjects from
+func (e *Eraser) Register(targets ...ErasureTarget) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.targets = append(e.targets, targets...)
+}
+
+// ErasureTarget returns the controller collection as a target for Eraser.Register
+func (c *genericObjectDBCtrl[T]) ErasureTarget(mode ErasureMode, anonymize map[string]AnonymizeFunc) ErasureTarget {
+	return ErasureTarget{Collection: c.db, Mode: mode, Anonymize: anonymize}
+}
+
+// EraseSubject deletes or anonymizes documents with subjectField equal to subjectID in all registered
+// collections inside one transaction (requires a replica set) and returns the erasure report
+// if some failed, nothing is erased and err is returned
+func (e *Eraser) EraseSubject(ctx context.Context, subjectField string, subjectID any) (*ErasureReport, error) {
+	log.Debug("DB DEBUG: Started e.EraseSubject")
+	defer log.Debug("DB DEBUG: finished e.EraseSubject")
+
+	e.mu.RLock()
+	targets := append([]ErasureTarget(nil), e.targets...)
+	e.mu.RUnlock()
+	for _, target := range targets {
+		err := requireCompat(target.Collection.Database(), target.Collection.Name(), FeatureTransactions)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	session, err := e.client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		report := &ErasureReport{SubjectField: subjectField, SubjectID: subjectID, ErasedAt: time.Now()}
+		for _, target := range targets {
+			field := subjectField
+			if target.SubjectField != "" {
+				field = target.SubjectField
+			}
+			entry, err := eraseIn(sc, target, bson.M{field: subjectID})
+			if err != nil {
+				return nil, err
+			}
+			report.Entries = append(report.Entries, entry)
+		}
+		return report, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*ErasureReport), nil
+}
+
+func eraseIn(ctx context.Context, target ErasureTarget, filter bson.M) (ErasureEntry, error) {
+	entry := ErasureEntry{Collection: target.Collection.Name()}
+	if target.Mode == ErasureDelete {
+		result, err := target.Collection.DeleteMany(ctx, filter)
+		if err != nil {
+			return entry, err
+		}
+		entry.Deleted = result.DeletedCount
+		return entry, nil
+	}
+
+	cursor, err := target.Collection.Find(ctx, filter)
+	if err != nil {
+		return entry, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	anonymize := Anonymize(target.Anonymize)
+	for cursor.Next(ctx) {
+		doc, err := applyTransformers(cursor.Current, []Transformer{anonymize})
+		if err != nil {
+			return entry, err
+		}
+		_, err = target.Collection.ReplaceOne(ctx, bson.M{"_id": cursor.Current.Lookup("_id")}, doc)
+		if err != nil {
+			return entry, err
+		}
+		entry.Anonymized++
+	}
+	return entry, cursorErr(ctx, cursor)
+}
@@ -0,0 +1,186 @@
+package mongodb
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrorCode is a stable machine-readable code of a package error
+type ErrorCode string
+
+const (
+	CodeNotFound     ErrorCode = "MGC-NOT-FOUND"
+	CodeDupKey       ErrorCode = "MGC-DUP-KEY"
+	CodeConflict     ErrorCode = "MGC-CONFLICT"
+	CodePrecondition ErrorCode = "MGC-PRECONDITION"
+	CodeValidation   ErrorCode = "MGC-VALIDATION"
+	CodeTimeout      ErrorCode = "MGC-TIMEOUT"
+	CodeCanceled     ErrorCode = "MGC-CANCELED"
+	CodeUnavailable  ErrorCode = "MGC-UNAVAILABLE"
+	CodeIntegrity    ErrorCode = "MGC-INTEGRITY"
+	CodeForbidden    ErrorCode = "MGC-FORBIDDEN"
+	CodeInternal     ErrorCode = "MGC-INTERNAL"
+)
+
+// Coder is implemented by errors carrying their own code, it takes precedence in CodeOf
+type Coder interface {
+	Code() ErrorCode
+}
+
+// CodeOf classifies err, returns an empty code for nil and CodeInternal for unknown errors
+func CodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	}
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.Code()
+	}
+
+	var enumErr *EnumError
+	var immutableErr *ImmutableFieldError
+	var dimensionErr *DimensionError
+	var sizeErr *DocumentTooLargeError
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return CodeNotFound
+	case errors.Is(err, ErrAlreadyExists), mongo.IsDuplicateKeyError(err):
+		return CodeDupKey
+	case errors.Is(err, ErrConflict), errors.Is(err, ErrStillReferenced), errors.Is(err, ErrFenced),
+		errors.Is(err, ErrLocked):
+		return CodeConflict
+	case errors.Is(err, ErrPreconditionFailed):
+		return CodePrecondition
+	case errors.As(err, &enumErr), errors.As(err, &immutableErr), errors.As(err, &dimensionErr), errors.As(err, &sizeErr),
+		errors.Is(err, ErrInvalidQuery), errors.Is(err, ErrMissingReference), errors.Is(err, ErrTenantMismatch):
+		return CodeValidation
+	case errors.Is(err, ErrBudgetExceeded):
+		return CodeTimeout
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded), mongo.IsTimeout(err):
+		return CodeTimeout
+	case mongo.IsNetworkError(err), errors.Is(err, mongo.ErrClientDisconnected), errors.Is(err, ErrReadOnly):
+		return CodeUnavailable
+	case errors.Is(err, ErrChecksumMismatch):
+		return CodeIntegrity
+	case errors.Is(err, ErrForbidden):
+		return CodeForbidden
+	}
+	return CodeInternal
+}
+
+// httpStatuses maps codes to HTTP status codes
+var httpStatuses = map[ErrorCode]int{
+	CodeNotFound:     http.StatusNotFound,
+	CodeDupKey:       http.StatusConflict,
+	CodeConflict:     http.StatusConflict,
+	CodePrecondition: http.StatusPreconditionFailed,
+	CodeValidation:   http.StatusUnprocessableEntity,
+	CodeTimeout:      http.StatusGatewayTimeout,
+	CodeCanceled:     499, // client closed request
+	CodeUnavailable:  http.StatusServiceUnavailable,
+	CodeForbidden:    http.StatusForbidden,
+	CodeIntegrity:    http.StatusInternalServerError,
+	CodeInternal:     http.StatusInternalServerError,
+}
+
+// gRPC status codes as defined by google.golang.org/grpc/codes
+const (
+	grpcCanceled           = 1
+	grpcUnknown            = 2
+	grpcInvalidArgument    = 3
+	grpcDeadlineExceeded   = 4
+	grpcNotFound           = 5
+	grpcAlreadyExists      = 6
+	grpcPermissionDenied   = 7
+	grpcFailedPrecondition = 9
+	grpcAborted            = 10
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcDataLoss           = 15
+)
+
+// grpcCodes maps codes to gRPC status codes
+var grpcCodes = map[ErrorCode]uint32{
+	CodeNotFound:     grpcNotFound,
+	CodeDupKey:       grpcAlreadyExists,
+	CodeConflict:     grpcAborted,
+	CodePrecondition: grpcFailedPrecondition,
+	CodeValidation:   grpcInvalidArgument,
+	CodeTimeout:      grpcDeadlineExceeded,
+	CodeCanceled:     grpcCanceled,
+	CodeUnavailable:  grpcUnavailable,
+	CodeForbidden:    grpcPermissionDenied,
+	CodeIntegrity:    grpcDataLoss,
+	CodeInternal:     grpcInternal,
+}
+
+// HTTPStatus returns the HTTP status code for err, 200 for nil
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if status, ok := httpStatuses[CodeOf(err)]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode returns the gRPC status code for err (convert with codes.Code(GRPCCode(err))), 0 (OK) for nil
+func GRPCCode(err error) uint32 {
+	if err == nil {
+		return 0
+	}
+	if code, ok := grpcCodes[CodeOf(err)]; ok {
+		return code
+	}
+	return grpcUnknown
+}
+
+var (
+	messagesMu sync.RWMutex
+	// messages is the catalog of user facing messages by code and language
+	messages = map[ErrorCode]map[string]string{
+		CodeNotFound:     {"en": "The requested item was not found.", "ru": "Запрошенный объект не найден."},
+		CodeDupKey:       {"en": "An item with the same key already exists.", "ru": "Объект с таким ключом уже существует."},
+		CodeConflict:     {"en": "The item was changed by someone else, reload and retry.", "ru": "Объект был изменён другим пользователем, обновите и повторите."},
+		CodePrecondition: {"en": "The item was changed since it was read, reload and retry.", "ru": "Объект изменился после чтения, обновите и повторите."},
+		CodeValidation:   {"en": "The item contains invalid values.", "ru": "Объект содержит недопустимые значения."},
+		CodeTimeout:      {"en": "The database did not respond in time.", "ru": "База данных не ответила вовремя."},
+		CodeCanceled:     {"en": "The request was canceled.", "ru": "Запрос был отменён."},
+		CodeUnavailable:  {"en": "The database is temporarily unavailable.", "ru": "База данных временно недоступна."},
+		CodeForbidden:    {"en": "You are not allowed to perform this operation.", "ru": "У вас нет прав на выполнение этой операции."},
+		CodeIntegrity:    {"en": "The data is corrupted.", "ru": "Данные повреждены."},
+		CodeInternal:     {"en": "Internal database error.", "ru": "Внутренняя ошибка базы данных."},
+	}
+)
+
+// RegisterMessage adds or replaces the message of code in language lang
+func RegisterMessage(code ErrorCode, lang string, message string) {
+	messagesMu.Lock()
+	defer messagesMu.Unlock()
+	if messages[code] == nil {
+		messages[code] = map[string]string{}
+	}
+	messages[code][lang] = message
+}
+
+// Message returns the user facing message of err in language lang, falling back to English,
+// empty for nil. Details of err are not included, log err itself for them.
+func Message(err error, lang string) string {
+	if err == nil {
+		return ""
+	}
+	code := CodeOf(err)
+	messagesMu.RLock()
+	defer messagesMu.RUnlock()
+	if msg, ok := messages[code][lang]; ok {
+		return msg
+	}
+	return messages[code]["en"]
+}
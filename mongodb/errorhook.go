@@ -0,0 +1,44 @@
+package mongodb
+
+import "context"
+
+// ErrorHook is called with every failed controller or Repository call, op is the method name
+// (e.g. "Get"). A non-nil returned error replaces err, so a hook can attach request metadata or
+// translate messages, hooks only observing failures (e.g. counting them) return err or nil.
+type ErrorHook func(ctx context.Context, op string, err error) error
+
+// WithErrorHook sets the hook applied to failures of the controller's methods and of its
+// Repository, see ErrorHook. It runs once per call, including for *NotFoundError and *PanicError;
+// a method implemented by calling others of the same controller reports the failure as its own.
+func WithErrorHook(hook ErrorHook) Option {
+	return func(o *ctrlOptions) {
+		o.errorHook = hook
+	}
+}
+
+// errorHookKey marks the context of a method called by another method of the same controller,
+// which applies the ErrorHook to the failure instead
+type errorHookKey struct{}
+
+// nested returns ctx for calling another method of c on behalf of the current one
+func (c *genericObjectDBCtrl[T]) nested(ctx context.Context) context.Context {
+	return context.WithValue(ctx, errorHookKey{}, c)
+}
+
+// onError applies the ErrorHook of the controller to the failure of op in *err
+func (c *genericObjectDBCtrl[T]) onError(ctx context.Context, op string, err *error) {
+	if *err == nil || c.opts.errorHook == nil {
+		return
+	}
+	if caller, _ := ctx.Value(errorHookKey{}).(*genericObjectDBCtrl[T]); caller == c {
+		return
+	}
+	if hooked := c.opts.errorHook(ctx, op, *err); hooked != nil {
+		*err = hooked
+	}
+}
+
+// onError applies the ErrorHook of the controller to the failure of the Repository call op in *err
+func (r *repository[T]) onError(ctx context.Context, op string, err *error) {
+	r.c.onError(ctx, op, err)
+}
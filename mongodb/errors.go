@@ -0,0 +1,24 @@
+package mongodb
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ErrAlreadyExists is returned when an item with the same unique key already exists
+var ErrAlreadyExists = errors.New("item already exists")
+
+// AlreadyExistsError carries the conflicting key values of a duplicate item
+// errors.Is(err, ErrAlreadyExists) reports true for it
+type AlreadyExistsError struct {
+	Key map[string]any
+}
+
+func (e *AlreadyExistsError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrAlreadyExists, e.Key)
+}
+
+func (e *AlreadyExistsError) Unwrap() error {
+	return ErrAlreadyExists
+}
@@ -0,0 +1,127 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrPreconditionFailed is returned by UpdateIfMatch when the item changed since the ETag was issued
+var ErrPreconditionFailed = errors.New("precondition failed: item was modified")
+
+// ETag returns the entity tag of item derived from its integer Version field,
+// or from its UpdatedAt field when it has no version. Empty when the model has neither.
+// Note: Update bumps Version only with ConcurrencyVersion, UpdateIfMatch always does.
+func ETag[T any](item *T) string {
+	if field := reflect.ValueOf(item).Elem().FieldByName("Version"); field.IsValid() && field.CanInt() {
+		return fmt.Sprintf(`"v%d"`, field.Int())
+	}
+	if updatedAt, ok := getTimestamp(item, "UpdatedAt"); ok {
+		// stored dates have millisecond precision
+		return fmt.Sprintf(`"t%d"`, updatedAt.UnixMilli())
+	}
+	return ""
+}
+
+// etagFilter returns the filter condition matching the state of an item of T etag was issued for,
+// "*" matches any state
+func etagFilter[T any](etag string) (bson.D, error) {
+	etag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(etag), "W/"), `"`)
+	if etag == "*" {
+		return bson.D{}, nil
+	}
+	if len(etag) < 2 {
+		return nil, fmt.Errorf("failed to parse etag %q", etag)
+	}
+	n, err := strconv.ParseInt(etag[1:], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse etag %q: %s", etag, err)
+	}
+	switch etag[0] {
+	case 'v':
+		return bson.D{{Key: versionKey[T](), Value: n}}, nil
+	case 't':
+		return bson.D{{Key: updatedAtKey[T](), Value: time.UnixMilli(n)}}, nil
+	}
+	return nil, fmt.Errorf("failed to parse etag %q", etag)
+}
+
+// UpdateIfMatch updates attributes attrs of the item identified by id only if it is still in the state
+// etag (see ETag, typically the If-Match header) was issued for, the version is incremented
+// if the item changed, return ErrPreconditionFailed
+// if the item does not exist, return mongo.ErrNoDocuments
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) UpdateIfMatch(ctx context.Context, id any, etag string, attrs map[string]any) (err error) {
+	defer c.recoverPanic(ctx, "UpdateIfMatch", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return err
+	}
+	id = c.internalID(id)
+	log.Debug("DB DEBUG: Started c.db.UpdateOne if match")
+	defer log.Debug("DB DEBUG: finished c.db.UpdateOne if match")
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+
+	condition, err := etagFilter[T](etag)
+	if err != nil {
+		return err
+	}
+	err = validateAttrs[T](attrs)
+	if err != nil {
+		return err
+	}
+	err = checkImmutable[T](attrs)
+	if err != nil {
+		return err
+	}
+	err = c.checkForeignKeyAttrs(ctx, attrs)
+	if err != nil {
+		return err
+	}
+
+	var update bson.M
+	attrs[updatedAtKey[T]()] = time.Now()
+	dataByte, err := c.marshal(attrs)
+	if err != nil {
+		return err
+	}
+	err = bson.Unmarshal(dataByte, &update)
+	if err != nil {
+		return err
+	}
+	c.stampFence(update)
+	modifier := bson.D{{Key: "$set", Value: update}}
+	if reflect.ValueOf(new(T)).Elem().FieldByName("Version").CanInt() {
+		modifier = append(modifier, bson.E{Key: "$inc", Value: bson.M{versionKey[T](): 1}})
+	}
+
+	filter := c.writeFilter(ctx, append(bson.D{{Key: "_id", Value: id}}, condition...))
+	result, err := c.db.UpdateOne(ctx, filter, modifier)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	if err = c.writeConflict(ctx, id); err != nil {
+		return err
+	}
+	count, err := c.db.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrPreconditionFailed
+	}
+	// a stale etag is expected, only a missing item hints at a wrong id
+	c.lintWrite(ctx, "UpdateIfMatch", filter, 0, 0)
+	return mongo.ErrNoDocuments
+}
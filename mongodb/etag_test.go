@@ -0,0 +1,90 @@
+package mongodb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestEtagFilter(t *testing.T) {
+	type model struct {
+		Version   int       `bson:"version"`
+		UpdatedAt time.Time `bson:"updated_at"`
+	}
+	tests := []struct {
+		etag    string
+		want    bson.D
+		invalid bool
+	}{
+		{etag: `"v3"`, want: bson.D{{Key: "version", Value: int64(3)}}},
+		{etag: `W/"v3"`, want: bson.D{{Key: "version", Value: int64(3)}}},
+		{etag: ` "v12" `, want: bson.D{{Key: "version", Value: int64(12)}}},
+		{etag: `"t1700000000123"`, want: bson.D{{Key: "updated_at", Value: time.UnixMilli(1700000000123)}}},
+		{etag: `*`, want: bson.D{}},
+		{etag: `"*"`, want: bson.D{}},
+		{etag: `""`, invalid: true},
+		{etag: `"v"`, invalid: true},
+		{etag: `"vx"`, invalid: true},
+		{etag: `"x3"`, invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.etag, func(t *testing.T) {
+			got, err := etagFilter[model](tt.etag)
+			if (err != nil) != tt.invalid {
+				t.Fatalf("etagFilter(%s) error = %v, invalid %v", tt.etag, err, tt.invalid)
+			}
+			if !tt.invalid && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("etagFilter(%s) = %v, want %v", tt.etag, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEtagFilterKeys(t *testing.T) {
+	type Audit struct {
+		Version   int       `bson:"rev"`
+		UpdatedAt time.Time `bson:"modified"`
+	}
+	type model struct {
+		Audit Audit `bson:"audit"`
+	}
+	type embedded struct {
+		Audit `bson:"audit"`
+	}
+	if got, _ := etagFilter[Audit](`"v3"`); !reflect.DeepEqual(got, bson.D{{Key: "rev", Value: int64(3)}}) {
+		t.Errorf("etagFilter[Audit](v3) = %v", got)
+	}
+	if got, _ := etagFilter[Audit](`"t1700000000123"`); !reflect.DeepEqual(got, bson.D{{Key: "modified", Value: time.UnixMilli(1700000000123)}}) {
+		t.Errorf("etagFilter[Audit](t) = %v", got)
+	}
+	if got, _ := etagFilter[model](`"v3"`); !reflect.DeepEqual(got, bson.D{{Key: "version", Value: int64(3)}}) {
+		t.Errorf("etagFilter[model](v3) = %v", got)
+	}
+	if got := versionKey[embedded](); got != "audit.rev" {
+		t.Errorf("versionKey[embedded]() = %s", got)
+	}
+}
+
+func TestETag(t *testing.T) {
+	type versioned struct {
+		Version int
+	}
+	type timestamped struct {
+		UpdatedAt time.Time
+	}
+	type plain struct {
+		Name string
+	}
+	updatedAt := time.UnixMilli(1700000000123)
+	if got := ETag(&versioned{Version: 3}); got != `"v3"` {
+		t.Errorf("ETag(versioned) = %s", got)
+	}
+	if got := ETag(&timestamped{UpdatedAt: updatedAt}); got != `"t1700000000123"` {
+		t.Errorf("ETag(timestamped) = %s", got)
+	}
+	if got := ETag(&plain{}); got != "" {
+		t.Errorf("ETag(plain) = %s", got)
+	}
+}
@@ -0,0 +1,124 @@
+package mongodb
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// existsManyBatchSize is the number of values per query of ExistsMany, keeping $in well below
+// the command size limit
+const existsManyBatchSize = 10000
+
+// ExistsMany returns the values of values some item has in keyField (a dot path), in the order of
+// values, so imports can tell new records from existing ones in one query per 10000 values
+// instead of an Exists per record. Numbers match regardless of their type, other values by their
+// BSON encoding. keyField may cross arrays of documents, e.g. "items.sku". The primary is read, so
+// items created just before are found. Prefer an index on keyField for the query to be covered.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ExistsMany(ctx context.Context, keyField string, values []any) (_ []any, err error) {
+	defer c.recoverPanic(ctx, "ExistsMany", &err)
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter) exists many")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter) exists many")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	existing := []any{}
+	if len(values) == 0 {
+		return existing, nil
+	}
+	keys := make([]any, len(values))
+	for i, value := range values {
+		keys[i] = value
+		if keyField == "_id" {
+			keys[i] = c.internalID(value)
+		}
+	}
+
+	path := strings.Split(keyField, ".")
+	projection := bson.M{keyField: 1}
+	if keyField != "_id" {
+		projection["_id"] = 0
+	}
+	found := map[string]bool{}
+	for start := 0; start < len(keys); start += existsManyBatchSize {
+		end := min(start+existsManyBatchSize, len(keys))
+		filter := bson.M{keyField: bson.M{"$in": keys[start:end]}}
+		// dedupe must see the latest writes, a lagging secondary would report them as new
+		cursor, err := c.db.Find(ctx, filter, profile.findOptions().SetProjection(projection))
+		if err != nil {
+			return nil, err
+		}
+		trackCursor(cursor)
+		for cursor.Next(ctx) {
+			doc := bson.RawValue{Type: bsontype.EmbeddedDocument, Value: cursor.Current}
+			for _, value := range pathValues(doc, path) {
+				found[existsKey(value)] = true
+			}
+		}
+		err = cursorErr(ctx, cursor)
+		closeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, key := range keys {
+		t, data, err := bson.MarshalValue(key)
+		if err != nil {
+			return nil, err
+		}
+		if found[existsKey(bson.RawValue{Type: t, Value: data})] {
+			existing = append(existing, values[i])
+		}
+	}
+	return existing, nil
+}
+
+// existsKey returns the key of v in ExistsMany, numbers of any type with the same value are equal
+func existsKey(v bson.RawValue) string {
+	if bsonTypeRank(v.Type) == 2 {
+		return "n" + strconv.FormatFloat(rawNumber(v), 'g', -1, 64)
+	}
+	return string(rune(v.Type)) + string(v.Value)
+}
+
+// pathValues returns the values at path below v the way queries resolve dot paths: arrays of
+// documents on the way are searched element by element, or indexed by a numeric path element,
+// and an array at the end contributes its elements as well as itself
+func pathValues(v bson.RawValue, path []string) []bson.RawValue {
+	if len(path) == 0 {
+		if v.Type != bsontype.Array {
+			return []bson.RawValue{v}
+		}
+		elements, _ := v.Array().Values()
+		return append(elements, v)
+	}
+	switch v.Type {
+	case bsontype.EmbeddedDocument:
+		next, err := v.Document().LookupErr(path[0])
+		if err != nil {
+			return nil
+		}
+		return pathValues(next, path[1:])
+	case bsontype.Array:
+		var values []bson.RawValue
+		if _, err := strconv.Atoi(path[0]); err == nil {
+			if next, err := v.Array().LookupErr(path[0]); err == nil {
+				values = pathValues(next, path[1:])
+			}
+		}
+		elements, _ := v.Array().Values()
+		for _, element := range elements {
+			if element.Type == bsontype.EmbeddedDocument {
+				values = append(values, pathValues(element, path)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
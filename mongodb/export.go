@@ -0,0 +1,202 @@
+package mongodb
+
+import (
+	"context"
+	"io"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// importBatchSize is the number of documents inserted per InsertMany on import
+const importBatchSize = 1000
+
+// ExportOption configures Export and Import
+type ExportOption func(*exportOptions)
+
+type exportOptions struct {
+	key          []byte
+	transformers []Transformer
+	format       Format
+}
+
+func newExportOptions(opts []ExportOption) exportOptions {
+	o := exportOptions{format: FormatNDJSON}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithEncryption AES-GCM encrypts the exported stream with key (16, 24 or 32 bytes) and appends
+// an integrity checksum. Import with the same option decrypts and verifies it.
+func WithEncryption(key []byte) ExportOption {
+	return func(o *exportOptions) {
+		o.key = key
+	}
+}
+
+// Export writes items identified by sels to w as newline delimited canonical extended JSON
+// or in the format of WithFormat
+// if some failed, return the number of exported items and err
+func (c *genericObjectDBCtrl[T]) Export(ctx context.Context, w io.Writer, sels map[string]any, opts ...ExportOption) (count int64, err error) {
+	defer c.recoverPanic(ctx, "Export", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.Export")
+	defer log.Debug("DB DEBUG: finished c.Export")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	o := newExportOptions(opts)
+	if o.key != nil {
+		encrypted, err := NewEncryptWriter(w, o.key)
+		if err != nil {
+			return 0, err
+		}
+		// the final checksum chunk is written only after a complete export, so Import rejects
+		// a failed one as truncated
+		defer func() {
+			if err == nil {
+				err = encrypted.Close()
+			}
+		}()
+		w = encrypted
+	}
+	enc := o.format.NewEncoder(w)
+
+	cursor, err := c.reader().Find(ctx, filterFromSels(sels), profile.findOptions())
+	if err != nil {
+		return 0, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	for cursor.Next(ctx) {
+		doc := cursor.Current
+		if len(o.transformers) > 0 {
+			transformed, err := applyTransformers(cursor.Current, o.transformers)
+			if err != nil {
+				return count, err
+			}
+			doc, err = bson.Marshal(transformed)
+			if err != nil {
+				return count, err
+			}
+		}
+		if err = enc.Encode(doc); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return count, err
+	}
+	return count, enc.Flush()
+}
+
+// Import inserts items read from r in the format written by Export, see WithFormat
+// if some failed, return the number of imported items and err
+func (c *genericObjectDBCtrl[T]) Import(ctx context.Context, r io.Reader, opts ...ExportOption) (_ int64, err error) {
+	defer c.recoverPanic(ctx, "Import", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return 0, err
+	}
+	log.Debug("DB DEBUG: Started c.Import")
+	defer log.Debug("DB DEBUG: finished c.Import")
+
+	o := newExportOptions(opts)
+	if o.key != nil {
+		decrypted, err := NewDecryptReader(r, o.key)
+		if err != nil {
+			return 0, err
+		}
+		r = decrypted
+	}
+
+	var count int64
+	batch := make([]any, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := c.db.InsertMany(ctx, batch)
+		if result != nil {
+			count += int64(len(result.InsertedIDs))
+		}
+		batch = batch[:0]
+		return err
+	}
+
+	dec := o.format.NewDecoder(r)
+	for {
+		doc, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		batch = append(batch, doc)
+		if len(batch) >= importBatchSize {
+			if err = flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, flush()
+}
+
+// CopyTo copies items identified by sels into dst, passing them through the transformers of
+// WithTransform, e.g. to share pseudonymized production data with staging
+// if some failed, return the number of copied items and err
+func (c *genericObjectDBCtrl[T]) CopyTo(ctx context.Context, dst *mongo.Collection, sels map[string]any, opts ...ExportOption) (_ int64, err error) {
+	defer c.recoverPanic(ctx, "CopyTo", &err)
+	sels = c.internalSels(sels)
+	if err = checkWritable(ctx); err != nil {
+		return 0, err
+	}
+	log.Debug("DB DEBUG: Started c.CopyTo")
+	defer log.Debug("DB DEBUG: finished c.CopyTo")
+
+	o := newExportOptions(opts)
+	cursor, err := c.db.Find(ctx, filterFromSels(sels))
+	if err != nil {
+		return 0, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	var count int64
+	batch := make([]any, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		result, err := dst.InsertMany(ctx, batch)
+		if result != nil {
+			count += int64(len(result.InsertedIDs))
+		}
+		batch = batch[:0]
+		return err
+	}
+	for cursor.Next(ctx) {
+		var doc any = cursor.Current
+		if len(o.transformers) > 0 {
+			doc, err = applyTransformers(cursor.Current, o.transformers)
+			if err != nil {
+				return count, err
+			}
+		} else {
+			doc = bson.Raw(append([]byte(nil), cursor.Current...))
+		}
+		batch = append(batch, doc)
+		if len(batch) >= importBatchSize {
+			if err = flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return count, err
+	}
+	return count, flush()
+}
@@ -0,0 +1,44 @@
+package mongodb
+
+import (
+	"bytes"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MarshalExtJSON marshals an item, a Page or a slice of items to MongoDB extended JSON,
+// preserving ObjectIDs, dates and Decimal128 that encoding/json loses.
+// canonical selects canonical mode, which keeps numeric types exact,
+// otherwise relaxed mode is used, which is friendlier to JSON consumers.
+func MarshalExtJSON(v any, canonical bool) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return bson.MarshalExtJSON(v, canonical, false)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		item, err := bson.MarshalExtJSON(rv.Index(i).Interface(), canonical, false)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(item)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalExtJSON unmarshals extended JSON produced by MarshalExtJSON into an item or a Page
+func UnmarshalExtJSON(data []byte, canonical bool, v any) error {
+	return bson.UnmarshalExtJSON(data, canonical, v)
+}
+
+// MarshalExtJSON marshals the page to relaxed or canonical extended JSON
+func (p *Page[T]) MarshalExtJSON(canonical bool) ([]byte, error) {
+	return MarshalExtJSON(p, canonical)
+}
@@ -0,0 +1,246 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// featureFlagCollection stores feature flags
+const featureFlagCollection = "_feature_flags"
+
+// featureFlagRetry is the pause before the flag change stream is reopened after a failure
+const featureFlagRetry = 5 * time.Second
+
+// Flag is a feature flag document
+type Flag struct {
+	Key     string `bson:"_id" json:"key"`
+	Enabled bool   `bson:"enabled" json:"enabled"`
+	// Percentage of subjects the flag is enabled for, 0 and 100 enable it for everybody
+	Percentage int `bson:"percentage" json:"percentage"`
+	// Value is the typed payload of the flag, read with FlagValue
+	Value     bson.RawValue `bson:"value,omitempty" json:"-"`
+	UpdatedAt time.Time     `bson:"updated_at" json:"updated_at"`
+}
+
+// Validate checks the rollout percentage
+func (f *Flag) Validate() error {
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return fmt.Errorf("flag %s has percentage %d, allowed range: 0-100", f.Key, f.Percentage)
+	}
+	return nil
+}
+
+// FeatureFlags serves flags from an in-process cache invalidated by a change stream on the flag collection.
+// Without change streams (see WithCompatibility) flags are read from the collection on every Get.
+type FeatureFlags struct {
+	ctrl *genericObjectDBCtrl[Flag]
+
+	mu    sync.RWMutex
+	cache map[string]*Flag
+	// generation counts invalidations, a flag read before one is not stored
+	generation uint64
+	// watching is false while the cache can't be invalidated, flags are not stored then
+	watching bool
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewFeatureFlags creates FeatureFlags storing flags in the database feature flags collection
+// and starts watching the collection, call Close to stop it
+func NewFeatureFlags(db *mongo.Database) *FeatureFlags {
+	ctx, stop := context.WithCancel(context.Background())
+	f := &FeatureFlags{
+		ctrl:  NewGenericObjectDBCtrl[Flag](db.Collection(featureFlagCollection)),
+		cache: map[string]*Flag{},
+		stop:  stop,
+		done:  make(chan struct{}),
+	}
+	if err := requireCompat(db, featureFlagCollection, FeatureChangeStreams); err != nil {
+		log.Warnf("DB WARN: feature flags are not cached: %s", err)
+		close(f.done)
+		return f
+	}
+	go f.watch(ctx)
+	return f
+}
+
+// Close stops watching the flag collection
+func (f *FeatureFlags) Close() {
+	f.stop()
+	<-f.done
+}
+
+// Get returns the flag key, a missing flag is returned disabled
+// if some failed, return err
+func (f *FeatureFlags) Get(ctx context.Context, key string) (*Flag, error) {
+	f.mu.RLock()
+	flag, ok := f.cache[key]
+	generation := f.generation
+	f.mu.RUnlock()
+	if ok {
+		return flag, nil
+	}
+
+	flag, err := f.ctrl.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+		flag = &Flag{Key: key}
+	}
+	f.mu.Lock()
+	if f.watching && f.generation == generation {
+		f.cache[key] = flag
+	}
+	f.mu.Unlock()
+	return flag, nil
+}
+
+// Enabled reports whether the flag key is enabled for subject (e.g. a user id).
+// With a percentage rollout a subject is consistently in or out of the rollout.
+// if some failed, return err
+func (f *FeatureFlags) Enabled(ctx context.Context, key string, subject string) (bool, error) {
+	flag, err := f.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if !flag.Enabled {
+		return false, nil
+	}
+	if flag.Percentage <= 0 || flag.Percentage >= 100 {
+		return true, nil
+	}
+	return rolloutBucket(key, subject) < flag.Percentage, nil
+}
+
+// Set creates or replaces the flag
+// if some failed, return err
+func (f *FeatureFlags) Set(ctx context.Context, flag *Flag) error {
+	result, err := f.ctrl.UpdateDetailed(ctx, flag.Key, flag)
+	if err != nil {
+		return err
+	}
+	if result.Matched == 0 {
+		_, err = f.ctrl.CreateDetailed(ctx, flag)
+		if err != nil {
+			return err
+		}
+	}
+	f.invalidate(flag.Key)
+	return nil
+}
+
+// SetValue creates or replaces the flag key with the typed value
+// if some failed, return err
+func (f *FeatureFlags) SetValue(ctx context.Context, key string, enabled bool, value any) error {
+	t, data, err := bson.MarshalValue(value)
+	if err != nil {
+		return err
+	}
+	return f.Set(ctx, &Flag{Key: key, Enabled: enabled, Value: bson.RawValue{Type: t, Value: data}})
+}
+
+// Delete deletes the flag key
+// if some failed, return err
+func (f *FeatureFlags) Delete(ctx context.Context, key string) error {
+	err := f.ctrl.Delete(ctx, key)
+	if err != nil {
+		return err
+	}
+	f.invalidate(key)
+	return nil
+}
+
+// FlagValue returns the typed value of the flag key, def if the flag is missing, disabled or has no value
+// if some failed, return err
+func FlagValue[V any](ctx context.Context, f *FeatureFlags, key string, def V) (V, error) {
+	flag, err := f.Get(ctx, key)
+	if err != nil {
+		return def, err
+	}
+	if !flag.Enabled || flag.Value.Type == 0 {
+		return def, nil
+	}
+	var value V
+	err = flag.Value.Unmarshal(&value)
+	if err != nil {
+		return def, err
+	}
+	return value, nil
+}
+
+func (f *FeatureFlags) invalidate(key string) {
+	f.mu.Lock()
+	f.generation++
+	delete(f.cache, key)
+	f.mu.Unlock()
+}
+
+// reset drops the cache, flags are cached afterwards only if watching
+func (f *FeatureFlags) reset(watching bool) {
+	f.mu.Lock()
+	f.generation++
+	f.watching = watching
+	f.cache = map[string]*Flag{}
+	f.mu.Unlock()
+}
+
+// watch invalidates cached flags on changes, the cache is dropped and not filled while the
+// stream is down, so stale flags are never served
+func (f *FeatureFlags) watch(ctx context.Context) {
+	defer close(f.done)
+	for {
+		err := f.watchOnce(ctx)
+		f.reset(false)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnf("DB WARN: feature flags change stream failed: %s", err)
+		if sleepCtx(ctx, featureFlagRetry) != nil {
+			return
+		}
+	}
+}
+
+func (f *FeatureFlags) watchOnce(ctx context.Context) error {
+	stream, err := f.ctrl.db.Watch(ctx, mongo.Pipeline{}, options.ChangeStream())
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+	// changes before the stream was opened may be cached already
+	f.reset(true)
+
+	for stream.Next(ctx) {
+		var event struct {
+			DocumentKey struct {
+				ID string `bson:"_id"`
+			} `bson:"documentKey"`
+		}
+		if err = stream.Decode(&event); err != nil || event.DocumentKey.ID == "" {
+			f.reset(true)
+			continue
+		}
+		f.invalidate(event.DocumentKey.ID)
+	}
+	return stream.Err()
+}
+
+// rolloutBucket maps subject to a stable bucket in [0, 100) per flag
+func rolloutBucket(key string, subject string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(subject))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,90 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// WithCausalReads binds a causally consistent session of client to the returned context. Reads made
+// with it, e.g. by Feed from secondaries, wait for the cluster time of the writes made with it before,
+// so users immediately see their own new posts. after (optional, see OperationTime) carries the
+// consistency point over from a previous request. end must be called when the context is done.
+// Note: the session must not be used by concurrent operations.
+// if some failed, return err
+func WithCausalReads(ctx context.Context, client *mongo.Client, after *primitive.Timestamp) (context.Context, func(), error) {
+	session, err := client.StartSession(options.Session().
+		SetCausalConsistency(true).
+		SetDefaultReadConcern(readconcern.Majority()).
+		SetDefaultWriteConcern(writeconcern.Majority()))
+	if err != nil {
+		return nil, nil, err
+	}
+	if after != nil {
+		err = session.AdvanceOperationTime(after)
+		if err != nil {
+			session.EndSession(ctx)
+			return nil, nil, err
+		}
+	}
+	return mongo.NewSessionContext(ctx, session), func() { session.EndSession(context.Background()) }, nil
+}
+
+// OperationTime returns the operation time of the last operation of the causal session of ctx,
+// to be passed to WithCausalReads of a later request, nil without a session
+func OperationTime(ctx context.Context) *primitive.Timestamp {
+	session := mongo.SessionFromContext(ctx)
+	if session == nil {
+		return nil
+	}
+	return session.OperationTime()
+}
+
+// Feed lists up to limit items by sels filter (logical AND) ordered by sort from a secondary when available,
+// with majority read concern. Within a context of WithCausalReads the read includes the writes made before.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) Feed(ctx context.Context, sels map[string]any, sort bson.D, limit int64) (_ []T, err error) {
+	defer c.recoverPanic(ctx, "Feed", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter) feed")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter) feed")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	collection, err := c.db.Clone(options.Collection().
+		SetReadPreference(readpref.SecondaryPreferred()).
+		SetReadConcern(readconcern.Majority()))
+	if err != nil {
+		return nil, err
+	}
+	opts := profile.findOptions().SetSort(NormalizeSort(sort))
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := collection.Find(ctx, filterFromSels(sels), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	results := []T{}
+	for cursor.Next(ctx) {
+		var result T
+		err = c.decodeItem(ctx, cursor.Current, &result)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,180 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// fenceCollection stores the current generation of every fence
+const fenceCollection = "_fences"
+
+// fenceKey is the item field holding the generation of the fenced instance that last wrote it
+const fenceKey = "_fence"
+
+// defaultFenceRefresh is how long a Fence trusts the generation it read
+const defaultFenceRefresh = time.Second
+
+// ErrFenced is returned by writes of an instance whose deployment generation was superseded
+var ErrFenced = errors.New("deployment generation fenced")
+
+// Fence guards writes by deployment generation: the new deployment of a blue/green cutover calls
+// Promote, after which writes of instances of older generations fail with ErrFenced, so stale
+// instances can't clobber data. Fenced controllers stamp the items they write with their
+// generation and their writes only match items not stamped by a newer one, so an item written
+// after the cutover is never overwritten by a stale instance, checked by the server within the
+// write. Writes of other items are rejected once the current generation read from a control
+// document is newer, which is trusted for Refresh and bounds how long a stale instance keeps
+// writing them after the cutover.
+type Fence struct {
+	db         *mongo.Collection
+	name       string
+	generation int64
+	// Refresh is how long the current generation read is trusted, a second by default
+	Refresh time.Duration
+
+	mu      sync.Mutex
+	current int64
+	checked time.Time
+}
+
+// NewFence creates the fence name of this instance of deployment generation (e.g. a build number
+// or a deploy timestamp, increasing with every deployment), stored in the fences collection of db
+func NewFence(db *mongo.Database, name string, generation int64) *Fence {
+	return &Fence{
+		db:         db.Collection(fenceCollection),
+		name:       name,
+		generation: generation,
+		Refresh:    defaultFenceRefresh,
+	}
+}
+
+// Promote makes the generation of this instance current unless a newer one already is
+// if some failed, return err
+func (f *Fence) Promote(ctx context.Context) error {
+	_, err := f.db.UpdateOne(ctx,
+		bson.M{"_id": f.name},
+		bson.M{"$max": bson.M{"generation": f.generation}, "$set": bson.M{"updated_at": time.Now()}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	log.Infof("DB INFO: fence %s promoted to generation %d", f.name, f.generation)
+	f.mu.Lock()
+	f.checked = time.Time{}
+	f.mu.Unlock()
+	return nil
+}
+
+// Check returns ErrFenced if a newer generation than this instance is current
+// if some failed, return err
+func (f *Fence) Check(ctx context.Context) error {
+	f.mu.Lock()
+	fresh := time.Since(f.checked) < f.Refresh
+	current := f.current
+	f.mu.Unlock()
+	if !fresh {
+		var doc struct {
+			Generation int64 `bson:"generation"`
+		}
+		err := f.db.FindOne(ctx, bson.M{"_id": f.name}).Decode(&doc)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+		current = doc.Generation
+		f.mu.Lock()
+		f.current, f.checked = current, time.Now()
+		f.mu.Unlock()
+	}
+	if current > f.generation {
+		return errors.Wrapf(ErrFenced, "%s generation %d superseded by %d", f.name, f.generation, current)
+	}
+	return nil
+}
+
+// WithFence makes controller writes fail with ErrFenced once fence is superseded. Create, Update,
+// UpdateAttributes, UpdateIfMatch and pipeline updates stamp the items with the generation of fence,
+// and they and deletes by id or filter skip items stamped by a newer generation, see Fence.
+func WithFence(fence *Fence) Option {
+	return func(o *ctrlOptions) {
+		o.fence = fence
+	}
+}
+
+// guardWrite rejects writes in read-only mode (see SetReadOnly) and of fenced instances
+func (c *genericObjectDBCtrl[T]) guardWrite(ctx context.Context) error {
+	if err := checkWritable(ctx); err != nil {
+		return err
+	}
+	if c.opts.fence != nil {
+		return c.opts.fence.Check(ctx)
+	}
+	return nil
+}
+
+// fenceFilter adds the WithFence condition to the filter of a write: the item was not written by a newer generation
+func (c *genericObjectDBCtrl[T]) fenceFilter(filter bson.D) bson.D {
+	if c.opts.fence == nil {
+		return filter
+	}
+	return append(filter, bson.E{Key: fenceKey, Value: bson.M{"$not": bson.M{"$gt": c.opts.fence.generation}}})
+}
+
+// stampFence sets the generation of the WithFence fence in the $set document of an update
+func (c *genericObjectDBCtrl[T]) stampFence(update bson.M) {
+	if c.opts.fence != nil {
+		update[fenceKey] = c.opts.fence.generation
+	}
+}
+
+// stampFenceDoc sets the generation of the WithFence fence in a document to insert
+func (c *genericObjectDBCtrl[T]) stampFenceDoc(doc bson.Raw) (bson.Raw, error) {
+	if c.opts.fence == nil {
+		return doc, nil
+	}
+	d, err := rawToD(doc)
+	if err != nil {
+		return nil, err
+	}
+	return c.marshal(c.stampFenceD(d))
+}
+
+// stampFenceD sets the generation of the WithFence fence in a replacement document
+func (c *genericObjectDBCtrl[T]) stampFenceD(d bson.D) bson.D {
+	if c.opts.fence == nil {
+		return d
+	}
+	if i := indexOfKey(d, fenceKey); i >= 0 {
+		d[i].Value = c.opts.fence.generation
+		return d
+	}
+	return append(d, bson.E{Key: fenceKey, Value: c.opts.fence.generation})
+}
+
+// fenceConflict returns ErrFenced if a newer generation than the WithFence one wrote the item by internal id
+func (c *genericObjectDBCtrl[T]) fenceConflict(ctx context.Context, id any) error {
+	if c.opts.fence == nil {
+		return nil
+	}
+	var doc struct {
+		Generation int64 `bson:"_fence"`
+	}
+	err := c.db.FindOne(ctx, bson.M{"_id": id}, options.FindOne().SetProjection(bson.M{fenceKey: 1})).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if doc.Generation > c.opts.fence.generation {
+		f := c.opts.fence
+		return errors.Wrapf(ErrFenced, "%v written by %s generation %d, this is %d", id, f.name, doc.Generation, f.generation)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package mongodb
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrMissingReference is returned by writes setting a foreign key to an _id that does not exist
+var ErrMissingReference = errors.New("referenced document does not exist")
+
+// ErrStillReferenced is returned by deletes of items a CascadeRestrict dependent still references
+var ErrStillReferenced = errors.New("document is still referenced")
+
+// ForeignKey declares that Field of the controller items holds _id values of documents of
+// Collection in the same database, a single value or an array of them
+type ForeignKey struct {
+	Field      string
+	Collection string
+}
+
+// WithForeignKeys makes Create, CreateManySkipDuplicates, Update, UpdateAttributes, UpdateAttributesBatched
+// and UpdateIfMatch check that the documents referenced by the foreign keys exist (ErrMissingReference),
+// null and missing fields are allowed.
+// The check runs before the write outside of a transaction, so a referenced document deleted
+// concurrently is not detected. Blocking deletes of referenced items is declared on the referenced
+// controller with a CascadeRestrict dependent.
+func WithForeignKeys(keys ...ForeignKey) Option {
+	return func(o *ctrlOptions) {
+		o.foreignKeys = append(o.foreignKeys, keys...)
+	}
+}
+
+// checkForeignKeys checks the foreign keys set in doc
+func (c *genericObjectDBCtrl[T]) checkForeignKeys(ctx context.Context, doc bson.Raw) error {
+	for _, key := range c.opts.foreignKeys {
+		value, err := doc.LookupErr(strings.Split(key.Field, ".")...)
+		if err != nil {
+			continue
+		}
+		err = c.checkForeignKey(ctx, key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkForeignKeyAttrs checks the foreign keys set by attrs of UpdateAttributes
+func (c *genericObjectDBCtrl[T]) checkForeignKeyAttrs(ctx context.Context, attrs map[string]any) error {
+	for _, key := range c.opts.foreignKeys {
+		value, ok := attrs[key.Field]
+		if !ok {
+			continue
+		}
+		t, data, err := bson.MarshalValue(value)
+		if err != nil {
+			return err
+		}
+		err = c.checkForeignKey(ctx, key, bson.RawValue{Type: t, Value: data})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkForeignKey checks that every _id of value exists in the collection of key
+func (c *genericObjectDBCtrl[T]) checkForeignKey(ctx context.Context, key ForeignKey, value bson.RawValue) error {
+	var ids []any
+	switch value.Type {
+	case bsontype.Null, bsontype.Undefined:
+		return nil
+	case bsontype.Array:
+		values, err := value.Array().Values()
+		if err != nil {
+			return err
+		}
+		seen := map[string]bool{}
+		for _, v := range values {
+			if k := refKey(v); !seen[k] {
+				seen[k] = true
+				ids = append(ids, v)
+			}
+		}
+	default:
+		ids = []any{value}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	count, err := c.db.Database().Collection(key.Collection).CountDocuments(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	if count < int64(len(ids)) {
+		return errors.Wrapf(ErrMissingReference, "%s references %s", key.Field, key.Collection)
+	}
+	return nil
+}
+
+// checkRestrictedDelete returns ErrStillReferenced if a CascadeRestrict dependent references
+// one of the items matched by filter
+func (c *genericObjectDBCtrl[T]) checkRestrictedDelete(ctx context.Context, filter bson.D) error {
+	var restricted []Dependent
+	for _, dep := range c.opts.dependents {
+		if dep.Action == CascadeRestrict {
+			restricted = append(restricted, dep)
+		}
+	}
+	if len(restricted) == 0 {
+		return nil
+	}
+	cursor, err := c.db.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(cursor))
+	var ids []any
+	for cursor.Next(ctx) {
+		ids = append(ids, cursor.Current.Lookup("_id"))
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	db := c.db.Database()
+	for _, dep := range restricted {
+		err = db.Collection(dep.Collection).FindOne(ctx, bson.M{dep.Field: bson.M{"$in": ids}}, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+		if err == nil {
+			return errors.Wrapf(ErrStillReferenced, "referenced by %s.%s", dep.Collection, dep.Field)
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,382 @@
+package mongodb
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Encoder writes documents of an export in a serialization format
+type Encoder interface {
+	Encode(doc bson.Raw) error
+	// Flush writes buffered data, it is called once after the last document
+	Flush() error
+}
+
+// Decoder reads documents of an import in a serialization format
+type Decoder interface {
+	// Decode returns the next document, io.EOF after the last one
+	Decode() (bson.Raw, error)
+}
+
+// Format is a serialization format of Export and Import, see WithFormat.
+// Parquet is provided by mongoarrow.FormatParquet, which keeps Arrow out of this package.
+type Format interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+var (
+	// FormatNDJSON is newline delimited canonical extended JSON, which keeps numeric types,
+	// the default format. Relaxed extended JSON is accepted on import.
+	FormatNDJSON Format = ndjsonFormat{}
+	// FormatBSON is a stream of bson documents as written by mongodump
+	FormatBSON Format = bsonFormat{}
+)
+
+// WithFormat sets the serialization format of Export and Import, FormatNDJSON by default
+func WithFormat(format Format) ExportOption {
+	return func(o *exportOptions) {
+		o.format = format
+	}
+}
+
+type ndjsonFormat struct{}
+
+func (ndjsonFormat) NewEncoder(w io.Writer) Encoder {
+	return &ndjsonEncoder{w: bufio.NewWriter(w)}
+}
+
+func (ndjsonFormat) NewDecoder(r io.Reader) Decoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 17*1024*1024)
+	return &ndjsonDecoder{scanner: scanner}
+}
+
+type ndjsonEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *ndjsonEncoder) Encode(doc bson.Raw) error {
+	line, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(line, '\n'))
+	return err
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+type ndjsonDecoder struct {
+	scanner *bufio.Scanner
+}
+
+func (d *ndjsonDecoder) Decode() (bson.Raw, error) {
+	for d.scanner.Scan() {
+		if len(d.scanner.Bytes()) == 0 {
+			continue
+		}
+		var doc bson.Raw
+		err := bson.UnmarshalExtJSON(d.scanner.Bytes(), false, &doc)
+		return doc, err
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+type bsonFormat struct{}
+
+func (bsonFormat) NewEncoder(w io.Writer) Encoder {
+	return &bsonEncoder{w: bufio.NewWriter(w)}
+}
+
+func (bsonFormat) NewDecoder(r io.Reader) Decoder {
+	return &bsonDecoder{r: bufio.NewReader(r)}
+}
+
+type bsonEncoder struct {
+	w *bufio.Writer
+}
+
+func (e *bsonEncoder) Encode(doc bson.Raw) error {
+	_, err := e.w.Write(doc)
+	return err
+}
+
+func (e *bsonEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+type bsonDecoder struct {
+	r io.Reader
+}
+
+func (d *bsonDecoder) Decode() (bson.Raw, error) {
+	var doc bson.Raw
+	err := readRecord(d.r, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// FormatCSV is a flat projection to CSV with a header row. columns are dot paths of the exported
+// fields, the top level fields of the first document when empty. Nested documents and arrays
+// are written as relaxed extended JSON, dates as RFC 3339 and missing fields as empty cells.
+// Imported values are strings except 24 hex digit _id values, which are ObjectIDs,
+// dotted columns are imported as nested documents and empty cells are omitted.
+// See FormatCSVMapped for column names, array and date rules.
+func FormatCSV(columns ...string) Format {
+	mapped := make([]CSVColumn, 0, len(columns))
+	for _, path := range columns {
+		mapped = append(mapped, CSVColumn{Path: path})
+	}
+	return csvFormat{columns: mapped}
+}
+
+// ArrayStrategy is how a CSV column flattens an array
+type ArrayStrategy int
+
+const (
+	// ArrayJSON writes the array as relaxed extended JSON
+	ArrayJSON ArrayStrategy = iota
+	// ArrayJoin writes the elements joined by the column Separator
+	ArrayJoin
+	// ArrayFirst writes the first element
+	ArrayFirst
+	// ArrayCount writes the number of elements
+	ArrayCount
+)
+
+// CSVColumn maps the field at dot path Path to a CSV column
+type CSVColumn struct {
+	Path string
+	// Name is the header of the column, Path when empty
+	Name string
+	// Array is how arrays are flattened, ArrayJSON by default
+	Array ArrayStrategy
+	// Separator joins elements with ArrayJoin, "|" when empty
+	Separator string
+	// DateFormat is the time layout of dates, time.RFC3339Nano when empty
+	DateFormat string
+	// Location is the time zone dates are written in, UTC when nil
+	Location *time.Location
+}
+
+func (c CSVColumn) header() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Path
+}
+
+// FormatCSVMapped is FormatCSV with a mapping of fields to columns, so nested documents
+// are flattened predictably without post-processing. Imported columns are stored under their Path.
+func FormatCSVMapped(columns ...CSVColumn) Format {
+	return csvFormat{columns: columns}
+}
+
+type csvFormat struct {
+	columns []CSVColumn
+}
+
+func (f csvFormat) NewEncoder(w io.Writer) Encoder {
+	return &csvEncoder{w: csv.NewWriter(w), columns: f.columns}
+}
+
+func (f csvFormat) NewDecoder(r io.Reader) Decoder {
+	paths := map[string]string{}
+	for _, column := range f.columns {
+		paths[column.header()] = column.Path
+	}
+	return &csvDecoder{r: csv.NewReader(r), paths: paths}
+}
+
+type csvEncoder struct {
+	w       *csv.Writer
+	columns []CSVColumn
+	header  bool
+}
+
+func (e *csvEncoder) Encode(doc bson.Raw) error {
+	if !e.header {
+		if len(e.columns) == 0 {
+			elements, err := doc.Elements()
+			if err != nil {
+				return err
+			}
+			for _, el := range elements {
+				e.columns = append(e.columns, CSVColumn{Path: el.Key()})
+			}
+		}
+		header := make([]string, len(e.columns))
+		for i, column := range e.columns {
+			header[i] = column.header()
+		}
+		if err := e.w.Write(header); err != nil {
+			return err
+		}
+		e.header = true
+	}
+
+	row := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		value, err := doc.LookupErr(strings.Split(column.Path, ".")...)
+		if err != nil {
+			continue
+		}
+		row[i], err = column.Cell(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %s", column.Path, err)
+		}
+	}
+	return e.w.Write(row)
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// Cell renders v as the CSV cell of the column, also used by typed exports of string columns
+func (c CSVColumn) Cell(v bson.RawValue) (string, error) {
+	switch v.Type {
+	case bsontype.Null, bsontype.Undefined:
+		return "", nil
+	case bsontype.String:
+		return v.StringValue(), nil
+	case bsontype.Boolean:
+		return strconv.FormatBool(v.Boolean()), nil
+	case bsontype.Int32:
+		return strconv.FormatInt(int64(v.Int32()), 10), nil
+	case bsontype.Int64:
+		return strconv.FormatInt(v.Int64(), 10), nil
+	case bsontype.Double:
+		return strconv.FormatFloat(v.Double(), 'f', -1, 64), nil
+	case bsontype.Decimal128:
+		return v.Decimal128().String(), nil
+	case bsontype.ObjectID:
+		return v.ObjectID().Hex(), nil
+	case bsontype.DateTime:
+		layout, loc := c.DateFormat, c.Location
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		if loc == nil {
+			loc = time.UTC
+		}
+		return v.Time().In(loc).Format(layout), nil
+	case bsontype.Array:
+		if c.Array != ArrayJSON {
+			return c.arrayCell(v.Array())
+		}
+	}
+	data, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, false, false)
+	if err != nil {
+		return "", err
+	}
+	// strip the {"v": ...} wrapper
+	return strings.TrimSuffix(strings.TrimPrefix(string(data), `{"v":`), "}"), nil
+}
+
+func (c CSVColumn) arrayCell(array bson.Raw) (string, error) {
+	values, err := array.Values()
+	if err != nil {
+		return "", err
+	}
+	switch c.Array {
+	case ArrayCount:
+		return strconv.Itoa(len(values)), nil
+	case ArrayFirst:
+		if len(values) == 0 {
+			return "", nil
+		}
+		return c.Cell(values[0])
+	}
+	separator := c.Separator
+	if separator == "" {
+		separator = "|"
+	}
+	cells := make([]string, 0, len(values))
+	for _, value := range values {
+		cell, err := c.Cell(value)
+		if err != nil {
+			return "", err
+		}
+		cells = append(cells, cell)
+	}
+	return strings.Join(cells, separator), nil
+}
+
+type csvDecoder struct {
+	r      *csv.Reader
+	paths  map[string]string
+	header []string
+}
+
+func (d *csvDecoder) Decode() (bson.Raw, error) {
+	if d.header == nil {
+		header, err := d.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		for i, name := range header {
+			if path, ok := d.paths[name]; ok {
+				header[i] = path
+			}
+		}
+		d.header = header
+	}
+	row, err := d.r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := bson.D{}
+	for i, column := range d.header {
+		if i >= len(row) || row[i] == "" {
+			continue
+		}
+		var value any = row[i]
+		if column == "_id" {
+			if id, err := primitive.ObjectIDFromHex(row[i]); err == nil {
+				value = id
+			}
+		}
+		doc = setPathD(doc, strings.Split(column, "."), value)
+	}
+	return bson.Marshal(doc)
+}
+
+// setPathD sets the dot path of doc to value, creating nested documents
+func setPathD(doc bson.D, path []string, value any) bson.D {
+	for i, e := range doc {
+		if e.Key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			doc[i].Value = value
+			return doc
+		}
+		nested, _ := e.Value.(bson.D)
+		doc[i].Value = setPathD(nested, path[1:], value)
+		return doc
+	}
+	if len(path) == 1 {
+		return append(doc, bson.E{Key: path[0], Value: value})
+	}
+	return append(doc, bson.E{Key: path[0], Value: setPathD(bson.D{}, path[1:], value)})
+}
@@ -0,0 +1,112 @@
+package mongodb
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func rawValue(t *testing.T, v any) bson.RawValue {
+	t.Helper()
+	if v == nil {
+		return bson.RawValue{Type: bsontype.Null}
+	}
+	typ, data, err := bson.MarshalValue(v)
+	if err != nil {
+		t.Fatalf("MarshalValue(%v) error = %v", v, err)
+	}
+	return bson.RawValue{Type: typ, Value: data}
+}
+
+func TestCSVColumnCell(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("5f1d7a9e8c3b2a1d0e9f8a7b")
+	date := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	moscow := time.FixedZone("MSK", 3*60*60)
+	tests := []struct {
+		name   string
+		column CSVColumn
+		value  any
+		want   string
+	}{
+		{name: "string", value: "a,b", want: "a,b"},
+		{name: "null", value: nil, want: ""},
+		{name: "bool", value: true, want: "true"},
+		{name: "int32", value: int32(-7), want: "-7"},
+		{name: "int64", value: int64(1) << 40, want: "1099511627776"},
+		{name: "double", value: 2.5, want: "2.5"},
+		{name: "object id", value: id, want: "5f1d7a9e8c3b2a1d0e9f8a7b"},
+		{name: "date", value: date, want: "2024-03-01T12:30:00Z"},
+		{name: "date format", column: CSVColumn{DateFormat: "2006-01-02 15:04", Location: moscow}, value: date, want: "2024-03-01 15:30"},
+		{name: "document", value: bson.D{{Key: "a", Value: 1}}, want: `{"a":1}`},
+		{name: "array json", value: bson.A{1, "x"}, want: `[1,"x"]`},
+		{name: "array join", column: CSVColumn{Array: ArrayJoin}, value: bson.A{1, "x"}, want: "1|x"},
+		{name: "array join separator", column: CSVColumn{Array: ArrayJoin, Separator: ";"}, value: bson.A{"a", "b"}, want: "a;b"},
+		{name: "array first", column: CSVColumn{Array: ArrayFirst}, value: bson.A{"a", "b"}, want: "a"},
+		{name: "array first empty", column: CSVColumn{Array: ArrayFirst}, value: bson.A{}, want: ""},
+		{name: "array count", column: CSVColumn{Array: ArrayCount}, value: bson.A{"a", "b", "c"}, want: "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.column.Cell(rawValue(t, tt.value))
+			if err != nil {
+				t.Fatalf("Cell() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Cell() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatCSVMapped(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("5f1d7a9e8c3b2a1d0e9f8a7b")
+	format := FormatCSVMapped(
+		CSVColumn{Path: "_id"},
+		CSVColumn{Path: "address.city", Name: "city"},
+		CSVColumn{Path: "tags", Array: ArrayJoin},
+		CSVColumn{Path: "note"},
+	)
+	docs := []bson.D{
+		{{Key: "_id", Value: id}, {Key: "address", Value: bson.D{{Key: "city", Value: "Bishkek"}}}, {Key: "tags", Value: bson.A{"a", "b"}}},
+		{{Key: "_id", Value: "plain"}, {Key: "note", Value: "x"}},
+	}
+
+	var buf bytes.Buffer
+	encoder := format.NewEncoder(&buf)
+	for _, doc := range docs {
+		raw, _ := bson.Marshal(doc)
+		if err := encoder.Encode(raw); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	want := "_id,city,tags,note\n5f1d7a9e8c3b2a1d0e9f8a7b,Bishkek,a|b,\nplain,,,x\n"
+	if buf.String() != want {
+		t.Fatalf("encoded %q, want %q", buf.String(), want)
+	}
+
+	decoder := format.NewDecoder(&buf)
+	wantDocs := []string{
+		`{"_id": {"$oid":"5f1d7a9e8c3b2a1d0e9f8a7b"},"address": {"city": "Bishkek"},"tags": "a|b"}`,
+		`{"_id": "plain","note": "x"}`,
+	}
+	for _, want := range wantDocs {
+		doc, err := decoder.Decode()
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if doc.String() != want {
+			t.Errorf("Decode() = %s, want %s", doc, want)
+		}
+	}
+	if _, err := decoder.Decode(); err != io.EOF {
+		t.Errorf("Decode() error = %v, want io.EOF", err)
+	}
+}
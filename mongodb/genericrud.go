@@ -8,35 +8,57 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"reflect"
+	"sync"
 	"time"
 )
 
+// CRUDDBService is the legacy controller interface, kept for existing consumers.
+// New code should use Repository (see AsRepository), which shares the controller.
 type CRUDDBService[T any] interface {
 	// Create item in DB
 	// Note: item ID used in database SHOULD BE set externally
+	// Note: zero fields tagged `mgdefault:"..."` are filled with the declared default (see Defaulter)
 	// if some failed, return err
 	Create(ctx context.Context, item *T) (err error)
 
+	// CreateUnique creates item ensuring the unique index on natural key keyFields
+	// if the key is taken, return *AlreadyExistsError
+	// if some failed, return err
+	CreateUnique(ctx context.Context, item *T, keyFields ...string) error
+
 	// Get an item by id
 	// if some failed, return err
 	Get(ctx context.Context, id any) (item *T, err error)
 
 	// Update an item identified by id
+	// Note: fields tagged `mgimmutable:"true"` are not overwritten
+	// Note: with WithConcurrencyPolicy a stale item is rejected with ErrConflict
 	// if some failed, return err
 	Update(ctx context.Context, id any, item *T) (err error)
 
 	// UpdateAttributes updates item's attributes 'attrs' identified by filter 'sels'
+	// Note: attrs addressing fields tagged `mgimmutable:"true"` are rejected with *ImmutableFieldError
 	// if some failed, return err
 	UpdateAttributes(ctx context.Context, sels map[string]any, attrs map[string]any) error
 
+	// UpdateAttributesBatched updates attributes 'attrs' of items identified by sels in resumable batches
+	// progress is checkpointed under job name
+	// if some failed, return number of updated items and err
+	UpdateAttributesBatched(ctx context.Context, job string, sels map[string]any, attrs map[string]any, batchSize int, pause time.Duration, onProgress func(updated int64)) (int64, error)
+
 	// Delete item in DB and identified by id
 	// if some failed, return err
 	Delete(ctx context.Context, id any) error
 
 	// DeleteRange delete items in DB and identified by sels
+	// Note: with WithCostGuard an expensive collection scan is rejected with ErrQueryTooExpensive
 	// if some failed, return err
 	DeleteRange(ctx context.Context, sels map[string]any) error
 
+	// DeleteRangeBatched delete items in DB identified by sels in _id ranged batches
+	// if some failed, return number of deleted items and err
+	DeleteRangeBatched(ctx context.Context, sels map[string]any, batchSize int, pause time.Duration, onProgress func(deleted int64)) (int64, error)
+
 	// ListAll uses for getting all items in DB for entity
 	// if some failed, return err
 	ListAll(ctx context.Context) (items []T, err error)
@@ -52,51 +74,87 @@ type CRUDDBService[T any] interface {
 	Exists(ctx context.Context, sels map[string]any) (item *T, exist bool, err error)
 
 	// List all items by sels filter (logical AND)
+	// Note: with WithCostGuard an expensive collection scan is rejected with ErrQueryTooExpensive
 	// if some failed, return err
 	List(ctx context.Context, sels map[string]any) ([]T, error)
 
 	// CreateIndex create index based on sels and unique flag
+	// Note: with WithMaintenanceWindow the build is refused or queued outside the window
 	// if some failed, return err
 	CreateIndex(ctx context.Context, sels map[string]int, unique bool) (string, error)
+
+	// WarmIndexes loads collection indexes into the server cache and runs representative queries
+	// if some failed, return err
+	WarmIndexes(ctx context.Context, queries ...map[string]any) error
 }
 
-func NewGenericObjectDBCtrl[T any](dbCollection *mongo.Collection) *genericObjectDBCtrl[T] {
-	return &genericObjectDBCtrl[T]{
-		db: dbCollection,
+func NewGenericObjectDBCtrl[T any](dbCollection *mongo.Collection, opts ...Option) *genericObjectDBCtrl[T] {
+	registerModel(dbCollection.Database().Name()+"."+dbCollection.Name(), reflect.TypeOf((*T)(nil)).Elem())
+	o := newCtrlOptions(opts)
+	if o.registry != nil {
+		if cloned, err := dbCollection.Clone(options.Collection().SetRegistry(o.registry)); err == nil {
+			dbCollection = cloned
+		}
+	}
+	registerController(dbCollection, o)
+	c := &genericObjectDBCtrl[T]{
+		db:   dbCollection,
+		opts: o,
+	}
+	if o.writeBack {
+		c.writeBacks = newWriteBackWorker(o.writeBackRate, o.writeBackQueue)
 	}
+	if o.maxLag > 0 {
+		c.lag = newLagMonitor(dbCollection, o.maxLag)
+	}
+	return c
 }
 
 type genericObjectDBCtrl[T any] struct {
-	db *mongo.Collection
+	db   *mongo.Collection
+	opts ctrlOptions
+	// pool holds *T reused by pooled decoding
+	pool sync.Pool
+	// writeBacks stores documents migrated on read, see WithLazyWriteBack
+	writeBacks *writeBackWorker
+	// lag selects secondary reads, see WithSecondaryReads
+	lag *lagMonitor
+	// uniqueIndexes holds the names of the unique indexes CreateUnique ensured by key fields
+	uniqueIndexes sync.Map
 }
 
-func (c *genericObjectDBCtrl[T]) Create(ctx context.Context, item *T) error {
-	log.Debug("DB DEBUG: Started c.db.InsertOne(ctx, &item)")
-	defer log.Debug("DB DEBUG: finished c.db.InsertOne(ctx, &item)")
-	now := time.Now()
-	createdAtField := reflect.ValueOf(item).Elem().FieldByName("CreatedAt")
-	if createdAtField.IsValid() && createdAtField.CanSet() {
-		createdAtField.Set(reflect.ValueOf(now))
-	}
-	updatedAtField := reflect.ValueOf(item).Elem().FieldByName("UpdatedAt")
-	if updatedAtField.IsValid() && updatedAtField.CanSet() {
-		updatedAtField.Set(reflect.ValueOf(now))
-	}
-
-	_, err := c.db.InsertOne(ctx, &item)
-	if err != nil {
-		return err
+// Close stops the background write-backs of migrated documents (see WithLazyWriteBack) and waits for
+// the one in progress. Queued documents are not written, they get migrated again on their next read.
+// The controller stays usable, later reads no longer write back.
+func (c *genericObjectDBCtrl[T]) Close() {
+	if c.writeBacks != nil {
+		c.writeBacks.close()
 	}
+}
 
-	return nil
+func (c *genericObjectDBCtrl[T]) Create(ctx context.Context, item *T) (err error) {
+	defer c.recoverPanic(ctx, "Create", &err)
+	_, err = c.CreateDetailed(c.nested(ctx), item)
+	return err
 }
 
-func (c *genericObjectDBCtrl[T]) Get(ctx context.Context, id any) (*T, error) {
+func (c *genericObjectDBCtrl[T]) Get(ctx context.Context, id any) (_ *T, err error) {
+	defer c.recoverPanic(ctx, "Get", &err)
+	id = c.internalID(id)
 	log.Debug("DB DEBUG: Started c.db.FindOne(ctx, filter)")
 	defer log.Debug("DB DEBUG: finished c.db.FindOne(ctx, filter)")
-	result := new(T)
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
 	filter := bson.D{bson.E{Key: "_id", Value: id}}
-	err := c.db.FindOne(ctx, filter).Decode(result)
+	if c.opts.hedgeDelay > 0 {
+		return c.hedgedFindOne(ctx, filter)
+	}
+	raw, err := c.reader().FindOne(ctx, filter, profile.findOneOptions()).Raw()
+	if err != nil {
+		return nil, err
+	}
+	result := new(T)
+	err = c.decodeItem(ctx, raw, result)
 	if err != nil {
 		return nil, err
 	}
@@ -104,18 +162,24 @@ func (c *genericObjectDBCtrl[T]) Get(ctx context.Context, id any) (*T, error) {
 	return result, nil
 }
 
-func (c *genericObjectDBCtrl[T]) Find(ctx context.Context, sels map[string]any) (*T, error) {
+func (c *genericObjectDBCtrl[T]) Find(ctx context.Context, sels map[string]any) (_ *T, err error) {
+	defer c.recoverPanic(ctx, "Find", &err)
+	sels = c.internalSels(sels)
 	log.Debug("DB DEBUG: Started c.db.FindOne(ctx, filter)")
 	defer log.Debug("DB DEBUG: finished c.db.FindOne(ctx, filter)")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+	c.warnUnindexedDynamic(ctx, sels)
+	c.recordAccess(sels, nil)
 
-	result := new(T)
+	filter := filterFromSels(sels)
 
-	var filter bson.D
-	for k, v := range sels {
-		filter = append(filter, bson.E{k, v})
+	raw, err := c.reader().FindOne(ctx, filter, profile.findOneOptions()).Raw()
+	if err != nil {
+		return nil, err
 	}
-
-	err := c.db.FindOne(ctx, filter).Decode(result)
+	result := new(T)
+	err = c.decodeItem(ctx, raw, result)
 	if err != nil {
 		return nil, err
 	}
@@ -123,11 +187,12 @@ func (c *genericObjectDBCtrl[T]) Find(ctx context.Context, sels map[string]any)
 	return result, nil
 }
 
-func (c *genericObjectDBCtrl[T]) Exists(ctx context.Context, sels map[string]any) (*T, bool, error) {
+func (c *genericObjectDBCtrl[T]) Exists(ctx context.Context, sels map[string]any) (_ *T, _ bool, err error) {
+	defer c.recoverPanic(ctx, "Exists", &err)
 	log.Debug("DB DEBUG: Started c.Find(ctx, sels)")
 	defer log.Debug("DB DEBUG: finished c.Find(ctx, sels)")
 
-	result, err := c.Find(ctx, sels)
+	result, err := c.Find(c.nested(ctx), sels)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, false, nil
@@ -138,144 +203,112 @@ func (c *genericObjectDBCtrl[T]) Exists(ctx context.Context, sels map[string]any
 	return result, true, nil
 }
 
-func (c *genericObjectDBCtrl[T]) Update(ctx context.Context, id any, item *T) error {
-	log.Debug("DB DEBUG: Started c.db.UpdateOne")
-	defer log.Debug("DB DEBUG: finished c.db.UpdateOne")
-	now := time.Now()
-	updatedAtField := reflect.ValueOf(item).Elem().FieldByName("UpdatedAt")
-	if updatedAtField.IsValid() && updatedAtField.CanSet() {
-		updatedAtField.Set(reflect.ValueOf(now))
-	}
-	dataByte, err := bson.Marshal(item)
-	if err != nil {
-		return err
-	}
-
-	var update bson.M
-	err = bson.Unmarshal(dataByte, &update)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.db.UpdateOne(
-		ctx,
-		bson.M{"_id": id},
-		bson.D{
-			bson.E{Key: "$set", Value: update},
-		},
-	)
-
-	if err != nil {
-		return err
-	}
-	return nil
+func (c *genericObjectDBCtrl[T]) Update(ctx context.Context, id any, item *T) (err error) {
+	defer c.recoverPanic(ctx, "Update", &err)
+	_, err = c.UpdateDetailed(c.nested(ctx), id, item)
+	return err
 }
 
-func (c *genericObjectDBCtrl[T]) UpdateAttributes(ctx context.Context, sels map[string]any, attrs map[string]any) error {
-	log.Debug("DB DEBUG: Started c.db.UpdateMany")
-	defer log.Debug("DB DEBUG: finished c.db.UpdateMany")
-	var filter bson.D
-	for k, v := range sels {
-		filter = append(filter, bson.E{k, v})
-	}
-
-	var update bson.M
-	attrs["updated_at"] = time.Now()
-	dataByte, err := bson.Marshal(attrs)
-	if err != nil {
-		return err
-	}
-	err = bson.Unmarshal(dataByte, &update)
-	if err != nil {
-		return err
-	}
-
-	_, err = c.db.UpdateMany(
-		ctx,
-		filter,
-		bson.D{
-			bson.E{Key: "$set", Value: update},
-		},
-	)
-
-	if err != nil {
-		return err
-	}
-	return nil
+func (c *genericObjectDBCtrl[T]) UpdateAttributes(ctx context.Context, sels map[string]any, attrs map[string]any) (err error) {
+	defer c.recoverPanic(ctx, "UpdateAttributes", &err)
+	_, err = c.UpdateAttributesDetailed(c.nested(ctx), sels, attrs)
+	return err
 }
 
-func (c *genericObjectDBCtrl[T]) Delete(ctx context.Context, id any) error {
-	filter := bson.D{
-		bson.E{Key: "_id", Value: id},
-	}
-	_, err := c.db.DeleteOne(ctx, filter)
-	if err != nil {
-		return err
-	}
-	return nil
+func (c *genericObjectDBCtrl[T]) Delete(ctx context.Context, id any) (err error) {
+	defer c.recoverPanic(ctx, "Delete", &err)
+	_, err = c.DeleteDetailed(c.nested(ctx), id)
+	return err
 }
 
-func (c *genericObjectDBCtrl[T]) DeleteRange(ctx context.Context, sels map[string]any) error {
-	var filter bson.D
-	for k, v := range sels {
-		filter = append(filter, bson.E{k, v})
-	}
-	_, err := c.db.DeleteMany(ctx, filter)
-	if err != nil {
-		return err
-	}
-	return nil
+func (c *genericObjectDBCtrl[T]) DeleteRange(ctx context.Context, sels map[string]any) (err error) {
+	defer c.recoverPanic(ctx, "DeleteRange", &err)
+	_, err = c.DeleteRangeDetailed(c.nested(ctx), sels)
+	return err
 }
 
-func (c *genericObjectDBCtrl[T]) ListAll(ctx context.Context) ([]T, error) {
+func (c *genericObjectDBCtrl[T]) ListAll(ctx context.Context) (_ []T, err error) {
+	defer c.recoverPanic(ctx, "ListAll", &err)
 	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter)")
 	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter)")
 
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
 	filter := bson.D{bson.E{}}
 
-	cursor, err := c.db.Find(ctx, filter)
+	cursor, err := c.reader().Find(ctx, filter, profile.findOptions())
 	if err != nil {
 		return nil, err
 	}
+	defer closeCursor(trackCursor(cursor))
 	results := []T{}
 	for cursor.Next(ctx) {
 		var result T
-		err := cursor.Decode(&result)
+		err := c.decodeItem(ctx, cursor.Current, &result)
 		if err != nil {
 			return nil, err
 		}
 
 		results = append(results, result)
 	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
 	return results, nil
 }
 
-func (c *genericObjectDBCtrl[T]) List(ctx context.Context, sels map[string]any) ([]T, error) {
+func (c *genericObjectDBCtrl[T]) List(ctx context.Context, sels map[string]any) (_ []T, err error) {
+	defer c.recoverPanic(ctx, "List", &err)
+	sels = c.internalSels(sels)
 	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter)")
 	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter)")
-	var filter bson.D
-	for k, v := range sels {
-		filter = append(filter, bson.E{k, v})
+	filter := filterFromSels(sels)
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+	c.warnUnindexedDynamic(ctx, sels)
+	c.recordAccess(sels, nil)
+	err = c.guardCost(ctx, "find", filter)
+	if err != nil {
+		return nil, err
 	}
 
-	cursor, err := c.db.Find(ctx, filter)
+	cursor, err := c.reader().Find(ctx, filter, profile.findOptions())
 	if err != nil {
 		return nil, err
 	}
+	defer closeCursor(trackCursor(cursor))
 	results := []T{}
 	for cursor.Next(ctx) {
 		var result T
-		err := cursor.Decode(&result)
+		err := c.decodeItem(ctx, cursor.Current, &result)
 		if err != nil {
 			return nil, err
 		}
 
 		results = append(results, result)
 	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
 	return results, nil
 }
 
-func (c *genericObjectDBCtrl[T]) CreateIndex(ctx context.Context, sels map[string]int, unique bool) (string, error) {
+func filterFromSels(sels map[string]any) bson.D {
+	filter := bson.D{}
+	for k, v := range sels {
+		filter = append(filter, bson.E{Key: k, Value: v})
+	}
+	return filter
+}
+
+func (c *genericObjectDBCtrl[T]) CreateIndex(ctx context.Context, sels map[string]int, unique bool) (_ string, err error) {
+	defer c.recoverPanic(ctx, "CreateIndex", &err)
+	err = c.guardDDL(ctx, "createIndex")
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel, _ := c.begin(ctx, opDDL)
+	defer cancel()
 	var indexKeys bson.D
 	for key, value := range sels {
 		indexKeys = append(indexKeys, bson.E{Key: key, Value: value})
@@ -287,7 +320,7 @@ func (c *genericObjectDBCtrl[T]) CreateIndex(ctx context.Context, sels map[strin
 	}
 
 	// Создание индекса
-	indexName, err := c.db.Indexes().CreateOne(context.Background(), indexModel)
+	indexName, err := c.db.Indexes().CreateOne(ctx, indexModel)
 	if err != nil {
 		return "", err
 	}
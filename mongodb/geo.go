@@ -0,0 +1,76 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Index2DSphere is the key value of a 2dsphere index field
+const Index2DSphere = "2dsphere"
+
+// GeoPoint is a GeoJSON point, coordinates are longitude, latitude
+type GeoPoint struct {
+	Type        string     `bson:"type" json:"type"`
+	Coordinates [2]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewGeoPoint returns the GeoJSON point at lng, lat
+func NewGeoPoint(lng float64, lat float64) GeoPoint {
+	return GeoPoint{Type: "Point", Coordinates: [2]float64{lng, lat}}
+}
+
+// GeoPolygon is a GeoJSON polygon, the first ring is the outer boundary, others are holes
+type GeoPolygon struct {
+	Type        string         `bson:"type" json:"type"`
+	Coordinates [][][2]float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// NewGeoPolygon returns the GeoJSON polygon bounded by points (longitude, latitude),
+// the ring is closed if the last point differs from the first
+func NewGeoPolygon(points ...[2]float64) GeoPolygon {
+	ring := append([][2]float64{}, points...)
+	if len(ring) > 0 && ring[0] != ring[len(ring)-1] {
+		ring = append(ring, ring[0])
+	}
+	return GeoPolygon{Type: "Polygon", Coordinates: [][][2]float64{ring}}
+}
+
+// WithinBetween returns sels matching documents with locationField inside polygon
+// and timeField in [from, to), for "points within the area between t1 and t2" queries
+// of tracking workloads. Combine it with other sels, e.g. a device id, by adding keys.
+func WithinBetween(locationField string, timeField string, polygon GeoPolygon, from time.Time, to time.Time) map[string]any {
+	return map[string]any{
+		locationField: map[string]any{"$geoWithin": map[string]any{"$geometry": polygon}},
+		timeField:     map[string]any{"$gte": from, "$lt": to},
+	}
+}
+
+// GeoTimeIndex returns the compound index spec serving WithinBetween queries: equality fields
+// (e.g. a device id) first, then the time range, then the 2dsphere location. The time range
+// before the location keeps narrow time windows selective, the 2dsphere key prunes the area
+// inside them.
+func GeoTimeIndex(locationField string, timeField string, equalityFields ...string) IndexSpec {
+	spec := IndexSpec{}
+	for _, field := range equalityFields {
+		spec.Keys = append(spec.Keys, bson.E{Key: field, Value: 1})
+	}
+	spec.Keys = append(spec.Keys, bson.E{Key: timeField, Value: 1}, bson.E{Key: locationField, Value: Index2DSphere})
+	return spec
+}
+
+// FindWithinBetween lists items with locationField inside polygon and timeField in [from, to)
+// also matching sels (logical AND), ensure GeoTimeIndex for the fields
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) FindWithinBetween(ctx context.Context, locationField string, timeField string, polygon GeoPolygon, from time.Time, to time.Time, sels map[string]any) (_ []T, err error) {
+	defer c.recoverPanic(ctx, "FindWithinBetween", &err)
+	sels = c.internalSels(sels)
+	filter := WithinBetween(locationField, timeField, polygon, from, to)
+	for k, v := range sels {
+		if _, ok := filter[k]; !ok {
+			filter[k] = v
+		}
+	}
+	return c.List(c.nested(ctx), filter)
+}
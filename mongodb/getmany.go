@@ -0,0 +1,118 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetMap gets items by ids in one query and returns them keyed by the requested ids,
+// which is the lookup application-side joins need after batching ids.
+// fields (optional) limits the loaded fields, _id is always loaded.
+// Missing ids are absent from the map.
+// if some failed, return err
+func GetMap[T any, K comparable](ctx context.Context, c *genericObjectDBCtrl[T], ids []K, fields ...string) (_ map[K]T, err error) {
+	defer c.recoverPanic(ctx, "GetMap", &err)
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter)")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter)")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	results := make(map[K]T, len(ids))
+	if len(ids) == 0 {
+		return results, nil
+	}
+
+	internal := make([]any, len(ids))
+	requested := make(map[string]K, len(ids))
+	for i, id := range ids {
+		internal[i] = c.internalID(id)
+		requested[refKey(internal[i])] = id
+	}
+
+	opts := profile.findOptions()
+	if len(fields) > 0 {
+		projection := bson.M{}
+		for _, field := range fields {
+			projection[field] = 1
+		}
+		opts.SetProjection(projection)
+	}
+
+	cursor, err := c.reader().Find(ctx, bson.M{"_id": bson.M{"$in": internal}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	for cursor.Next(ctx) {
+		id, ok := requested[refKey(cursor.Current.Lookup("_id"))]
+		if !ok {
+			continue
+		}
+		var result T
+		err = c.decodeItem(ctx, cursor.Current, &result)
+		if err != nil {
+			return nil, err
+		}
+		results[id] = result
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// GetManyResult is the outcome of GetManyDetailed
+type GetManyResult[T any] struct {
+	// Items are the found items in the order of the requested ids
+	Items []T
+	// Missing are the requested ids no item was found for
+	Missing []any
+}
+
+// GetManyDetailed gets items by ids in one query and reports the ids not found,
+// so bulk endpoints can return partial results instead of failing wholesale
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) GetManyDetailed(ctx context.Context, ids []any) (_ *GetManyResult[T], err error) {
+	defer c.recoverPanic(ctx, "GetManyDetailed", &err)
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter) many")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter) many")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	result := &GetManyResult[T]{Items: []T{}}
+	if len(ids) == 0 {
+		return result, nil
+	}
+	internal := c.internalID(ids).([]any)
+	cursor, err := c.reader().Find(ctx, bson.M{"_id": bson.M{"$in": internal}}, profile.findOptions())
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	found := make(map[string]T, len(ids))
+	for cursor.Next(ctx) {
+		var item T
+		err = c.decodeItem(ctx, cursor.Current, &item)
+		if err != nil {
+			return nil, err
+		}
+		found[refKey(cursor.Current.Lookup("_id"))] = item
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+
+	for i, id := range ids {
+		if item, ok := found[refKey(internal[i])]; ok {
+			result.Items = append(result.Items, item)
+		} else {
+			result.Missing = append(result.Missing, id)
+		}
+	}
+	return result, nil
+}
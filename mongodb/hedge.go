@@ -0,0 +1,69 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// WithHedgedReads makes Get issue a duplicate read to a secondary when the primary read
+// has not answered within delay, returning whichever answers first. A secondary may lag,
+// so its "not found" or error answers are not trusted and the primary answer is awaited.
+func WithHedgedReads(delay time.Duration) Option {
+	return func(o *ctrlOptions) {
+		o.hedgeDelay = delay
+	}
+}
+
+type hedgedResult[T any] struct {
+	item      *T
+	err       error
+	secondary bool
+}
+
+// hedgedFindOne runs FindOne on the primary and, after the hedge delay, on a secondary
+func (c *genericObjectDBCtrl[T]) hedgedFindOne(ctx context.Context, filter any) (*T, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgedResult[T], 2)
+	read := func(collection *mongo.Collection, secondary bool) {
+		result := new(T)
+		raw, err := collection.FindOne(ctx, filter).Raw()
+		if err == nil {
+			err = c.decodeItem(ctx, raw, result)
+		}
+		if err != nil {
+			result = nil
+		}
+		results <- hedgedResult[T]{item: result, err: err, secondary: secondary}
+	}
+	go read(c.db, false)
+
+	timer := time.NewTimer(c.opts.hedgeDelay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.item, r.err
+	case <-timer.C:
+	}
+
+	secondary, err := c.db.Clone(options.Collection().SetReadPreference(readpref.SecondaryPreferred()))
+	if err != nil {
+		r := <-results
+		return r.item, r.err
+	}
+	log.Debug("DB DEBUG: hedging read to a secondary")
+	go read(secondary, true)
+
+	for {
+		r := <-results
+		if r.err == nil || !r.secondary {
+			return r.item, r.err
+		}
+	}
+}
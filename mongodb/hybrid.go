@@ -0,0 +1,105 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// defaultRRFConstant is the k constant of reciprocal rank fusion from the original paper
+const defaultRRFConstant = 60
+
+// defaultHybridLimit is the number of results of HybridSearch when the query sets no Limit
+const defaultHybridLimit = 10
+
+// HybridQuery describes a combined text and vector search
+type HybridQuery struct {
+	// Text is the full-text query
+	Text string
+	// SearchIndex is the Atlas Search index used for Text, the collection text index if empty
+	SearchIndex string
+	// Paths are the fields searched by Text with Atlas Search
+	Paths []string
+	// VectorField and Vector are the vector search field and query vector
+	VectorField string
+	Vector      []float32
+	// TextWeight and VectorWeight scale each ranking in the fusion, 1 if not set
+	TextWeight   float64
+	VectorWeight float64
+	// Limit is the number of fused results, each search fetches Limit candidates, 10 if not set
+	Limit int
+	// Sels filters both searches
+	Sels map[string]any
+}
+
+// HybridSearch runs the text and vector searches of query and fuses them by reciprocal rank fusion.
+// Score of results is the fused score, highlights come from the text search.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) HybridSearch(ctx context.Context, query HybridQuery) (_ []SearchResult[T], err error) {
+	defer c.recoverPanic(ctx, "HybridSearch", &err)
+	if query.Limit <= 0 {
+		query.Limit = defaultHybridLimit
+	}
+	var textResults []SearchResult[T]
+	if query.SearchIndex != "" {
+		textResults, err = c.AtlasSearch(c.nested(ctx), query.SearchIndex, query.Text, query.Paths, query.Sels, int64(query.Limit))
+	} else {
+		textResults, err = c.TextSearch(c.nested(ctx), query.Text, query.Sels, int64(query.Limit))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vectorResults, err := c.VectorSearch(c.nested(ctx), query.VectorField, query.Vector, query.Limit, query.Sels)
+	if err != nil {
+		return nil, err
+	}
+
+	weight := func(w float64) float64 {
+		if w == 0 {
+			return 1
+		}
+		return w
+	}
+	fused := FuseRanks([][]SearchResult[T]{textResults, vectorResults}, []float64{weight(query.TextWeight), weight(query.VectorWeight)}, defaultRRFConstant)
+	if len(fused) > query.Limit {
+		fused = fused[:query.Limit]
+	}
+	return fused, nil
+}
+
+// FuseRanks merges ranked result lists with weighted reciprocal rank fusion:
+// score = sum(weight_i / (k + rank_i)), ranks are 1-based positions in each list.
+// Results are matched by ID, missing weights default to 1, k <= 0 uses 60.
+func FuseRanks[T any](lists [][]SearchResult[T], weights []float64, k int) []SearchResult[T] {
+	if k <= 0 {
+		k = defaultRRFConstant
+	}
+
+	var fused []*SearchResult[T]
+	byID := map[string]*SearchResult[T]{}
+	for i, list := range lists {
+		w := 1.0
+		if i < len(weights) {
+			w = weights[i]
+		}
+		for rank, result := range list {
+			key := fmt.Sprintf("%T:%v", result.ID, result.ID)
+			entry, ok := byID[key]
+			if !ok {
+				entry = &SearchResult[T]{ID: result.ID, Item: result.Item}
+				byID[key] = entry
+				fused = append(fused, entry)
+			}
+			entry.Score += w / float64(k+rank+1)
+			entry.Highlights = append(entry.Highlights, result.Highlights...)
+		}
+	}
+
+	sort.SliceStable(fused, func(i, j int) bool { return fused[i].Score > fused[j].Score })
+	results := make([]SearchResult[T], len(fused))
+	for i, entry := range fused {
+		results[i] = *entry
+	}
+	return results
+}
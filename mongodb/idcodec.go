@@ -0,0 +1,184 @@
+package mongodb
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// base62Alphabet are the digits of Base62Codec ids
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// base62Length is the length of a 12 byte ObjectID in base62
+const base62Length = 17
+
+// IDCodec translates internal ObjectIDs to opaque external ids and back
+type IDCodec interface {
+	Encode(id primitive.ObjectID) string
+	// Decode returns the ObjectID of an external id
+	// if id is not an id of the codec, return err
+	Decode(id string) (primitive.ObjectID, error)
+}
+
+// Base62Codec encodes ObjectIDs as 17 character base62 strings. With a secret the ObjectID bytes
+// are permuted by a keyed Feistel network before encoding, so external ids don't reveal the
+// creation time or sequence of the items and can't be enumerated without the secret.
+type Base62Codec struct {
+	secret []byte
+}
+
+// NewBase62Codec returns a codec obfuscating ids with secret, or only encoding them when it's empty
+func NewBase62Codec(secret []byte) *Base62Codec {
+	return &Base62Codec{secret: secret}
+}
+
+func (c *Base62Codec) Encode(id primitive.ObjectID) string {
+	data := id
+	if len(c.secret) > 0 {
+		data = c.permute(data, false)
+	}
+	n := new(big.Int).SetBytes(data[:])
+	digits := make([]byte, base62Length)
+	base := big.NewInt(62)
+	mod := new(big.Int)
+	for i := base62Length - 1; i >= 0; i-- {
+		n.DivMod(n, base, mod)
+		digits[i] = base62Alphabet[mod.Int64()]
+	}
+	return string(digits)
+}
+
+func (c *Base62Codec) Decode(id string) (primitive.ObjectID, error) {
+	if len(id) != base62Length {
+		return primitive.NilObjectID, fmt.Errorf("failed to decode id %q: length %d, expected %d", id, len(id), base62Length)
+	}
+	n := new(big.Int)
+	base := big.NewInt(62)
+	for i := 0; i < len(id); i++ {
+		digit := indexOfByte(base62Alphabet, id[i])
+		if digit < 0 {
+			return primitive.NilObjectID, fmt.Errorf("failed to decode id %q: invalid character %q", id, id[i])
+		}
+		n.Mul(n, base).Add(n, big.NewInt(int64(digit)))
+	}
+	if n.BitLen() > 96 {
+		return primitive.NilObjectID, fmt.Errorf("failed to decode id %q: out of range", id)
+	}
+	var data primitive.ObjectID
+	n.FillBytes(data[:])
+	if len(c.secret) > 0 {
+		data = c.permute(data, true)
+	}
+	return data, nil
+}
+
+// permute runs the 4 round Feistel network over the two 6 byte halves of id, or its inverse
+func (c *Base62Codec) permute(id primitive.ObjectID, inverse bool) primitive.ObjectID {
+	left, right := [6]byte(id[:6]), [6]byte(id[6:])
+	const rounds = 4
+	for i := 0; i < rounds; i++ {
+		round := i
+		if inverse {
+			round = rounds - 1 - i
+			left, right = right, left
+		}
+		f := c.round(byte(round), right)
+		for j := range left {
+			left[j] ^= f[j]
+		}
+		if !inverse {
+			left, right = right, left
+		}
+	}
+	var out primitive.ObjectID
+	copy(out[:6], left[:])
+	copy(out[6:], right[:])
+	return out
+}
+
+func (c *Base62Codec) round(round byte, half [6]byte) [6]byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte{round})
+	mac.Write(half[:])
+	return [6]byte(mac.Sum(nil)[:6])
+}
+
+func indexOfByte(s string, b byte) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == b {
+			return i
+		}
+	}
+	return -1
+}
+
+// WithIDCodec makes the controller, its Repository (see AsRepository) and Cached accept external
+// ids of codec where they take an _id: the id arguments, e.g. of Get, GetMany, GetMap, GetRaw,
+// Update, UpdateIfMatch, SetAttrs, UnsetAttrs, GetAttr, Delete, DeleteCascade and MergeDocuments,
+// and the _id selector of every method taking sels (Find, List, Iterate, the search, statistics,
+// batched and export methods, ...), plain or in $in, $nin, $eq and $ne. Strings the codec can't
+// decode are used as they are.
+// Returned items and raw documents, and the ids in reports such as DuplicateGroup, hold internal ids:
+// encode them with the codec before exposing them.
+func WithIDCodec(codec IDCodec) Option {
+	return func(o *ctrlOptions) {
+		o.idCodec = codec
+	}
+}
+
+// internalID translates an external id of the codec to its ObjectID
+func (c *genericObjectDBCtrl[T]) internalID(id any) any {
+	if c.opts.idCodec == nil {
+		return id
+	}
+	switch v := id.(type) {
+	case string:
+		if oid, err := c.opts.idCodec.Decode(v); err == nil {
+			return oid
+		}
+	case []any:
+		ids := make([]any, len(v))
+		for i, x := range v {
+			ids[i] = c.internalID(x)
+		}
+		return ids
+	case []string:
+		ids := make([]any, len(v))
+		for i, x := range v {
+			ids[i] = c.internalID(x)
+		}
+		return ids
+	case bson.M:
+		return c.internalID(map[string]any(v))
+	case map[string]any:
+		ops := make(map[string]any, len(v))
+		for op, x := range v {
+			switch op {
+			case "$in", "$nin", "$eq", "$ne":
+				ops[op] = c.internalID(x)
+			default:
+				ops[op] = x
+			}
+		}
+		return ops
+	}
+	return id
+}
+
+// internalSels returns sels with the _id selector translated by internalID
+func (c *genericObjectDBCtrl[T]) internalSels(sels map[string]any) map[string]any {
+	id, ok := sels["_id"]
+	if c.opts.idCodec == nil || !ok {
+		return sels
+	}
+	translated := make(map[string]any, len(sels))
+	for k, v := range sels {
+		translated[k] = v
+	}
+	translated["_id"] = c.internalID(id)
+	return translated
+}
@@ -0,0 +1,70 @@
+package mongodb
+
+import (
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBase62Codec(t *testing.T) {
+	ids := []primitive.ObjectID{
+		primitive.NilObjectID,
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		primitive.NewObjectID(),
+		primitive.NewObjectID(),
+	}
+	for _, secret := range []string{"", "secret"} {
+		codec := NewBase62Codec([]byte(secret))
+		seen := map[string]bool{}
+		for _, id := range ids {
+			encoded := codec.Encode(id)
+			if len(encoded) != base62Length {
+				t.Errorf("Encode(%s) = %q, length %d", id.Hex(), encoded, len(encoded))
+			}
+			if seen[encoded] {
+				t.Errorf("Encode(%s) = %q, duplicate", id.Hex(), encoded)
+			}
+			seen[encoded] = true
+			decoded, err := codec.Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode(%q) error = %v", encoded, err)
+			}
+			if decoded != id {
+				t.Errorf("Decode(Encode(%s)) = %s", id.Hex(), decoded.Hex())
+			}
+		}
+	}
+}
+
+func TestBase62CodecPermutation(t *testing.T) {
+	plain, keyed, other := NewBase62Codec(nil), NewBase62Codec([]byte("a")), NewBase62Codec([]byte("b"))
+	id, _ := primitive.ObjectIDFromHex("5f1d7a9e8c3b2a1d0e9f8a7b")
+	next, _ := primitive.ObjectIDFromHex("5f1d7a9e8c3b2a1d0e9f8a7c")
+	if keyed.Encode(id) == plain.Encode(id) {
+		t.Errorf("keyed Encode() equals plain Encode()")
+	}
+	if keyed.Encode(id) == other.Encode(id) {
+		t.Errorf("Encode() with different secrets are equal")
+	}
+	// consecutive ids must not share a visible prefix once permuted
+	if a, b := keyed.Encode(id), keyed.Encode(next); a[:8] == b[:8] {
+		t.Errorf("Encode() of consecutive ids share a prefix: %s %s", a, b)
+	}
+	if got := keyed.permute(keyed.permute(id, false), true); got != id {
+		t.Errorf("inverse permute = %s, want %s", got.Hex(), id.Hex())
+	}
+	decoded, err := other.Decode(keyed.Encode(id))
+	if err == nil && decoded == id {
+		t.Errorf("Decode() with another secret returned the id")
+	}
+}
+
+func TestBase62CodecDecodeInvalid(t *testing.T) {
+	codec := NewBase62Codec(nil)
+	for _, id := range []string{"", "short", strings.Repeat("0", base62Length+1), "0000000000000000-", strings.Repeat("z", base62Length)} {
+		if _, err := codec.Decode(id); err == nil {
+			t.Errorf("Decode(%q) error = nil", id)
+		}
+	}
+}
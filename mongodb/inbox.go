@@ -0,0 +1,167 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Notification is an inbox entry of a user
+type Notification[T any] struct {
+	ID        primitive.ObjectID `bson:"_id" json:"id"`
+	User      string             `bson:"user" json:"user"`
+	Payload   T                  `bson:"payload" json:"payload"`
+	Read      bool               `bson:"read" json:"read"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	ReadAt    *time.Time         `bson:"read_at,omitempty" json:"read_at,omitempty"`
+	ExpiresAt *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+// Inbox keeps per-user notification lists with unread counts and bulk mark-read,
+// notifications are removed by a TTL index after the inbox ttl
+type Inbox[T any] struct {
+	db  *mongo.Collection
+	ttl time.Duration
+}
+
+// NewInbox creates an Inbox on collection and ensures its indexes,
+// ttl 0 keeps notifications until they are deleted
+// if some failed, return err
+func NewInbox[T any](ctx context.Context, collection *mongo.Collection, ttl time.Duration) (*Inbox[T], error) {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "read", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Inbox[T]{db: collection, ttl: ttl}, nil
+}
+
+// Push adds payload to the inbox of user and returns the notification id
+// if some failed, return err
+func (b *Inbox[T]) Push(ctx context.Context, user string, payload T) (primitive.ObjectID, error) {
+	ids, err := b.PushMany(ctx, []string{user}, payload)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return ids[0], nil
+}
+
+// PushMany adds payload to the inboxes of users in one insert and returns the notification ids
+// if some failed, return err
+func (b *Inbox[T]) PushMany(ctx context.Context, users []string, payload T) ([]primitive.ObjectID, error) {
+	log.Debug("DB DEBUG: Started c.db.InsertMany(ctx, docs) inbox")
+	defer log.Debug("DB DEBUG: finished c.db.InsertMany(ctx, docs) inbox")
+	if err := checkWritable(ctx); err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	var expires *time.Time
+	if b.ttl > 0 {
+		at := now.Add(b.ttl)
+		expires = &at
+	}
+	ids := make([]primitive.ObjectID, 0, len(users))
+	docs := make([]any, 0, len(users))
+	for _, user := range users {
+		id := primitive.NewObjectID()
+		ids = append(ids, id)
+		docs = append(docs, Notification[T]{ID: id, User: user, Payload: payload, CreatedAt: now, ExpiresAt: expires})
+	}
+	_, err := b.db.InsertMany(ctx, docs)
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// List returns notifications of user newest first, only unread ones if unreadOnly, limit 0 returns all
+// if some failed, return err
+func (b *Inbox[T]) List(ctx context.Context, user string, unreadOnly bool, limit int64) ([]Notification[T], error) {
+	filter := bson.M{"user": user}
+	if unreadOnly {
+		filter["read"] = false
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := b.db.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	results := []Notification[T]{}
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// UnreadCount returns the number of unread notifications of user
+// if some failed, return err
+func (b *Inbox[T]) UnreadCount(ctx context.Context, user string) (int64, error) {
+	return b.db.CountDocuments(ctx, bson.M{"user": user, "read": false})
+}
+
+// MarkRead marks notifications ids of user read and returns the number of newly read ones
+// if some failed, return err
+func (b *Inbox[T]) MarkRead(ctx context.Context, user string, ids ...primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return b.markRead(ctx, bson.M{"user": user, "read": false, "_id": bson.M{"$in": ids}})
+}
+
+// MarkAllRead marks all notifications of user read and returns the number of newly read ones
+// if some failed, return err
+func (b *Inbox[T]) MarkAllRead(ctx context.Context, user string) (int64, error) {
+	return b.markRead(ctx, bson.M{"user": user, "read": false})
+}
+
+func (b *Inbox[T]) markRead(ctx context.Context, filter bson.M) (int64, error) {
+	if err := checkWritable(ctx); err != nil {
+		return 0, err
+	}
+	result, err := b.db.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// Delete deletes notifications ids of user, without ids it deletes nothing
+// if some failed, return err
+func (b *Inbox[T]) Delete(ctx context.Context, user string, ids ...primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return b.delete(ctx, bson.M{"user": user, "_id": bson.M{"$in": ids}})
+}
+
+// DeleteAll deletes all notifications of user
+// if some failed, return err
+func (b *Inbox[T]) DeleteAll(ctx context.Context, user string) (int64, error) {
+	return b.delete(ctx, bson.M{"user": user})
+}
+
+func (b *Inbox[T]) delete(ctx context.Context, filter bson.M) (int64, error) {
+	if err := checkWritable(ctx); err != nil {
+		return 0, err
+	}
+	result, err := b.db.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,164 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IndexConflictPolicy selects how EnsureIndexes resolves an existing index conflicting with a spec
+type IndexConflictPolicy int
+
+const (
+	// IndexConflictFail returns *IndexConflictError
+	IndexConflictFail IndexConflictPolicy = iota
+	// IndexConflictReplace builds the spec index under a new name first, then drops the old index,
+	// so queries are never left without an index. The server refuses two indexes with the same keys
+	// differing only in options such as unique, use IndexConflictRebuild for those.
+	IndexConflictReplace
+	// IndexConflictRebuild drops the old index, then builds the spec index,
+	// queries run without the index during the build
+	IndexConflictRebuild
+	// IndexConflictIgnore keeps the existing index
+	IndexConflictIgnore
+)
+
+// IndexConflictError is returned by EnsureIndexes when an existing index has the same keys or name
+// as a spec but different options
+type IndexConflictError struct {
+	Spec     IndexSpec
+	Existing string
+}
+
+func (e *IndexConflictError) Error() string {
+	return fmt.Sprintf("index %s conflicts with existing index %s", e.Spec.IndexName(), e.Existing)
+}
+
+// existingIndex is an index as reported by listIndexes
+type existingIndex struct {
+	Name   string `bson:"name"`
+	Key    bson.D `bson:"key"`
+	Unique bool   `bson:"unique"`
+	Sparse bool   `bson:"sparse"`
+
+	PartialFilterExpression bson.Raw `bson:"partialFilterExpression"`
+	WildcardProjection      bson.Raw `bson:"wildcardProjection"`
+}
+
+// sameKeys reports whether the spec indexes the same keys in the same order as index
+func (s IndexSpec) sameKeys(index existingIndex) bool {
+	if len(s.Keys) != len(index.Key) {
+		return false
+	}
+	for i, k := range s.Keys {
+		// the server may store 1 as int32 or double
+		if k.Key != index.Key[i].Key || fmt.Sprint(k.Value) != fmt.Sprint(index.Key[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameOptions reports whether the spec and index have the same options
+func (s IndexSpec) sameOptions(index existingIndex) bool {
+	return s.Unique == index.Unique &&
+		s.Sparse == index.Sparse &&
+		canonicalFilter(s.PartialFilterExpression) == canonicalFilter(index.PartialFilterExpression) &&
+		canonicalFilter(s.WildcardProjection) == canonicalFilter(index.WildcardProjection)
+}
+
+// canonicalFilter renders filter (or projection) independent of key order and numeric types, empty for no filter
+func canonicalFilter(filter any) string {
+	if filter == nil {
+		return ""
+	}
+	if raw, ok := filter.(bson.Raw); ok && len(raw) == 0 {
+		return ""
+	}
+	data, err := bson.Marshal(filter)
+	if err != nil {
+		return fmt.Sprint(filter)
+	}
+	var m bson.M
+	if err = bson.Unmarshal(data, &m); err != nil || len(m) == 0 {
+		return ""
+	}
+	// fmt prints maps sorted by key
+	return fmt.Sprint(m)
+}
+
+// indexPlan is the set of index changes needed to satisfy specs
+type indexPlan struct {
+	create []IndexSpec
+	// dropBefore are dropped before the builds, dropAfter after them
+	dropBefore []string
+	dropAfter  []string
+}
+
+func (p *indexPlan) empty() bool {
+	return len(p.create) == 0 && len(p.dropBefore) == 0 && len(p.dropAfter) == 0
+}
+
+// planIndexes compares specs with the indexes of the collection
+// if a conflict can't be resolved by the spec policy, return *IndexConflictError
+func (c *genericObjectDBCtrl[T]) planIndexes(ctx context.Context, specs []IndexSpec) (*indexPlan, error) {
+	existing, err := c.listIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, index := range existing {
+		names[index.Name] = true
+	}
+
+	plan := &indexPlan{}
+	for _, spec := range specs {
+		var conflict *existingIndex
+		satisfied := false
+		for i, index := range existing {
+			sameKeys := spec.sameKeys(index)
+			if sameKeys && spec.sameOptions(index) {
+				satisfied = true
+				break
+			}
+			if sameKeys || index.Name == spec.IndexName() {
+				conflict = &existing[i]
+			}
+		}
+		if satisfied {
+			continue
+		}
+		if conflict == nil {
+			plan.create = append(plan.create, spec)
+			continue
+		}
+
+		switch spec.OnConflict {
+		case IndexConflictIgnore:
+		case IndexConflictRebuild:
+			plan.dropBefore = append(plan.dropBefore, conflict.Name)
+			plan.create = append(plan.create, spec)
+		case IndexConflictReplace:
+			if names[spec.IndexName()] {
+				spec.Name = freeIndexName(spec.IndexName(), names)
+			}
+			names[spec.IndexName()] = true
+			plan.create = append(plan.create, spec)
+			plan.dropAfter = append(plan.dropAfter, conflict.Name)
+		default:
+			return nil, &IndexConflictError{Spec: spec, Existing: conflict.Name}
+		}
+	}
+	return plan, nil
+}
+
+// freeIndexName returns name suffixed with the first number not taken in names
+func freeIndexName(name string, names map[string]bool) string {
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s_%d", name, i)
+		if !names[candidate] {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexSpec declares an index of the collection
+type IndexSpec struct {
+	// Name of the index, derived from Keys like the server does ("a_1_b_-1") when empty
+	Name string
+	// Keys are the indexed fields in order with 1/-1 or an index type such as "text"
+	Keys   bson.D
+	Unique bool
+	// PartialFilterExpression (optional) limits the index to items matching the filter, e.g.
+	// bson.D{{Key: "deleted", Value: false}} with Unique for "unique among active items"
+	PartialFilterExpression any
+	// Sparse skips items missing the indexed fields
+	Sparse bool
+	// WildcardProjection (optional) includes or excludes paths of a "$**" wildcard index
+	WildcardProjection any
+	// OnConflict selects what EnsureIndexes does when the collection has an index with the same keys
+	// or name but different options
+	OnConflict IndexConflictPolicy
+}
+
+// IndexName returns the name of the index
+func (s IndexSpec) IndexName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	parts := make([]string, 0, len(s.Keys)*2)
+	for _, k := range s.Keys {
+		parts = append(parts, k.Key, fmt.Sprint(k.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (s IndexSpec) model() mongo.IndexModel {
+	opts := options.Index().SetName(s.IndexName())
+	if s.Unique {
+		opts.SetUnique(true)
+	}
+	if s.PartialFilterExpression != nil {
+		opts.SetPartialFilterExpression(s.PartialFilterExpression)
+	}
+	if s.Sparse {
+		opts.SetSparse(true)
+	}
+	if s.WildcardProjection != nil {
+		opts.SetWildcardProjection(s.WildcardProjection)
+	}
+	return mongo.IndexModel{Keys: s.Keys, Options: opts}
+}
+
+// EnsureIndexes creates the indexes of specs missing in the collection and waits for the builds.
+// Existing indexes with the same keys and options are kept whatever their names,
+// conflicting ones are handled by IndexSpec.OnConflict.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) EnsureIndexes(ctx context.Context, specs ...IndexSpec) (err error) {
+	defer c.recoverPanic(ctx, "EnsureIndexes", &err)
+	log.Debug("DB DEBUG: Started c.EnsureIndexes")
+	defer log.Debug("DB DEBUG: finished c.EnsureIndexes")
+
+	plan, err := c.planIndexes(ctx, specs)
+	if err != nil || plan.empty() {
+		return err
+	}
+	err = c.guardDDL(ctx, "createIndexes")
+	if err != nil {
+		return err
+	}
+	ctx, cancel, _ := c.begin(ctx, opDDL)
+	defer cancel()
+	err = c.dropIndexes(ctx, plan.dropBefore)
+	if err != nil {
+		return err
+	}
+	if len(plan.create) > 0 {
+		_, err = c.db.Indexes().CreateMany(ctx, indexModels(plan.create))
+		if err != nil {
+			return err
+		}
+	}
+	return c.dropIndexes(ctx, plan.dropAfter)
+}
+
+// listIndexes returns the built indexes of the collection
+func (c *genericObjectDBCtrl[T]) listIndexes(ctx context.Context) ([]existingIndex, error) {
+	cursor, err := c.db.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []existingIndex
+	err = cursor.All(ctx, &indexes)
+	if err != nil {
+		return nil, err
+	}
+	return indexes, nil
+}
+
+// indexNames returns names of the built indexes of the collection
+func (c *genericObjectDBCtrl[T]) indexNames(ctx context.Context) (map[string]bool, error) {
+	indexes, err := c.listIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, index := range indexes {
+		names[index.Name] = true
+	}
+	return names, nil
+}
+
+func (c *genericObjectDBCtrl[T]) dropIndexes(ctx context.Context, names []string) error {
+	for _, name := range names {
+		log.Debugf("DB DEBUG: dropping index %s of %s", name, c.db.Name())
+		_, err := c.db.Indexes().DropOne(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to drop index %s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func indexModels(specs []IndexSpec) []mongo.IndexModel {
+	models := make([]mongo.IndexModel, 0, len(specs))
+	for _, spec := range specs {
+		models = append(models, spec.model())
+	}
+	return models
+}
+
+// IndexBuildProgress is the state of an index build reported by $currentOp
+type IndexBuildProgress struct {
+	Name string
+	// Phase is the build message of the server, e.g. "Index Build: scanning collection"
+	Phase   string
+	Done    int64
+	Total   int64
+	Percent float64
+	// Finished is set once the index is ready
+	Finished bool
+}
+
+// IndexBuild is an index build started by StartIndexBuild
+type IndexBuild struct {
+	Names []string
+
+	done chan struct{}
+	err  error
+}
+
+// Done is closed when the build completes
+func (b *IndexBuild) Done() <-chan struct{} {
+	return b.done
+}
+
+// Err returns the result of the build after Done is closed
+func (b *IndexBuild) Err() error {
+	<-b.done
+	return b.err
+}
+
+// StartIndexBuild kicks off builds of the missing indexes of specs and returns without waiting for them,
+// indexes replaced by IndexConflictReplace are dropped when the build completes.
+// The server keeps building if the process exits, so after a restart progress is followed again with
+// WatchIndexBuild and the same names. onProgress (optional) receives progress every pollInterval.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) StartIndexBuild(ctx context.Context, pollInterval time.Duration, onProgress func(IndexBuildProgress), specs ...IndexSpec) (_ *IndexBuild, err error) {
+	defer c.recoverPanic(ctx, "StartIndexBuild", &err)
+	log.Debug("DB DEBUG: Started c.StartIndexBuild")
+	defer log.Debug("DB DEBUG: finished c.StartIndexBuild")
+
+	plan, err := c.planIndexes(ctx, specs)
+	if err != nil {
+		return nil, err
+	}
+	build := &IndexBuild{done: make(chan struct{})}
+	for _, spec := range plan.create {
+		build.Names = append(build.Names, spec.IndexName())
+	}
+	if plan.empty() {
+		close(build.done)
+		return build, nil
+	}
+	err = c.guardDDL(ctx, "createIndexes")
+	if err != nil {
+		return nil, err
+	}
+	err = c.dropIndexes(ctx, plan.dropBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	// the build outlives the call, only values of ctx are kept
+	buildCtx := context.WithoutCancel(ctx)
+	var once sync.Once
+	finish := func(err error) {
+		once.Do(func() {
+			build.err = err
+			close(build.done)
+		})
+	}
+	// a failed build stops the watch, a successful one is reported ready by its last poll
+	watchCtx, stopWatch := context.WithCancel(buildCtx)
+	go func() {
+		var err error
+		if len(plan.create) > 0 {
+			_, err = c.db.Indexes().CreateMany(buildCtx, indexModels(plan.create))
+		}
+		if err == nil {
+			err = c.dropIndexes(buildCtx, plan.dropAfter)
+		}
+		finish(err)
+		if err != nil || onProgress == nil {
+			stopWatch()
+		}
+	}()
+	if onProgress != nil {
+		go func() {
+			defer stopWatch()
+			err := c.WatchIndexBuild(watchCtx, build.Names, pollInterval, onProgress)
+			if err != nil && watchCtx.Err() == nil {
+				log.Errorf("DB ERROR: failed to watch index build: %s", err)
+			}
+		}()
+	}
+	return build, nil
+}
+
+// WatchIndexBuild polls $currentOp every pollInterval and reports progress of the builds of indexes names
+// to onProgress (optional) until all of them are ready. It works for builds started by another process too.
+// if an index is neither ready nor building in two consecutive polls (the build failed), return err
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) WatchIndexBuild(ctx context.Context, names []string, pollInterval time.Duration, onProgress func(IndexBuildProgress)) (err error) {
+	defer c.recoverPanic(ctx, "WatchIndexBuild", &err)
+	if pollInterval <= 0 {
+		pollInterval = 5 * time.Second
+	}
+	if onProgress == nil {
+		onProgress = func(IndexBuildProgress) {}
+	}
+	finished := map[string]bool{}
+	missing := map[string]int{}
+	for {
+		ready, err := c.indexNames(ctx)
+		if err != nil {
+			return err
+		}
+		ops, err := CurrentOps(ctx, c.db.Database(), map[string]any{
+			"command.createIndexes": c.db.Name(),
+			"command.indexes.name":  bson.M{"$in": names},
+		})
+		if err != nil {
+			return err
+		}
+
+		pending := 0
+		for _, name := range names {
+			if finished[name] {
+				continue
+			}
+			if ready[name] {
+				finished[name] = true
+				onProgress(IndexBuildProgress{Name: name, Percent: 100, Finished: true})
+				continue
+			}
+			pending++
+			op, ok := buildOp(ops, name)
+			if !ok {
+				missing[name]++
+				if missing[name] > 1 {
+					return fmt.Errorf("failed to build index %s: neither ready nor building", name)
+				}
+				continue
+			}
+			missing[name] = 0
+			progress := IndexBuildProgress{Name: name, Phase: op.Msg, Done: op.Progress.Done, Total: op.Progress.Total}
+			if op.Progress.Total > 0 {
+				progress.Percent = float64(op.Progress.Done) * 100 / float64(op.Progress.Total)
+			}
+			onProgress(progress)
+		}
+		if pending == 0 {
+			return nil
+		}
+		if err = sleepCtx(ctx, pollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// buildOp returns the operation building index name
+func buildOp(ops []CurrentOp, name string) (CurrentOp, bool) {
+	for _, op := range ops {
+		indexes, ok := op.Command.Lookup("indexes").ArrayOK()
+		if !ok {
+			continue
+		}
+		values, err := indexes.Values()
+		if err != nil {
+			continue
+		}
+		for _, v := range values {
+			if doc, ok := v.DocumentOK(); ok {
+				if indexName, ok := doc.Lookup("name").StringValueOK(); ok && indexName == name {
+					return op, true
+				}
+			}
+		}
+	}
+	return CurrentOp{}, false
+}
@@ -0,0 +1,29 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexSpecIndexName(t *testing.T) {
+	tests := []struct {
+		name string
+		spec IndexSpec
+		want string
+	}{
+		{name: "single", spec: IndexSpec{Keys: bson.D{{Key: "email", Value: 1}}}, want: "email_1"},
+		{name: "compound", spec: IndexSpec{Keys: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: -1}}}, want: "a_1_b_-1"},
+		{name: "typed", spec: IndexSpec{Keys: bson.D{{Key: "title", Value: "text"}}}, want: "title_text"},
+		{name: "nested", spec: IndexSpec{Keys: bson.D{{Key: "address.city", Value: 1}}}, want: "address.city_1"},
+		{name: "wildcard", spec: IndexSpec{Keys: bson.D{{Key: "$**", Value: 1}}}, want: "$**_1"},
+		{name: "explicit", spec: IndexSpec{Name: "by_email", Keys: bson.D{{Key: "email", Value: 1}}}, want: "by_email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.spec.IndexName(); got != tt.want {
+				t.Errorf("IndexName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package mongodb
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// IndexUsage is the usage of an index on one server since Since, as reported by $indexStats
+type IndexUsage struct {
+	Name  string
+	Key   bson.D
+	Host  string
+	Ops   int64
+	Since time.Time
+}
+
+// IndexUsageStats returns usage counters of the collection indexes, one entry per index and server
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) IndexUsageStats(ctx context.Context) (_ []IndexUsage, err error) {
+	defer c.recoverPanic(ctx, "IndexUsageStats", &err)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $indexStats)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $indexStats)")
+
+	cursor, err := c.db.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$indexStats", Value: bson.M{}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		Name     string `bson:"name"`
+		Key      bson.D `bson:"key"`
+		Host     string `bson:"host"`
+		Accesses struct {
+			Ops   int64     `bson:"ops"`
+			Since time.Time `bson:"since"`
+		} `bson:"accesses"`
+	}
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make([]IndexUsage, 0, len(results))
+	for _, r := range results {
+		usage = append(usage, IndexUsage{
+			Name:  r.Name,
+			Key:   r.Key,
+			Host:  r.Host,
+			Ops:   r.Accesses.Ops,
+			Since: r.Accesses.Since,
+		})
+	}
+	return usage, nil
+}
+
+// UnusedIndexes returns names of indexes not used on any server for at least window.
+// Counters reset on server restart, so an index is reported only when every server
+// has been counting for longer than window. The _id index is never reported.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) UnusedIndexes(ctx context.Context, window time.Duration) (_ []string, err error) {
+	defer c.recoverPanic(ctx, "UnusedIndexes", &err)
+	usage, err := c.IndexUsageStats(c.nested(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-window)
+	unused := map[string]bool{}
+	for _, u := range usage {
+		if u.Name == "_id_" {
+			continue
+		}
+		isUnused, seen := unused[u.Name]
+		if !seen {
+			isUnused = true
+		}
+		unused[u.Name] = isUnused && u.Ops == 0 && u.Since.Before(cutoff)
+	}
+
+	var names []string
+	for name, isUnused := range unused {
+		if isUnused {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,161 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// bounds of the batch size tuned by AutoBatch
+const (
+	autoBatchMin        = 16
+	autoBatchMax        = 10000
+	autoBatchInitial    = 101
+	autoBatchMaxHolding = time.Second
+)
+
+// IterateOption configures Iterate
+type IterateOption func(*iterateOptions)
+
+type iterateOptions struct {
+	batchSize   int32
+	targetBytes int
+	pooled      bool
+}
+
+// Resetter is implemented by models reused by WithPooledDecode, Reset clears the item
+// for the next decode keeping allocated capacity (e.g. slices truncated to zero length)
+type Resetter interface {
+	Reset()
+}
+
+// WithPooledDecode decodes items into values reused from a pool instead of allocating one per item,
+// for ingestion paths where GC pressure of millions of decodes matters.
+// fn MUST NOT retain the item after it returns. Items are cleared with Reset when T implements
+// Resetter, otherwise they are set to the zero value.
+func WithPooledDecode() IterateOption {
+	return func(o *iterateOptions) {
+		o.pooled = true
+	}
+}
+
+// WithBatchSize sets a fixed cursor batch size
+func WithBatchSize(size int32) IterateOption {
+	return func(o *iterateOptions) {
+		o.batchSize = size
+	}
+}
+
+// AutoBatch tunes the cursor batch size after every batch so a batch holds about targetBytes
+// of documents (by the observed average document size) and the consumer processes a batch
+// in about a second, balancing memory use against round trips
+func AutoBatch(targetBytes int) IterateOption {
+	return func(o *iterateOptions) {
+		o.targetBytes = targetBytes
+	}
+}
+
+// Iterate streams items identified by sels to fn one by one without loading them all in memory.
+// Iteration stops at the first error returned by fn, which is returned.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) Iterate(ctx context.Context, sels map[string]any, fn func(item *T) error, opts ...IterateOption) (err error) {
+	defer c.recoverPanic(ctx, "Iterate", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.Iterate")
+	defer log.Debug("DB DEBUG: finished c.Iterate")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+	c.warnUnindexedDynamic(ctx, sels)
+	c.recordAccess(sels, nil)
+
+	var o iterateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	findOpts := profile.findOptions()
+	if o.batchSize > 0 {
+		findOpts.SetBatchSize(o.batchSize)
+	} else if o.targetBytes > 0 {
+		findOpts.SetBatchSize(autoBatchInitial)
+	}
+
+	cursor, err := c.reader().Find(ctx, filterFromSels(sels), findOpts)
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	tuner := batchTuner{targetBytes: o.targetBytes}
+	for cursor.Next(ctx) {
+		item := c.newItem(o.pooled)
+		err = c.decodeItem(ctx, cursor.Current, item)
+		if err != nil {
+			return err
+		}
+
+		started := time.Now()
+		err = fn(item)
+		if o.pooled {
+			c.releaseItem(item)
+		}
+		if err != nil {
+			return err
+		}
+
+		if tuner.targetBytes > 0 {
+			tuner.observe(len(cursor.Current), time.Since(started))
+			if cursor.RemainingBatchLength() == 0 {
+				cursor.SetBatchSize(tuner.next())
+			}
+		}
+	}
+	return cursorErr(ctx, cursor)
+}
+
+// batchTuner derives the next batch size from document sizes and consumer speed of the last batch
+type batchTuner struct {
+	targetBytes int
+	docs        int
+	bytes       int
+	consuming   time.Duration
+}
+
+func (t *batchTuner) observe(size int, consuming time.Duration) {
+	t.docs++
+	t.bytes += size
+	t.consuming += consuming
+}
+
+func (t *batchTuner) next() int32 {
+	if t.docs == 0 {
+		return autoBatchInitial
+	}
+	size := t.targetBytes / max(t.bytes/t.docs, 1)
+	if perDoc := t.consuming / time.Duration(t.docs); perDoc > 0 {
+		size = min(size, int(autoBatchMaxHolding/perDoc))
+	}
+	t.docs, t.bytes, t.consuming = 0, 0, 0
+	return int32(min(max(size, autoBatchMin), autoBatchMax))
+}
+
+// newItem returns a zero item, from the controller pool when pooled
+func (c *genericObjectDBCtrl[T]) newItem(pooled bool) *T {
+	if pooled {
+		if item, ok := c.pool.Get().(*T); ok {
+			return item
+		}
+	}
+	return new(T)
+}
+
+// releaseItem clears item and returns it to the controller pool
+func (c *genericObjectDBCtrl[T]) releaseItem(item *T) {
+	if resetter, ok := any(item).(Resetter); ok {
+		resetter.Reset()
+	} else {
+		var zero T
+		*item = zero
+	}
+	c.pool.Put(item)
+}
@@ -0,0 +1,69 @@
+package mongodb
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type localeKey struct{}
+
+// WithLocale returns a context whose controller reads sort and compare strings by the rules of
+// locale (an ICU locale such as "fr" or "de"), see WithLocaleCollation
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, localeKey{}, locale)
+}
+
+// LocaleFromContext returns the locale set by WithLocale
+func LocaleFromContext(ctx context.Context) (string, bool) {
+	locale, ok := ctx.Value(localeKey{}).(string)
+	return locale, ok && locale != ""
+}
+
+// LocaleFromAcceptLanguage returns the locale of the most preferred language of an HTTP
+// Accept-Language header, "" for none or "*". Only the primary language subtag is kept
+// ("pt-BR" is "pt") since the server supports few region specific collations.
+func LocaleFromAcceptLanguage(header string) string {
+	best, bestQ := "", -1.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			// a malformed weight counts as q=0, not acceptable
+			q, _ = strconv.ParseFloat(v, 64)
+		}
+		if tag == "" || tag == "*" || q <= 0 || q <= bestQ {
+			continue
+		}
+		best, bestQ = tag, q
+	}
+	language, _, _ := strings.Cut(best, "-")
+	return strings.ToLower(language)
+}
+
+// WithLocaleCollation applies the locale of the call context (see WithLocale) as the collation of
+// the controller's find queries and counts, so user facing lists sort per user without passing
+// collations around. base sets the other collation fields, e.g. Strength 2 for case insensitive
+// comparison. Calls without a locale and deployments without collation support are unchanged.
+// Note: queries use an index only if it was created with the same collation.
+func WithLocaleCollation(base options.Collation) Option {
+	return func(o *ctrlOptions) {
+		o.localeCollation = &base
+	}
+}
+
+// collation returns the collation of the call by WithLocaleCollation, nil for none
+func (c *genericObjectDBCtrl[T]) collation(ctx context.Context) *options.Collation {
+	if c.opts.localeCollation == nil || !c.opts.compat.Supports(FeatureCollation) {
+		return nil
+	}
+	locale, ok := LocaleFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	collation := *c.opts.localeCollation
+	collation.Locale = locale
+	return &collation
+}
@@ -0,0 +1,163 @@
+package mongodb
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// localizedSortField holds the sort key of ListLocalized during the aggregation
+const localizedSortField = "_localized_sort"
+
+// LocalizedText is a text stored per language as map[lang]string, e.g.
+// Title LocalizedText `bson:"title"` stored as {"title": {"en": "Chair", "de": "Stuhl"}}.
+// Languages are the locales of WithLocale, see SetLocalized for updates of one language.
+type LocalizedText map[string]string
+
+type fallbackLocalesKey struct{}
+
+// WithFallbackLocales returns a context whose localized reads fall back to locales, in order,
+// when a text lacks the locale of WithLocale
+func WithFallbackLocales(ctx context.Context, locales ...string) context.Context {
+	return context.WithValue(ctx, fallbackLocalesKey{}, locales)
+}
+
+// LocaleFallbacks returns the locales localized reads with ctx try in order: the locale of
+// WithLocale, its language without region ("pt" for "pt_BR") and the locales of
+// WithFallbackLocales
+func LocaleFallbacks(ctx context.Context) []string {
+	var chain []string
+	add := func(locale string) {
+		for _, l := range chain {
+			if l == locale {
+				return
+			}
+		}
+		chain = append(chain, locale)
+	}
+	if locale, ok := LocaleFromContext(ctx); ok {
+		add(locale)
+		if language, _, found := strings.Cut(strings.ReplaceAll(locale, "-", "_"), "_"); found {
+			add(language)
+		}
+	}
+	fallbacks, _ := ctx.Value(fallbackLocalesKey{}).([]string)
+	for _, locale := range fallbacks {
+		add(locale)
+	}
+	return chain
+}
+
+// In returns the text of the first of locales it has
+func (t LocalizedText) In(locales ...string) (string, bool) {
+	for _, locale := range locales {
+		if text, ok := t[locale]; ok {
+			return text, true
+		}
+	}
+	return "", false
+}
+
+// Get returns the text in the first locale of LocaleFallbacks(ctx) it has, otherwise the text of
+// its first language in lexical order so a text is never shown empty, "" for an empty text
+func (t LocalizedText) Get(ctx context.Context) string {
+	if text, ok := t.In(LocaleFallbacks(ctx)...); ok {
+		return text
+	}
+	languages := make([]string, 0, len(t))
+	for language := range t {
+		languages = append(languages, language)
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+	sort.Strings(languages)
+	return t[languages[0]]
+}
+
+// SetLocalized sets the text of language of the LocalizedText field of the item by id, leaving
+// the other languages untouched
+// if not found, return mongo.ErrNoDocuments
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) SetLocalized(ctx context.Context, id any, field string, language string, text string) (err error) {
+	defer c.recoverPanic(ctx, "SetLocalized", &err)
+	return c.SetAttrs(c.nested(ctx), id, field, map[string]any{language: text})
+}
+
+// UnsetLocalized removes languages from the LocalizedText field of the item by id
+// if not found, return mongo.ErrNoDocuments
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) UnsetLocalized(ctx context.Context, id any, field string, languages ...string) (err error) {
+	defer c.recoverPanic(ctx, "UnsetLocalized", &err)
+	return c.UnsetAttrs(c.nested(ctx), id, field, languages...)
+}
+
+// ListLocalized lists items by sels filter (logical AND) ordered by the text of the LocalizedText
+// field in the locales of LocaleFallbacks(ctx), order 1 ascending and -1 descending, compared
+// with the collation of the context locale. Items without a text in any of them sort as null.
+// limit <= 0 means no limit.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ListLocalized(ctx context.Context, sels map[string]any, field string, order int, limit int64) (_ []T, err error) {
+	defer c.recoverPanic(ctx, "ListLocalized", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, localized sort)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, localized sort)")
+	err = checkDynamicField[T](field)
+	if err != nil {
+		return nil, err
+	}
+	chain := LocaleFallbacks(ctx)
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	// nested two argument $ifNull, variadic $ifNull needs 5.0
+	var key any
+	for i := len(chain) - 1; i >= 0; i-- {
+		key = bson.M{"$ifNull": bson.A{"$" + AttrPath(field, chain[i]), key}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filterFromSels(sels)}},
+		{{Key: "$addFields", Value: bson.M{localizedSortField: key}}},
+		{{Key: "$sort", Value: bson.D{{Key: localizedSortField, Value: order}, {Key: "_id", Value: 1}}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$unset", Value: localizedSortField}})
+
+	opts := options.Aggregate()
+	if profile.MaxTime > 0 {
+		opts.SetMaxTime(profile.MaxTime)
+	}
+	if len(chain) > 0 && c.opts.compat.Supports(FeatureCollation) {
+		collation := options.Collation{Locale: chain[0]}
+		if c.opts.localeCollation != nil {
+			collation = *c.opts.localeCollation
+			collation.Locale = chain[0]
+		}
+		opts.SetCollation(&collation)
+	}
+	cursor, err := c.reader().Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	items := []T{}
+	for cursor.Next(ctx) {
+		var item T
+		err = c.decodeItem(ctx, cursor.Current, &item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
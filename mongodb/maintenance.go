@@ -0,0 +1,93 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// ErrOutsideMaintenanceWindow is returned by DDL operations blocked by WithMaintenanceWindow
+var ErrOutsideMaintenanceWindow = errors.New("DDL operation outside maintenance window")
+
+// MaintenanceWindow is a daily time window in which heavy DDL such as index builds is allowed.
+// Start and End are offsets from midnight in Location (UTC when nil), End before Start wraps past midnight.
+type MaintenanceWindow struct {
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+	// Queue makes DDL outside the window wait for the window to open instead of failing
+	Queue bool
+}
+
+// WithMaintenanceWindow guards index builds and other DDL of the controller with window,
+// so startup code can't accidentally start an index build at peak traffic.
+// Use WithMaintenanceOverride to run DDL outside the window deliberately.
+func WithMaintenanceWindow(window MaintenanceWindow) Option {
+	return func(o *ctrlOptions) {
+		o.maintenance = &window
+	}
+}
+
+type maintenanceOverrideKey struct{}
+
+// WithMaintenanceOverride allows DDL made with the returned context outside the maintenance window
+func WithMaintenanceOverride(ctx context.Context) context.Context {
+	return context.WithValue(ctx, maintenanceOverrideKey{}, true)
+}
+
+// Contains reports whether t is inside the window
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	offset := w.offset(t)
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// Next returns the time the window opens next after t, t itself if the window is open
+func (w MaintenanceWindow) Next(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	wait := w.Start - w.offset(t)
+	if wait < 0 {
+		wait += 24 * time.Hour
+	}
+	return t.Add(wait)
+}
+
+// offset returns the time of day of t in the window location
+func (w MaintenanceWindow) offset(t time.Time) time.Duration {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+}
+
+// guardDDL checks the maintenance window before a DDL operation, waiting for it in queue mode
+// if outside the window, return ErrOutsideMaintenanceWindow
+func (c *genericObjectDBCtrl[T]) guardDDL(ctx context.Context, op string) error {
+	window := c.opts.maintenance
+	if window == nil {
+		return nil
+	}
+	if override, _ := ctx.Value(maintenanceOverrideKey{}).(bool); override {
+		log.Warnf("DB WARN: %s on %s outside maintenance window by override", op, c.db.Name())
+		return nil
+	}
+	now := time.Now()
+	if window.Contains(now) {
+		return nil
+	}
+	next := window.Next(now)
+	if !window.Queue {
+		return errors.Wrapf(ErrOutsideMaintenanceWindow, "%s on %s, window opens at %s", op, c.db.Name(), next.Format(time.RFC3339))
+	}
+	log.Debugf("DB DEBUG: %s on %s queued until %s", op, c.db.Name(), next.Format(time.RFC3339))
+	return sleepCtx(ctx, time.Until(next))
+}
@@ -0,0 +1,206 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChildCounter keeps CountField of parent documents (e.g. post.comments_count) equal to the number
+// of child documents referencing them by ParentField (e.g. comment.post_id). Child writes made
+// through it and the $inc of the parent commit in one transaction (requires a replica set), and
+// Reconcile repairs drift left by writes made around it.
+type ChildCounter struct {
+	Parents     *mongo.Collection
+	CountField  string
+	Children    *mongo.Collection
+	ParentField string
+}
+
+// CreateChild inserts child and increments the counter of its parent, returns the child _id
+// if child has no ParentField, return err
+// if the parent does not exist, return *NotFoundError
+// if some failed, return err
+func (cc *ChildCounter) CreateChild(ctx context.Context, child any) (any, error) {
+	log.Debug("DB DEBUG: Started ChildCounter.CreateChild")
+	defer log.Debug("DB DEBUG: finished ChildCounter.CreateChild")
+	data, err := bson.Marshal(child)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal child: %s", err)
+	}
+	parent, err := bson.Raw(data).LookupErr(strings.Split(cc.ParentField, ".")...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create child: no %s", cc.ParentField)
+	}
+	return cc.transact(ctx, func(sc mongo.SessionContext) (any, error) {
+		res, err := cc.Children.InsertOne(sc, bson.Raw(data))
+		if err != nil {
+			return nil, err
+		}
+		return res.InsertedID, cc.incParent(sc, parent, 1)
+	})
+}
+
+// DeleteChild deletes the child id and decrements the counter of its parent,
+// returns false if the child does not exist
+// if some failed, return err
+func (cc *ChildCounter) DeleteChild(ctx context.Context, id any) (bool, error) {
+	log.Debug("DB DEBUG: Started ChildCounter.DeleteChild")
+	defer log.Debug("DB DEBUG: finished ChildCounter.DeleteChild")
+	deleted, err := cc.transact(ctx, func(sc mongo.SessionContext) (any, error) {
+		opts := options.FindOneAndDelete().SetProjection(bson.M{cc.ParentField: 1})
+		raw, err := cc.Children.FindOneAndDelete(sc, bson.M{"_id": id}, opts).Raw()
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if parent, err := raw.LookupErr(strings.Split(cc.ParentField, ".")...); err == nil {
+			return true, cc.incParent(sc, parent, -1)
+		}
+		return true, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return deleted.(bool), nil
+}
+
+// MoveChild changes the parent of the child id to parent and moves its count along,
+// returns false if the child does not exist
+// if parent does not exist, return *NotFoundError
+// if some failed, return err
+func (cc *ChildCounter) MoveChild(ctx context.Context, id any, parent any) (bool, error) {
+	log.Debug("DB DEBUG: Started ChildCounter.MoveChild")
+	defer log.Debug("DB DEBUG: finished ChildCounter.MoveChild")
+	moved, err := cc.transact(ctx, func(sc mongo.SessionContext) (any, error) {
+		opts := options.FindOneAndUpdate().SetProjection(bson.M{cc.ParentField: 1})
+		raw, err := cc.Children.FindOneAndUpdate(sc, bson.M{"_id": id}, bson.M{"$set": bson.M{cc.ParentField: parent}}, opts).Raw()
+		if err == mongo.ErrNoDocuments {
+			return false, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if previous, err := raw.LookupErr(strings.Split(cc.ParentField, ".")...); err == nil {
+			if refKey(previous) == refKey(parent) {
+				return true, nil
+			}
+			if err = cc.incParent(sc, previous, -1); err != nil {
+				return nil, err
+			}
+		}
+		return true, cc.incParent(sc, parent, 1)
+	})
+	if err != nil {
+		return false, err
+	}
+	return moved.(bool), nil
+}
+
+// Reconcile recounts the children of every parent and sets the counters that drifted,
+// returns the number of parents repaired. It reads all parents with a $lookup using an index
+// on ParentField, so schedule it off peak (see Handler). Requires MongoDB 5.0.
+// if some failed, return err
+func (cc *ChildCounter) Reconcile(ctx context.Context) (int64, error) {
+	log.Debug("DB DEBUG: Started ChildCounter.Reconcile")
+	defer log.Debug("DB DEBUG: finished ChildCounter.Reconcile")
+	if err := checkWritable(ctx); err != nil {
+		return 0, err
+	}
+	cursor, err := cc.Parents.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: cc.Children.Name()},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: cc.ParentField},
+			{Key: "pipeline", Value: bson.A{bson.M{"$project": bson.M{"_id": 1}}}},
+			{Key: "as", Value: "_children"},
+		}}},
+		{{Key: "$project", Value: bson.M{"actual": bson.M{"$size": "$_children"}, "stored": "$" + cc.CountField}}},
+		{{Key: "$match", Value: bson.M{"$expr": bson.M{"$ne": bson.A{"$actual", "$stored"}}}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	var repaired int64
+	for cursor.Next(ctx) {
+		var drift struct {
+			ID     any   `bson:"_id"`
+			Actual int64 `bson:"actual"`
+		}
+		err = cursor.Decode(&drift)
+		if err != nil {
+			return repaired, err
+		}
+		// a concurrent transaction may have changed the counter since, recount this parent in
+		// a transaction, so a child write committing meanwhile conflicts with setting the counter
+		modified, err := cc.transact(ctx, func(sc mongo.SessionContext) (any, error) {
+			count, err := cc.Children.CountDocuments(sc, bson.M{cc.ParentField: drift.ID})
+			if err != nil {
+				return nil, err
+			}
+			res, err := cc.Parents.UpdateOne(sc, bson.M{"_id": drift.ID}, bson.M{"$set": bson.M{cc.CountField: count}})
+			if err != nil {
+				return nil, err
+			}
+			return res.ModifiedCount, nil
+		})
+		if err != nil {
+			return repaired, err
+		}
+		repaired += modified.(int64)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return repaired, err
+	}
+	if repaired > 0 {
+		log.Warnf("DB WARN: repaired %d %s counters of %s", repaired, cc.CountField, cc.Parents.Name())
+	}
+	return repaired, nil
+}
+
+// Handler returns a ScheduleHandler running Reconcile, to register it with Schedules
+func (cc *ChildCounter) Handler() ScheduleHandler {
+	return func(ctx context.Context, _ time.Time) error {
+		_, err := cc.Reconcile(ctx)
+		return err
+	}
+}
+
+// incParent adds n to the counter of parent, a missing parent aborts the transaction of an
+// increment, children of a deleted parent may still be deleted or moved away
+func (cc *ChildCounter) incParent(ctx context.Context, parent any, n int64) error {
+	res, err := cc.Parents.UpdateOne(ctx, bson.M{"_id": parent}, bson.M{"$inc": bson.M{cc.CountField: n}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 && n > 0 {
+		return &NotFoundError{Collection: cc.Parents.Name(), ID: parent}
+	}
+	return nil
+}
+
+// transact runs fn in a transaction of a session of the children client
+func (cc *ChildCounter) transact(ctx context.Context, fn func(sc mongo.SessionContext) (any, error)) (any, error) {
+	if err := checkWritable(ctx); err != nil {
+		return nil, err
+	}
+	if err := requireCompat(cc.Children.Database(), cc.Children.Name(), FeatureTransactions); err != nil {
+		return nil, err
+	}
+	session, err := cc.Children.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+	return session.WithTransaction(ctx, fn)
+}
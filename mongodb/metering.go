@@ -0,0 +1,319 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// meteringCollection stores usage records of CollectionSink
+const meteringCollection = "_metering"
+
+// UsageKind is the kind of a UsageRecord
+type UsageKind string
+
+const (
+	UsageRead    UsageKind = "read"
+	UsageWrite   UsageKind = "write"
+	UsageStorage UsageKind = "storage"
+	// UsageTransfer is the wire traffic of commands, Bytes are request and response sizes,
+	// see PayloadMonitor
+	UsageTransfer UsageKind = "transfer"
+)
+
+// UsageRecord is the database usage of a tenant in a collection over a metering interval, or for
+// UsageStorage the stored documents and bytes at At
+type UsageRecord struct {
+	Tenant     string    `bson:"tenant" json:"tenant"`
+	Collection string    `bson:"collection" json:"collection"`
+	Kind       UsageKind `bson:"kind" json:"kind"`
+	Operations int64     `bson:"operations" json:"operations"`
+	Documents  int64     `bson:"documents" json:"documents"`
+	Bytes      int64     `bson:"bytes" json:"bytes"`
+	At         time.Time `bson:"at" json:"at"`
+}
+
+// MeteringSink receives batches of usage records, e.g. to forward them to a billing system
+type MeteringSink interface {
+	Write(ctx context.Context, records []UsageRecord) error
+}
+
+// CollectionSink is a MeteringSink inserting records into the metering collection of a database
+type CollectionSink struct {
+	db *mongo.Collection
+}
+
+// NewCollectionSink creates a CollectionSink storing records in the metering collection of db
+func NewCollectionSink(db *mongo.Database) *CollectionSink {
+	return &CollectionSink{db: db.Collection(meteringCollection)}
+}
+
+func (s *CollectionSink) Write(ctx context.Context, records []UsageRecord) error {
+	docs := make([]any, len(records))
+	for i := range records {
+		docs[i] = records[i]
+	}
+	_, err := s.db.InsertMany(ctx, docs)
+	return err
+}
+
+type usageKey struct {
+	tenant     string
+	collection string
+	kind       UsageKind
+}
+
+// Meter sums usage per tenant, collection and kind and writes one record of each to the sink every
+// interval, so metering costs a write per interval instead of per operation
+type Meter struct {
+	sink     MeteringSink
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[usageKey]*UsageRecord
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewMeter starts a Meter flushing to sink every interval, call Close to flush the rest and stop it
+func NewMeter(sink MeteringSink, interval time.Duration) *Meter {
+	ctx, stop := context.WithCancel(context.Background())
+	m := &Meter{
+		sink:     sink,
+		interval: interval,
+		pending:  map[usageKey]*UsageRecord{},
+		stop:     stop,
+		done:     make(chan struct{}),
+	}
+	go m.run(ctx)
+	return m
+}
+
+// Add adds one operation on documents totalling bytes to the usage of tenant in collection
+func (m *Meter) Add(tenant string, collection string, kind UsageKind, documents int64, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := usageKey{tenant: tenant, collection: collection, kind: kind}
+	record, ok := m.pending[key]
+	if !ok {
+		record = &UsageRecord{Tenant: tenant, Collection: collection, Kind: kind}
+		m.pending[key] = record
+	}
+	record.Operations++
+	record.Documents += documents
+	record.Bytes += bytes
+}
+
+// Flush writes the pending usage to the sink
+// if some failed, the usage is kept for the next flush and return err
+func (m *Meter) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = map[usageKey]*UsageRecord{}
+	m.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+	now := time.Now()
+	records := make([]UsageRecord, 0, len(pending))
+	for _, record := range pending {
+		record.At = now
+		records = append(records, *record)
+	}
+	err := m.sink.Write(ctx, records)
+	if err != nil {
+		m.mu.Lock()
+		for key, record := range pending {
+			if current, ok := m.pending[key]; ok {
+				current.Operations += record.Operations
+				current.Documents += record.Documents
+				current.Bytes += record.Bytes
+			} else {
+				m.pending[key] = record
+			}
+		}
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close stops the periodic flushes and flushes the pending usage
+// if some failed, return err
+func (m *Meter) Close(ctx context.Context) error {
+	m.stop()
+	<-m.done
+	return m.Flush(ctx)
+}
+
+func (m *Meter) run(ctx context.Context) {
+	defer close(m.done)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Flush(ctx); err != nil && ctx.Err() == nil {
+				log.Warnf("DB WARN: failed to flush usage records: %s", err)
+			}
+		}
+	}
+}
+
+// RecordStorage writes the documents and bytes (BSON size) stored per tenant in collection, by the
+// tenant id in tenantField, to the sink as UsageStorage records. It scans the collection, schedule
+// it e.g. daily. Requires MongoDB 4.4.
+// if some failed, return err
+func (m *Meter) RecordStorage(ctx context.Context, collection *mongo.Collection, tenantField string) error {
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $bsonSize) storage")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $bsonSize) storage")
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$" + tenantField},
+			{Key: "documents", Value: bson.M{"$sum": 1}},
+			{Key: "bytes", Value: bson.M{"$sum": bson.M{"$bsonSize": "$$ROOT"}}},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	var rows []struct {
+		Tenant    any   `bson:"_id"`
+		Documents int64 `bson:"documents"`
+		Bytes     int64 `bson:"bytes"`
+	}
+	err = cursor.All(ctx, &rows)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	records := make([]UsageRecord, 0, len(rows))
+	for _, row := range rows {
+		tenant, _ := row.Tenant.(string)
+		records = append(records, UsageRecord{
+			Tenant:     tenant,
+			Collection: collection.Name(),
+			Kind:       UsageStorage,
+			Operations: 1,
+			Documents:  row.Documents,
+			Bytes:      row.Bytes,
+			At:         now,
+		})
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return m.sink.Write(ctx, records)
+}
+
+// Metered is a Repository adding the reads and writes of the tenant of the context (see WithTenant,
+// "" without one) to a Meter. Bytes are the BSON sizes of the items read and written.
+type Metered[T any] struct {
+	Repository[T]
+
+	name  string
+	meter *Meter
+}
+
+// NewMetered meters repo storing items of collection name with meter
+func NewMetered[T any](repo Repository[T], name string, meter *Meter) *Metered[T] {
+	return &Metered[T]{Repository: repo, name: name, meter: meter}
+}
+
+func (m *Metered[T]) add(ctx context.Context, kind UsageKind, items ...*T) {
+	tenant, _ := TenantFromContext(ctx)
+	var size int64
+	for _, item := range items {
+		if n, err := itemSize(item); err == nil {
+			size += n
+		}
+	}
+	m.meter.Add(tenant, m.name, kind, int64(len(items)), size)
+}
+
+func (m *Metered[T]) Create(ctx context.Context, item *T) (*CreateResult, error) {
+	result, err := m.Repository.Create(ctx, item)
+	if err == nil {
+		m.add(ctx, UsageWrite, item)
+	}
+	return result, err
+}
+
+func (m *Metered[T]) Get(ctx context.Context, id any) (*T, error) {
+	item, err := m.Repository.Get(ctx, id)
+	if err == nil {
+		m.add(ctx, UsageRead, item)
+	}
+	return item, err
+}
+
+func (m *Metered[T]) Find(ctx context.Context, q Query) (*T, error) {
+	item, err := m.Repository.Find(ctx, q)
+	if err == nil {
+		m.add(ctx, UsageRead, item)
+	}
+	return item, err
+}
+
+func (m *Metered[T]) List(ctx context.Context, q Query) ([]T, error) {
+	items, err := m.Repository.List(ctx, q)
+	if err == nil {
+		read := make([]*T, len(items))
+		for i := range items {
+			read[i] = &items[i]
+		}
+		m.add(ctx, UsageRead, read...)
+	}
+	return items, err
+}
+
+func (m *Metered[T]) Count(ctx context.Context, q Query) (int64, error) {
+	count, err := m.Repository.Count(ctx, q)
+	if err == nil {
+		m.add(ctx, UsageRead)
+	}
+	return count, err
+}
+
+func (m *Metered[T]) Update(ctx context.Context, id any, item *T) (*UpdateResult, error) {
+	result, err := m.Repository.Update(ctx, id, item)
+	if err == nil {
+		m.add(ctx, UsageWrite, item)
+	}
+	return result, err
+}
+
+func (m *Metered[T]) UpdateAttributes(ctx context.Context, q Query, attrs map[string]any) (*UpdateResult, error) {
+	result, err := m.Repository.UpdateAttributes(ctx, q, attrs)
+	if err == nil {
+		tenant, _ := TenantFromContext(ctx)
+		size, _ := bson.Marshal(attrs)
+		m.meter.Add(tenant, m.name, UsageWrite, result.Modified, int64(len(size))*result.Modified)
+	}
+	return result, err
+}
+
+func (m *Metered[T]) Delete(ctx context.Context, id any) (*DeleteResult, error) {
+	result, err := m.Repository.Delete(ctx, id)
+	if err == nil {
+		tenant, _ := TenantFromContext(ctx)
+		m.meter.Add(tenant, m.name, UsageWrite, result.Deleted, 0)
+	}
+	return result, err
+}
+
+func (m *Metered[T]) DeleteRange(ctx context.Context, q Query) (*DeleteResult, error) {
+	result, err := m.Repository.DeleteRange(ctx, q)
+	if err == nil {
+		tenant, _ := TenantFromContext(ctx)
+		m.meter.Add(tenant, m.name, UsageWrite, result.Deleted, 0)
+	}
+	return result, err
+}
@@ -0,0 +1,285 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultMigrateBatchSize is the number of documents written per bulk write of Migrator
+const defaultMigrateBatchSize = 1000
+
+// MigrationProgress reports the progress of Migrator
+type MigrationProgress struct {
+	Collection string
+	// Copied is the number of documents copied from Collection so far
+	Copied int64
+	// Applied is the number of change events applied by Tail so far
+	Applied int64
+}
+
+// MigrationDiff is a collection whose source and target differ after Verify
+type MigrationDiff struct {
+	Collection     string
+	SourceCount    int64
+	TargetCount    int64
+	SourceChecksum string
+	TargetChecksum string
+}
+
+// Migrator copies collections between databases, usually on different clusters, for cluster moves:
+// Copy makes the initial bulk copy with indexes, Tail applies the changes made since the copy
+// started until the cutover, and Verify compares counts and checksums.
+// Writes are idempotent, so an interrupted Copy can be rerun.
+type Migrator struct {
+	Source *mongo.Database
+	Target *mongo.Database
+	// Collections to migrate, all collections of Source when empty
+	Collections []string
+	// BatchSize is the number of documents per bulk write, 1000 by default
+	BatchSize int
+	// Rate limits copied documents per second, unlimited when 0
+	Rate float64
+	// OnProgress is called after every bulk write
+	OnProgress func(MigrationProgress)
+}
+
+// Copy copies documents and indexes of the collections to Target and returns the resume token
+// to Tail the changes made since the copy started
+// if some failed, return err
+func (m *Migrator) Copy(ctx context.Context) (bson.Raw, error) {
+	log.Debug("DB DEBUG: Started Migrator.Copy")
+	defer log.Debug("DB DEBUG: finished Migrator.Copy")
+
+	if err := requireCompat(m.Source, "", FeatureChangeStreams); err != nil {
+		return nil, err
+	}
+	collections, err := m.collections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the stream is opened before copying so no change made during the copy is missed
+	stream, err := m.Source.Watch(ctx, m.changesPipeline(collections))
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch %s: %s", m.Source.Name(), err)
+	}
+	token := stream.ResumeToken()
+	stream.Close(ctx)
+
+	for _, name := range collections {
+		err = m.copyCollection(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %s", name, err)
+		}
+	}
+	return token, nil
+}
+
+// Tail applies changes of the collections after token to Target until ctx is done,
+// cancel ctx at the cutover once writes to Source are stopped and Tail caught up
+// if ctx is done, return nil
+// if some failed, return err
+func (m *Migrator) Tail(ctx context.Context, token bson.Raw) error {
+	log.Debug("DB DEBUG: Started Migrator.Tail")
+	defer log.Debug("DB DEBUG: finished Migrator.Tail")
+
+	if err := requireCompat(m.Source, "", FeatureChangeStreams); err != nil {
+		return err
+	}
+	collections, err := m.collections(ctx)
+	if err != nil {
+		return err
+	}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if token != nil {
+		opts.SetStartAfter(token)
+	}
+	stream, err := m.Source.Watch(ctx, m.changesPipeline(collections), opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	applied := map[string]int64{}
+	for stream.Next(ctx) {
+		var event struct {
+			OperationType string `bson:"operationType"`
+			NS            struct {
+				Coll string `bson:"coll"`
+			} `bson:"ns"`
+			DocumentKey  bson.Raw `bson:"documentKey"`
+			FullDocument bson.Raw `bson:"fullDocument"`
+		}
+		err = stream.Decode(&event)
+		if err != nil {
+			return err
+		}
+		target := m.Target.Collection(event.NS.Coll)
+		switch event.OperationType {
+		case "insert", "update", "replace":
+			if event.FullDocument == nil {
+				// deleted after the update, the delete event follows
+				continue
+			}
+			_, err = target.ReplaceOne(ctx, event.DocumentKey, event.FullDocument, options.Replace().SetUpsert(true))
+		case "delete":
+			_, err = target.DeleteOne(ctx, event.DocumentKey)
+		default:
+			log.Warnf("DB WARN: migration of %s skipped %s event", event.NS.Coll, event.OperationType)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		applied[event.NS.Coll]++
+		if m.OnProgress != nil {
+			m.OnProgress(MigrationProgress{Collection: event.NS.Coll, Applied: applied[event.NS.Coll]})
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return stream.Err()
+}
+
+// Verify compares document counts and checksums of the collections in Source and Target
+// and returns the differing ones
+// if some failed, return err
+func (m *Migrator) Verify(ctx context.Context) ([]MigrationDiff, error) {
+	log.Debug("DB DEBUG: Started Migrator.Verify")
+	defer log.Debug("DB DEBUG: finished Migrator.Verify")
+
+	collections, err := m.collections(ctx)
+	if err != nil {
+		return nil, err
+	}
+	diffs := []MigrationDiff{}
+	for _, name := range collections {
+		diff := MigrationDiff{Collection: name}
+		diff.SourceChecksum, diff.SourceCount, err = collectionChecksum(ctx, m.Source.Collection(name))
+		if err != nil {
+			return nil, err
+		}
+		diff.TargetChecksum, diff.TargetCount, err = collectionChecksum(ctx, m.Target.Collection(name))
+		if err != nil {
+			return nil, err
+		}
+		if diff.SourceCount != diff.TargetCount || diff.SourceChecksum != diff.TargetChecksum {
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs, nil
+}
+
+func (m *Migrator) collections(ctx context.Context) ([]string, error) {
+	if len(m.Collections) > 0 {
+		return m.Collections, nil
+	}
+	return m.Source.ListCollectionNames(ctx, bson.M{"type": "collection", "name": bson.M{"$not": bson.M{"$regex": "^system\\."}}})
+}
+
+func (m *Migrator) changesPipeline(collections []string) mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ns.coll": bson.M{"$in": collections}}}},
+	}
+}
+
+func (m *Migrator) copyCollection(ctx context.Context, name string) error {
+	source := m.Source.Collection(name)
+	target := m.Target.Collection(name)
+
+	indexes, err := source.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(indexes))
+	for indexes.Next(ctx) {
+		if index, _ := indexes.Current.Lookup("name").StringValueOK(); index == "_id_" {
+			continue
+		}
+		err = createIndexFromSpec(ctx, m.Target, name, indexes.Current)
+		if err != nil {
+			return err
+		}
+	}
+	if err = cursorErr(ctx, indexes); err != nil {
+		return err
+	}
+
+	batchSize := m.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultMigrateBatchSize
+	}
+	var interval time.Duration
+	if m.Rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(batchSize) / m.Rate)
+	}
+
+	cursor, err := source.Find(ctx, bson.D{}, options.Find().SetBatchSize(int32(batchSize)))
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	var copied int64
+	batch := make([]mongo.WriteModel, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		started := time.Now()
+		_, err := target.BulkWrite(ctx, batch, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		copied += int64(len(batch))
+		batch = batch[:0]
+		if m.OnProgress != nil {
+			m.OnProgress(MigrationProgress{Collection: name, Copied: copied})
+		}
+		return sleepCtx(ctx, interval-time.Since(started))
+	}
+	for cursor.Next(ctx) {
+		doc := append(bson.Raw(nil), cursor.Current...)
+		batch = append(batch, mongo.NewReplaceOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: doc.Lookup("_id")}}).
+			SetReplacement(doc).
+			SetUpsert(true))
+		if len(batch) >= batchSize {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// collectionChecksum hashes all documents of collection in _id order
+func collectionChecksum(ctx context.Context, collection *mongo.Collection) (string, int64, error) {
+	cursor, err := collection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return "", 0, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	var count int64
+	digest := sha256.New()
+	for cursor.Next(ctx) {
+		count++
+		writeHashed(digest, cursor.Current)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), count, nil
+}
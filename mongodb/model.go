@@ -0,0 +1,138 @@
+package mongodb
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// modelField describes an exported struct field of a model
+type modelField struct {
+	// Index is the field index sequence for reflect.Value.FieldByIndex
+	Index []int
+	// Name is the Go field name
+	Name string
+	// BSONName is the key the field is stored under, dotted for fields of embedded structs
+	// that are not inlined
+	BSONName string
+	Type     reflect.Type
+	Tag      reflect.StructTag
+}
+
+var modelFieldsCache sync.Map // reflect.Type -> []modelField
+
+// modelFields returns the exported fields of struct type t, cached per type.
+// Fields of embedded structs (also through pointers) are included with their full index,
+// inlined ones under their own names, others under dotted paths.
+func modelFields(t reflect.Type) []modelField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if cached, ok := modelFieldsCache.Load(t); ok {
+		return cached.([]modelField)
+	}
+
+	var fields []modelField
+	if t.Kind() == reflect.Struct {
+		fields = collectFields(t, nil, "", map[reflect.Type]bool{})
+	}
+
+	modelFieldsCache.Store(t, fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, prefix string, visiting map[reflect.Type]bool) []modelField {
+	if visiting[t] {
+		return nil
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	var fields []modelField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		embedded := f.Type
+		if embedded.Kind() == reflect.Pointer {
+			embedded = embedded.Elem()
+		}
+		if f.Anonymous && embedded.Kind() == reflect.Struct && embedded != timeType {
+			name := bsonName(f)
+			if name == "-" {
+				continue
+			}
+			if isInline(f) {
+				fields = append(fields, collectFields(embedded, fieldIndex, prefix, visiting)...)
+				continue
+			}
+			if f.IsExported() {
+				fields = append(fields, modelField{Index: fieldIndex, Name: f.Name, BSONName: prefix + name, Type: f.Type, Tag: f.Tag})
+				fields = append(fields, collectFields(embedded, fieldIndex, prefix+name+".", visiting)...)
+			}
+			continue
+		}
+
+		if !f.IsExported() {
+			continue
+		}
+		name := bsonName(f)
+		if name == "-" {
+			continue
+		}
+		fields = append(fields, modelField{
+			Index:    fieldIndex,
+			Name:     f.Name,
+			BSONName: prefix + name,
+			Type:     f.Type,
+			Tag:      f.Tag,
+		})
+	}
+	return fields
+}
+
+// bsonTag returns the bson struct tag of f, supporting the bare tag form
+func bsonTag(f reflect.StructField) string {
+	tag, ok := f.Tag.Lookup("bson")
+	if !ok && !strings.Contains(string(f.Tag), ":") {
+		tag = string(f.Tag)
+	}
+	return tag
+}
+
+// bsonName returns the key the bson codec stores the field under
+func bsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(bsonTag(f), ",")
+	if name == "" {
+		return strings.ToLower(f.Name)
+	}
+	return name
+}
+
+func isInline(f reflect.StructField) bool {
+	_, opts, _ := strings.Cut(bsonTag(f), ",")
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == "inline" {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldByIndex returns the field of struct v at index, allocating nil embedded pointers on the way
+// when alloc is set, otherwise an invalid Value is returned for fields behind nil pointers
+func fieldByIndex(v reflect.Value, index []int, alloc bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
@@ -0,0 +1,301 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MultiCtrl reads items of T across several collections, e.g. per-tenant or per-period ones,
+// and merges the results with a global sort and limit, hiding the partitioning from callers
+type MultiCtrl[T any] struct {
+	ctrls []*genericObjectDBCtrl[T]
+}
+
+// NewMultiCtrl creates a MultiCtrl over ctrls
+func NewMultiCtrl[T any](ctrls ...*genericObjectDBCtrl[T]) *MultiCtrl[T] {
+	return &MultiCtrl[T]{ctrls: ctrls}
+}
+
+// multiDoc is a document read from the controller with index ctrl
+type multiDoc struct {
+	ctrl int
+	raw  bson.Raw
+}
+
+// List lists items by sels filter (logical AND) of all collections ordered by sort,
+// limit 0 returns all items. Collections are queried concurrently with the same sort and limit
+// and their results merged, an _id tie-breaker is appended to sort (see NormalizeSort).
+// if some failed, return err
+func (m *MultiCtrl[T]) List(ctx context.Context, sels map[string]any, sort bson.D, limit int64) ([]T, error) {
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter) multi")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter) multi")
+	sort = NormalizeSort(sort)
+
+	parts := make([][]multiDoc, len(m.ctrls))
+	errs := make([]error, len(m.ctrls))
+	var wg sync.WaitGroup
+	for i, c := range m.ctrls {
+		wg.Add(1)
+		go func(i int, c *genericObjectDBCtrl[T]) {
+			defer wg.Done()
+			parts[i], errs[i] = c.findRaw(ctx, i, sels, sort, limit)
+		}(i, c)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	merged := mergeSorted(parts, sort, limit)
+	results := make([]T, 0, len(merged))
+	for _, doc := range merged {
+		var item T
+		err := m.ctrls[doc.ctrl].decodeItem(ctx, doc.raw, &item)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, item)
+	}
+	return results, nil
+}
+
+// Find finds the first item by sels filter (logical AND) of all collections ordered by sort
+// if not found, return mongo.ErrNoDocuments
+// if some failed, return err
+func (m *MultiCtrl[T]) Find(ctx context.Context, sels map[string]any, sort bson.D) (*T, error) {
+	items, err := m.List(ctx, sels, sort, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &items[0], nil
+}
+
+// Count returns the number of items by sels filter (logical AND) of all collections
+// if some failed, return err
+func (m *MultiCtrl[T]) Count(ctx context.Context, sels map[string]any) (int64, error) {
+	var total int64
+	for _, c := range m.ctrls {
+		ctx, cancel, _ := c.begin(ctx, opRead)
+		count, err := c.reader().CountDocuments(ctx, filterFromSels(sels))
+		cancel()
+		if err != nil {
+			return 0, err
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// findRaw returns raw documents of the collection by sels ordered by sort
+func (c *genericObjectDBCtrl[T]) findRaw(ctx context.Context, index int, sels map[string]any, sort bson.D, limit int64) ([]multiDoc, error) {
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+	opts := profile.findOptions().SetSort(sort)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := c.reader().Find(ctx, filterFromSels(sels), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	docs := []multiDoc{}
+	for cursor.Next(ctx) {
+		docs = append(docs, multiDoc{ctrl: index, raw: append(bson.Raw(nil), cursor.Current...)})
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// mergeSorted merges lists sorted by sort into one, keeping at most limit documents when limit > 0
+func mergeSorted(lists [][]multiDoc, sort bson.D, limit int64) []multiDoc {
+	pos := make([]int, len(lists))
+	var merged []multiDoc
+	for limit <= 0 || int64(len(merged)) < limit {
+		best := -1
+		for i, list := range lists {
+			if pos[i] >= len(list) {
+				continue
+			}
+			if best < 0 || compareRawDocs(list[pos[i]].raw, lists[best][pos[best]].raw, sort) < 0 {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		merged = append(merged, lists[best][pos[best]])
+		pos[best]++
+	}
+	return merged
+}
+
+// compareRawDocs compares documents a and b by sort keys in the server sort order
+func compareRawDocs(a bson.Raw, b bson.Raw, sort bson.D) int {
+	for _, e := range sort {
+		path := strings.Split(e.Key, ".")
+		cmp := compareRawValues(lookupOrNull(a, path), lookupOrNull(b, path))
+		if cmp != 0 {
+			if sortDirection(e.Value) < 0 {
+				return -cmp
+			}
+			return cmp
+		}
+	}
+	return 0
+}
+
+func lookupOrNull(doc bson.Raw, path []string) bson.RawValue {
+	v, err := doc.LookupErr(path...)
+	if err != nil {
+		return bson.RawValue{Type: bsontype.Null}
+	}
+	return v
+}
+
+func sortDirection(v any) int {
+	switch d := v.(type) {
+	case int:
+		return d
+	case int32:
+		return int(d)
+	case int64:
+		return int(d)
+	case float64:
+		return int(d)
+	}
+	return 1
+}
+
+// bsonTypeRank is the position of a bson type in the server comparison order
+func bsonTypeRank(t bsontype.Type) int {
+	switch t {
+	case bsontype.MinKey:
+		return 0
+	case bsontype.Null, bsontype.Undefined:
+		return 1
+	case bsontype.Double, bsontype.Int32, bsontype.Int64, bsontype.Decimal128:
+		return 2
+	case bsontype.String, bsontype.Symbol:
+		return 3
+	case bsontype.EmbeddedDocument:
+		return 4
+	case bsontype.Array:
+		return 5
+	case bsontype.Binary:
+		return 6
+	case bsontype.ObjectID:
+		return 7
+	case bsontype.Boolean:
+		return 8
+	case bsontype.DateTime:
+		return 9
+	case bsontype.Timestamp:
+		return 10
+	case bsontype.Regex:
+		return 11
+	case bsontype.MaxKey:
+		return 13
+	}
+	return 12
+}
+
+// compareRawValues compares a and b in the server comparison order,
+// values of the same type without a natural order are compared bytewise
+func compareRawValues(a bson.RawValue, b bson.RawValue) int {
+	ra, rb := bsonTypeRank(a.Type), bsonTypeRank(b.Type)
+	if ra != rb {
+		return ra - rb
+	}
+	switch ra {
+	case 1:
+		return 0
+	case 2:
+		fa, fb := rawNumber(a), rawNumber(b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	case 3:
+		return strings.Compare(rawString(a), rawString(b))
+	case 8:
+		ba, bb := a.Boolean(), b.Boolean()
+		if ba == bb {
+			return 0
+		}
+		if !ba {
+			return -1
+		}
+		return 1
+	case 9:
+		da, db := a.DateTime(), b.DateTime()
+		switch {
+		case da < db:
+			return -1
+		case da > db:
+			return 1
+		}
+		return 0
+	case 10:
+		ta, ia := a.Timestamp()
+		tb, ib := b.Timestamp()
+		if ta != tb {
+			if ta < tb {
+				return -1
+			}
+			return 1
+		}
+		if ia != ib {
+			if ia < ib {
+				return -1
+			}
+			return 1
+		}
+		return 0
+	}
+	return bytes.Compare(a.Value, b.Value)
+}
+
+// rawNumber returns a numeric value as float64
+func rawNumber(v bson.RawValue) float64 {
+	switch v.Type {
+	case bsontype.Double:
+		return v.Double()
+	case bsontype.Int32:
+		return float64(v.Int32())
+	case bsontype.Int64:
+		return float64(v.Int64())
+	case bsontype.Decimal128:
+		f, err := strconv.ParseFloat(v.Decimal128().String(), 64)
+		if err == nil {
+			return f
+		}
+	}
+	return 0
+}
+
+// rawString returns a string or symbol value
+func rawString(v bson.RawValue) string {
+	if v.Type == bsontype.Symbol {
+		return v.Symbol()
+	}
+	return v.StringValue()
+}
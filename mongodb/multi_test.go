@@ -0,0 +1,55 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCompareRawValues(t *testing.T) {
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		a, b any
+		want int
+	}{
+		{name: "null before numbers", a: nil, b: int32(0), want: -1},
+		{name: "numbers across types", a: int32(2), b: int64(2), want: 0},
+		{name: "int and double", a: int64(2), b: 2.5, want: -1},
+		{name: "double and int", a: 3.0, b: int32(2), want: 1},
+		{name: "numbers before strings", a: 100, b: "1", want: -1},
+		{name: "strings", a: "abc", b: "abd", want: -1},
+		{name: "strings before documents", a: "z", b: bson.D{}, want: -1},
+		{name: "object ids before booleans", a: primitive.NewObjectID(), b: false, want: -1},
+		{name: "booleans", a: false, b: true, want: -1},
+		{name: "equal booleans", a: true, b: true, want: 0},
+		{name: "booleans before dates", a: true, b: date, want: -1},
+		{name: "dates", a: date.Add(time.Millisecond), b: date, want: 1},
+		{name: "timestamps", a: primitive.Timestamp{T: 1, I: 2}, b: primitive.Timestamp{T: 1, I: 1}, want: 1},
+		{name: "max key last", a: primitive.MaxKey{}, b: primitive.Regex{Pattern: "x"}, want: 1},
+		{name: "min key first", a: primitive.MinKey{}, b: nil, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compareRawValues(rawValue(t, tt.a), rawValue(t, tt.b))
+			if sign(got) != tt.want {
+				t.Errorf("compareRawValues(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+			}
+			if back := compareRawValues(rawValue(t, tt.b), rawValue(t, tt.a)); sign(back) != -tt.want {
+				t.Errorf("compareRawValues(%v, %v) = %d, want %d", tt.b, tt.a, back, -tt.want)
+			}
+		})
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
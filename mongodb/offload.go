@@ -0,0 +1,305 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultOffloadThreshold is the size above which fields tagged `mgoffload:""` are offloaded
+const defaultOffloadThreshold = 1 << 20
+
+// offloadRefKey is the key of the reference stored in place of an offloaded field
+const offloadRefKey = "_gridfs"
+
+// WithGridFSOffload stores string and []byte fields tagged `mgoffload:"threshold"` (bytes, 1MB when empty)
+// in the GridFS bucket (collection name + "_offload" when empty) when their size exceeds the threshold,
+// keeping a reference in the item. Offloaded fields are hydrated transparently on read and their files
+// are replaced on Update and removed on Delete. Files are uploaded under new ids before the write and
+// the replaced ones removed after it, buffered updates (see WithWriteBuffer) keep the replaced files
+// until Delete.
+// Note: only top level fields are offloaded, files of items removed by DeleteRange are not removed.
+func WithGridFSOffload(bucket string) Option {
+	return func(o *ctrlOptions) {
+		o.offload = true
+		o.offloadBucket = bucket
+	}
+}
+
+type offloadField struct {
+	name      string
+	threshold int
+}
+
+// offloadFields returns the top level fields of T tagged with `mgoffload`
+func offloadFields[T any]() []offloadField {
+	var fields []offloadField
+	for _, f := range modelFields(reflect.TypeOf((*T)(nil))) {
+		tag, ok := f.Tag.Lookup("mgoffload")
+		if !ok || strings.Contains(f.BSONName, ".") {
+			continue
+		}
+		threshold, err := strconv.Atoi(tag)
+		if err != nil || threshold <= 0 {
+			threshold = defaultOffloadThreshold
+		}
+		fields = append(fields, offloadField{name: f.BSONName, threshold: threshold})
+	}
+	return fields
+}
+
+// bucket returns the offload bucket with deadlines of ctx
+func (c *genericObjectDBCtrl[T]) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	name := c.opts.offloadBucket
+	if name == "" {
+		name = c.db.Name() + "_offload"
+	}
+	bucket, err := gridfs.NewBucket(c.db.Database(), options.GridFSBucket().SetName(name))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = bucket.SetReadDeadline(deadline)
+		_ = bucket.SetWriteDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+// offloadFileID is a new GridFS file id of field of the item with id, every upload gets its own
+// so a failed write never leaves the item referencing a replaced or removed file
+func (c *genericObjectDBCtrl[T]) offloadFileID(id any, field string) bson.D {
+	return bson.D{{Key: "c", Value: c.db.Name()}, {Key: "id", Value: id}, {Key: "f", Value: field}, {Key: "v", Value: primitive.NewObjectID()}}
+}
+
+// offloadWrite tracks the files uploaded for a write of the item with id: rollback removes them
+// when the write failed, commit removes the files they replace once the write succeeded
+type offloadWrite struct {
+	bucket   *gridfs.Bucket
+	id       any
+	fields   []string
+	uploaded []any
+}
+
+// rollback removes the files uploaded for the failed write
+func (w *offloadWrite) rollback() {
+	if w == nil {
+		return
+	}
+	for _, fileID := range w.uploaded {
+		err := w.bucket.Delete(fileID)
+		if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			log.Warnf("DB WARN: failed to remove offloaded file %v of a failed write: %s", fileID, err)
+		}
+	}
+}
+
+// commit removes the files of the written fields except the uploaded ones
+func (w *offloadWrite) commit(ctx context.Context, collection string) {
+	if w == nil || len(w.fields) == 0 {
+		return
+	}
+	filter := bson.M{"_id.c": collection, "_id.id": w.id, "_id.f": bson.M{"$in": w.fields}}
+	if len(w.uploaded) > 0 {
+		filter["_id"] = bson.M{"$nin": w.uploaded}
+	}
+	err := removeOffloadFiles(ctx, w.bucket, filter)
+	if err != nil {
+		log.Warnf("DB WARN: failed to remove replaced offloaded files of %v: %s", w.id, err)
+	}
+}
+
+// removeOffloadFiles removes the files of bucket matching filter
+func removeOffloadFiles(ctx context.Context, bucket *gridfs.Bucket, filter bson.M) error {
+	cursor, err := bucket.Find(filter)
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(cursor))
+	for cursor.Next(ctx) {
+		err = bucket.Delete(cursor.Current.Lookup("_id"))
+		if err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return err
+		}
+	}
+	return cursorErr(ctx, cursor)
+}
+
+// offloadValue uploads value of field to GridFS when it exceeds the threshold and returns the reference
+// to store instead, smaller values are returned as is
+func (c *genericObjectDBCtrl[T]) offloadValue(w *offloadWrite, f offloadField, value any) (any, error) {
+	w.fields = append(w.fields, f.name)
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	case primitive.Binary:
+		data = v.Data
+	default:
+		return value, nil
+	}
+	if len(data) <= f.threshold {
+		return value, nil
+	}
+
+	fileID := c.offloadFileID(w.id, f.name)
+	err := w.bucket.UploadFromStreamWithID(fileID, f.name, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to offload %s: %s", f.name, err)
+	}
+	w.uploaded = append(w.uploaded, fileID)
+	log.Debugf("DB DEBUG: offloaded %s of %v to GridFS (%d bytes)", f.name, w.id, len(data))
+	_, isString := value.(string)
+	return bson.D{{Key: offloadRefKey, Value: fileID}, {Key: "string", Value: isString}}, nil
+}
+
+// offloadDoc offloads the large fields of the encoded item doc, returning doc with references
+// and the uploads to roll back if the insert fails
+func (c *genericObjectDBCtrl[T]) offloadDoc(ctx context.Context, doc bson.Raw) (bson.Raw, *offloadWrite, error) {
+	fields := offloadFields[T]()
+	if !c.opts.offload || len(fields) == 0 {
+		return doc, nil, nil
+	}
+	var d bson.D
+	err := c.unmarshal(doc, &d)
+	if err != nil {
+		return nil, nil, err
+	}
+	id, ok := idOf(d)
+	if !ok {
+		// the id is needed for the file ids, generate it like the driver would
+		id = primitive.NewObjectID()
+		d = append(bson.D{{Key: "_id", Value: id}}, d...)
+	}
+	bucket, err := c.bucket(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := &offloadWrite{bucket: bucket, id: id}
+	for _, f := range fields {
+		for i := range d {
+			if d[i].Key != f.name {
+				continue
+			}
+			d[i].Value, err = c.offloadValue(w, f, d[i].Value)
+			if err != nil {
+				w.rollback()
+				return nil, nil, err
+			}
+		}
+	}
+	data, err := c.marshal(d)
+	if err != nil {
+		w.rollback()
+		return nil, nil, err
+	}
+	return data, w, nil
+}
+
+// offloadUpdate offloads the large fields of the $set document update of the item with id and
+// returns the uploads to commit once the update succeeded or roll back if it failed
+func (c *genericObjectDBCtrl[T]) offloadUpdate(ctx context.Context, id any, update bson.M) (*offloadWrite, error) {
+	fields := offloadFields[T]()
+	if !c.opts.offload || len(fields) == 0 {
+		return nil, nil
+	}
+	bucket, err := c.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	w := &offloadWrite{bucket: bucket, id: id}
+	for _, f := range fields {
+		value, ok := update[f.name]
+		if !ok {
+			continue
+		}
+		update[f.name], err = c.offloadValue(w, f, value)
+		if err != nil {
+			w.rollback()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// removeOffloaded removes the offloaded files of the item with id
+func (c *genericObjectDBCtrl[T]) removeOffloaded(ctx context.Context, id any) error {
+	fields := offloadFields[T]()
+	if !c.opts.offload || len(fields) == 0 {
+		return nil
+	}
+	bucket, err := c.bucket(ctx)
+	if err != nil {
+		return err
+	}
+	err = removeOffloadFiles(ctx, bucket, bson.M{"_id.c": c.db.Name(), "_id.id": id})
+	if err != nil {
+		return fmt.Errorf("failed to remove offloaded files: %s", err)
+	}
+	return nil
+}
+
+// hydrate replaces references to offloaded fields of raw with their content
+func (c *genericObjectDBCtrl[T]) hydrate(ctx context.Context, raw bson.Raw) (bson.Raw, error) {
+	if !c.opts.offload {
+		return raw, nil
+	}
+	var refs []offloadField
+	for _, f := range offloadFields[T]() {
+		if ref, ok := raw.Lookup(f.name).DocumentOK(); ok && len(ref.Lookup(offloadRefKey).Value) > 0 {
+			refs = append(refs, f)
+		}
+	}
+	if len(refs) == 0 {
+		return raw, nil
+	}
+
+	var d bson.D
+	err := c.unmarshal(raw, &d)
+	if err != nil {
+		return nil, err
+	}
+	bucket, err := c.bucket(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range refs {
+		ref := raw.Lookup(f.name).Document()
+		var buf bytes.Buffer
+		_, err = bucket.DownloadToStream(ref.Lookup(offloadRefKey), &buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hydrate offloaded %s: %s", f.name, err)
+		}
+		var value any = buf.Bytes()
+		if isString, _ := ref.Lookup("string").BooleanOK(); isString {
+			value = buf.String()
+		}
+		for i := range d {
+			if d[i].Key == f.name {
+				d[i].Value = value
+			}
+		}
+	}
+	return c.marshal(d)
+}
+
+// idOf returns the _id of document d
+func idOf(d bson.D) (any, bool) {
+	for _, e := range d {
+		if e.Key == "_id" {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
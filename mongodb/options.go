@@ -0,0 +1,53 @@
+package mongodb
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Option configures a controller created by NewGenericObjectDBCtrl
+type Option func(*ctrlOptions)
+
+type ctrlOptions struct {
+	concurrency         ConcurrencyPolicy
+	config              *Config
+	dependents          []Dependent
+	hedgeDelay          time.Duration
+	maintenance         *MaintenanceWindow
+	registry            *bsoncodec.Registry
+	registryHooks       []func(*bsoncodec.Registry)
+	timeouts            Profile
+	writeBack           bool
+	writeBackRate       float64
+	writeBackQueue      int
+	maxDocumentSize     int
+	offload             bool
+	offloadBucket       string
+	compress            bool
+	maxLag              time.Duration
+	costMaxDocs         int64
+	costReject          bool
+	commentExtractors   []CommentExtractor
+	workload            string
+	compat              *Capabilities
+	accessRecorder      *AccessRecorder
+	foreignKeys         []ForeignKey
+	idCodec             IDCodec
+	fence               *Fence
+	localeCollation     *options.Collation
+	errorHook           ErrorHook
+	scheduler           *Scheduler
+	checkOutLocks       bool
+	maxExpectedModified int64
+}
+
+func newCtrlOptions(opts []Option) ctrlOptions {
+	var o ctrlOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.buildRegistry()
+	return o
+}
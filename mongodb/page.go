@@ -0,0 +1,64 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Page is one page of items with the total number of items matching the filter
+type Page[T any] struct {
+	Items    []T   `bson:"items" json:"items"`
+	Total    int64 `bson:"total" json:"total"`
+	Page     int64 `bson:"page" json:"page"`
+	PageSize int64 `bson:"page_size" json:"page_size"`
+}
+
+// ListPage lists items by sels filter (logical AND) ordered by sort, page is 1-based.
+// An _id tie-breaker is appended to sort (see NormalizeSort) so pages are stable.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ListPage(ctx context.Context, sels map[string]any, sort bson.D, page int64, pageSize int64) (_ *Page[T], err error) {
+	defer c.recoverPanic(ctx, "ListPage", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter) page")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter) page")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+	c.warnUnindexedDynamic(ctx, sels)
+	c.recordAccess(sels, sort)
+
+	if page < 1 {
+		page = 1
+	}
+	filter := filterFromSels(sels)
+	reader := c.reader()
+	total, err := reader.CountDocuments(ctx, filter, profile.countOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	opts := profile.findOptions().
+		SetSkip((page - 1) * pageSize).
+		SetLimit(pageSize).
+		SetSort(NormalizeSort(sort))
+	cursor, err := reader.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	items := []T{}
+	for cursor.Next(ctx) {
+		var item T
+		err = c.decodeItem(ctx, cursor.Current, &item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+
+	return &Page[T]{Items: items, Total: total, Page: page, PageSize: pageSize}, nil
+}
@@ -0,0 +1,38 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/labstack/gommon/log"
+)
+
+// PanicError is returned by controller methods recovering from a panic, e.g. of reflection
+// or decoding on a model type they cannot handle
+type PanicError struct {
+	Op    string
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.Op, e.Value)
+}
+
+// recoverPanic converts a panic of the deferring method op into a *PanicError in err and logs its stack,
+// so a bad model cannot take down the whole process. It must be deferred directly.
+// Failures of a call whose budget ran out (see WithBudget) are reported as ErrBudgetExceeded,
+// then the ErrorHook of the controller is applied.
+func (c *genericObjectDBCtrl[T]) recoverPanic(ctx context.Context, op string, err *error) {
+	r := recover()
+	if r == nil {
+		*err = budgetErr(ctx, *err)
+		c.onError(ctx, op, err)
+		return
+	}
+	stack := debug.Stack()
+	log.Errorf("DB ERROR: panic in %s of %s: %v\n%s", op, c.db.Name(), r, stack)
+	*err = &PanicError{Op: op, Value: r, Stack: stack}
+	c.onError(ctx, op, err)
+}
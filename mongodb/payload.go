@@ -0,0 +1,135 @@
+package mongodb
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// PayloadStats are the wire sizes of one command on one collection
+type PayloadStats struct {
+	Command    string `json:"command"`
+	Collection string `json:"collection,omitempty"`
+	Count      int64  `json:"count"`
+	// RequestBytes and ResponseBytes are the summed BSON sizes of the commands and their replies
+	RequestBytes     int64 `json:"request_bytes"`
+	ResponseBytes    int64 `json:"response_bytes"`
+	MaxRequestBytes  int64 `json:"max_request_bytes"`
+	MaxResponseBytes int64 `json:"max_response_bytes"`
+}
+
+type payloadKey struct {
+	command    string
+	collection string
+}
+
+type pendingPayload struct {
+	key    payloadKey
+	size   int64
+	tenant string
+}
+
+// PayloadMonitor records the request and response sizes of the commands of a client by command
+// and collection, so oversized documents and unbounded lists show before they cause outages.
+// Install it with ConnectConfig.Payloads or options.Client().SetMonitor(p.Monitor()).
+type PayloadMonitor struct {
+	warnBytes int64
+	meter     *Meter
+
+	mu      sync.Mutex
+	pending map[int64]pendingPayload
+	stats   map[payloadKey]*PayloadStats
+}
+
+// NewPayloadMonitor creates a PayloadMonitor logging commands or replies larger than warnBytes
+// (never when 0). With a meter the traffic of every command is added to it as UsageTransfer of
+// the tenant of the operation context, see WithTenant.
+func NewPayloadMonitor(warnBytes int64, meter *Meter) *PayloadMonitor {
+	return &PayloadMonitor{
+		warnBytes: warnBytes,
+		meter:     meter,
+		pending:   map[int64]pendingPayload{},
+		stats:     map[payloadKey]*PayloadStats{},
+	}
+}
+
+// Monitor returns the command monitor feeding p
+func (p *PayloadMonitor) Monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started:   p.started,
+		Succeeded: p.succeeded,
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			delete(p.pending, e.RequestID)
+		},
+	}
+}
+
+func (p *PayloadMonitor) started(ctx context.Context, e *event.CommandStartedEvent) {
+	key := payloadKey{command: e.CommandName}
+	key.collection, _ = e.Command.Lookup(e.CommandName).StringValueOK()
+	if e.CommandName == "getMore" {
+		key.collection, _ = e.Command.Lookup("collection").StringValueOK()
+	}
+	size := int64(len(e.Command))
+	tenant, _ := TenantFromContext(ctx)
+	if p.warnBytes > 0 && size > p.warnBytes {
+		log.Warnf("DB WARN: %s on %s sends %d bytes", key.command, key.collection, size)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending[e.RequestID] = pendingPayload{key: key, size: size, tenant: tenant}
+}
+
+func (p *PayloadMonitor) succeeded(_ context.Context, e *event.CommandSucceededEvent) {
+	size := int64(len(e.Reply))
+	p.mu.Lock()
+	request, ok := p.pending[e.RequestID]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.pending, e.RequestID)
+	stats, ok := p.stats[request.key]
+	if !ok {
+		stats = &PayloadStats{Command: request.key.command, Collection: request.key.collection}
+		p.stats[request.key] = stats
+	}
+	stats.Count++
+	stats.RequestBytes += request.size
+	stats.ResponseBytes += size
+	stats.MaxRequestBytes = max(stats.MaxRequestBytes, request.size)
+	stats.MaxResponseBytes = max(stats.MaxResponseBytes, size)
+	p.mu.Unlock()
+
+	if p.warnBytes > 0 && size > p.warnBytes {
+		log.Warnf("DB WARN: %s on %s returned %d bytes", request.key.command, request.key.collection, size)
+	}
+	if p.meter != nil {
+		p.meter.Add(request.tenant, request.key.collection, UsageTransfer, 0, request.size+size)
+	}
+}
+
+// Stats returns the recorded sizes, largest response traffic first
+func (p *PayloadMonitor) Stats() []PayloadStats {
+	p.mu.Lock()
+	stats := make([]PayloadStats, 0, len(p.stats))
+	for _, s := range p.stats {
+		stats = append(stats, *s)
+	}
+	p.mu.Unlock()
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ResponseBytes > stats[j].ResponseBytes })
+	return stats
+}
+
+// Reset drops the recorded sizes
+func (p *PayloadMonitor) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats = map[payloadKey]*PayloadStats{}
+}
@@ -0,0 +1,116 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Period is a calendar unit of GroupByPeriod
+type Period string
+
+const (
+	PeriodHour    Period = "hour"
+	PeriodDay     Period = "day"
+	PeriodWeek    Period = "week" // weeks start on monday (ISO 8601)
+	PeriodMonth   Period = "month"
+	PeriodQuarter Period = "quarter"
+	PeriodYear    Period = "year"
+)
+
+// PeriodBucket is the number of items in the period starting at Start and the sums of the
+// requested fields over them
+type PeriodBucket struct {
+	Start time.Time
+	Count int64
+	Sums  map[string]float64
+	// DecimalSums are the exact sums of the fields holding Decimal128 values, e.g. money
+	DecimalSums map[string]primitive.Decimal128
+}
+
+// GroupByPeriod counts items matched by sels (logical AND) per period of dateField, and sums
+// sumFields over them, ordered by period. Periods follow the calendar of the IANA time zone tz
+// (e.g. "Europe/Berlin", "" for UTC), so days start at local midnight across DST changes, and
+// bucket starts are returned in tz. Periods without items are omitted. Requires MongoDB 5.0.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) GroupByPeriod(ctx context.Context, dateField string, period Period, tz string, sels map[string]any, sumFields ...string) (_ []PeriodBucket, err error) {
+	defer c.recoverPanic(ctx, "GroupByPeriod", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $dateTrunc)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $dateTrunc)")
+	switch period {
+	case PeriodHour, PeriodDay, PeriodWeek, PeriodMonth, PeriodQuarter, PeriodYear:
+	default:
+		return nil, fmt.Errorf("failed to group by period: unknown period %q", period)
+	}
+	if tz == "" {
+		tz = "UTC"
+	}
+	location, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to group by period: %s", err)
+	}
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+
+	trunc := bson.D{
+		{Key: "date", Value: "$" + dateField},
+		{Key: "unit", Value: string(period)},
+		{Key: "timezone", Value: tz},
+	}
+	if period == PeriodWeek {
+		trunc = append(trunc, bson.E{Key: "startOfWeek", Value: "monday"})
+	}
+	group := bson.D{
+		{Key: "_id", Value: bson.M{"$dateTrunc": trunc}},
+		{Key: "count", Value: bson.M{"$sum": 1}},
+	}
+	for i, field := range sumFields {
+		group = append(group, bson.E{Key: fmt.Sprintf("sum%d", i), Value: bson.M{"$sum": "$" + field}})
+	}
+	filter := typedFilter(sels, dateField, "date")
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: group}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	}
+	cursor, err := c.reader().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	buckets := []PeriodBucket{}
+	for cursor.Next(ctx) {
+		var row struct {
+			Start time.Time `bson:"_id"`
+			Count int64     `bson:"count"`
+		}
+		err = cursor.Decode(&row)
+		if err != nil {
+			return nil, err
+		}
+		bucket := PeriodBucket{Start: row.Start.In(location), Count: row.Count, Sums: make(map[string]float64, len(sumFields))}
+		for i, field := range sumFields {
+			if value, err := cursor.Current.LookupErr(fmt.Sprintf("sum%d", i)); err == nil {
+				bucket.Sums[field] = rawNumber(value)
+				if d, ok := value.Decimal128OK(); ok {
+					if bucket.DecimalSums == nil {
+						bucket.DecimalSums = map[string]primitive.Decimal128{}
+					}
+					bucket.DecimalSums[field] = d
+				}
+			}
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
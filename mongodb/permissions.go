@@ -0,0 +1,115 @@
+package mongodb
+
+import (
+	"context"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// OpKind is an operation the application performs on a collection, named after the privilege
+// action it requires
+type OpKind string
+
+const (
+	OpFind        OpKind = "find"
+	OpInsert      OpKind = "insert"
+	OpUpdate      OpKind = "update"
+	OpRemove      OpKind = "remove"
+	OpCreateIndex OpKind = "createIndex"
+)
+
+// server error codes of denied operations
+var unauthorizedCodes = []int{
+	13,   // Unauthorized
+	8000, // AtlasError, Atlas reports denied operations with it
+}
+
+// PermissionProbe is the outcome of probing one operation
+type PermissionProbe struct {
+	Op      OpKind `json:"op"`
+	Allowed bool   `json:"allowed"`
+	// Method is how the permission was confirmed, "attempt", "privileges" or "unauthenticated"
+	Method string `json:"method"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ProbePermissions confirms the connection's user can perform ops on the collection, so missing
+// roles surface at boot instead of at the first write. find, update, remove and createIndex are
+// attempted in harmless forms (matching a fresh ObjectID, re-creating the _id index), insert is
+// checked against the privileges reported by connectionStatus since any insert writes.
+// if an op is denied, return the probes and err wrapping ErrForbidden
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ProbePermissions(ctx context.Context, ops []OpKind) (_ []PermissionProbe, err error) {
+	defer c.recoverPanic(ctx, "ProbePermissions", &err)
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+	return probePermissions(ctx, c.db, ops)
+}
+
+func probePermissions(ctx context.Context, collection *mongo.Collection, ops []OpKind) ([]PermissionProbe, error) {
+	log.Debug("DB DEBUG: Started probePermissions")
+	defer log.Debug("DB DEBUG: finished probePermissions")
+
+	var (
+		privileges    []privilege
+		authenticated bool
+		loaded        bool
+	)
+	probes := make([]PermissionProbe, 0, len(ops))
+	var denied []string
+	for _, op := range ops {
+		probe := PermissionProbe{Op: op, Method: "attempt"}
+		var err error
+		missing := primitive.NewObjectID()
+		switch op {
+		case OpFind:
+			err = collection.FindOne(ctx, bson.M{"_id": missing}).Err()
+		case OpUpdate:
+			_, err = collection.UpdateOne(ctx, bson.M{"_id": missing}, bson.M{"$set": bson.M{"_id": missing}})
+		case OpRemove:
+			_, err = collection.DeleteOne(ctx, bson.M{"_id": missing})
+		case OpCreateIndex:
+			err = collection.Database().RunCommand(ctx, bson.D{
+				{Key: "createIndexes", Value: collection.Name()},
+				{Key: "indexes", Value: bson.A{bson.M{"key": bson.M{"_id": 1}, "name": "_id_"}}},
+			}).Err()
+		default:
+			if !loaded {
+				privileges, authenticated, err = userPrivileges(ctx, collection.Database())
+				if err != nil {
+					return nil, err
+				}
+				loaded = true
+			}
+			probe.Method = "privileges"
+			if !authenticated {
+				probe.Method = "unauthenticated"
+			}
+			probe.Allowed = !authenticated || hasPrivilege(privileges, collection.Database().Name(), collection.Name(), string(op))
+		}
+		if probe.Method == "attempt" {
+			var serverErr mongo.ServerError
+			switch {
+			case err == nil || errors.Is(err, mongo.ErrNoDocuments):
+				probe.Allowed = true
+			case errors.As(err, &serverErr) && hasAnyCode(serverErr, unauthorizedCodes):
+				probe.Detail = err.Error()
+			default:
+				return nil, err
+			}
+		}
+		if !probe.Allowed {
+			denied = append(denied, string(op))
+		}
+		probes = append(probes, probe)
+	}
+	if len(denied) > 0 {
+		return probes, errors.Wrapf(ErrForbidden, "user lacks %s on %s", strings.Join(denied, ", "), collection.Name())
+	}
+	return probes, nil
+}
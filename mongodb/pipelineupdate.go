@@ -0,0 +1,352 @@
+package mongodb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// jsOperators are the server side JavaScript operators PipelineUpdate rejects
+var jsOperators = map[string]bool{"$function": true, "$accumulator": true, "$where": true}
+
+// PipelineUpdate builds an update with an aggregation pipeline (MongoDB 4.2), so fields can be
+// computed from other fields of the same document atomically, e.g.
+//
+//	NewPipelineUpdate().
+//		Set("total", Multiply(Field("price"), Field("quantity"))).
+//		SetIf("status", Gte(Field("paid"), Field("total")), "paid")
+//
+// Stages run in order, each sees the fields set by the previous ones.
+type PipelineUpdate struct {
+	stages mongo.Pipeline
+	err    error
+	// paths are the fields written by the stages, checked against the immutable fields of the model
+	paths []string
+	// replaced is set by ReplaceWith, which may write any field
+	replaced bool
+}
+
+// NewPipelineUpdate creates an empty PipelineUpdate
+func NewPipelineUpdate() *PipelineUpdate {
+	return &PipelineUpdate{}
+}
+
+// Set adds a stage setting the field at dot path to the expression value, plain values which are
+// not expressions need Literal when they are strings starting with $ or documents with operator keys
+func (p *PipelineUpdate) Set(path string, value any) *PipelineUpdate {
+	return p.stage("$set", path, bson.D{{Key: path, Value: value}})
+}
+
+// SetIf adds a stage setting the field at dot path to value when the expression cond is true,
+// leaving it unchanged otherwise
+func (p *PipelineUpdate) SetIf(path string, cond any, value any) *PipelineUpdate {
+	return p.Set(path, Cond(cond, value, Field(path)))
+}
+
+// Unset adds a stage removing the fields at dot paths, none adds no stage
+func (p *PipelineUpdate) Unset(paths ...string) *PipelineUpdate {
+	if len(paths) == 0 {
+		return p
+	}
+	for _, path := range paths {
+		p.checkPath(path)
+	}
+	p.paths = append(p.paths, paths...)
+	p.stages = append(p.stages, bson.D{{Key: "$unset", Value: paths}})
+	return p
+}
+
+// ReplaceWith adds a stage replacing the document with the document expression value, keep the
+// _id in it, e.g. with MergeObjects(Field("$ROOT"), ...). Models with immutable fields reject it.
+func (p *PipelineUpdate) ReplaceWith(value any) *PipelineUpdate {
+	p.checkExpr("$replaceWith", value, 0)
+	p.replaced = true
+	p.stages = append(p.stages, bson.D{{Key: "$replaceWith", Value: value}})
+	return p
+}
+
+// Pipeline returns the stages of the update
+// if some path or expression is invalid, return ErrInvalidQuery
+func (p *PipelineUpdate) Pipeline() (mongo.Pipeline, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.stages) == 0 {
+		return nil, errors.Wrap(ErrInvalidQuery, "empty pipeline update")
+	}
+	return append(mongo.Pipeline{}, p.stages...), nil
+}
+
+func (p *PipelineUpdate) stage(name string, path string, value bson.D) *PipelineUpdate {
+	p.checkPath(path)
+	p.checkExpr(path, value[0].Value, 0)
+	p.paths = append(p.paths, path)
+	p.stages = append(p.stages, bson.D{{Key: name, Value: value}})
+	return p
+}
+
+func (p *PipelineUpdate) checkPath(path string) {
+	if p.err != nil {
+		return
+	}
+	for _, part := range strings.Split(path, ".") {
+		switch {
+		case part == "":
+			p.err = errors.Wrapf(ErrInvalidQuery, "%q: empty path element", path)
+		case strings.HasPrefix(part, "$"):
+			p.err = errors.Wrapf(ErrInvalidQuery, "%q: operator in path", path)
+		case strings.IndexByte(part, 0) >= 0:
+			p.err = errors.Wrapf(ErrInvalidQuery, "%q: NUL byte in path", path)
+		}
+	}
+}
+
+// checkExpr rejects server side JavaScript and too deep nesting in the expression v at path
+func (p *PipelineUpdate) checkExpr(path string, v any, depth int) {
+	if p.err != nil {
+		return
+	}
+	if depth > maxQueryDepth {
+		p.err = errors.Wrapf(ErrInvalidQuery, "%q: nested deeper than %d", path, maxQueryDepth)
+		return
+	}
+	checkKey := func(key string, value any) {
+		if jsOperators[key] {
+			p.err = errors.Wrapf(ErrInvalidQuery, "%q: server side JavaScript %s not allowed", path, key)
+			return
+		}
+		p.checkExpr(joinPath(path, key), value, depth+1)
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			checkKey(key, value)
+		}
+	case bson.M:
+		p.checkExpr(path, map[string]any(v), depth)
+	case bson.D:
+		for _, e := range v {
+			checkKey(e.Key, e.Value)
+		}
+	case []any:
+		for _, value := range v {
+			p.checkExpr(path, value, depth+1)
+		}
+	case bson.A:
+		p.checkExpr(path, []any(v), depth)
+	default:
+		// typed containers such as []bson.M or map[string]bson.D
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			if rv.Type().Elem().Kind() == reflect.Uint8 {
+				return
+			}
+			for i := 0; i < rv.Len() && p.err == nil; i++ {
+				p.checkExpr(path, rv.Index(i).Interface(), depth+1)
+			}
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return
+			}
+			iter := rv.MapRange()
+			for iter.Next() && p.err == nil {
+				checkKey(iter.Key().String(), iter.Value().Interface())
+			}
+		}
+	}
+}
+
+// Field returns the expression of the field at dot path of the document, Field("$ROOT") is the
+// whole document
+func Field(path string) string {
+	return "$" + path
+}
+
+// Literal returns an expression of value taken as is, e.g. strings starting with $
+func Literal(value any) bson.M {
+	return bson.M{"$literal": value}
+}
+
+// Cond returns an expression of then when the expression cond is true, otherwise of otherwise
+func Cond(cond any, then any, otherwise any) bson.M {
+	return bson.M{"$cond": bson.A{cond, then, otherwise}}
+}
+
+// IfNull returns an expression of value, or of fallback when value is null or missing
+func IfNull(value any, fallback any) bson.M {
+	return bson.M{"$ifNull": bson.A{value, fallback}}
+}
+
+// Add returns an expression of the sum of values, dates plus milliseconds for a date
+func Add(values ...any) bson.M {
+	return bson.M{"$add": bson.A(values)}
+}
+
+// Subtract returns an expression of a minus b
+func Subtract(a any, b any) bson.M {
+	return bson.M{"$subtract": bson.A{a, b}}
+}
+
+// Multiply returns an expression of the product of values
+func Multiply(values ...any) bson.M {
+	return bson.M{"$multiply": bson.A(values)}
+}
+
+// Divide returns an expression of a divided by b
+func Divide(a any, b any) bson.M {
+	return bson.M{"$divide": bson.A{a, b}}
+}
+
+// Concat returns an expression of the concatenated strings of values
+func Concat(values ...any) bson.M {
+	return bson.M{"$concat": bson.A(values)}
+}
+
+// MergeObjects returns an expression of the documents merged, later fields win
+func MergeObjects(docs ...any) bson.M {
+	return bson.M{"$mergeObjects": bson.A(docs)}
+}
+
+// Eq returns an expression whether a equals b
+func Eq(a any, b any) bson.M {
+	return bson.M{"$eq": bson.A{a, b}}
+}
+
+// Gt returns an expression whether a is greater than b
+func Gt(a any, b any) bson.M {
+	return bson.M{"$gt": bson.A{a, b}}
+}
+
+// Gte returns an expression whether a is greater than or equals b
+func Gte(a any, b any) bson.M {
+	return bson.M{"$gte": bson.A{a, b}}
+}
+
+// Lt returns an expression whether a is less than b
+func Lt(a any, b any) bson.M {
+	return bson.M{"$lt": bson.A{a, b}}
+}
+
+// Lte returns an expression whether a is less than or equals b
+func Lte(a any, b any) bson.M {
+	return bson.M{"$lte": bson.A{a, b}}
+}
+
+// And returns an expression whether all conds are true
+func And(conds ...any) bson.M {
+	return bson.M{"$and": bson.A(conds)}
+}
+
+// Or returns an expression whether some cond is true
+func Or(conds ...any) bson.M {
+	return bson.M{"$or": bson.A(conds)}
+}
+
+// Now is the expression of the current server time, the same for all documents of an update
+const Now = "$$NOW"
+
+// pipelineModifier returns the stages of p followed by the controller stage setting updated_at
+// and incrementing version with ConcurrencyVersion
+// if p writes an immutable field of T, return *ImmutableFieldError
+func (c *genericObjectDBCtrl[T]) pipelineModifier(p *PipelineUpdate) (mongo.Pipeline, error) {
+	pipeline, err := p.Pipeline()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range p.paths {
+		if err = checkImmutablePath[T](path); err != nil {
+			return nil, err
+		}
+	}
+	if names := immutableFields[T](); p.replaced && len(names) > 0 {
+		return nil, &ImmutableFieldError{Field: names[0]}
+	}
+	set := bson.D{{Key: updatedAtKey[T](), Value: time.Now()}}
+	if c.opts.concurrency == ConcurrencyVersion {
+		version := versionKey[T]()
+		set = append(set, bson.E{Key: version, Value: Add(IfNull(Field(version), 0), 1)})
+	}
+	if c.opts.fence != nil {
+		set = append(set, bson.E{Key: fenceKey, Value: c.opts.fence.generation})
+	}
+	return append(pipeline, bson.D{{Key: "$set", Value: set}}), nil
+}
+
+// UpdatePipeline updates the item identified by id with the pipeline update p and reports matched
+// and modified counts. Unlike Update, validation and references are not checked as the values
+// are computed by the server. Requires MongoDB 4.2.
+// if p is invalid, return ErrInvalidQuery
+// if p writes a field tagged `mgimmutable:"true"`, return *ImmutableFieldError
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) UpdatePipeline(ctx context.Context, id any, p *PipelineUpdate) (_ *UpdateResult, err error) {
+	defer c.recoverPanic(ctx, "UpdatePipeline", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	id = c.internalID(id)
+	log.Debug("DB DEBUG: Started c.db.UpdateOne pipeline")
+	defer log.Debug("DB DEBUG: finished c.db.UpdateOne pipeline")
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+	pipeline, err := c.pipelineModifier(p)
+	if err != nil {
+		return nil, err
+	}
+	filter := c.writeFilter(ctx, bson.D{bson.E{Key: "_id", Value: id}})
+	result, err := c.db.UpdateOne(ctx, filter, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		if err = c.writeConflict(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	c.lintWrite(ctx, "UpdatePipeline", filter, result.MatchedCount, result.ModifiedCount)
+	return &UpdateResult{
+		Matched:  result.MatchedCount,
+		Modified: result.ModifiedCount,
+	}, nil
+}
+
+// UpdateAttributesPipeline updates the items by sels filter (logical AND) with the pipeline update p
+// like UpdateAttributes and reports matched and modified counts, see UpdatePipeline
+// if p is invalid, return ErrInvalidQuery
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) UpdateAttributesPipeline(ctx context.Context, sels map[string]any, p *PipelineUpdate) (_ *UpdateResult, err error) {
+	defer c.recoverPanic(ctx, "UpdateAttributesPipeline", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.UpdateMany pipeline")
+	defer log.Debug("DB DEBUG: finished c.db.UpdateMany pipeline")
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+	pipeline, err := c.pipelineModifier(p)
+	if err != nil {
+		return nil, err
+	}
+	filter := c.writeFilter(ctx, filterFromSels(sels))
+	result, err := c.db.UpdateMany(ctx, filter, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := sels["_id"]; ok && result.MatchedCount == 0 && !isOperatorValue(id) {
+		if err = c.writeConflict(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	c.lintWrite(ctx, "UpdateAttributesPipeline", filter, result.MatchedCount, result.ModifiedCount)
+	return &UpdateResult{
+		Matched:  result.MatchedCount,
+		Modified: result.ModifiedCount,
+	}, nil
+}
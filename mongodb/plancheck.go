@@ -0,0 +1,127 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrCollectionScan is returned by CheckPlans when registered queries scan their collection
+var ErrCollectionScan = errors.New("collection scan")
+
+// PlanCheck is the explained winning plan of a registered query
+type PlanCheck struct {
+	Query          string
+	Collection     string
+	CollectionScan bool
+	Indexes        []string
+	// Err is the error explaining the query
+	Err error
+}
+
+// CheckPlans explains every registered query bound to its example Params against db and fails if one
+// falls back to a collection scan or can't be explained, catching index regressions before deploy,
+// e.g. in a CI job against a database with the production indexes. Queries need a Collection.
+// if some query scans its collection, return all checks and ErrCollectionScan naming the queries
+// if some explain failed, return all checks and err
+func (r *QueryRegistry) CheckPlans(ctx context.Context, db *mongo.Database) ([]PlanCheck, error) {
+	log.Debug("DB DEBUG: Started QueryRegistry.CheckPlans")
+	defer log.Debug("DB DEBUG: finished QueryRegistry.CheckPlans")
+
+	var checks []PlanCheck
+	var scans, failed []string
+	for _, name := range r.Names() {
+		q, _ := r.Get(name)
+		check := PlanCheck{Query: name, Collection: q.Collection}
+		estimate, err := explainQuery(ctx, db, bindParams(q, q.Params))
+		if err != nil {
+			check.Err = err
+			failed = append(failed, fmt.Sprintf("%s: %s", name, err))
+		} else {
+			check.CollectionScan = estimate.CollectionScan
+			check.Indexes = estimate.Indexes
+			if estimate.CollectionScan {
+				scans = append(scans, name)
+			}
+		}
+		checks = append(checks, check)
+	}
+	if len(failed) > 0 {
+		return checks, fmt.Errorf("failed to explain queries: %s", strings.Join(failed, "; "))
+	}
+	if len(scans) > 0 {
+		return checks, errors.Wrapf(ErrCollectionScan, "queries %s", strings.Join(scans, ", "))
+	}
+	return checks, nil
+}
+
+// explainQuery explains the bound query q with the query planner without running it
+func explainQuery(ctx context.Context, db *mongo.Database, q NamedQuery) (*CostEstimate, error) {
+	if q.Collection == "" {
+		return nil, fmt.Errorf("no collection")
+	}
+	var command bson.D
+	if q.Filter != nil {
+		command = bson.D{
+			{Key: "find", Value: q.Collection},
+			{Key: "filter", Value: filterFromSels(q.Filter)},
+		}
+		if len(q.Sort) > 0 {
+			command = append(command, bson.E{Key: "sort", Value: NormalizeSort(q.Sort)})
+		}
+		if q.Limit > 0 {
+			command = append(command, bson.E{Key: "limit", Value: q.Limit})
+		}
+	} else {
+		command = bson.D{
+			{Key: "aggregate", Value: q.Collection},
+			{Key: "pipeline", Value: q.Pipeline},
+			{Key: "cursor", Value: bson.D{}},
+		}
+	}
+
+	var result bson.Raw
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "explain", Value: command},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := winningPlans(result)
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("failed to explain %s: no plan found", q.Collection)
+	}
+	estimate := &CostEstimate{}
+	for _, plan := range plans {
+		walkPlan(plan, estimate)
+	}
+	return estimate, nil
+}
+
+// winningPlans returns the winning plans of an explain result: of the query, of the first $cursor
+// stage of pipelines not pushed down entirely, or of every shard of sharded pipelines
+func winningPlans(result bson.Raw) []bson.Raw {
+	if plan, ok := result.Lookup("queryPlanner", "winningPlan").DocumentOK(); ok {
+		return []bson.Raw{plan}
+	}
+	if plan, ok := result.Lookup("stages", "0", "$cursor", "queryPlanner", "winningPlan").DocumentOK(); ok {
+		return []bson.Raw{plan}
+	}
+	var plans []bson.Raw
+	if shards, ok := result.Lookup("shards").DocumentOK(); ok {
+		elements, _ := shards.Elements()
+		for _, shard := range elements {
+			if doc, ok := shard.Value().DocumentOK(); ok {
+				plans = append(plans, winningPlans(doc)...)
+			}
+		}
+	}
+	return plans
+}
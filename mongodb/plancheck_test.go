@@ -0,0 +1,43 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWinningPlans(t *testing.T) {
+	plan := bson.M{"stage": "IXSCAN", "indexName": "a_1"}
+	tests := []struct {
+		name   string
+		result bson.M
+		want   int
+	}{
+		{name: "query", result: bson.M{"queryPlanner": bson.M{"winningPlan": plan}}, want: 1},
+		{name: "pipeline", result: bson.M{"stages": bson.A{bson.M{"$cursor": bson.M{"queryPlanner": bson.M{"winningPlan": plan}}}}}, want: 1},
+		{name: "sharded pipeline", result: bson.M{"shards": bson.M{
+			"s0": bson.M{"queryPlanner": bson.M{"winningPlan": plan}},
+			"s1": bson.M{"stages": bson.A{bson.M{"$cursor": bson.M{"queryPlanner": bson.M{"winningPlan": plan}}}}},
+		}}, want: 2},
+		{name: "no plan", result: bson.M{"ok": 1}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := bson.Marshal(tt.result)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := winningPlans(raw)
+			if len(got) != tt.want {
+				t.Fatalf("winningPlans() returned %d plans, want %d", len(got), tt.want)
+			}
+			for _, p := range got {
+				estimate := &CostEstimate{}
+				walkPlan(p, estimate)
+				if len(estimate.Indexes) != 1 || estimate.Indexes[0] != "a_1" {
+					t.Errorf("walkPlan() indexes = %v", estimate.Indexes)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DefaultDiscriminator is the type code field of PolymorphicCtrl documents
+const DefaultDiscriminator = "_type"
+
+// PolymorphicCtrl stores several Go types implementing T (usually an interface) in one collection.
+// Documents carry the type code of their variant in a discriminator field, reads decode into the
+// registered variant and filter by the registered codes. Register variants with RegisterVariant.
+type PolymorphicCtrl[T any] struct {
+	db    *mongo.Collection
+	field string
+	codes *typeCodes
+}
+
+// NewPolymorphicCtrl creates a PolymorphicCtrl on collection with discriminator field, DefaultDiscriminator when empty
+func NewPolymorphicCtrl[T any](collection *mongo.Collection, field string) *PolymorphicCtrl[T] {
+	if field == "" {
+		field = DefaultDiscriminator
+	}
+	return &PolymorphicCtrl[T]{
+		db:    collection,
+		field: field,
+		codes: newTypeCodes(reflect.TypeOf((*T)(nil)).Elem()),
+	}
+}
+
+// RegisterVariant registers struct type V (stored as code) as a variant of p, V or *V must implement T
+// if code or V are already registered or V does not implement T, return err
+func RegisterVariant[T any, V any](p *PolymorphicCtrl[T], code string) error {
+	return p.codes.register(code, reflect.TypeOf((*V)(nil)).Elem())
+}
+
+// Create inserts item with the type code of its variant and returns its id
+// if the variant of item is not registered, return err
+// if some failed, return err
+func (p *PolymorphicCtrl[T]) Create(ctx context.Context, item T) (any, error) {
+	log.Debug("DB DEBUG: Started c.db.InsertOne(ctx, item) polymorphic")
+	defer log.Debug("DB DEBUG: finished c.db.InsertOne(ctx, item) polymorphic")
+	if err := checkWritable(ctx); err != nil {
+		return nil, err
+	}
+	doc, err := p.document(item)
+	if err != nil {
+		return nil, err
+	}
+	result, err := p.db.InsertOne(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	return result.InsertedID, nil
+}
+
+// Get returns the item by id decoded into its variant
+// if not found, return mongo.ErrNoDocuments
+// if some failed, return err
+func (p *PolymorphicCtrl[T]) Get(ctx context.Context, id any) (T, error) {
+	log.Debug("DB DEBUG: Started c.db.FindOne(ctx, filter) polymorphic")
+	defer log.Debug("DB DEBUG: finished c.db.FindOne(ctx, filter) polymorphic")
+	var zero T
+	raw, err := p.db.FindOne(ctx, p.idFilter(id)).Raw()
+	if err != nil {
+		return zero, err
+	}
+	return p.decode(raw)
+}
+
+// List returns the items of all registered variants selected by sels filter (logical AND)
+// if some failed, return err
+func (p *PolymorphicCtrl[T]) List(ctx context.Context, sels map[string]any) ([]T, error) {
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter) polymorphic")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter) polymorphic")
+	filter := append(filterFromSels(sels), bson.E{Key: p.field, Value: bson.M{"$in": p.codes.codes()}})
+	cursor, err := p.db.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	results := []T{}
+	for cursor.Next(ctx) {
+		item, err := p.decode(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, item)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Update replaces the item by id with item, which may be of another variant
+// if not found or not of a registered variant, return mongo.ErrNoDocuments
+// if some failed, return err
+func (p *PolymorphicCtrl[T]) Update(ctx context.Context, id any, item T) error {
+	log.Debug("DB DEBUG: Started c.db.ReplaceOne(ctx, filter, item) polymorphic")
+	defer log.Debug("DB DEBUG: finished c.db.ReplaceOne(ctx, filter, item) polymorphic")
+	if err := checkWritable(ctx); err != nil {
+		return err
+	}
+	doc, err := p.document(item)
+	if err != nil {
+		return err
+	}
+	result, err := p.db.ReplaceOne(ctx, p.idFilter(id), doc)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// Delete removes the item by id, documents of variants not registered with p are kept
+// if some failed, return err
+func (p *PolymorphicCtrl[T]) Delete(ctx context.Context, id any) error {
+	log.Debug("DB DEBUG: Started c.db.DeleteOne(ctx, filter) polymorphic")
+	defer log.Debug("DB DEBUG: finished c.db.DeleteOne(ctx, filter) polymorphic")
+	if err := checkWritable(ctx); err != nil {
+		return err
+	}
+	_, err := p.db.DeleteOne(ctx, p.idFilter(id))
+	return err
+}
+
+// idFilter selects the item by id if it is of a registered variant
+func (p *PolymorphicCtrl[T]) idFilter(id any) bson.D {
+	return bson.D{{Key: "_id", Value: id}, {Key: p.field, Value: bson.M{"$in": p.codes.codes()}}}
+}
+
+// ListVariant returns the items of variant V selected by sels filter (logical AND)
+// if V is not registered, return err
+// if some failed, return err
+func ListVariant[T any, V any](ctx context.Context, p *PolymorphicCtrl[T], sels map[string]any) ([]V, error) {
+	t := reflect.TypeOf((*V)(nil)).Elem()
+	code, ok := p.codes.codeOfType(t)
+	if !ok {
+		return nil, fmt.Errorf("failed to list %s: variant not registered", t)
+	}
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter) variant")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter) variant")
+	filter := append(filterFromSels(sels), bson.E{Key: p.field, Value: code})
+	cursor, err := p.db.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	results := []V{}
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// document encodes item with the type code of its variant
+func (p *PolymorphicCtrl[T]) document(item T) (bson.D, error) {
+	code, ok := p.codes.codeOf(item)
+	if !ok {
+		return nil, fmt.Errorf("failed to encode %T: variant not registered", item)
+	}
+	data, err := bson.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.D
+	err = bson.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range doc {
+		if e.Key == p.field {
+			doc = append(doc[:i], doc[i+1:]...)
+			break
+		}
+	}
+	return append(doc, bson.E{Key: p.field, Value: code}), nil
+}
+
+// decode decodes raw into the variant V of its type code, as *V when only *V implements T
+func (p *PolymorphicCtrl[T]) decode(raw bson.Raw) (T, error) {
+	var zero T
+	code, _ := raw.Lookup(p.field).StringValueOK()
+	ptr, value, ok := p.codes.newValue(code)
+	if !ok {
+		return zero, fmt.Errorf("failed to decode %s: unknown %s %q", raw.Lookup("_id"), p.field, code)
+	}
+	err := bson.Unmarshal(raw, ptr.Interface())
+	if err != nil {
+		return zero, err
+	}
+	return value.Interface().(T), nil
+}
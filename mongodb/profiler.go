@@ -0,0 +1,86 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Profiling levels of the database profiler
+const (
+	ProfilingOff     = 0
+	ProfilingSlowOps = 1
+	ProfilingAll     = 2
+)
+
+// SlowOp is an operation recorded by the database profiler in system.profile
+type SlowOp struct {
+	Op           string    `bson:"op"`
+	Namespace    string    `bson:"ns"`
+	Millis       int64     `bson:"millis"`
+	Timestamp    time.Time `bson:"ts"`
+	Command      bson.Raw  `bson:"command"`
+	PlanSummary  string    `bson:"planSummary"`
+	KeysExamined int64     `bson:"keysExamined"`
+	DocsExamined int64     `bson:"docsExamined"`
+	NReturned    int64     `bson:"nreturned"`
+	AppName      string    `bson:"appName"`
+	Client       string    `bson:"client"`
+	User         string    `bson:"user"`
+}
+
+// Comment returns the $comment attached to the profiled command, if any
+func (op SlowOp) Comment() string {
+	value, err := op.Command.LookupErr("comment")
+	if err != nil {
+		return ""
+	}
+	if s, ok := value.StringValueOK(); ok {
+		return s
+	}
+	return value.String()
+}
+
+// SetProfiling sets the profiler level of the database and the slow operation threshold
+// if some failed, return err
+func SetProfiling(ctx context.Context, db *mongo.Database, level int, slowMS int) error {
+	log.Debug("DB DEBUG: Started db.RunCommand(ctx, profile)")
+	defer log.Debug("DB DEBUG: finished db.RunCommand(ctx, profile)")
+
+	return db.RunCommand(ctx, bson.D{
+		{Key: "profile", Value: level},
+		{Key: "slowms", Value: slowMS},
+	}).Err()
+}
+
+// SlowOps returns operations recorded by the profiler since the given time, slowest first.
+// collection (optional) restricts results to one collection, limit <= 0 means no limit.
+// if some failed, return err
+func SlowOps(ctx context.Context, db *mongo.Database, collection string, since time.Time, limit int64) ([]SlowOp, error) {
+	log.Debug("DB DEBUG: Started system.profile.Find(ctx, filter)")
+	defer log.Debug("DB DEBUG: finished system.profile.Find(ctx, filter)")
+
+	filter := bson.D{{Key: "ts", Value: bson.M{"$gte": since}}}
+	if collection != "" {
+		filter = append(filter, bson.E{Key: "ns", Value: db.Name() + "." + collection})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "millis", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := db.Collection("system.profile").Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	ops := []SlowOp{}
+	err = cursor.All(ctx, &ops)
+	if err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
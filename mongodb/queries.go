@@ -0,0 +1,301 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// QueryParam is a placeholder of a NamedQuery, replaced by the parameter value on execution
+type QueryParam struct {
+	Name string
+}
+
+// Param returns the placeholder of parameter name
+func Param(name string) QueryParam {
+	return QueryParam{Name: name}
+}
+
+// NamedQuery is a parameterized filter or aggregation pipeline registered in a QueryRegistry
+type NamedQuery struct {
+	Name        string
+	Description string
+	// Collection is the collection the query runs on, used by CheckPlans
+	Collection string
+	// Filter is a selector template (see Param), exclusive with Pipeline
+	Filter map[string]any
+	Sort   bson.D
+	Limit  int64
+	// Pipeline is an aggregation template (see Param), exclusive with Filter
+	Pipeline mongo.Pipeline
+	// Params are the parameters of the query with example values, used for validation and explain
+	Params map[string]any
+}
+
+// QueryRegistry holds named queries, so complex queries live in one reviewed place
+// and run by name
+type QueryRegistry struct {
+	mu      sync.RWMutex
+	queries map[string]NamedQuery
+}
+
+// NewQueryRegistry creates an empty QueryRegistry
+func NewQueryRegistry() *QueryRegistry {
+	return &QueryRegistry{queries: map[string]NamedQuery{}}
+}
+
+// Register validates q and adds it: the name must be new, exactly one of Filter and Pipeline
+// must be set, placeholders and Params must match and the query bound to the example
+// values must compile (see CompileFilter). Register queries at startup to fail early.
+// if validation failed, return err
+func (r *QueryRegistry) Register(q NamedQuery) error {
+	if q.Name == "" {
+		return fmt.Errorf("failed to register query: empty name")
+	}
+	if (q.Filter == nil) == (q.Pipeline == nil) {
+		return fmt.Errorf("failed to register query %s: exactly one of Filter and Pipeline must be set", q.Name)
+	}
+	used := map[string]bool{}
+	collectParams(q.Filter, used)
+	collectParams(q.Pipeline, used)
+	for name := range used {
+		if _, ok := q.Params[name]; !ok {
+			return fmt.Errorf("failed to register query %s: parameter %s is not declared", q.Name, name)
+		}
+	}
+	for name := range q.Params {
+		if !used[name] {
+			return fmt.Errorf("failed to register query %s: parameter %s is not used", q.Name, name)
+		}
+	}
+	bound := bindParams(q, q.Params)
+	if q.Filter != nil {
+		_, err := CompileFilter(bound.Filter)
+		if err != nil {
+			return fmt.Errorf("failed to register query %s: %s", q.Name, err)
+		}
+	} else {
+		_, err := bson.Marshal(bson.D{{Key: "pipeline", Value: bound.Pipeline}})
+		if err != nil {
+			return fmt.Errorf("failed to register query %s: %s", q.Name, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.queries[q.Name]; ok {
+		return fmt.Errorf("failed to register query %s: already registered", q.Name)
+	}
+	r.queries[q.Name] = q
+	return nil
+}
+
+// MustRegister is Register panicking on error, for package level registration
+func (r *QueryRegistry) MustRegister(q NamedQuery) {
+	if err := r.Register(q); err != nil {
+		panic(err)
+	}
+}
+
+// Get returns the query registered as name
+func (r *QueryRegistry) Get(name string) (NamedQuery, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	q, ok := r.queries[name]
+	return q, ok
+}
+
+// Names returns the names of the registered queries in order
+func (r *QueryRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.queries))
+	for name := range r.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Bind returns the query registered as name with its placeholders replaced by params
+// if the query is unknown or params miss or add parameters, return err
+func (r *QueryRegistry) Bind(name string, params map[string]any) (NamedQuery, error) {
+	q, ok := r.Get(name)
+	if !ok {
+		return NamedQuery{}, fmt.Errorf("failed to bind query %s: not registered", name)
+	}
+	for param := range q.Params {
+		if _, ok := params[param]; !ok {
+			return NamedQuery{}, fmt.Errorf("failed to bind query %s: missing parameter %s", name, param)
+		}
+	}
+	for param := range params {
+		if _, ok := q.Params[param]; !ok {
+			return NamedQuery{}, fmt.Errorf("failed to bind query %s: unknown parameter %s", name, param)
+		}
+	}
+	return bindParams(q, params), nil
+}
+
+// RunQuery executes the query registered as name with params on c. Filter queries go through
+// the controller like List, pipeline results are decoded as items of c.
+// if some failed, return err
+func RunQuery[T any](ctx context.Context, c *genericObjectDBCtrl[T], r *QueryRegistry, name string, params map[string]any) ([]T, error) {
+	log.Debugf("DB DEBUG: Started RunQuery %s", name)
+	defer log.Debugf("DB DEBUG: finished RunQuery %s", name)
+
+	q, err := r.Bind(name, params)
+	if err != nil {
+		return nil, err
+	}
+	if q.Filter != nil {
+		return AsRepository(c).List(ctx, Query{Filter: q.Filter, Sort: q.Sort, Limit: q.Limit})
+	}
+
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+	cursor, err := c.reader().Aggregate(ctx, q.Pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	results := []T{}
+	for cursor.Next(ctx) {
+		var item T
+		err = c.decodeItem(ctx, cursor.Current, &item)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, item)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// bindParams returns q with placeholders of its Filter and Pipeline replaced by params
+func bindParams(q NamedQuery, params map[string]any) NamedQuery {
+	if q.Filter != nil {
+		q.Filter = bindValue(q.Filter, params).(map[string]any)
+	}
+	if q.Pipeline != nil {
+		q.Pipeline = bindValue(q.Pipeline, params).(mongo.Pipeline)
+	}
+	return q
+}
+
+// bindValue returns a copy of v with placeholders replaced by params
+func bindValue(v any, params map[string]any) any {
+	switch v := v.(type) {
+	case QueryParam:
+		return params[v.Name]
+	case map[string]any:
+		bound := make(map[string]any, len(v))
+		for k, value := range v {
+			bound[k] = bindValue(value, params)
+		}
+		return bound
+	case bson.M:
+		return bson.M(bindValue(map[string]any(v), params).(map[string]any))
+	case bson.D:
+		bound := make(bson.D, len(v))
+		for i, e := range v {
+			bound[i] = bson.E{Key: e.Key, Value: bindValue(e.Value, params)}
+		}
+		return bound
+	case []any:
+		bound := make([]any, len(v))
+		for i, value := range v {
+			bound[i] = bindValue(value, params)
+		}
+		return bound
+	case bson.A:
+		return bson.A(bindValue([]any(v), params).([]any))
+	case mongo.Pipeline:
+		bound := make(mongo.Pipeline, len(v))
+		for i, stage := range v {
+			bound[i] = bindValue(stage, params).(bson.D)
+		}
+		return bound
+	}
+	return bindReflect(v, params)
+}
+
+// bindReflect binds placeholders in slices and maps of other types, e.g. the []bson.M of an $or.
+// Values holding placeholders are returned as []any or map[string]any, others unchanged.
+func bindReflect(v any, params map[string]any) any {
+	names := map[string]bool{}
+	collectParams(v, names)
+	if len(names) == 0 {
+		return v
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Map {
+		bound := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			bound[iter.Key().String()] = bindValue(iter.Value().Interface(), params)
+		}
+		return bound
+	}
+	bound := make([]any, rv.Len())
+	for i := range bound {
+		bound[i] = bindValue(rv.Index(i).Interface(), params)
+	}
+	return bound
+}
+
+// collectParams adds the names of placeholders in v to names
+func collectParams(v any, names map[string]bool) {
+	switch v := v.(type) {
+	case QueryParam:
+		names[v.Name] = true
+	case map[string]any:
+		for _, value := range v {
+			collectParams(value, names)
+		}
+	case bson.M:
+		collectParams(map[string]any(v), names)
+	case bson.D:
+		for _, e := range v {
+			collectParams(e.Value, names)
+		}
+	case []any:
+		for _, value := range v {
+			collectParams(value, names)
+		}
+	case bson.A:
+		collectParams([]any(v), names)
+	case mongo.Pipeline:
+		for _, stage := range v {
+			collectParams(stage, names)
+		}
+	case nil, []byte:
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			if rv.Type().Elem().Kind() == reflect.Uint8 {
+				return
+			}
+			for i := 0; i < rv.Len(); i++ {
+				collectParams(rv.Index(i).Interface(), names)
+			}
+		case reflect.Map:
+			if rv.Type().Key().Kind() != reflect.String {
+				return
+			}
+			iter := rv.MapRange()
+			for iter.Next() {
+				collectParams(iter.Value().Interface(), names)
+			}
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// QuotaLimits are the maximum documents and bytes (BSON size) a tenant may store, 0 is unlimited
+type QuotaLimits struct {
+	MaxDocuments int64
+	MaxBytes     int64
+}
+
+// QuotaUsage is what a tenant stores
+type QuotaUsage struct {
+	Documents int64
+	Bytes     int64
+}
+
+// QuotaExceededError is returned by writes that would take a tenant over its quota
+type QuotaExceededError struct {
+	Tenant     string
+	Collection string
+	Limits     QuotaLimits
+	Usage      QuotaUsage
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("tenant %s over quota of %s: %d documents, %d bytes, limits %d documents, %d bytes",
+		e.Tenant, e.Collection, e.Usage.Documents, e.Usage.Bytes, e.Limits.MaxDocuments, e.Limits.MaxBytes)
+}
+
+// Code implements Coder
+func (e *QuotaExceededError) Code() ErrorCode {
+	return CodePrecondition
+}
+
+// Quota is a Repository rejecting writes that take the tenant of the context (see WithTenant) over
+// its limits with *QuotaExceededError. Usage is kept in Counters, reserved before a write and
+// released when it fails, so concurrent writes can't overshoot. Writes made around Quota drift the
+// counters, repair them with Reconcile. Updates and deletes by id read the item first for its size,
+// DeleteRange lists the items it deletes.
+type Quota[T any] struct {
+	Repository[T]
+
+	name     string
+	counters *Counter
+	limits   func(tenant string) QuotaLimits
+}
+
+// NewQuota creates the quota layer over repo storing items of collection name, counters are stored in
+// db and limits returns the limits of a tenant, e.g. by its plan
+func NewQuota[T any](repo Repository[T], name string, db *mongo.Database, limits func(tenant string) QuotaLimits) *Quota[T] {
+	return &Quota[T]{Repository: repo, name: name, counters: NewCounter(db), limits: limits}
+}
+
+func (q *Quota[T]) keys(tenant string) (string, string) {
+	prefix := "quota:" + q.name + ":" + tenant
+	return prefix + ":documents", prefix + ":bytes"
+}
+
+// Usage returns the counted usage of tenant
+// if some failed, return err
+func (q *Quota[T]) Usage(ctx context.Context, tenant string) (QuotaUsage, error) {
+	docsKey, bytesKey := q.keys(tenant)
+	docs, err := q.counters.Get(ctx, docsKey)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	size, err := q.counters.Get(ctx, bytesKey)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	return QuotaUsage{Documents: docs, Bytes: size}, nil
+}
+
+// reserve adds delta to the usage of tenant, reverting it and returning *QuotaExceededError when
+// a growing usage passes the limits
+func (q *Quota[T]) reserve(ctx context.Context, tenant string, delta QuotaUsage) error {
+	docsKey, bytesKey := q.keys(tenant)
+	limits := q.limits(tenant)
+	docs, err := q.counters.IncrBy(ctx, docsKey, delta.Documents)
+	if err != nil {
+		return err
+	}
+	size, err := q.counters.IncrBy(ctx, bytesKey, delta.Bytes)
+	if err != nil {
+		_, _ = q.counters.DecrBy(ctx, docsKey, delta.Documents)
+		return err
+	}
+	over := (delta.Documents > 0 && limits.MaxDocuments > 0 && docs > limits.MaxDocuments) ||
+		(delta.Bytes > 0 && limits.MaxBytes > 0 && size > limits.MaxBytes)
+	if !over {
+		return nil
+	}
+	q.release(ctx, tenant, delta)
+	return &QuotaExceededError{Tenant: tenant, Collection: q.name, Limits: limits, Usage: QuotaUsage{Documents: docs - delta.Documents, Bytes: size - delta.Bytes}}
+}
+
+// release takes delta back from the usage of tenant
+func (q *Quota[T]) release(ctx context.Context, tenant string, delta QuotaUsage) {
+	docsKey, bytesKey := q.keys(tenant)
+	_, _ = q.counters.DecrBy(ctx, docsKey, delta.Documents)
+	_, _ = q.counters.DecrBy(ctx, bytesKey, delta.Bytes)
+}
+
+func itemSize[T any](item *T) (int64, error) {
+	data, err := bson.Marshal(item)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+func (q *Quota[T]) Create(ctx context.Context, item *T) (*CreateResult, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	size, err := itemSize(item)
+	if err != nil {
+		return nil, err
+	}
+	delta := QuotaUsage{Documents: 1, Bytes: size}
+	if err = q.reserve(ctx, tenant, delta); err != nil {
+		return nil, err
+	}
+	result, err := q.Repository.Create(ctx, item)
+	if err != nil {
+		q.release(ctx, tenant, delta)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (q *Quota[T]) Update(ctx context.Context, id any, item *T) (*UpdateResult, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	old, err := q.Repository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	oldSize, err := itemSize(old)
+	if err != nil {
+		return nil, err
+	}
+	size, err := itemSize(item)
+	if err != nil {
+		return nil, err
+	}
+	delta := QuotaUsage{Bytes: size - oldSize}
+	if err = q.reserve(ctx, tenant, delta); err != nil {
+		return nil, err
+	}
+	result, err := q.Repository.Update(ctx, id, item)
+	if err != nil {
+		q.release(ctx, tenant, delta)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (q *Quota[T]) Delete(ctx context.Context, id any) (*DeleteResult, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	old, err := q.Repository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	size, err := itemSize(old)
+	if err != nil {
+		return nil, err
+	}
+	result, err := q.Repository.Delete(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	q.release(ctx, tenant, QuotaUsage{Documents: result.Deleted, Bytes: size * result.Deleted})
+	return result, nil
+}
+
+func (q *Quota[T]) UpdateAttributes(ctx context.Context, query Query, attrs map[string]any) (*UpdateResult, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	old, err := q.storage(ctx, query, attrs)
+	if err != nil {
+		return nil, err
+	}
+	data, err := bson.Marshal(attrsDoc(attrs, func(path string) (any, bool) {
+		return attrs[path], true
+	}))
+	if err != nil {
+		return nil, err
+	}
+	// every selected item grows by the size of the new attributes less the size of the old ones
+	delta := QuotaUsage{Bytes: old.Documents*int64(len(data)) - old.Bytes}
+	if err = q.reserve(ctx, tenant, delta); err != nil {
+		return nil, err
+	}
+	result, err := q.Repository.UpdateAttributes(ctx, query, attrs)
+	if err != nil {
+		q.release(ctx, tenant, delta)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (q *Quota[T]) DeleteRange(ctx context.Context, query Query) (*DeleteResult, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	usage, err := q.storage(ctx, Query{Filter: query.Filter}, nil)
+	if err != nil {
+		return nil, err
+	}
+	result, err := q.Repository.DeleteRange(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	// items created between the sizing and the delete are not accounted, Reconcile repairs them
+	q.release(ctx, tenant, QuotaUsage{Documents: result.Deleted, Bytes: usage.Bytes})
+	return result, nil
+}
+
+// Reconcile recounts the items of tenant through the repository and corrects its usage,
+// it scans every item of the tenant
+// if some failed, return err
+func (q *Quota[T]) Reconcile(ctx context.Context, tenant string) (QuotaUsage, error) {
+	ctx = WithTenant(ctx, tenant)
+	actual, err := q.storage(ctx, Query{}, nil)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	counted, err := q.Usage(ctx, tenant)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	docsKey, bytesKey := q.keys(tenant)
+	if _, err = q.counters.IncrBy(ctx, docsKey, actual.Documents-counted.Documents); err != nil {
+		return QuotaUsage{}, err
+	}
+	if _, err = q.counters.IncrBy(ctx, bytesKey, actual.Bytes-counted.Bytes); err != nil {
+		return QuotaUsage{}, err
+	}
+	return actual, nil
+}
+
+// storageSizer is implemented by repositories summing the size of items on the server
+type storageSizer interface {
+	// storageUsage returns the number of items selected by q and the sum of the BSON size of expr
+	// evaluated on each of them
+	storageUsage(ctx context.Context, q Query, expr any) (QuotaUsage, error)
+}
+
+// storage returns the number of items selected by query and their size, of only the attributes
+// attrs if they are set
+func (q *Quota[T]) storage(ctx context.Context, query Query, attrs map[string]any) (QuotaUsage, error) {
+	if sizer, ok := q.Repository.(storageSizer); ok {
+		var expr any = "$$ROOT"
+		if attrs != nil {
+			expr = attrsDoc(attrs, func(path string) (any, bool) {
+				return "$" + path, true
+			})
+		}
+		return sizer.storageUsage(ctx, query, expr)
+	}
+	items, err := q.Repository.List(ctx, Query{Filter: query.Filter})
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	usage := QuotaUsage{Documents: int64(len(items))}
+	for i := range items {
+		data, err := bson.Marshal(&items[i])
+		if err != nil {
+			return QuotaUsage{}, err
+		}
+		if attrs != nil {
+			data, err = bson.Marshal(attrsDoc(attrs, func(path string) (any, bool) {
+				value, err := bson.Raw(data).LookupErr(strings.Split(path, ".")...)
+				return value, err == nil
+			}))
+			if err != nil {
+				return QuotaUsage{}, err
+			}
+		}
+		usage.Bytes += int64(len(data))
+	}
+	return usage, nil
+}
+
+// attrsDoc returns the document nesting the value of every dot path of attrs, paths without value are left out
+func attrsDoc(attrs map[string]any, value func(path string) (any, bool)) bson.M {
+	doc := bson.M{}
+	for path := range attrs {
+		v, ok := value(path)
+		if !ok {
+			continue
+		}
+		parent := doc
+		keys := strings.Split(path, ".")
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := parent[key].(bson.M)
+			if !ok {
+				child = bson.M{}
+				parent[key] = child
+			}
+			parent = child
+		}
+		parent[keys[len(keys)-1]] = v
+	}
+	return doc
+}
+
+func (r *repository[T]) storageUsage(ctx context.Context, q Query, expr any) (QuotaUsage, error) {
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $bsonSize) quota")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $bsonSize) quota")
+	ctx, cancel, _ := r.c.begin(ctx, opRead)
+	defer cancel()
+	cursor, err := r.c.db.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filterFromSels(r.c.internalSels(q.Filter))}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "documents", Value: bson.M{"$sum": 1}},
+			{Key: "bytes", Value: bson.M{"$sum": bson.M{"$bsonSize": expr}}},
+		}}},
+	})
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	var rows []struct {
+		Documents int64 `bson:"documents"`
+		Bytes     int64 `bson:"bytes"`
+	}
+	err = cursor.All(ctx, &rows)
+	if err != nil || len(rows) == 0 {
+		return QuotaUsage{}, err
+	}
+	return QuotaUsage{Documents: rows[0].Documents, Bytes: rows[0].Bytes}, nil
+}
+
+func (r *tenantRepository[T]) storageUsage(ctx context.Context, q Query, expr any) (QuotaUsage, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	return repo.(storageSizer).storageUsage(ctx, scope(q, tenant, field), expr)
+}
@@ -0,0 +1,22 @@
+package mongodb
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAttrsDoc(t *testing.T) {
+	attrs := map[string]any{"name": "n", "meta.a": 1, "meta.b": 2, "missing": 3}
+	got := attrsDoc(attrs, func(path string) (any, bool) {
+		if path == "missing" {
+			return nil, false
+		}
+		return "$" + path, true
+	})
+	want := bson.M{"name": "$name", "meta": bson.M{"a": "$meta.a", "b": "$meta.b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("attrsDoc() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// rateLimitCollection stores rate limiter hit counters
+const rateLimitCollection = "_ratelimits"
+
+// RateLimiter is a coarse sliding-window rate limiter for services that do not want Redis.
+// Hits are counted per key in fixed windows, the sliding count is approximated by weighting
+// the previous window by its overlap with the sliding one. Counters expire by a TTL index.
+type RateLimiter struct {
+	db *mongo.Collection
+}
+
+// NewRateLimiter creates a RateLimiter storing counters in the database rate limits collection
+// and ensures its TTL index
+// if some failed, return err
+func NewRateLimiter(ctx context.Context, db *mongo.Database) (*RateLimiter, error) {
+	collection := db.Collection(rateLimitCollection)
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimiter{db: collection}, nil
+}
+
+// Allow records a hit of key and reports whether it is within limit hits per window.
+// Denied hits are not counted.
+// if some failed, return err
+func (r *RateLimiter) Allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, error) {
+	if window <= 0 {
+		return false, fmt.Errorf("failed to check rate limit: window must be positive")
+	}
+	now := time.Now()
+	start := now.Truncate(window)
+	current := rateLimitID(key, start)
+
+	var doc struct {
+		Count int64 `bson:"count"`
+	}
+	err := r.db.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": current},
+		bson.D{
+			bson.E{Key: "$inc", Value: bson.M{"count": 1}},
+			bson.E{Key: "$setOnInsert", Value: bson.M{"expires_at": start.Add(2 * window)}},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return false, err
+	}
+
+	previous, err := r.count(ctx, rateLimitID(key, start.Add(-window)))
+	if err != nil {
+		return false, err
+	}
+	overlap := 1 - float64(now.Sub(start))/float64(window)
+	if float64(previous)*overlap+float64(doc.Count) <= float64(limit) {
+		return true, nil
+	}
+
+	_, err = r.db.UpdateOne(ctx, bson.M{"_id": current}, bson.M{"$inc": bson.M{"count": -1}})
+	return false, err
+}
+
+func (r *RateLimiter) count(ctx context.Context, id string) (int64, error) {
+	var doc struct {
+		Count int64 `bson:"count"`
+	}
+	err := r.db.FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return doc.Count, nil
+}
+
+func rateLimitID(key string, start time.Time) string {
+	return fmt.Sprintf("%s:%d", key, start.UnixMilli())
+}
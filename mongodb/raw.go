@@ -0,0 +1,108 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GetRaw gets an item by id as undecoded bson, for pass-through services.
+// Offloaded and compressed fields are restored, schema upgrades are not applied.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) GetRaw(ctx context.Context, id any) (_ bson.Raw, err error) {
+	defer c.recoverPanic(ctx, "GetRaw", &err)
+	id = c.internalID(id)
+	log.Debug("DB DEBUG: Started c.db.FindOne(ctx, filter)")
+	defer log.Debug("DB DEBUG: finished c.db.FindOne(ctx, filter)")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+
+	raw, err := c.reader().FindOne(ctx, bson.D{bson.E{Key: "_id", Value: id}}, profile.findOneOptions()).Raw()
+	if err != nil {
+		return nil, err
+	}
+	return c.restoreRaw(ctx, raw)
+}
+
+// ListRaw lists items by sels filter (logical AND) as undecoded bson, skipping the typed decode.
+// Offloaded and compressed fields are restored, schema upgrades are not applied.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ListRaw(ctx context.Context, sels map[string]any) (_ []bson.Raw, err error) {
+	defer c.recoverPanic(ctx, "ListRaw", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter)")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter)")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+	c.recordAccess(sels, nil)
+
+	cursor, err := c.reader().Find(ctx, filterFromSels(sels), profile.findOptions())
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	results := []bson.Raw{}
+	for cursor.Next(ctx) {
+		doc, err := c.restoreRaw(ctx, cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		// cursor.Current is only valid until the next call to Next
+		results = append(results, append(bson.Raw(nil), doc...))
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// IterateRaw streams items identified by sels to fn as bson like Iterate, skipping the typed decode.
+// Offloaded and compressed fields are restored, schema upgrades are not applied.
+// doc is only valid until fn returns.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) IterateRaw(ctx context.Context, sels map[string]any, fn func(doc bson.Raw) error, opts ...IterateOption) (err error) {
+	defer c.recoverPanic(ctx, "IterateRaw", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.IterateRaw")
+	defer log.Debug("DB DEBUG: finished c.IterateRaw")
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+	c.recordAccess(sels, nil)
+
+	var o iterateOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	findOpts := profile.findOptions()
+	if o.batchSize > 0 {
+		findOpts.SetBatchSize(o.batchSize)
+	}
+
+	cursor, err := c.reader().Find(ctx, filterFromSels(sels), findOpts)
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	for cursor.Next(ctx) {
+		doc, err := c.restoreRaw(ctx, cursor.Current)
+		if err != nil {
+			return err
+		}
+		if err = fn(doc); err != nil {
+			return err
+		}
+	}
+	return cursorErr(ctx, cursor)
+}
+
+// restoreRaw restores the offloaded and compressed fields of the stored document doc
+func (c *genericObjectDBCtrl[T]) restoreRaw(ctx context.Context, doc bson.Raw) (bson.Raw, error) {
+	doc, err := c.hydrate(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	return c.decompress(doc)
+}
@@ -0,0 +1,58 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// ErrReadOnly is returned by writes while read-only mode is on, see SetReadOnly and WithReadOnly
+var ErrReadOnly = errors.New("read-only mode")
+
+// readOnlyMode is the process wide read-only switch
+var readOnlyMode = struct {
+	sync.RWMutex
+	on     bool
+	reason string
+}{}
+
+// SetReadOnly switches the process wide read-only mode: while on, controller writes fail with
+// ErrReadOnly and reads keep working, e.g. during migrations, failovers and incident mitigation.
+// reason is included in the errors.
+func SetReadOnly(on bool, reason string) {
+	readOnlyMode.Lock()
+	defer readOnlyMode.Unlock()
+	if readOnlyMode.on != on {
+		log.Warnf("DB WARN: read-only mode %s: %s", map[bool]string{true: "on", false: "off"}[on], reason)
+	}
+	readOnlyMode.on = on
+	readOnlyMode.reason = reason
+}
+
+// IsReadOnly reports whether the process wide read-only mode is on and why
+func IsReadOnly() (bool, string) {
+	readOnlyMode.RLock()
+	defer readOnlyMode.RUnlock()
+	return readOnlyMode.on, readOnlyMode.reason
+}
+
+type readOnlyKey struct{}
+
+// WithReadOnly returns a context whose controller writes fail with ErrReadOnly, e.g. for requests
+// of users whose data is being moved
+func WithReadOnly(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, reason)
+}
+
+// checkWritable returns ErrReadOnly when read-only mode is on for the process or ctx
+func checkWritable(ctx context.Context) error {
+	if reason, ok := ctx.Value(readOnlyKey{}).(string); ok {
+		return errors.Wrap(ErrReadOnly, reason)
+	}
+	if on, reason := IsReadOnly(); on {
+		return errors.Wrap(ErrReadOnly, reason)
+	}
+	return nil
+}
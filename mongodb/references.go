@@ -0,0 +1,123 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Reference declares that Field of documents in From holds _id values of documents in To,
+// e.g. orders.customer_id -> customers._id. Both collections must be in the same database.
+type Reference struct {
+	From  *mongo.Collection
+	Field string
+	To    *mongo.Collection
+}
+
+func (r Reference) String() string {
+	return fmt.Sprintf("%s.%s -> %s._id", r.From.Name(), r.Field, r.To.Name())
+}
+
+// RepairAction defines what CheckReferences does with dangling references
+type RepairAction int
+
+const (
+	// RepairNone only reports dangling references
+	RepairNone RepairAction = iota
+	// RepairUnset removes the dangling reference field from the referencing documents
+	RepairUnset
+	// RepairDelete deletes the referencing documents
+	RepairDelete
+)
+
+// DanglingReport lists documents referencing missing documents for one Reference
+type DanglingReport struct {
+	Reference string
+	// IDs are _id values of the referencing documents
+	IDs []any
+	// Values are the missing referenced values
+	Values   []any
+	Repaired int64
+}
+
+// Collection returns the collection the controller works with
+func (c *genericObjectDBCtrl[T]) Collection() *mongo.Collection {
+	return c.db
+}
+
+// CheckReferences scans every reference for documents pointing to missing documents
+// and applies action to them. Only scalar reference fields are checked.
+// if some failed, return reports collected so far and err
+func CheckReferences(ctx context.Context, refs []Reference, action RepairAction) ([]DanglingReport, error) {
+	log.Debug("DB DEBUG: Started CheckReferences")
+	defer log.Debug("DB DEBUG: finished CheckReferences")
+
+	var reports []DanglingReport
+	for _, ref := range refs {
+		report, err := checkReference(ctx, ref, action)
+		if err != nil {
+			return reports, fmt.Errorf("failed to check %s: %s", ref, err)
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+func checkReference(ctx context.Context, ref Reference, action RepairAction) (*DanglingReport, error) {
+	if ref.From.Database().Name() != ref.To.Database().Name() {
+		return nil, fmt.Errorf("collections are in different databases")
+	}
+
+	cursor, err := ref.From.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{ref.Field: bson.M{"$exists": true, "$ne": nil}}}},
+		{{Key: "$project", Value: bson.M{"value": "$" + ref.Field}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         ref.To.Name(),
+			"localField":   "value",
+			"foreignField": "_id",
+			"as":           "target",
+			"pipeline":     bson.A{bson.M{"$project": bson.M{"_id": 1}}},
+		}}},
+		{{Key: "$match", Value: bson.M{"target": bson.M{"$size": 0}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var dangling []struct {
+		ID    any `bson:"_id"`
+		Value any `bson:"value"`
+	}
+	err = cursor.All(ctx, &dangling)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DanglingReport{Reference: ref.String()}
+	for _, d := range dangling {
+		report.IDs = append(report.IDs, d.ID)
+		report.Values = append(report.Values, d.Value)
+	}
+	if len(report.IDs) == 0 {
+		return report, nil
+	}
+
+	filter := bson.M{"_id": bson.M{"$in": report.IDs}}
+	switch action {
+	case RepairUnset:
+		result, err := ref.From.UpdateMany(ctx, filter, bson.M{"$unset": bson.M{ref.Field: ""}})
+		if err != nil {
+			return report, err
+		}
+		report.Repaired = result.ModifiedCount
+	case RepairDelete:
+		result, err := ref.From.DeleteMany(ctx, filter)
+		if err != nil {
+			return report, err
+		}
+		report.Repaired = result.DeletedCount
+	}
+	return report, nil
+}
@@ -0,0 +1,223 @@
+package mongodb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// modelRegistry records the models used with collections in the process
+var modelRegistry = struct {
+	sync.RWMutex
+	models      map[string]reflect.Type
+	controllers map[string]registeredController
+}{models: map[string]reflect.Type{}, controllers: map[string]registeredController{}}
+
+// registeredController is what the registry keeps of a controller
+type registeredController struct {
+	collection  *mongo.Collection
+	foreignKeys []ForeignKey
+	dependents  []Dependent
+	compat      *Capabilities
+}
+
+// RegisterModel records model T as stored in collection ("db.collection"), controllers
+// created by NewGenericObjectDBCtrl register their models automatically
+func RegisterModel[T any](collection string) {
+	registerModel(collection, reflect.TypeOf((*T)(nil)).Elem())
+}
+
+func registerModel(collection string, t reflect.Type) {
+	modelRegistry.Lock()
+	defer modelRegistry.Unlock()
+	modelRegistry.models[collection] = t
+}
+
+// unregisterModel removes collection from the registry, e.g. after a temporary collection is dropped
+func unregisterModel(collection string) {
+	modelRegistry.Lock()
+	defer modelRegistry.Unlock()
+	delete(modelRegistry.models, collection)
+	delete(modelRegistry.controllers, collection)
+}
+
+// registerController records the collection and declared relations of a controller
+func registerController(collection *mongo.Collection, o ctrlOptions) {
+	modelRegistry.Lock()
+	defer modelRegistry.Unlock()
+	modelRegistry.controllers[collection.Database().Name()+"."+collection.Name()] = registeredController{
+		collection:  collection,
+		foreignKeys: o.foreignKeys,
+		dependents:  o.dependents,
+		compat:      o.compat,
+	}
+}
+
+// registeredCompat returns the capabilities declared with WithCompatibility by a controller of
+// collection, or else by a controller of another collection of db, nil when there is none
+func registeredCompat(db *mongo.Database, collection string) *Capabilities {
+	modelRegistry.RLock()
+	defer modelRegistry.RUnlock()
+	if c, ok := modelRegistry.controllers[db.Name()+"."+collection]; ok && c.compat != nil {
+		return c.compat
+	}
+	for _, c := range modelRegistry.controllers {
+		if c.compat != nil && c.collection.Database().Name() == db.Name() {
+			return c.compat
+		}
+	}
+	return nil
+}
+
+// registeredModels returns a snapshot of the registry sorted by collection
+func registeredModels() ([]string, map[string]reflect.Type) {
+	modelRegistry.RLock()
+	defer modelRegistry.RUnlock()
+	models := make(map[string]reflect.Type, len(modelRegistry.models))
+	names := make([]string, 0, len(modelRegistry.models))
+	for name, t := range modelRegistry.models {
+		models[name] = t
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, models
+}
+
+// ModelInfo describes a registered model for introspection, see RegisteredModels
+type ModelInfo struct {
+	// Collection is "db.collection"
+	Collection string           `json:"collection"`
+	Type       string           `json:"type"`
+	Fields     []ModelFieldInfo `json:"fields"`
+	// References are declared with `mgref` tags
+	References []ReferenceInfo `json:"references,omitempty"`
+	// ForeignKeys are declared with WithForeignKeys
+	ForeignKeys []ReferenceInfo `json:"foreign_keys,omitempty"`
+	Dependents  []DependentInfo `json:"dependents,omitempty"`
+	// Indexes are the indexes of the collection on the server, listed for models of controllers
+	Indexes []IndexInfo `json:"indexes,omitempty"`
+}
+
+// ModelFieldInfo is a stored field of a model with its mg* tags
+type ModelFieldInfo struct {
+	Name     string            `json:"name"`
+	BSONName string            `json:"bson_name"`
+	Type     string            `json:"type"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+// ReferenceInfo is a field referencing documents of another collection
+type ReferenceInfo struct {
+	Field      string `json:"field"`
+	Collection string `json:"collection"`
+}
+
+// DependentInfo is a Dependent of a controller with its action named
+type DependentInfo struct {
+	Collection string `json:"collection"`
+	Field      string `json:"field"`
+	Action     string `json:"action"`
+}
+
+// IndexInfo is an index of a registered collection
+type IndexInfo struct {
+	Name   string `json:"name"`
+	Keys   any    `json:"keys"`
+	Unique bool   `json:"unique,omitempty"`
+	Sparse bool   `json:"sparse,omitempty"`
+}
+
+// modelTags are the struct tags of model fields interpreted by the package
+var modelTags = []string{"mganon", "mgcompress", "mgdata", "mgdefault", "mgdim", "mgenum", "mgimmutable", "mgoffload", "mgref"}
+
+var cascadeActionNames = map[CascadeAction]string{
+	CascadeDelete:   "delete",
+	CascadeNullify:  "nullify",
+	CascadeRestrict: "restrict",
+}
+
+// RegisteredModels describes the models registered in the process sorted by collection, with
+// their fields and declared relations and, when withIndexes is set, the server indexes of the
+// collections of controllers, for debugging and architecture documentation from live code
+// if some failed, return err
+func RegisteredModels(ctx context.Context, withIndexes bool) ([]ModelInfo, error) {
+	names, models := registeredModels()
+	modelRegistry.RLock()
+	controllers := make(map[string]registeredController, len(modelRegistry.controllers))
+	for name, c := range modelRegistry.controllers {
+		controllers[name] = c
+	}
+	modelRegistry.RUnlock()
+
+	infos := make([]ModelInfo, 0, len(names))
+	for _, name := range names {
+		t := models[name]
+		info := ModelInfo{Collection: name, Type: t.String(), Fields: []ModelFieldInfo{}}
+		for _, f := range modelFields(t) {
+			field := ModelFieldInfo{Name: f.Name, BSONName: f.BSONName, Type: f.Type.String()}
+			for _, key := range modelTags {
+				if value, ok := f.Tag.Lookup(key); ok {
+					if field.Tags == nil {
+						field.Tags = map[string]string{}
+					}
+					field.Tags[key] = value
+				}
+			}
+			info.Fields = append(info.Fields, field)
+		}
+		if relations, err := modelRelations(t); err == nil {
+			for _, rel := range relations {
+				info.References = append(info.References, ReferenceInfo{Field: rel.field.BSONName, Collection: rel.collection})
+			}
+		}
+
+		controller, ok := controllers[name]
+		if ok {
+			for _, fk := range controller.foreignKeys {
+				info.ForeignKeys = append(info.ForeignKeys, ReferenceInfo{Field: fk.Field, Collection: fk.Collection})
+			}
+			for _, d := range controller.dependents {
+				info.Dependents = append(info.Dependents, DependentInfo{Collection: d.Collection, Field: d.Field, Action: cascadeActionNames[d.Action]})
+			}
+		}
+		if ok && withIndexes {
+			cursor, err := controller.collection.Indexes().List(ctx)
+			if err != nil {
+				return nil, err
+			}
+			var indexes []existingIndex
+			if err = cursor.All(ctx, &indexes); err != nil {
+				return nil, err
+			}
+			for _, index := range indexes {
+				info.Indexes = append(info.Indexes, IndexInfo{Name: index.Name, Keys: index.Key, Unique: index.Unique, Sparse: index.Sparse})
+			}
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// RegistryHandler serves RegisteredModels as JSON, with server indexes for ?indexes=true.
+// It exposes the data model, mount it on an internal or authenticated route only.
+func RegistryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		infos, err := RegisteredModels(r.Context(), r.URL.Query().Get("indexes") == "true")
+		if err != nil {
+			http.Error(w, err.Error(), HTTPStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(infos)
+	})
+}
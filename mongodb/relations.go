@@ -0,0 +1,227 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// relation is a reference declared on a model field with `mgref:"collection[,TargetField]"`,
+// e.g. CustomerID `bson:"customer_id" mgref:"customers,Customer"` loads the customer
+// into the Customer field (*Customer, Customer or a slice when the id field is a slice)
+type relation struct {
+	field      modelField
+	collection string
+	target     *modelField
+}
+
+// modelRelations returns relations declared on the fields of T
+func modelRelations(t reflect.Type) ([]relation, error) {
+	fields := modelFields(t)
+	var relations []relation
+	for _, f := range fields {
+		tag, ok := f.Tag.Lookup("mgref")
+		if !ok {
+			continue
+		}
+		collection, targetName, _ := strings.Cut(tag, ",")
+		rel := relation{field: f, collection: collection}
+		if targetName != "" {
+			for i := range fields {
+				if fields[i].Name == targetName {
+					rel.target = &fields[i]
+				}
+			}
+			if rel.target == nil {
+				return nil, fmt.Errorf("mgref of %s: no field %s", f.Name, targetName)
+			}
+		}
+		relations = append(relations, rel)
+	}
+	return relations, nil
+}
+
+// ModelReferences returns references declared with `mgref` tags of T for CheckReferences,
+// from is the collection of T, referenced collections are looked up in the same database
+func ModelReferences[T any](from *mongo.Collection) ([]Reference, error) {
+	relations, err := modelRelations(reflect.TypeOf((*T)(nil)))
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]Reference, 0, len(relations))
+	for _, rel := range relations {
+		refs = append(refs, Reference{
+			From:  from,
+			Field: rel.field.BSONName,
+			To:    from.Database().Collection(rel.collection),
+		})
+	}
+	return refs, nil
+}
+
+// GetWithRefs gets an item by id and loads the documents it references into the target fields
+// declared with `mgref` tags
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) GetWithRefs(ctx context.Context, id any) (_ *T, err error) {
+	defer c.recoverPanic(ctx, "GetWithRefs", &err)
+	item, err := c.Get(c.nested(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	items := []T{*item}
+	err = c.resolveRefs(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// ListWithRefs lists items by sels filter and loads the documents they reference into the target fields
+// declared with `mgref` tags, using one batched $in query per relation
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ListWithRefs(ctx context.Context, sels map[string]any) (_ []T, err error) {
+	defer c.recoverPanic(ctx, "ListWithRefs", &err)
+	sels = c.internalSels(sels)
+	items, err := c.List(c.nested(ctx), sels)
+	if err != nil {
+		return nil, err
+	}
+	err = c.resolveRefs(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (c *genericObjectDBCtrl[T]) resolveRefs(ctx context.Context, items []T) error {
+	log.Debug("DB DEBUG: Started c.resolveRefs")
+	defer log.Debug("DB DEBUG: finished c.resolveRefs")
+
+	relations, err := modelRelations(reflect.TypeOf((*T)(nil)))
+	if err != nil {
+		return err
+	}
+	for _, rel := range relations {
+		if rel.target == nil || len(items) == 0 {
+			continue
+		}
+		err = c.resolveRelation(ctx, rel, items)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %s", rel.field.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *genericObjectDBCtrl[T]) resolveRelation(ctx context.Context, rel relation, items []T) error {
+	var ids []any
+	for i := range items {
+		ids = append(ids, refValues(fieldByIndex(reflect.ValueOf(&items[i]).Elem(), rel.field.Index, false))...)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	targetType := rel.target.Type
+	elemType := targetType
+	if elemType.Kind() == reflect.Slice {
+		elemType = elemType.Elem()
+	}
+	docType := elemType
+	if docType.Kind() == reflect.Pointer {
+		docType = docType.Elem()
+	}
+
+	cursor, err := c.db.Database().Collection(rel.collection).Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return err
+	}
+	defer closeCursor(trackCursor(cursor))
+	docs := map[string]reflect.Value{}
+	for cursor.Next(ctx) {
+		doc := reflect.New(docType)
+		err = cursor.Decode(doc.Interface())
+		if err != nil {
+			return err
+		}
+		docs[refKey(cursor.Current.Lookup("_id"))] = doc
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return err
+	}
+
+	elem := func(doc reflect.Value) reflect.Value {
+		if elemType.Kind() == reflect.Pointer {
+			return doc
+		}
+		return doc.Elem()
+	}
+	for i := range items {
+		item := reflect.ValueOf(&items[i]).Elem()
+		values := refValues(fieldByIndex(item, rel.field.Index, false))
+		target := fieldByIndex(item, rel.target.Index, len(values) > 0)
+		if !target.IsValid() {
+			continue
+		}
+		if targetType.Kind() == reflect.Slice {
+			slice := reflect.MakeSlice(targetType, 0, len(values))
+			for _, v := range values {
+				if doc, ok := docs[refKey(v)]; ok {
+					slice = reflect.Append(slice, elem(doc))
+				}
+			}
+			target.Set(slice)
+			continue
+		}
+		if len(values) > 0 {
+			if doc, ok := docs[refKey(values[0])]; ok {
+				target.Set(elem(doc))
+			}
+		}
+	}
+	return nil
+}
+
+// refValues returns the referenced ids held by an id field, which is a scalar or a slice
+func refValues(v reflect.Value) []any {
+	if !v.IsValid() {
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		values := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, v.Index(i).Interface())
+		}
+		return values
+	}
+	if v.IsZero() {
+		return nil
+	}
+	return []any{v.Interface()}
+}
+
+// refKey returns a comparable key of an id, equal for the Go value and its decoded bson value
+func refKey(id any) string {
+	if raw, ok := id.(bson.RawValue); ok {
+		var v any
+		if err := raw.Unmarshal(&v); err == nil {
+			id = v
+		}
+	}
+	_, data, err := bson.MarshalValue(id)
+	if err != nil {
+		return fmt.Sprint(id)
+	}
+	return string(data)
+}
@@ -0,0 +1,125 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// replicationLagRefresh is how often the lag used by WithSecondaryReads is refreshed
+const replicationLagRefresh = 5 * time.Second
+
+// ReplicationLag returns how far each secondary of the replica set is behind the primary, by member name.
+// It requires the clusterMonitor role (replSetGetStatus).
+// if some failed, return err
+func ReplicationLag(ctx context.Context, db *mongo.Database) (map[string]time.Duration, error) {
+	log.Debug("DB DEBUG: Started admin.RunCommand(ctx, replSetGetStatus)")
+	defer log.Debug("DB DEBUG: finished admin.RunCommand(ctx, replSetGetStatus)")
+
+	var status struct {
+		Members []struct {
+			Name       string    `bson:"name"`
+			StateStr   string    `bson:"stateStr"`
+			OptimeDate time.Time `bson:"optimeDate"`
+		} `bson:"members"`
+	}
+	err := db.Client().Database("admin").RunCommand(ctx, bson.D{{Key: "replSetGetStatus", Value: 1}}).Decode(&status)
+	if err != nil {
+		return nil, err
+	}
+
+	var primary time.Time
+	for _, m := range status.Members {
+		if m.StateStr == "PRIMARY" {
+			primary = m.OptimeDate
+		}
+	}
+	lags := map[string]time.Duration{}
+	for _, m := range status.Members {
+		if m.StateStr == "SECONDARY" && !primary.IsZero() {
+			lags[m.Name] = max(primary.Sub(m.OptimeDate), 0)
+		}
+	}
+	return lags, nil
+}
+
+// WithSecondaryReads makes Get, Find, List, ListAll, ListPage and Iterate read from secondaries
+// while the replication lag of every secondary is within maxLag, and from the primary otherwise,
+// for features that tolerate some staleness but not minutes of it.
+// The lag is refreshed in the background every 5 seconds, reads go to the primary while it is unknown.
+func WithSecondaryReads(maxLag time.Duration) Option {
+	return func(o *ctrlOptions) {
+		o.maxLag = maxLag
+	}
+}
+
+// lagMonitor caches the maximal replication lag of a deployment
+type lagMonitor struct {
+	maxLag    time.Duration
+	secondary *mongo.Collection
+
+	mu         sync.Mutex
+	lag        time.Duration
+	known      bool
+	checkedAt  time.Time
+	refreshing atomic.Bool
+}
+
+func newLagMonitor(collection *mongo.Collection, maxLag time.Duration) *lagMonitor {
+	secondary, err := collection.Clone(options.Collection().SetReadPreference(readpref.SecondaryPreferred()))
+	if err != nil {
+		return nil
+	}
+	return &lagMonitor{maxLag: maxLag, secondary: secondary}
+}
+
+// healthy reports whether the last known lag is within the threshold, refreshing a stale value in the background
+func (m *lagMonitor) healthy() bool {
+	m.mu.Lock()
+	stale := time.Since(m.checkedAt) > replicationLagRefresh
+	healthy := m.known && m.lag <= m.maxLag
+	m.mu.Unlock()
+
+	if stale && m.refreshing.CompareAndSwap(false, true) {
+		go m.refresh()
+	}
+	return healthy
+}
+
+func (m *lagMonitor) refresh() {
+	defer m.refreshing.Store(false)
+	ctx, cancel := context.WithTimeout(context.Background(), replicationLagRefresh)
+	defer cancel()
+
+	lags, err := ReplicationLag(ctx, m.secondary.Database())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkedAt = time.Now()
+	if err != nil || len(lags) == 0 {
+		m.known = false
+		return
+	}
+	m.known = true
+	m.lag = 0
+	for _, lag := range lags {
+		m.lag = max(m.lag, lag)
+	}
+	if m.lag > m.maxLag {
+		log.Warnf("DB WARN: replication lag %s exceeds %s, reading from primary", m.lag, m.maxLag)
+	}
+}
+
+// reader returns the collection reads are made with
+func (c *genericObjectDBCtrl[T]) reader() *mongo.Collection {
+	if c.lag != nil && c.lag.healthy() {
+		return c.lag.secondary
+	}
+	return c.db
+}
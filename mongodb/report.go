@@ -0,0 +1,119 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CollectionSource is anything reading a collection, e.g. a controller
+type CollectionSource interface {
+	Collection() *mongo.Collection
+}
+
+type reportQuery struct {
+	name     string
+	source   CollectionSource
+	pipeline mongo.Pipeline
+	decode   func(ctx context.Context, cursor *mongo.Cursor) (any, error)
+}
+
+// Report runs named aggregations over the collections of several controllers in one snapshot
+// session, so all of them see the data as of the same cluster time, e.g. for end of day reports
+// whose totals must add up across collections. Snapshot reads need MongoDB 5.0 on a replica set
+// or sharded cluster, and the whole report must finish within the snapshot history window
+// (minSnapshotHistoryWindowInSeconds, 5 minutes by default).
+type Report struct {
+	client  *mongo.Client
+	queries []reportQuery
+}
+
+// NewReport returns an empty report reading through client
+func NewReport(client *mongo.Client) *Report {
+	return &Report{client: client}
+}
+
+// Add adds the aggregation named name of pipeline over the collection of source, its rows are
+// returned as bson.M
+func (r *Report) Add(name string, source CollectionSource, pipeline mongo.Pipeline) *Report {
+	return AddReportQuery[bson.M](r, name, source, pipeline)
+}
+
+// AddReportQuery adds the aggregation named name of pipeline over the collection of source,
+// its rows are decoded as R
+func AddReportQuery[R any](r *Report, name string, source CollectionSource, pipeline mongo.Pipeline) *Report {
+	r.queries = append(r.queries, reportQuery{
+		name:     name,
+		source:   source,
+		pipeline: pipeline,
+		decode: func(ctx context.Context, cursor *mongo.Cursor) (any, error) {
+			rows := []R{}
+			err := cursor.All(ctx, &rows)
+			return rows, err
+		},
+	})
+	return r
+}
+
+// ReportResult holds the rows of every aggregation of a Report
+type ReportResult struct {
+	// AtClusterTime is the cluster time of the snapshot all aggregations read
+	AtClusterTime *primitive.Timestamp
+	rows          map[string]any
+}
+
+// ReportRows returns the rows of the aggregation name of result
+// if name is not in result or its rows are not of type R, return err
+func ReportRows[R any](result *ReportResult, name string) ([]R, error) {
+	rows, ok := result.rows[name]
+	if !ok {
+		return nil, fmt.Errorf("failed to get report rows: no aggregation %s", name)
+	}
+	typed, ok := rows.([]R)
+	if !ok {
+		return nil, fmt.Errorf("failed to get report rows: %s rows are %T", name, rows)
+	}
+	return typed, nil
+}
+
+// Run runs the aggregations one after another in a snapshot session
+// if names repeat, return err
+// if some failed, return err
+func (r *Report) Run(ctx context.Context) (*ReportResult, error) {
+	log.Debug("DB DEBUG: Started Report.Run")
+	defer log.Debug("DB DEBUG: finished Report.Run")
+	result := &ReportResult{rows: make(map[string]any, len(r.queries))}
+	for _, q := range r.queries {
+		if _, ok := result.rows[q.name]; ok {
+			return nil, fmt.Errorf("failed to run report: aggregation %s added twice", q.name)
+		}
+		result.rows[q.name] = nil
+	}
+
+	session, err := r.client.StartSession(options.Session().SetSnapshot(true))
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(context.Background())
+	sc := mongo.NewSessionContext(ctx, session)
+	for _, q := range r.queries {
+		cursor, err := q.source.Collection().Aggregate(sc, q.pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to run report aggregation %s: %s", q.name, err)
+		}
+		// decode may return without draining the cursor, it is closed here
+		rows, err := q.decode(sc, trackCursor(cursor))
+		closeCursor(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read report aggregation %s: %s", q.name, err)
+		}
+		result.rows[q.name] = rows
+	}
+	result.AtClusterTime = session.OperationTime()
+	return result, nil
+}
@@ -0,0 +1,252 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Query selects items for the Repository read and bulk write methods
+type Query struct {
+	// Filter is the selector (logical AND of its keys), all items when empty
+	Filter map[string]any
+	// Sort orders the items, an _id tie-breaker is appended (see NormalizeSort)
+	Sort bson.D
+	Skip int64
+	// Limit bounds the number of items, unlimited when 0
+	Limit int64
+	// Fields limits the loaded fields, all fields when empty, _id is always loaded
+	Fields []string
+}
+
+func (q Query) findOptions(profile Profile) *options.FindOptions {
+	opts := profile.findOptions()
+	if len(q.Sort) > 0 {
+		opts.SetSort(NormalizeSort(q.Sort))
+	}
+	if q.Skip > 0 {
+		opts.SetSkip(q.Skip)
+	}
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+	if len(q.Fields) > 0 {
+		projection := bson.D{}
+		for _, field := range q.Fields {
+			projection = append(projection, bson.E{Key: field, Value: 1})
+		}
+		opts.SetProjection(projection)
+	}
+	return opts
+}
+
+// NotFoundError is returned by Repository when the requested item does not exist
+// errors.Is(err, mongo.ErrNoDocuments) reports true for it
+type NotFoundError struct {
+	Collection string
+	ID         any
+}
+
+func (e *NotFoundError) Error() string {
+	if e.ID == nil {
+		return fmt.Sprintf("no item in %s matches the query", e.Collection)
+	}
+	return fmt.Sprintf("item %v not found in %s", e.ID, e.Collection)
+}
+
+func (e *NotFoundError) Unwrap() error {
+	return mongo.ErrNoDocuments
+}
+
+// Code implements Coder
+func (e *NotFoundError) Code() ErrorCode {
+	return CodeNotFound
+}
+
+// Repository is the v2 controller interface: queries are Query structs, writes return
+// result types and missing items are reported as *NotFoundError.
+// CRUDDBService stays available for existing consumers, see Legacy, so code can migrate
+// call by call.
+type Repository[T any] interface {
+	// Create item in DB and return its id
+	// if some failed, return err
+	Create(ctx context.Context, item *T) (*CreateResult, error)
+
+	// Get an item by id
+	// if not found, return *NotFoundError
+	// if some failed, return err
+	Get(ctx context.Context, id any) (*T, error)
+
+	// Find the first item selected by q
+	// if not found, return *NotFoundError
+	// if some failed, return err
+	Find(ctx context.Context, q Query) (*T, error)
+
+	// List items selected by q
+	// if some failed, return err
+	List(ctx context.Context, q Query) ([]T, error)
+
+	// Count items selected by the filter of q
+	// if some failed, return err
+	Count(ctx context.Context, q Query) (int64, error)
+
+	// Update an item identified by id
+	// if not found, return *NotFoundError
+	// if some failed, return err
+	Update(ctx context.Context, id any, item *T) (*UpdateResult, error)
+
+	// UpdateAttributes updates attributes attrs of items selected by the filter of q
+	// if some failed, return err
+	UpdateAttributes(ctx context.Context, q Query, attrs map[string]any) (*UpdateResult, error)
+
+	// Delete an item identified by id
+	// if not found, return *NotFoundError
+	// if some failed, return err
+	Delete(ctx context.Context, id any) (*DeleteResult, error)
+
+	// DeleteRange deletes items selected by the filter of q
+	// if some failed, return err
+	DeleteRange(ctx context.Context, q Query) (*DeleteResult, error)
+
+	// Legacy returns the CRUDDBService of the same controller
+	Legacy() CRUDDBService[T]
+}
+
+// NewRepository creates a Repository on dbCollection, opts are the controller options
+func NewRepository[T any](dbCollection *mongo.Collection, opts ...Option) Repository[T] {
+	return AsRepository(NewGenericObjectDBCtrl[T](dbCollection, opts...))
+}
+
+// AsRepository returns the Repository of an existing controller
+func AsRepository[T any](c *genericObjectDBCtrl[T]) Repository[T] {
+	return &repository[T]{c: c}
+}
+
+// repository adapts the controller to Repository
+type repository[T any] struct {
+	c *genericObjectDBCtrl[T]
+}
+
+func (r *repository[T]) Create(ctx context.Context, item *T) (_ *CreateResult, err error) {
+	defer r.onError(ctx, "Create", &err)
+	return r.c.CreateDetailed(r.c.nested(ctx), item)
+}
+
+func (r *repository[T]) Get(ctx context.Context, id any) (_ *T, err error) {
+	defer r.onError(ctx, "Get", &err)
+	item, err := r.c.Get(r.c.nested(ctx), id)
+	return item, r.notFound(err, id)
+}
+
+func (r *repository[T]) Find(ctx context.Context, q Query) (_ *T, err error) {
+	defer r.onError(ctx, "Find", &err)
+	q.Limit = 1
+	items, err := r.list(r.c.nested(ctx), q)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, &NotFoundError{Collection: r.c.db.Name()}
+	}
+	return &items[0], nil
+}
+
+func (r *repository[T]) List(ctx context.Context, q Query) (_ []T, err error) {
+	defer r.onError(ctx, "List", &err)
+	return r.list(r.c.nested(ctx), q)
+}
+
+func (r *repository[T]) list(ctx context.Context, q Query) (_ []T, err error) {
+	defer r.c.recoverPanic(ctx, "List", &err)
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, filter) repository")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, filter) repository")
+	c := r.c
+	ctx, cancel, profile := c.begin(ctx, opRead)
+	defer cancel()
+	q.Filter = c.internalSels(q.Filter)
+	c.warnUnindexedDynamic(ctx, q.Filter)
+	c.recordAccess(q.Filter, q.Sort)
+
+	filter := filterFromSels(q.Filter)
+	err = c.guardCost(ctx, "find", filter)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := c.reader().Find(ctx, filter, q.findOptions(profile))
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	results := []T{}
+	for cursor.Next(ctx) {
+		var item T
+		err = c.decodeItem(ctx, cursor.Current, &item)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, item)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *repository[T]) Count(ctx context.Context, q Query) (_ int64, err error) {
+	defer r.onError(ctx, "Count", &err)
+	ctx, cancel, _ := r.c.begin(ctx, opRead)
+	defer cancel()
+	return r.c.reader().CountDocuments(ctx, filterFromSels(r.c.internalSels(q.Filter)))
+}
+
+func (r *repository[T]) Update(ctx context.Context, id any, item *T) (_ *UpdateResult, err error) {
+	defer r.onError(ctx, "Update", &err)
+	result, err := r.c.UpdateDetailed(r.c.nested(ctx), id, item)
+	if err != nil {
+		return nil, err
+	}
+	// the legacy update reports an unmatched id without an error
+	if result.Matched == 0 && writeBufferFrom(ctx) == nil {
+		return nil, &NotFoundError{Collection: r.c.db.Name(), ID: id}
+	}
+	return result, nil
+}
+
+func (r *repository[T]) UpdateAttributes(ctx context.Context, q Query, attrs map[string]any) (_ *UpdateResult, err error) {
+	defer r.onError(ctx, "UpdateAttributes", &err)
+	return r.c.UpdateAttributesDetailed(r.c.nested(ctx), q.Filter, attrs)
+}
+
+func (r *repository[T]) Delete(ctx context.Context, id any) (_ *DeleteResult, err error) {
+	defer r.onError(ctx, "Delete", &err)
+	result, err := r.c.DeleteDetailed(r.c.nested(ctx), id)
+	if err != nil {
+		return nil, err
+	}
+	if result.Deleted == 0 && writeBufferFrom(ctx) == nil {
+		return nil, &NotFoundError{Collection: r.c.db.Name(), ID: id}
+	}
+	return result, nil
+}
+
+func (r *repository[T]) DeleteRange(ctx context.Context, q Query) (_ *DeleteResult, err error) {
+	defer r.onError(ctx, "DeleteRange", &err)
+	return r.c.DeleteRangeDetailed(r.c.nested(ctx), q.Filter)
+}
+
+func (r *repository[T]) Legacy() CRUDDBService[T] {
+	return r.c
+}
+
+// notFound converts mongo.ErrNoDocuments of the item id into *NotFoundError
+func (r *repository[T]) notFound(err error, id any) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &NotFoundError{Collection: r.c.db.Name(), ID: id}
+	}
+	return err
+}
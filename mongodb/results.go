@@ -0,0 +1,366 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CreateResult describes the outcome of CreateDetailed
+type CreateResult struct {
+	// ID is the _id the server stored the item under
+	ID any
+}
+
+// UpdateResult describes the outcome of UpdateDetailed and UpdateAttributesDetailed
+type UpdateResult struct {
+	// Matched is the number of items matched by the filter
+	Matched int64
+	// Modified is the number of items actually changed
+	Modified int64
+	// UpsertedID is the _id of the inserted item if the update was an upsert, nil otherwise
+	UpsertedID any
+}
+
+// DeleteResult describes the outcome of DeleteDetailed and DeleteRangeDetailed
+type DeleteResult struct {
+	// Deleted is the number of removed items
+	Deleted int64
+}
+
+// CreateDetailed creates item in DB like Create and reports the stored _id
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) CreateDetailed(ctx context.Context, item *T) (_ *CreateResult, err error) {
+	defer c.recoverPanic(ctx, "CreateDetailed", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	log.Debug("DB DEBUG: Started c.db.InsertOne(ctx, &item)")
+	defer log.Debug("DB DEBUG: finished c.db.InsertOne(ctx, &item)")
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+	doc, offloaded, err := c.prepareCreate(ctx, item, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			offloaded.rollback()
+		}
+	}()
+	if buffer := writeBufferFrom(ctx); buffer != nil {
+		data, id, err := c.ensureID(doc)
+		if err != nil {
+			return nil, err
+		}
+		buffer.add(c.db, mongo.NewInsertOneModel().SetDocument(data))
+		return &CreateResult{ID: id}, nil
+	}
+
+	result, err := c.db.InsertOne(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreateResult{ID: result.InsertedID}, nil
+}
+
+// prepareCreate applies defaults, validation, the schema version and timestamps to item and returns
+// the document to insert, with foreign keys and size checked and fields offloaded, compressed
+// and fenced. The caller rolls the offloaded files back if the document is not inserted.
+func (c *genericObjectDBCtrl[T]) prepareCreate(ctx context.Context, item *T, now time.Time) (_ bson.Raw, _ *offloadWrite, err error) {
+	err = applyDefaults(item)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = validateItem(item)
+	if err != nil {
+		return nil, nil, err
+	}
+	setSchemaVersion(item)
+	setTimestamp(item, "CreatedAt", now)
+	setTimestamp(item, "UpdatedAt", now)
+
+	data, err := c.marshal(item)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = c.checkForeignKeys(ctx, data); err != nil {
+		return nil, nil, err
+	}
+	data, offloaded, err := c.offloadDoc(ctx, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		if err != nil {
+			offloaded.rollback()
+		}
+	}()
+	data, err = c.compressDoc(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err = c.stampFenceDoc(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = c.checkDocumentSize(data); err != nil {
+		return nil, nil, err
+	}
+	return data, offloaded, nil
+}
+
+// UpdateDetailed updates an item identified by id like Update and reports matched and modified counts,
+// Matched is 0 when no item has id
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) UpdateDetailed(ctx context.Context, id any, item *T) (_ *UpdateResult, err error) {
+	defer c.recoverPanic(ctx, "UpdateDetailed", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	id = c.internalID(id)
+	log.Debug("DB DEBUG: Started c.db.UpdateOne")
+	defer log.Debug("DB DEBUG: finished c.db.UpdateOne")
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+	err = validateItem(item)
+	if err != nil {
+		return nil, err
+	}
+	filter, guarded, applyGuard := c.concurrencyGuard(item, bson.D{bson.E{Key: "_id", Value: id}})
+	filter = c.writeFilter(ctx, filter)
+	setTimestamp(item, "UpdatedAt", time.Now())
+	dataByte, err := c.marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	err = c.checkForeignKeys(ctx, dataByte)
+	if err != nil {
+		return nil, err
+	}
+
+	var update bson.M
+	err = bson.Unmarshal(dataByte, &update)
+	if err != nil {
+		return nil, err
+	}
+	offloaded, err := c.offloadUpdate(ctx, id, update)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			offloaded.rollback()
+		}
+	}()
+	err = c.compressUpdate(update)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.offload || c.opts.compress {
+		dataByte, err = c.marshal(update)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = c.checkDocumentSize(dataByte)
+	if err != nil {
+		return nil, err
+	}
+	stripImmutable[T](update)
+	for k, v := range guarded {
+		update[k] = v
+	}
+	c.stampFence(update)
+	// guarded updates are not buffered, their conflicts must reach the caller and the version of
+	// item may only change once the update is applied
+	if buffer := writeBufferFrom(ctx); buffer != nil && c.opts.concurrency == ConcurrencyNone && !c.opts.checkOutLocks {
+		buffer.add(c.db, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.D{{Key: "$set", Value: update}}))
+		return &UpdateResult{}, nil
+	}
+
+	result, err := c.db.UpdateOne(
+		ctx,
+		filter,
+		bson.D{
+			bson.E{Key: "$set", Value: update},
+		},
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	c.lintWrite(ctx, "Update", filter, result.MatchedCount, result.ModifiedCount)
+	if result.MatchedCount == 0 {
+		offloaded.rollback()
+		if err = c.writeConflict(ctx, id); err != nil {
+			return nil, err
+		}
+		if err = c.resolveUnmatched(ctx, id); err != nil {
+			return nil, err
+		}
+		return &UpdateResult{}, nil
+	}
+	offloaded.commit(ctx, c.db.Name())
+	applyGuard()
+	return &UpdateResult{
+		Matched:    result.MatchedCount,
+		Modified:   result.ModifiedCount,
+		UpsertedID: result.UpsertedID,
+	}, nil
+}
+
+// UpdateAttributesDetailed updates attributes like UpdateAttributes and reports matched and modified counts
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) UpdateAttributesDetailed(ctx context.Context, sels map[string]any, attrs map[string]any) (_ *UpdateResult, err error) {
+	defer c.recoverPanic(ctx, "UpdateAttributesDetailed", &err)
+	return c.updateAttributes(ctx, sels, attrs, nil)
+}
+
+// updateAttributes sets attrs and removes the unset paths of the items selected by sels
+func (c *genericObjectDBCtrl[T]) updateAttributes(ctx context.Context, sels map[string]any, attrs map[string]any, unset []string) (_ *UpdateResult, err error) {
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.UpdateMany")
+	defer log.Debug("DB DEBUG: finished c.db.UpdateMany")
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+	err = validateAttrs[T](attrs)
+	if err != nil {
+		return nil, err
+	}
+	err = checkImmutable[T](attrs)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range unset {
+		if err = checkImmutablePath[T](path); err != nil {
+			return nil, err
+		}
+	}
+	err = c.checkForeignKeyAttrs(ctx, attrs)
+	if err != nil {
+		return nil, err
+	}
+	filter := c.writeFilter(ctx, filterFromSels(sels))
+
+	var update bson.M
+	attrs[updatedAtKey[T]()] = time.Now()
+	dataByte, err := c.marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+	err = bson.Unmarshal(dataByte, &update)
+	if err != nil {
+		return nil, err
+	}
+	c.stampFence(update)
+
+	modifier := bson.D{
+		bson.E{Key: "$set", Value: update},
+	}
+	if len(unset) > 0 {
+		paths := bson.M{}
+		for _, path := range unset {
+			paths[path] = ""
+		}
+		modifier = append(modifier, bson.E{Key: "$unset", Value: paths})
+	}
+	if c.opts.concurrency == ConcurrencyVersion {
+		modifier = append(modifier, bson.E{Key: "$inc", Value: bson.M{versionKey[T](): 1}})
+	}
+	result, err := c.db.UpdateMany(
+		ctx,
+		filter,
+		modifier,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := sels["_id"]; ok && result.MatchedCount == 0 && !isOperatorValue(id) {
+		if err = c.writeConflict(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	c.lintWrite(ctx, "UpdateAttributes", filter, result.MatchedCount, result.ModifiedCount)
+	return &UpdateResult{
+		Matched:    result.MatchedCount,
+		Modified:   result.ModifiedCount,
+		UpsertedID: result.UpsertedID,
+	}, nil
+}
+
+// DeleteDetailed deletes item identified by id like Delete and reports the number of removed items
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) DeleteDetailed(ctx context.Context, id any) (_ *DeleteResult, err error) {
+	defer c.recoverPanic(ctx, "DeleteDetailed", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	id = c.internalID(id)
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+	filter := c.writeFilter(ctx, bson.D{
+		bson.E{Key: "_id", Value: id},
+	})
+	err = c.checkRestrictedDelete(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	// offloaded files are removed after the delete, which a buffered delete can't do
+	if buffer := writeBufferFrom(ctx); buffer != nil && !c.opts.offload {
+		buffer.add(c.db, mongo.NewDeleteOneModel().SetFilter(filter))
+		return &DeleteResult{}, nil
+	}
+	result, err := c.db.DeleteOne(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if result.DeletedCount == 0 {
+		if err = c.writeConflict(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	c.lintWrite(ctx, "Delete", filter, result.DeletedCount, 0)
+	if result.DeletedCount > 0 {
+		err = c.removeOffloaded(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &DeleteResult{Deleted: result.DeletedCount}, nil
+}
+
+// DeleteRangeDetailed deletes items identified by sels like DeleteRange and reports the number of removed items
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) DeleteRangeDetailed(ctx context.Context, sels map[string]any) (_ *DeleteResult, err error) {
+	defer c.recoverPanic(ctx, "DeleteRangeDetailed", &err)
+	if err = c.guardWrite(ctx); err != nil {
+		return nil, err
+	}
+	sels = c.internalSels(sels)
+	ctx, cancel, _ := c.begin(ctx, opWrite)
+	defer cancel()
+	filter := c.writeFilter(ctx, filterFromSels(sels))
+	err = c.guardCost(ctx, "delete", filter)
+	if err != nil {
+		return nil, err
+	}
+	err = c.checkRestrictedDelete(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	result, err := c.db.DeleteMany(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	c.lintWrite(ctx, "DeleteRange", filter, result.DeletedCount, 0)
+	return &DeleteResult{Deleted: result.DeletedCount}, nil
+}
@@ -0,0 +1,165 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RollupOp is the aggregation of a rollup metric
+type RollupOp string
+
+const (
+	RollupSum   RollupOp = "sum"
+	RollupAvg   RollupOp = "avg"
+	RollupMin   RollupOp = "min"
+	RollupMax   RollupOp = "max"
+	RollupCount RollupOp = "count"
+)
+
+// RollupMetric computes Name of a summary document as Op over Field of the raw documents
+type RollupMetric struct {
+	Name  string
+	Op    RollupOp
+	Field string
+}
+
+// Rollup aggregates raw measurement documents into summary documents per Period
+// (e.g. an hour or a day) and GroupBy fields. Completed periods are merged into Target,
+// the last rolled up period is checkpointed under Name, so runs resume where they stopped
+// and can be scheduled with Schedules (see Handler). Summary documents have the _id
+// {start, <group fields>}, a start field, the group fields and the metrics.
+type Rollup struct {
+	Name      string
+	Source    *mongo.Collection
+	Target    *mongo.Collection
+	TimeField string
+	Period    time.Duration
+	GroupBy   []string
+	Metrics   []RollupMetric
+	// Delay is waited after a period ends before it is rolled up, for late measurements
+	Delay time.Duration
+}
+
+type rollupProgress struct {
+	Next time.Time `bson:"next"`
+}
+
+// Run rolls up all completed periods since the checkpoint and returns the number of periods rolled up
+// if some failed, return err
+func (r *Rollup) Run(ctx context.Context) (int, error) {
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, pipeline) rollup")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, pipeline) rollup")
+	if r.Period <= 0 {
+		return 0, fmt.Errorf("failed to run rollup %s: period must be positive", r.Name)
+	}
+	if err := requireCompat(r.Source.Database(), r.Source.Name(), FeatureMerge); err != nil {
+		return 0, err
+	}
+
+	checkpoints := NewCheckpointer(r.Source.Database())
+	job := "rollup:" + r.Name
+	var progress rollupProgress
+	found, err := checkpoints.Load(ctx, job, &progress)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		progress.Next, err = r.firstPeriod(ctx)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return 0, nil
+			}
+			return 0, err
+		}
+	}
+
+	until := time.Now().Add(-r.Delay).UTC().Truncate(r.Period)
+	done := 0
+	for start := progress.Next; start.Before(until); start = start.Add(r.Period) {
+		err = r.rollupPeriod(ctx, start)
+		if err != nil {
+			return done, err
+		}
+		err = checkpoints.Save(ctx, job, rollupProgress{Next: start.Add(r.Period)})
+		if err != nil {
+			return done, err
+		}
+		done++
+	}
+	return done, nil
+}
+
+// Handler returns a ScheduleHandler running the rollup, to register it with Schedules
+func (r *Rollup) Handler() ScheduleHandler {
+	return func(ctx context.Context, _ time.Time) error {
+		_, err := r.Run(ctx)
+		return err
+	}
+}
+
+// firstPeriod returns the period of the oldest raw document
+func (r *Rollup) firstPeriod(ctx context.Context) (time.Time, error) {
+	var doc bson.Raw
+	err := r.Source.FindOne(
+		ctx,
+		bson.M{r.TimeField: bson.M{"$exists": true}},
+		options.FindOne().SetSort(bson.D{{Key: r.TimeField, Value: 1}}).SetProjection(bson.M{r.TimeField: 1}),
+	).Decode(&doc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	at, ok := doc.Lookup(r.TimeField).TimeOK()
+	if !ok {
+		return time.Time{}, fmt.Errorf("failed to run rollup %s: %s is not a date", r.Name, r.TimeField)
+	}
+	return at.UTC().Truncate(r.Period), nil
+}
+
+// rollupPeriod merges the summaries of [start, start+Period) into Target, rerunning a period replaces its summaries
+func (r *Rollup) rollupPeriod(ctx context.Context, start time.Time) error {
+	key := bson.D{{Key: "start", Value: start}}
+	for _, field := range r.GroupBy {
+		key = append(key, bson.E{Key: field, Value: "$" + field})
+	}
+	group := bson.D{{Key: "_id", Value: key}}
+	for _, m := range r.Metrics {
+		var acc bson.D
+		switch m.Op {
+		case RollupCount:
+			acc = bson.D{{Key: "$sum", Value: 1}}
+		case RollupSum, RollupAvg, RollupMin, RollupMax:
+			acc = bson.D{{Key: "$" + string(m.Op), Value: "$" + m.Field}}
+		default:
+			return fmt.Errorf("failed to run rollup %s: unsupported op %s", r.Name, m.Op)
+		}
+		group = append(group, bson.E{Key: m.Name, Value: acc})
+	}
+	set := bson.D{{Key: "start", Value: "$_id.start"}}
+	for _, field := range r.GroupBy {
+		set = append(set, bson.E{Key: field, Value: "$_id." + field})
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{r.TimeField: bson.M{"$gte": start, "$lt": start.Add(r.Period)}}}},
+		{{Key: "$group", Value: group}},
+		{{Key: "$set", Value: set}},
+		{{Key: "$merge", Value: bson.D{
+			{Key: "into", Value: bson.D{{Key: "db", Value: r.Target.Database().Name()}, {Key: "coll", Value: r.Target.Name()}}},
+			{Key: "on", Value: "_id"},
+			{Key: "whenMatched", Value: "replace"},
+			{Key: "whenNotMatched", Value: "insert"},
+		}}},
+	}
+	cursor, err := r.Source.Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	return cursor.Close(ctx)
+}
@@ -0,0 +1,185 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority is the scheduling class of a controller call, see Scheduler
+type Priority int
+
+const (
+	// PriorityInteractive calls serve users and are never throttled
+	PriorityInteractive Priority = iota
+	// PriorityBatch calls are background work throttled while interactive latency degrades
+	PriorityBatch
+)
+
+// schedulerAdjustInterval is the minimum time between changes of the batch concurrency limit
+const schedulerAdjustInterval = time.Second
+
+type priorityKey struct{}
+
+// WithPriority returns a context whose controller calls are scheduled with priority p
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority of calls with ctx: the one of WithPriority, otherwise
+// PriorityBatch for the ProfileBatch profile (see WithProfile) and PriorityInteractive else
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	if name, ok := ProfileName(ctx); ok && name == ProfileBatch {
+		return PriorityBatch
+	}
+	return PriorityInteractive
+}
+
+// Scheduler protects interactive calls from background jobs sharing the connection pool.
+// It tracks the moving average latency of interactive calls and bounds the number of concurrent
+// batch calls, halving the bound while the average exceeds the target and raising it by one
+// while it does not, down to 1 and up to maxBatch. Share one Scheduler among the controllers
+// of a client, see WithScheduler.
+type Scheduler struct {
+	target   time.Duration
+	maxBatch int
+
+	mu         sync.Mutex
+	latency    time.Duration
+	limit      int
+	running    int
+	waiters    []chan struct{}
+	lastAdjust time.Time
+}
+
+// SchedulerStats is a snapshot of a Scheduler
+type SchedulerStats struct {
+	// InteractiveLatency is the moving average latency of interactive calls
+	InteractiveLatency time.Duration
+	BatchLimit         int
+	BatchRunning       int
+	BatchWaiting       int
+}
+
+// NewScheduler creates a Scheduler keeping interactive latency under target with at most
+// maxBatch concurrent batch calls
+func NewScheduler(target time.Duration, maxBatch int) *Scheduler {
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	return &Scheduler{target: target, maxBatch: maxBatch, limit: maxBatch}
+}
+
+// WithScheduler schedules the calls of the controller by their priority (see PriorityFromContext)
+// with s: batch calls wait for a slot, interactive calls report their latency
+func WithScheduler(s *Scheduler) Option {
+	return func(o *ctrlOptions) {
+		o.scheduler = s
+	}
+}
+
+// Stats returns a snapshot of the scheduler state
+func (s *Scheduler) Stats() SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return SchedulerStats{
+		InteractiveLatency: s.latency,
+		BatchLimit:         s.limit,
+		BatchRunning:       s.running,
+		BatchWaiting:       len(s.waiters),
+	}
+}
+
+// begin schedules a call with ctx, the returned cancel must be called when the call ends.
+// A batch call whose ctx ends while waiting returns the done ctx.
+func (s *Scheduler) begin(ctx context.Context, cancel context.CancelFunc) (context.Context, context.CancelFunc) {
+	if PriorityFromContext(ctx) == PriorityInteractive {
+		start := time.Now()
+		return ctx, func() {
+			s.observe(time.Since(start))
+			cancel()
+		}
+	}
+	if err := s.acquire(ctx); err != nil {
+		return ctx, cancel
+	}
+	return ctx, func() {
+		s.release()
+		cancel()
+	}
+}
+
+// acquire waits for a batch slot
+func (s *Scheduler) acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.running < s.limit {
+		s.running++
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for i, w := range s.waiters {
+			if w == ready {
+				s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+				return ctx.Err()
+			}
+		}
+		// the slot was granted while ctx ended
+		s.running--
+		s.dispatch()
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.dispatch()
+}
+
+// dispatch hands free slots to waiting batch calls in arrival order, s.mu must be held
+func (s *Scheduler) dispatch() {
+	for s.running < s.limit && len(s.waiters) > 0 {
+		s.running++
+		close(s.waiters[0])
+		s.waiters = s.waiters[1:]
+	}
+}
+
+// observe records the latency of an interactive call and adjusts the batch limit
+func (s *Scheduler) observe(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.latency == 0 {
+		s.latency = d
+	} else {
+		s.latency = (4*s.latency + d) / 5
+	}
+	now := time.Now()
+	if now.Sub(s.lastAdjust) < schedulerAdjustInterval {
+		return
+	}
+	switch {
+	case s.latency > s.target && s.limit > 1:
+		s.limit /= 2
+	case s.latency <= s.target && s.limit < s.maxBatch:
+		s.limit++
+	default:
+		return
+	}
+	s.lastAdjust = now
+	s.dispatch()
+}
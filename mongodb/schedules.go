@@ -0,0 +1,230 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// scheduleCollection stores cron definitions and their next run times
+const scheduleCollection = "_schedules"
+
+// defaultScheduleLease is how long a claimed run is owned before other replicas may take it over
+const defaultScheduleLease = 5 * time.Minute
+
+// ScheduleHandler runs a due schedule, scheduled is the planned run time
+type ScheduleHandler func(ctx context.Context, scheduled time.Time) error
+
+// ScheduleState is the persisted state of a schedule
+type ScheduleState struct {
+	Name        string    `bson:"_id" json:"name"`
+	Cron        string    `bson:"cron" json:"cron"`
+	NextRun     time.Time `bson:"next_run" json:"next_run"`
+	LockedUntil time.Time `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	Owner       string    `bson:"owner,omitempty" json:"owner,omitempty"`
+	LastRun     time.Time `bson:"last_run,omitempty" json:"last_run,omitempty"`
+	LastError   string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+}
+
+// Schedules runs cron schedules across replicas: definitions and next run times are stored
+// in the database and every due run is claimed atomically by exactly one replica
+type Schedules struct {
+	db    *mongo.Collection
+	owner string
+	// Lease bounds how long a run may take before another replica reruns it, 5 minutes by default
+	Lease time.Duration
+	// Location is the time zone cron expressions are evaluated in, UTC by default
+	Location *time.Location
+
+	mu        sync.Mutex
+	schedules map[string]*registeredSchedule
+}
+
+type registeredSchedule struct {
+	cron    *CronSchedule
+	handler ScheduleHandler
+}
+
+// NewSchedules creates Schedules storing state in the database schedules collection,
+// owner identifies this replica in claims (e.g. the host name)
+func NewSchedules(db *mongo.Database, owner string) *Schedules {
+	return &Schedules{
+		db:        db.Collection(scheduleCollection),
+		owner:     owner,
+		Lease:     defaultScheduleLease,
+		Location:  time.UTC,
+		schedules: map[string]*registeredSchedule{},
+	}
+}
+
+// Register stores the cron definition of name and registers handler for its runs.
+// The next run time is kept unless the cron expression changed.
+// if some failed, return err
+func (s *Schedules) Register(ctx context.Context, name string, expr string, handler ScheduleHandler) error {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return err
+	}
+	next := cron.Next(time.Now().In(s.Location))
+	if next.IsZero() {
+		return fmt.Errorf("failed to register schedule %s: %q never runs", name, expr)
+	}
+
+	// matches a missing or changed definition only, a kept one fails the upsert with a duplicate key
+	_, err = s.db.UpdateOne(
+		ctx,
+		bson.M{"_id": name, "cron": bson.M{"$ne": expr}},
+		bson.M{"$set": bson.M{"cron": expr, "next_run": next}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	s.mu.Lock()
+	s.schedules[name] = &registeredSchedule{cron: cron, handler: handler}
+	s.mu.Unlock()
+	return nil
+}
+
+// Remove unregisters name and deletes its state
+// if some failed, return err
+func (s *Schedules) Remove(ctx context.Context, name string) error {
+	s.mu.Lock()
+	delete(s.schedules, name)
+	s.mu.Unlock()
+	_, err := s.db.DeleteOne(ctx, bson.M{"_id": name})
+	return err
+}
+
+// List returns the state of all stored schedules
+// if some failed, return err
+func (s *Schedules) List(ctx context.Context) ([]ScheduleState, error) {
+	cursor, err := s.db.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "next_run", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	states := []ScheduleState{}
+	err = cursor.All(ctx, &states)
+	if err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// Run claims and runs due schedules every pollInterval until ctx is done
+// if ctx is done, return ctx.Err()
+func (s *Schedules) Run(ctx context.Context, pollInterval time.Duration) error {
+	for {
+		err := s.RunDue(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Errorf("DB ERROR: failed to run schedules: %s", err)
+		}
+		err = sleepCtx(ctx, pollInterval)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// RunDue claims and runs the schedules registered by this replica that are due now,
+// handler errors are recorded in the schedule state
+// if some failed, return err
+func (s *Schedules) RunDue(ctx context.Context) error {
+	for {
+		state, err := s.claim(ctx)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return nil
+			}
+			return err
+		}
+		err = s.run(ctx, state)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Schedules) claim(ctx context.Context) (*ScheduleState, error) {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.schedules))
+	for name := range s.schedules {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	if len(names) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	now := time.Now()
+	var state ScheduleState
+	err := s.db.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"_id":      bson.M{"$in": names},
+			"next_run": bson.M{"$lte": now},
+			"$or": bson.A{
+				bson.M{"locked_until": bson.M{"$exists": false}},
+				bson.M{"locked_until": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{"$set": bson.M{"locked_until": now.Add(s.Lease), "owner": s.owner}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_run", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&state)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *Schedules) run(ctx context.Context, state *ScheduleState) error {
+	s.mu.Lock()
+	registered, ok := s.schedules[state.Name]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, s.Lease)
+	err := runSchedule(runCtx, registered.handler, state.NextRun)
+	cancel()
+	lastError := ""
+	if err != nil {
+		log.Errorf("DB ERROR: schedule %s failed: %s", state.Name, err)
+		lastError = err.Error()
+	}
+
+	now := time.Now()
+	_, err = s.db.UpdateOne(
+		ctx,
+		bson.M{"_id": state.Name, "owner": s.owner},
+		bson.M{
+			"$set": bson.M{
+				"next_run":   registered.cron.Next(now.In(s.Location)),
+				"last_run":   now,
+				"last_error": lastError,
+			},
+			"$unset": bson.M{"locked_until": "", "owner": ""},
+		},
+	)
+	return err
+}
+
+// runSchedule runs handler converting a panic into an error, so one schedule does not stop the others
+func runSchedule(ctx context.Context, handler ScheduleHandler, scheduled time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, scheduled)
+}
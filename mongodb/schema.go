@@ -0,0 +1,147 @@
+package mongodb
+
+import (
+	"context"
+	"sort"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxTrackedValues caps the distinct values tracked per field for cardinality estimates
+const maxTrackedValues = 1000
+
+// SchemaReport describes the fields found in a sample of documents
+type SchemaReport struct {
+	Sampled int
+	Fields  []FieldStats
+}
+
+// FieldStats describes one dotted field path of the sampled documents
+type FieldStats struct {
+	Path string
+	// Types counts occurrences per bson type name
+	Types map[string]int
+	// PresentRate is the share of sampled documents containing the field
+	PresentRate float64
+	// NullRate is the share of sampled documents where the field is null
+	NullRate float64
+	// Cardinality is the number of distinct scalar values seen, capped at 1000
+	Cardinality int
+	// CardinalityCapped reports that more distinct values exist than were tracked
+	CardinalityCapped bool
+}
+
+type fieldAccumulator struct {
+	types   map[string]int
+	present int
+	nulls   int
+	values  map[string]struct{}
+	capped  bool
+}
+
+// InspectSchema samples sampleSize random documents and reports field names, bson types,
+// null rates and cardinality estimates, to audit drift between Go structs and stored data.
+// Arrays of documents are traversed with the same dotted paths as queries use.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) InspectSchema(ctx context.Context, sampleSize int) (_ *SchemaReport, err error) {
+	defer c.recoverPanic(ctx, "InspectSchema", &err)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $sample)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $sample)")
+
+	cursor, err := c.db.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sample", Value: bson.M{"size": sampleSize}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	report := &SchemaReport{}
+	fields := map[string]*fieldAccumulator{}
+	for cursor.Next(ctx) {
+		report.Sampled++
+		seen := map[string]bool{}
+		err = inspectDocument(cursor.Current, "", fields, seen)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+
+	for path, acc := range fields {
+		stats := FieldStats{
+			Path:              path,
+			Types:             acc.types,
+			Cardinality:       len(acc.values),
+			CardinalityCapped: acc.capped,
+		}
+		if report.Sampled > 0 {
+			stats.PresentRate = float64(acc.present) / float64(report.Sampled)
+			stats.NullRate = float64(acc.nulls) / float64(report.Sampled)
+		}
+		report.Fields = append(report.Fields, stats)
+	}
+	sort.Slice(report.Fields, func(i, j int) bool { return report.Fields[i].Path < report.Fields[j].Path })
+
+	return report, nil
+}
+
+// inspectDocument accumulates stats of every element of doc, seen counts a path once per sampled document
+func inspectDocument(doc bson.Raw, prefix string, fields map[string]*fieldAccumulator, seen map[string]bool) error {
+	elems, err := doc.Elements()
+	if err != nil {
+		return err
+	}
+	for _, elem := range elems {
+		err = inspectValue(prefix+elem.Key(), elem.Value(), fields, seen)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func inspectValue(path string, value bson.RawValue, fields map[string]*fieldAccumulator, seen map[string]bool) error {
+	acc, ok := fields[path]
+	if !ok {
+		acc = &fieldAccumulator{types: map[string]int{}, values: map[string]struct{}{}}
+		fields[path] = acc
+	}
+	acc.types[value.Type.String()]++
+	if !seen[path] {
+		seen[path] = true
+		acc.present++
+		if value.Type == bsontype.Null {
+			acc.nulls++
+		}
+	}
+
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		return inspectDocument(value.Document(), path+".", fields, seen)
+	case bsontype.Array:
+		values, err := value.Array().Values()
+		if err != nil {
+			return err
+		}
+		for _, v := range values {
+			if v.Type == bsontype.EmbeddedDocument {
+				if err = inspectDocument(v.Document(), path+".", fields, seen); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		if len(acc.values) < maxTrackedValues {
+			acc.values[value.String()] = struct{}{}
+		} else if _, ok := acc.values[value.String()]; !ok {
+			acc.capped = true
+		}
+	}
+	return nil
+}
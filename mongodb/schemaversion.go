@@ -0,0 +1,160 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Upgrade migrates a stored document of a model one schema version up, in place
+type Upgrade func(doc bson.M) error
+
+// upgradeChain holds the registered upgrades of a model by the version they upgrade from
+type upgradeChain struct {
+	upgrades map[int]Upgrade
+	current  int
+}
+
+var (
+	upgradesMu sync.RWMutex
+	upgrades   = map[reflect.Type]*upgradeChain{}
+)
+
+// RegisterUpgrade registers fn migrating documents of T from schema version from to from+1.
+// Documents read with a schema_version older than the current one (the highest from + 1,
+// missing means 0) are migrated by the chain of upgrades before they are decoded into T.
+// T should have an int field stored as "schema_version", it is set to the current version on Create.
+func RegisterUpgrade[T any](from int, fn Upgrade) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	upgradesMu.Lock()
+	defer upgradesMu.Unlock()
+	chain := upgrades[t]
+	if chain == nil {
+		chain = &upgradeChain{upgrades: map[int]Upgrade{}}
+		upgrades[t] = chain
+	}
+	chain.upgrades[from] = fn
+	chain.current = max(chain.current, from+1)
+}
+
+// CurrentSchemaVersion returns the schema version of T after all registered upgrades, 0 without upgrades
+func CurrentSchemaVersion[T any]() int {
+	chain := upgradesOf[T]()
+	if chain == nil {
+		return 0
+	}
+	return chain.current
+}
+
+func upgradesOf[T any]() *upgradeChain {
+	upgradesMu.RLock()
+	defer upgradesMu.RUnlock()
+	return upgrades[reflect.TypeOf((*T)(nil)).Elem()]
+}
+
+// WithLazyWriteBack makes the controller store documents migrated on read back in the background,
+// so every old document is upgraded once instead of on every read. Write-backs are rate limited
+// by WithWriteBackRate and stopped by Close of the controller.
+func WithLazyWriteBack() Option {
+	return func(o *ctrlOptions) {
+		o.writeBack = true
+	}
+}
+
+// decodeItem decodes raw into item hydrating offloaded and compressed fields and migrating it
+// to the current schema version first
+func (c *genericObjectDBCtrl[T]) decodeItem(ctx context.Context, raw bson.Raw, item *T) error {
+	raw, err := c.hydrate(ctx, raw)
+	if err != nil {
+		return err
+	}
+	raw, err = c.decompress(raw)
+	if err != nil {
+		return err
+	}
+	chain := upgradesOf[T]()
+	if chain == nil {
+		return c.unmarshal(raw, item)
+	}
+	version := 0
+	if value, err := raw.LookupErr("schema_version"); err == nil {
+		if v, ok := value.AsInt64OK(); ok {
+			version = int(v)
+		}
+	}
+	if version >= chain.current {
+		return c.unmarshal(raw, item)
+	}
+
+	var doc bson.M
+	err = c.unmarshal(raw, &doc)
+	if err != nil {
+		return err
+	}
+	for v := version; v < chain.current; v++ {
+		upgrade, ok := chain.upgrades[v]
+		if !ok {
+			return fmt.Errorf("failed to migrate %s: no upgrade from schema version %d", c.db.Name(), v)
+		}
+		if err = upgrade(doc); err != nil {
+			return fmt.Errorf("failed to migrate %s from schema version %d: %s", c.db.Name(), v, err)
+		}
+	}
+	doc["schema_version"] = chain.current
+	data, err := c.marshal(doc)
+	if err != nil {
+		return err
+	}
+	err = c.unmarshal(data, item)
+	if err != nil {
+		return err
+	}
+
+	if c.opts.writeBack {
+		c.writeBack(raw, doc, version)
+	}
+	return nil
+}
+
+// writeBack queues the migrated document to be stored unless it changed meanwhile: the filter
+// matches the schema version, UpdatedAt, Version and lease of the document as read from raw,
+// so an update or CheckOut made after the read is not overwritten
+func (c *genericObjectDBCtrl[T]) writeBack(raw bson.Raw, doc bson.M, version int) {
+	filter := bson.D{{Key: "_id", Value: doc["_id"]}}
+	if version == 0 {
+		filter = append(filter, bson.E{Key: "schema_version", Value: bson.M{"$exists": false}})
+	} else {
+		filter = append(filter, bson.E{Key: "schema_version", Value: version})
+	}
+	for _, key := range []string{updatedAtKey[T](), versionKey[T](), checkoutKey} {
+		if value, err := raw.LookupErr(strings.Split(key, ".")...); err == nil {
+			filter = append(filter, bson.E{Key: key, Value: value})
+		} else {
+			filter = append(filter, bson.E{Key: key, Value: bson.M{"$exists": false}})
+		}
+	}
+	c.writeBacks.enqueue(c.db, filter, doc)
+}
+
+// setSchemaVersion stores the current schema version into the schema_version field of item
+func setSchemaVersion[T any](item *T) {
+	chain := upgradesOf[T]()
+	if chain == nil {
+		return
+	}
+	v := reflect.ValueOf(item).Elem()
+	for _, f := range modelFields(v.Type()) {
+		if f.BSONName != "schema_version" {
+			continue
+		}
+		field := fieldByIndex(v, f.Index, true)
+		if field.IsValid() && field.CanSet() && field.CanInt() {
+			field.SetInt(int64(chain.current))
+		}
+		return
+	}
+}
@@ -0,0 +1,148 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SearchResult is a matched item with the metadata explaining why it matched
+type SearchResult[T any] struct {
+	ID         any
+	Item       T
+	Score      float64
+	Highlights []Highlight
+}
+
+// Highlight is a snippet of a matched field returned by Atlas Search
+type Highlight struct {
+	Path  string          `bson:"path"`
+	Texts []HighlightText `bson:"texts"`
+	Score float64         `bson:"score"`
+}
+
+// HighlightText is a part of a Highlight, Type is "hit" for matched terms and "text" for context
+type HighlightText struct {
+	Value string `bson:"value"`
+	Type  string `bson:"type"`
+}
+
+// TextSearch finds items matching query by the collection text index, filtered by sels and
+// ordered by relevance. limit <= 0 means no limit.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) TextSearch(ctx context.Context, query string, sels map[string]any, limit int64) (_ []SearchResult[T], err error) {
+	defer c.recoverPanic(ctx, "TextSearch", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Find(ctx, $text)")
+	defer log.Debug("DB DEBUG: finished c.db.Find(ctx, $text)")
+	err = c.requireFeature(FeatureTextSearch)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := append(bson.D{bson.E{Key: "$text", Value: bson.M{"$search": query}}}, filterFromSels(sels)...)
+	score := bson.M{"_score": bson.M{"$meta": "textScore"}}
+	opts := options.Find().SetProjection(score).SetSort(score)
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := c.db.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.decodeSearchResults(ctx, trackCursor(cursor))
+}
+
+// AtlasSearch finds items matching query in paths with the Atlas Search index, filtered by sels,
+// with scores and highlight snippets. limit <= 0 means no limit.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) AtlasSearch(ctx context.Context, index string, query string, paths []string, sels map[string]any, limit int64) (_ []SearchResult[T], err error) {
+	defer c.recoverPanic(ctx, "AtlasSearch", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $search)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $search)")
+	err = c.requireFeature(FeatureAtlasSearch)
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$search", Value: bson.M{
+			"index":     index,
+			"text":      bson.M{"query": query, "path": paths},
+			"highlight": bson.M{"path": paths},
+		}}},
+	}
+	if len(sels) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filterFromSels(sels)}})
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.M{
+		"_score":      bson.M{"$meta": "searchScore"},
+		"_highlights": bson.M{"$meta": "searchHighlights"},
+	}}})
+
+	cursor, err := c.db.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return c.decodeSearchResults(ctx, trackCursor(cursor))
+}
+
+// decodeSearchResults decodes documents carrying _score and _highlights metadata fields,
+// items are decoded like those of the other reads (see decodeItem)
+func (c *genericObjectDBCtrl[T]) decodeSearchResults(ctx context.Context, cursor *mongo.Cursor) ([]SearchResult[T], error) {
+	// tracked by the callers where the cursor is created
+	defer closeCursor(cursor)
+
+	results := []SearchResult[T]{}
+	for cursor.Next(ctx) {
+		var result SearchResult[T]
+		// the metadata must not reach a write-back of a migrated item
+		doc, err := withoutSearchMeta(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		err = c.decodeItem(ctx, doc, &result.Item)
+		if err != nil {
+			return nil, err
+		}
+		var meta struct {
+			ID         any         `bson:"_id"`
+			Score      float64     `bson:"_score"`
+			Highlights []Highlight `bson:"_highlights"`
+		}
+		err = cursor.Decode(&meta)
+		if err != nil {
+			return nil, err
+		}
+		result.ID, result.Score, result.Highlights = meta.ID, meta.Score, meta.Highlights
+
+		results = append(results, result)
+	}
+	if err := cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// withoutSearchMeta returns doc without the _score and _highlights metadata fields
+func withoutSearchMeta(doc bson.Raw) (bson.Raw, error) {
+	d, err := rawToD(doc)
+	if err != nil {
+		return nil, err
+	}
+	stored := d[:0]
+	for _, e := range d {
+		if e.Key != "_score" && e.Key != "_highlights" {
+			stored = append(stored, e)
+		}
+	}
+	return bson.Marshal(stored)
+}
@@ -0,0 +1,158 @@
+package mongodb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SyncResult reports the changes made by SyncReferenceData
+type SyncResult struct {
+	Inserted int
+	Updated  int
+	Deleted  int
+}
+
+// SyncReferenceData converges the collection to desired, e.g. a lookup table managed in code:
+// rows are matched by the bson keyFields, missing ones are created, differing ones get their
+// differing fields updated and stored rows not in desired are deleted. _id and timestamps are
+// not compared, so unchanged rows are not written. Writes go through the controller hooks.
+// if desired has duplicate keys, return err before any write
+// if some failed, return the changes made so far and err
+func SyncReferenceData[T any](ctx context.Context, c *genericObjectDBCtrl[T], desired []T, keyFields ...string) (*SyncResult, error) {
+	log.Debug("DB DEBUG: Started SyncReferenceData")
+	defer log.Debug("DB DEBUG: finished SyncReferenceData")
+	if len(keyFields) == 0 {
+		return nil, fmt.Errorf("failed to sync %s: no key fields", c.db.Name())
+	}
+
+	skip := map[string]bool{"_id": true, updatedAtKey[T](): true}
+	for _, name := range []string{"CreatedAt", "UpdatedAt"} {
+		if f, ok := timestampField[T](name); ok {
+			skip[f.BSONName] = true
+		}
+	}
+	if c.opts.concurrency == ConcurrencyVersion {
+		skip[versionKey[T]()] = true
+	}
+
+	wanted := make(map[string]bson.Raw, len(desired))
+	items := make(map[string]*T, len(desired))
+	order := make([]string, 0, len(desired))
+	for i := range desired {
+		item := desired[i]
+		err := applyDefaults(&item)
+		if err != nil {
+			return nil, err
+		}
+		setSchemaVersion(&item)
+		data, err := c.marshal(&item)
+		if err != nil {
+			return nil, err
+		}
+		doc := bson.Raw(data)
+		key := syncKey(doc, keyFields)
+		if _, ok := wanted[key]; ok {
+			return nil, fmt.Errorf("failed to sync %s: duplicate key %s", c.db.Name(), key)
+		}
+		wanted[key] = doc
+		items[key] = &item
+		order = append(order, key)
+	}
+
+	type syncUpdate struct {
+		id    bson.RawValue
+		attrs map[string]any
+	}
+	var updates []syncUpdate
+	var stale []any
+	seen := map[string]bool{}
+	// writes are made after the scan, so the scan never meets its own updates
+	err := c.Iterate(ctx, nil, func(item *T) error {
+		data, err := c.marshal(item)
+		if err != nil {
+			return err
+		}
+		doc := bson.Raw(data)
+		id := doc.Lookup("_id")
+		key := syncKey(doc, keyFields)
+		want, ok := wanted[key]
+		if !ok || seen[key] {
+			stale = append(stale, id)
+			return nil
+		}
+		seen[key] = true
+
+		attrs := map[string]any{}
+		elements, err := want.Elements()
+		if err != nil {
+			return err
+		}
+		for _, e := range elements {
+			if skip[e.Key()] {
+				continue
+			}
+			stored, err := doc.LookupErr(e.Key())
+			if err == nil && stored.Type == e.Value().Type && bytes.Equal(stored.Value, e.Value().Value) {
+				continue
+			}
+			var value any
+			if err = e.Value().Unmarshal(&value); err != nil {
+				return err
+			}
+			attrs[e.Key()] = value
+		}
+		if len(attrs) > 0 {
+			updates = append(updates, syncUpdate{id: id, attrs: attrs})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SyncResult{}
+	for _, u := range updates {
+		_, err = c.UpdateAttributesDetailed(ctx, map[string]any{"_id": u.id}, u.attrs)
+		if err != nil {
+			return result, err
+		}
+		result.Updated++
+	}
+	for _, key := range order {
+		if seen[key] {
+			continue
+		}
+		_, err = c.CreateDetailed(ctx, items[key])
+		if err != nil {
+			return result, err
+		}
+		result.Inserted++
+	}
+	for _, id := range stale {
+		_, err = c.DeleteDetailed(ctx, id)
+		if err != nil {
+			return result, err
+		}
+		result.Deleted++
+	}
+	return result, nil
+}
+
+// syncKey returns the values of keyFields of doc as a string key
+func syncKey(doc bson.Raw, keyFields []string) string {
+	parts := make([]string, 0, len(keyFields))
+	for _, field := range keyFields {
+		value, err := doc.LookupErr(strings.Split(field, ".")...)
+		if err != nil {
+			parts = append(parts, "")
+			continue
+		}
+		parts = append(parts, refKey(value))
+	}
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,244 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrSelfCheckFailed is returned by SelfCheckReport.Err when a check failed
+var ErrSelfCheckFailed = errors.New("self check failed")
+
+// CollectionRequirements are what the application needs of a collection
+type CollectionRequirements struct {
+	Source CollectionSource
+	// Indexes must exist with the same keys
+	Indexes []IndexSpec
+	// Validator requires a validator on the collection
+	Validator bool
+	// Ops are the operations the user must be allowed on the collection, see ProbePermissions
+	Ops []OpKind
+}
+
+// SelfCheckOptions are the requirements SelfCheck verifies
+type SelfCheckOptions struct {
+	// MinVersion is the oldest supported server version, e.g. "5.0", any when empty
+	MinVersion  string
+	Collections []CollectionRequirements
+}
+
+// CheckResult is the outcome of one check of SelfCheck
+type CheckResult struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SelfCheckReport lists the outcomes of all checks of SelfCheck
+type SelfCheckReport struct {
+	Results []CheckResult `json:"results"`
+}
+
+func (r *SelfCheckReport) add(name string, ok bool, detail string, args ...any) {
+	r.Results = append(r.Results, CheckResult{Name: name, OK: ok, Detail: fmt.Sprintf(detail, args...)})
+}
+
+// Failed returns the failed checks
+func (r *SelfCheckReport) Failed() []CheckResult {
+	var failed []CheckResult
+	for _, result := range r.Results {
+		if !result.OK {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err returns ErrSelfCheckFailed naming the failed checks, nil if all passed
+func (r *SelfCheckReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	names := make([]string, len(failed))
+	for i, result := range failed {
+		names[i] = result.Name + ": " + result.Detail
+	}
+	return errors.Wrap(ErrSelfCheckFailed, strings.Join(names, "; "))
+}
+
+// SelfCheck verifies at boot that the server behind db is reachable and recent enough and that
+// the collections have the required indexes, validators and user privileges, so deployments fail
+// fast instead of at the first affected request. Checks continue after failures, the report lists
+// all of them, see SelfCheckReport.Err.
+// if the server is not reachable, return the report and err
+func SelfCheck(ctx context.Context, db *mongo.Database, opts SelfCheckOptions) (*SelfCheckReport, error) {
+	log.Debug("DB DEBUG: Started SelfCheck")
+	defer log.Debug("DB DEBUG: finished SelfCheck")
+	report := &SelfCheckReport{}
+
+	err := db.Client().Ping(ctx, nil)
+	if err != nil {
+		report.add("connectivity", false, "%s", err)
+		return report, err
+	}
+	report.add("connectivity", true, "")
+
+	var info struct {
+		Version string `bson:"version"`
+	}
+	err = db.RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&info)
+	switch {
+	case err != nil:
+		report.add("version", false, "%s", err)
+	case opts.MinVersion != "" && !versionAtLeast(info.Version, opts.MinVersion):
+		report.add("version", false, "server %s, at least %s required", info.Version, opts.MinVersion)
+	default:
+		report.add("version", true, "server %s", info.Version)
+	}
+
+	for _, req := range opts.Collections {
+		collection := req.Source.Collection()
+		name := collection.Name()
+		checkIndexes(ctx, report, collection, req.Indexes)
+		if req.Validator {
+			checkValidator(ctx, report, collection)
+		}
+		if len(req.Ops) == 0 {
+			continue
+		}
+		probes, err := probePermissions(ctx, collection, req.Ops)
+		switch {
+		case errors.Is(err, ErrForbidden):
+			var denied []string
+			for _, probe := range probes {
+				if !probe.Allowed {
+					denied = append(denied, string(probe.Op))
+				}
+			}
+			report.add("privileges "+name, false, "denied %s", strings.Join(denied, ", "))
+		case err != nil:
+			report.add("privileges "+name, false, "%s", err)
+		default:
+			report.add("privileges "+name, true, "")
+		}
+	}
+	return report, nil
+}
+
+func checkIndexes(ctx context.Context, report *SelfCheckReport, collection *mongo.Collection, specs []IndexSpec) {
+	if len(specs) == 0 {
+		return
+	}
+	name := "indexes " + collection.Name()
+	cursor, err := collection.Indexes().List(ctx)
+	if err != nil {
+		report.add(name, false, "%s", err)
+		return
+	}
+	var existing []existingIndex
+	if err = cursor.All(ctx, &existing); err != nil {
+		report.add(name, false, "%s", err)
+		return
+	}
+	var missing []string
+	for _, spec := range specs {
+		found := false
+		for _, index := range existing {
+			found = found || spec.sameKeys(index)
+		}
+		if !found {
+			missing = append(missing, spec.IndexName())
+		}
+	}
+	if len(missing) > 0 {
+		report.add(name, false, "missing %s", strings.Join(missing, ", "))
+		return
+	}
+	report.add(name, true, "")
+}
+
+func checkValidator(ctx context.Context, report *SelfCheckReport, collection *mongo.Collection) {
+	name := "validator " + collection.Name()
+	specs, err := collection.Database().ListCollectionSpecifications(ctx, bson.M{"name": collection.Name()})
+	if err != nil {
+		report.add(name, false, "%s", err)
+		return
+	}
+	if len(specs) == 0 {
+		report.add(name, false, "collection does not exist")
+		return
+	}
+	if validator, err := specs[0].Options.LookupErr("validator"); err != nil || len(validator.Value) <= 5 {
+		report.add(name, false, "no validator")
+		return
+	}
+	report.add(name, true, "")
+}
+
+// privilege is a privilege of connectionStatus, empty db and collection match any
+type privilege struct {
+	Resource struct {
+		DB          *string `bson:"db"`
+		Collection  *string `bson:"collection"`
+		AnyResource bool    `bson:"anyResource"`
+	} `bson:"resource"`
+	Actions []string `bson:"actions"`
+}
+
+// userPrivileges returns the privileges of the authenticated users of the connection
+func userPrivileges(ctx context.Context, db *mongo.Database) ([]privilege, bool, error) {
+	var status struct {
+		AuthInfo struct {
+			Users      []bson.Raw  `bson:"authenticatedUsers"`
+			Privileges []privilege `bson:"authenticatedUserPrivileges"`
+		} `bson:"authInfo"`
+	}
+	err := db.RunCommand(ctx, bson.D{{Key: "connectionStatus", Value: 1}, {Key: "showPrivileges", Value: true}}).Decode(&status)
+	if err != nil {
+		return nil, false, err
+	}
+	return status.AuthInfo.Privileges, len(status.AuthInfo.Users) > 0, nil
+}
+
+// hasPrivilege reports whether privileges allow action on collection of database
+func hasPrivilege(privileges []privilege, database string, collection string, action string) bool {
+	for _, p := range privileges {
+		r := p.Resource
+		matches := r.AnyResource ||
+			(r.DB != nil && r.Collection != nil &&
+				(*r.DB == "" || *r.DB == database) &&
+				(*r.Collection == "" && !strings.HasPrefix(collection, "system.") || *r.Collection == collection))
+		if !matches {
+			continue
+		}
+		for _, a := range p.Actions {
+			if a == action || a == "anyAction" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// versionAtLeast compares dotted server versions numerically, e.g. "4.4.10" >= "4.4"
+func versionAtLeast(version string, min string) bool {
+	have, want := strings.Split(version, "."), strings.Split(min, ".")
+	for i, w := range want {
+		wn, _ := strconv.Atoi(w)
+		hn := 0
+		if i < len(have) {
+			hn, _ = strconv.Atoi(strings.SplitN(have[i], "-", 2)[0])
+		}
+		if hn != wn {
+			return hn > wn
+		}
+	}
+	return true
+}
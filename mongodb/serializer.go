@@ -0,0 +1,125 @@
+package mongodb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Serializer encodes values for the Cached decorator (see WithCacheSerializer) and exports
+// (see SerializedFormat). BSON and JSON are built in, msgpack or protobuf encodings plug in by
+// implementing it over their library, so the package does not depend on them.
+type Serializer interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	// SerializerBSON encodes values as bson documents
+	SerializerBSON Serializer = bsonSerializer{}
+	// SerializerJSON encodes values as canonical extended JSON, keeping bson types
+	SerializerJSON Serializer = jsonSerializer{}
+)
+
+type bsonSerializer struct{}
+
+func (bsonSerializer) Marshal(v any) ([]byte, error) {
+	return bson.Marshal(v)
+}
+
+func (bsonSerializer) Unmarshal(data []byte, v any) error {
+	return bson.Unmarshal(data, v)
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) Marshal(v any) ([]byte, error) {
+	return bson.MarshalExtJSON(v, true, false)
+}
+
+func (jsonSerializer) Unmarshal(data []byte, v any) error {
+	return bson.UnmarshalExtJSON(data, true, v)
+}
+
+// maxFrameSize bounds the frames read by SerializedFormat, twice the bson document limit
+const maxFrameSize = 32 * 1024 * 1024
+
+// SerializedFormat is an export Format writing every document as a frame of a 4 byte big endian
+// length and the document encoded by s. Documents are passed to s as bson.D and decoded into
+// *bson.D on import.
+func SerializedFormat(s Serializer) Format {
+	return serializedFormat{s: s}
+}
+
+type serializedFormat struct {
+	s Serializer
+}
+
+func (f serializedFormat) NewEncoder(w io.Writer) Encoder {
+	return &serializedEncoder{s: f.s, w: bufio.NewWriter(w)}
+}
+
+func (f serializedFormat) NewDecoder(r io.Reader) Decoder {
+	return &serializedDecoder{s: f.s, r: bufio.NewReader(r)}
+}
+
+type serializedEncoder struct {
+	s Serializer
+	w *bufio.Writer
+}
+
+func (e *serializedEncoder) Encode(doc bson.Raw) error {
+	var d bson.D
+	err := bson.Unmarshal(doc, &d)
+	if err != nil {
+		return err
+	}
+	data, err := e.s.Marshal(d)
+	if err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(data)))
+	if _, err = e.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *serializedEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+type serializedDecoder struct {
+	s Serializer
+	r *bufio.Reader
+}
+
+func (d *serializedDecoder) Decode() (bson.Raw, error) {
+	var size [4]byte
+	_, err := io.ReadFull(d.r, size[:])
+	if err != nil {
+		// io.EOF before a frame ends the stream, io.ErrUnexpectedEOF reports a truncated one
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxFrameSize {
+		return nil, fmt.Errorf("failed to decode frame: size %d exceeds %d", n, maxFrameSize)
+	}
+	data := make([]byte, n)
+	if _, err = io.ReadFull(d.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	var doc bson.D
+	if err = d.s.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return bson.Marshal(doc)
+}
@@ -0,0 +1,231 @@
+package mongodb
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sessionCollection stores web sessions
+const sessionCollection = "_sessions"
+
+// defaultSessionMaxAge is the session lifetime when SessionOptions.MaxAge is not set
+const defaultSessionMaxAge = 30 * 24 * 60 * 60
+
+// ErrInvalidSessionCookie is returned when the session cookie is malformed or its signature does not match
+var ErrInvalidSessionCookie = errors.New("invalid session cookie")
+
+// SessionOptions are the cookie attributes of sessions, MaxAge is in seconds,
+// MaxAge < 0 deletes the session on Save
+type SessionOptions struct {
+	Path     string
+	Domain   string
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+}
+
+// Session is a web session following the gorilla/sessions shape, Values are persisted on Save
+type Session struct {
+	ID      string
+	Values  map[string]any
+	Options *SessionOptions
+	IsNew   bool
+	name    string
+}
+
+// Name returns the cookie name of the session
+func (s *Session) Name() string {
+	return s.name
+}
+
+// SessionStore persists sessions in a TTL-indexed collection and keeps only the signed
+// session id in the cookie, with the Get/New/Save methods of a gorilla/sessions store
+type SessionStore struct {
+	db      *mongo.Collection
+	keys    [][]byte
+	Options *SessionOptions
+}
+
+// NewSessionStore creates a SessionStore storing sessions in the database sessions collection
+// and ensures its TTL index. Cookies are signed with the first key and verified with any key,
+// so keys can be rotated by prepending the new one.
+// if some failed, return err
+func NewSessionStore(ctx context.Context, db *mongo.Database, keys ...[]byte) (*SessionStore, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one session key is required")
+	}
+	collection := db.Collection(sessionCollection)
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &SessionStore{
+		db:   collection,
+		keys: keys,
+		Options: &SessionOptions{
+			Path:     "/",
+			MaxAge:   defaultSessionMaxAge,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		},
+	}, nil
+}
+
+type sessionDoc struct {
+	ID        string         `bson:"_id"`
+	Values    map[string]any `bson:"values"`
+	ExpiresAt time.Time      `bson:"expires_at"`
+}
+
+// Get returns the session name of the request, a new session if there is none or it expired
+// if the cookie is not valid, return a new session and ErrInvalidSessionCookie
+// if some failed, return err
+func (s *SessionStore) Get(r *http.Request, name string) (*Session, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return s.New(r, name)
+	}
+	id, ok := s.verify(cookie.Value)
+	if !ok {
+		session, _ := s.New(r, name)
+		return session, ErrInvalidSessionCookie
+	}
+
+	var doc sessionDoc
+	err = s.db.FindOne(r.Context(), bson.M{"_id": id, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&doc)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return s.New(r, name)
+		}
+		return nil, err
+	}
+	session := s.newSession(name)
+	session.ID = doc.ID
+	if doc.Values != nil {
+		session.Values = doc.Values
+	}
+	return session, nil
+}
+
+// New returns a new session name, it is stored on Save
+func (s *SessionStore) New(r *http.Request, name string) (*Session, error) {
+	session := s.newSession(name)
+	session.IsNew = true
+	return session, nil
+}
+
+// Save stores the session and sets its cookie, with Options.MaxAge < 0 the session is deleted
+// if some failed, return err
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, session *Session) error {
+	opts := session.Options
+	if opts.MaxAge < 0 {
+		if session.ID != "" {
+			_, err := s.db.DeleteOne(r.Context(), bson.M{"_id": session.ID})
+			if err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, s.cookie(session.name, "", opts))
+		return nil
+	}
+
+	if session.ID == "" {
+		id, err := newSessionID()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+	maxAge := opts.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultSessionMaxAge
+	}
+	_, err := s.db.ReplaceOne(
+		r.Context(),
+		bson.M{"_id": session.ID},
+		sessionDoc{ID: session.ID, Values: session.Values, ExpiresAt: time.Now().Add(time.Duration(maxAge) * time.Second)},
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, s.cookie(session.name, s.sign(session.ID), opts))
+	return nil
+}
+
+func (s *SessionStore) newSession(name string) *Session {
+	opts := *s.Options
+	return &Session{
+		Values:  map[string]any{},
+		Options: &opts,
+		name:    name,
+	}
+}
+
+func (s *SessionStore) cookie(name string, value string, opts *SessionOptions) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		MaxAge:   opts.MaxAge,
+		Secure:   opts.Secure,
+		HttpOnly: opts.HttpOnly,
+		SameSite: opts.SameSite,
+	}
+	if opts.MaxAge > 0 {
+		cookie.Expires = time.Now().Add(time.Duration(opts.MaxAge) * time.Second)
+	} else if opts.MaxAge < 0 {
+		cookie.Expires = time.Unix(1, 0)
+	}
+	return cookie
+}
+
+// sign returns the cookie value id.signature signed with the first key
+func (s *SessionStore) sign(id string) string {
+	return id + "." + sessionMAC(s.keys[0], id)
+}
+
+// verify returns the session id of the cookie value if it is signed with any key
+func (s *SessionStore) verify(value string) (string, bool) {
+	id, mac, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", false
+	}
+	for _, key := range s.keys {
+		if hmac.Equal([]byte(mac), []byte(sessionMAC(key, id))) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func sessionMAC(key []byte, id string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,336 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// settingsCollection stores configuration documents
+const settingsCollection = "_settings"
+
+// settingsRetry is the pause before the settings change stream is reopened after a failure
+const settingsRetry = 5 * time.Second
+
+// changeStreamHistoryLost and changeStreamFatalError are the server error codes of a change stream
+// that can't be resumed, e.g. because the resume token is no longer in the oplog
+const (
+	changeStreamHistoryLost = 286
+	changeStreamFatalError  = 280
+)
+
+// Setting is a versioned configuration document
+type Setting struct {
+	Key string `bson:"_id" json:"key"`
+	// Value is the typed configuration, read with GetSetting
+	Value bson.RawValue `bson:"value" json:"-"`
+	// Version is incremented by every Set, 0 means the setting does not exist
+	Version   int64     `bson:"version" json:"version"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Settings stores configuration documents and notifies subscribers about changes,
+// so services can hot-reload configuration stored in MongoDB
+type Settings struct {
+	db *mongo.Collection
+
+	mu          sync.Mutex
+	subscribers map[int]settingSubscriber
+	nextID      int
+
+	// resumeToken and versions are owned by the watching goroutine: the change stream resumes
+	// after resumeToken, versions are the delivered versions a full reload is compared against
+	resumeToken bson.Raw
+	versions    map[string]int64
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+type settingSubscriber struct {
+	key string
+	fn  func(Setting)
+}
+
+// NewSettings creates Settings storing configuration in the database settings collection
+// and starts watching the collection, call Close to stop it
+func NewSettings(db *mongo.Database) *Settings {
+	ctx, stop := context.WithCancel(context.Background())
+	s := &Settings{
+		db:          db.Collection(settingsCollection),
+		subscribers: map[int]settingSubscriber{},
+		stop:        stop,
+		done:        make(chan struct{}),
+	}
+	go s.watch(ctx)
+	return s
+}
+
+// Close stops watching the settings collection
+func (s *Settings) Close() {
+	s.stop()
+	<-s.done
+}
+
+// Get returns the setting key, a missing setting is returned with Version 0
+// if some failed, return err
+func (s *Settings) Get(ctx context.Context, key string) (*Setting, error) {
+	setting := &Setting{Key: key}
+	err := s.db.FindOne(ctx, bson.M{"_id": key}).Decode(setting)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	return setting, nil
+}
+
+// Set stores value under key and returns the new version
+// if some failed, return err
+func (s *Settings) Set(ctx context.Context, key string, value any) (int64, error) {
+	return s.set(ctx, bson.M{"_id": key}, value, true)
+}
+
+// SetIfVersion stores value under key only if the setting is still at version,
+// version 0 creates a new setting, and returns the new version
+// if the setting was changed meanwhile, return ErrConflict
+// if some failed, return err
+func (s *Settings) SetIfVersion(ctx context.Context, key string, value any, version int64) (int64, error) {
+	if version == 0 {
+		newVersion, err := s.set(ctx, bson.M{"_id": key, "version": bson.M{"$exists": false}}, value, true)
+		if mongo.IsDuplicateKeyError(err) {
+			return 0, ErrConflict
+		}
+		return newVersion, err
+	}
+	newVersion, err := s.set(ctx, bson.M{"_id": key, "version": version}, value, false)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, ErrConflict
+	}
+	return newVersion, err
+}
+
+func (s *Settings) set(ctx context.Context, filter bson.M, value any, upsert bool) (int64, error) {
+	if err := checkWritable(ctx); err != nil {
+		return 0, err
+	}
+	t, data, err := bson.MarshalValue(value)
+	if err != nil {
+		return 0, err
+	}
+	var setting Setting
+	err = s.db.FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.D{
+			bson.E{Key: "$set", Value: bson.M{"value": bson.RawValue{Type: t, Value: data}, "updated_at": time.Now()}},
+			bson.E{Key: "$inc", Value: bson.M{"version": 1}},
+		},
+		options.FindOneAndUpdate().SetUpsert(upsert).SetReturnDocument(options.After),
+	).Decode(&setting)
+	if err != nil {
+		return 0, err
+	}
+	return setting.Version, nil
+}
+
+// Delete deletes the setting key
+// if some failed, return err
+func (s *Settings) Delete(ctx context.Context, key string) error {
+	if err := checkWritable(ctx); err != nil {
+		return err
+	}
+	_, err := s.db.DeleteOne(ctx, bson.M{"_id": key})
+	return err
+}
+
+// Subscribe registers fn to receive changes of the setting key, an empty key subscribes to all settings.
+// A deleted setting is delivered with Version 0. fn is called from the watching goroutine.
+func (s *Settings) Subscribe(key string, fn func(Setting)) (unsubscribe func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := s.nextID
+	s.nextID++
+	s.subscribers[id] = settingSubscriber{key: key, fn: fn}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subscribers, id)
+	}
+}
+
+// GetSetting returns the typed value and version of the setting key, def and 0 if it does not exist
+// if some failed, return err
+func GetSetting[V any](ctx context.Context, s *Settings, key string, def V) (V, int64, error) {
+	setting, err := s.Get(ctx, key)
+	if err != nil {
+		return def, 0, err
+	}
+	if setting.Version == 0 {
+		return def, 0, nil
+	}
+	var value V
+	err = setting.Value.Unmarshal(&value)
+	if err != nil {
+		return def, 0, err
+	}
+	return value, setting.Version, nil
+}
+
+// OnSetting subscribes fn to typed changes of the setting key, def is delivered when it is deleted.
+// Values that do not decode into V are logged and skipped.
+func OnSetting[V any](s *Settings, key string, def V, fn func(value V, version int64)) (unsubscribe func()) {
+	return s.Subscribe(key, func(setting Setting) {
+		if setting.Version == 0 {
+			fn(def, 0)
+			return
+		}
+		var value V
+		err := setting.Value.Unmarshal(&value)
+		if err != nil {
+			log.Errorf("DB ERROR: failed to decode setting %s: %s", key, err)
+			return
+		}
+		fn(value, setting.Version)
+	})
+}
+
+// watch delivers changes to subscribers, resuming the change stream after failures.
+// If it can't be resumed, settings are reloaded and the ones changed meanwhile are delivered.
+func (s *Settings) watch(ctx context.Context) {
+	defer close(s.done)
+	if err := requireCompat(s.db.Database(), s.db.Name(), FeatureChangeStreams); err != nil {
+		log.Warnf("DB WARN: settings changes are not delivered to subscribers: %s", err)
+		return
+	}
+	for {
+		err := s.watchOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Warnf("DB WARN: settings change stream failed: %s", err)
+		if sleepCtx(ctx, settingsRetry) != nil {
+			return
+		}
+	}
+}
+
+func (s *Settings) watchOnce(ctx context.Context) error {
+	stream, err := s.openStream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	for stream.Next(ctx) {
+		var event struct {
+			OperationType string `bson:"operationType"`
+			DocumentKey   struct {
+				ID string `bson:"_id"`
+			} `bson:"documentKey"`
+			FullDocument *Setting `bson:"fullDocument"`
+		}
+		if err = stream.Decode(&event); err != nil {
+			log.Errorf("DB ERROR: failed to decode settings change: %s", err)
+		} else {
+			setting := Setting{Key: event.DocumentKey.ID}
+			if event.FullDocument != nil && event.OperationType != "delete" {
+				setting = *event.FullDocument
+			}
+			s.deliver(setting)
+		}
+		s.resumeToken = stream.ResumeToken()
+	}
+	if token := stream.ResumeToken(); token != nil {
+		s.resumeToken = token
+	}
+	return stream.Err()
+}
+
+// openStream resumes the change stream after the last seen change. Without a resume token,
+// or if the change was already removed from the oplog, a new stream is opened and settings are reloaded.
+func (s *Settings) openStream(ctx context.Context) (*mongo.ChangeStream, error) {
+	if s.resumeToken != nil {
+		stream, err := s.db.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup).SetResumeAfter(s.resumeToken))
+		var serverErr mongo.ServerError
+		if !errors.As(err, &serverErr) || !(serverErr.HasErrorCode(changeStreamHistoryLost) || serverErr.HasErrorCode(changeStreamFatalError)) {
+			return stream, err
+		}
+		log.Warnf("DB WARN: failed to resume settings change stream, reloading settings: %s", err)
+		s.resumeToken = nil
+	}
+	// the stream is opened before reloading so no change made during the reload is missed
+	stream, err := s.db.Watch(ctx, mongo.Pipeline{}, options.ChangeStream().SetFullDocument(options.UpdateLookup))
+	if err != nil {
+		return nil, err
+	}
+	s.resumeToken = stream.ResumeToken()
+	if err = s.reload(ctx); err != nil {
+		stream.Close(context.Background())
+		return nil, err
+	}
+	return stream, nil
+}
+
+// reload loads all settings and delivers the ones whose version differs from the delivered one,
+// deleted ones with Version 0. The first load only records the versions.
+func (s *Settings) reload(ctx context.Context) error {
+	cursor, err := s.db.Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	var settings []Setting
+	if err = cursor.All(ctx, &settings); err != nil {
+		return err
+	}
+	if s.versions == nil {
+		s.versions = make(map[string]int64, len(settings))
+		for _, setting := range settings {
+			s.versions[setting.Key] = setting.Version
+		}
+		return nil
+	}
+	current := make(map[string]bool, len(settings))
+	for _, setting := range settings {
+		current[setting.Key] = true
+		if s.versions[setting.Key] != setting.Version {
+			s.deliver(setting)
+		}
+	}
+	for key := range s.versions {
+		if !current[key] {
+			s.deliver(Setting{Key: key})
+		}
+	}
+	return nil
+}
+
+// deliver records the version of setting and notifies subscribers
+func (s *Settings) deliver(setting Setting) {
+	if s.versions != nil {
+		if setting.Version == 0 {
+			delete(s.versions, setting.Key)
+		} else {
+			s.versions[setting.Key] = setting.Version
+		}
+	}
+	s.notify(setting)
+}
+
+func (s *Settings) notify(setting Setting) {
+	s.mu.Lock()
+	fns := make([]func(Setting), 0, len(s.subscribers))
+	for _, sub := range s.subscribers {
+		if sub.key == "" || sub.key == setting.Key {
+			fns = append(fns, sub.fn)
+		}
+	}
+	s.mu.Unlock()
+	for _, fn := range fns {
+		fn(setting)
+	}
+}
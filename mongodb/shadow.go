@@ -0,0 +1,238 @@
+package mongodb
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// shadowTimeout bounds a mirrored write
+const shadowTimeout = 10 * time.Second
+
+type shadowWrite struct {
+	ctx   context.Context
+	apply func(ctx context.Context) error
+}
+
+// ShadowStats counts the writes mirrored by a Shadow
+type ShadowStats struct {
+	Mirrored int64 `json:"mirrored"`
+	Failed   int64 `json:"failed"`
+	// Dropped writes found the queue full
+	Dropped int64 `json:"dropped"`
+}
+
+// Shadow is a Repository mirroring a sample of its successful writes into a shadow Repository,
+// e.g. on a new cluster or with a new schema, to test it under real traffic. Mirroring is fire and
+// forget: writes are queued and applied in the background, failures are counted and logged and
+// never reach the caller. Items are sampled by id, so the creates, updates and deletes of one item
+// are mirrored together; filter based writes are always mirrored as they only affect the sampled
+// items present in the shadow. Updates of items created before mirroring started fail in the
+// shadow and are counted as failed.
+type Shadow[T any] struct {
+	Repository[T]
+
+	shadow  Repository[T]
+	percent float64
+
+	queue chan shadowWrite
+	wg    sync.WaitGroup
+	once  sync.Once
+
+	mirrored atomic.Int64
+	failed   atomic.Int64
+	dropped  atomic.Int64
+}
+
+// NewShadow mirrors percent (0-100) of the items written through repo into shadow with a queue of
+// queueSize writes, call Close to drain it
+func NewShadow[T any](repo Repository[T], shadow Repository[T], percent float64, queueSize int) *Shadow[T] {
+	s := &Shadow[T]{
+		Repository: repo,
+		shadow:     shadow,
+		percent:    percent,
+		queue:      make(chan shadowWrite, queueSize),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Stats returns the mirrored write counts
+func (s *Shadow[T]) Stats() ShadowStats {
+	return ShadowStats{Mirrored: s.mirrored.Load(), Failed: s.failed.Load(), Dropped: s.dropped.Load()}
+}
+
+// Close stops mirroring and waits for the queued writes, s must not be written to afterwards
+func (s *Shadow[T]) Close() {
+	s.once.Do(func() { close(s.queue) })
+	s.wg.Wait()
+}
+
+func (s *Shadow[T]) run() {
+	defer s.wg.Done()
+	for write := range s.queue {
+		ctx, cancel := context.WithTimeout(write.ctx, shadowTimeout)
+		if err := write.apply(ctx); err != nil {
+			s.failed.Add(1)
+			log.Warnf("DB WARN: failed to mirror write to shadow: %s", err)
+		} else {
+			s.mirrored.Add(1)
+		}
+		cancel()
+	}
+}
+
+// sampled reports whether the item id is mirrored
+func (s *Shadow[T]) sampled(id any) bool {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(refKey(id)))
+	return float64(h.Sum64()%10000) < s.percent*100
+}
+
+// mirror queues write keeping the values of ctx (e.g. the tenant) without its cancellation
+func (s *Shadow[T]) mirror(ctx context.Context, write func(ctx context.Context) error) {
+	select {
+	case s.queue <- shadowWrite{ctx: context.WithoutCancel(ctx), apply: write}:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// shadowItem returns a deep copy of item for the shadow with _id set to id when it is not nil,
+// as the primary does not write generated ids back into item
+func shadowItem[T any](item *T, id any) (*T, error) {
+	var doc bson.D
+	data, err := bson.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	if err = bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if id != nil {
+		doc = setPathD(doc, []string{"_id"}, id)
+	}
+	if data, err = bson.Marshal(doc); err != nil {
+		return nil, err
+	}
+	copied := new(T)
+	return copied, bson.Unmarshal(data, copied)
+}
+
+// shadowMap returns a deep copy of m, values the caller or the primary change later don't race
+// with the mirrored write
+func shadowMap(m map[string]any) (map[string]any, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := bson.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	copied := map[string]any{}
+	return copied, bson.Unmarshal(data, &copied)
+}
+
+// shadowQuery returns a copy of q not sharing its filter, sort and fields
+func shadowQuery(q Query) (Query, error) {
+	filter, err := shadowMap(q.Filter)
+	if err != nil {
+		return q, err
+	}
+	q.Filter = filter
+	q.Sort = append(bson.D(nil), q.Sort...)
+	q.Fields = append([]string(nil), q.Fields...)
+	return q, nil
+}
+
+// mirrorFailed counts a write which could not be copied for the shadow
+func (s *Shadow[T]) mirrorFailed(err error) {
+	s.failed.Add(1)
+	log.Warnf("DB WARN: failed to copy write for shadow: %s", err)
+}
+
+func (s *Shadow[T]) Create(ctx context.Context, item *T) (*CreateResult, error) {
+	result, err := s.Repository.Create(ctx, item)
+	if err == nil && s.sampled(result.ID) {
+		copied, err := shadowItem(item, result.ID)
+		if err != nil {
+			s.mirrorFailed(err)
+			return result, nil
+		}
+		s.mirror(ctx, func(ctx context.Context) error {
+			_, err := s.shadow.Create(ctx, copied)
+			return err
+		})
+	}
+	return result, err
+}
+
+func (s *Shadow[T]) Update(ctx context.Context, id any, item *T) (*UpdateResult, error) {
+	result, err := s.Repository.Update(ctx, id, item)
+	if err == nil && s.sampled(id) {
+		copied, err := shadowItem(item, nil)
+		if err != nil {
+			s.mirrorFailed(err)
+			return result, nil
+		}
+		s.mirror(ctx, func(ctx context.Context) error {
+			_, err := s.shadow.Update(ctx, id, copied)
+			return err
+		})
+	}
+	return result, err
+}
+
+func (s *Shadow[T]) UpdateAttributes(ctx context.Context, q Query, attrs map[string]any) (*UpdateResult, error) {
+	result, err := s.Repository.UpdateAttributes(ctx, q, attrs)
+	if err == nil && s.percent > 0 {
+		copiedQuery, err := shadowQuery(q)
+		if err != nil {
+			s.mirrorFailed(err)
+			return result, nil
+		}
+		copied, err := shadowMap(attrs)
+		if err != nil {
+			s.mirrorFailed(err)
+			return result, nil
+		}
+		s.mirror(ctx, func(ctx context.Context) error {
+			_, err := s.shadow.UpdateAttributes(ctx, copiedQuery, copied)
+			return err
+		})
+	}
+	return result, err
+}
+
+func (s *Shadow[T]) Delete(ctx context.Context, id any) (*DeleteResult, error) {
+	result, err := s.Repository.Delete(ctx, id)
+	if err == nil && s.sampled(id) {
+		s.mirror(ctx, func(ctx context.Context) error {
+			_, err := s.shadow.Delete(ctx, id)
+			return err
+		})
+	}
+	return result, err
+}
+
+func (s *Shadow[T]) DeleteRange(ctx context.Context, q Query) (*DeleteResult, error) {
+	result, err := s.Repository.DeleteRange(ctx, q)
+	if err == nil && s.percent > 0 {
+		copiedQuery, err := shadowQuery(q)
+		if err != nil {
+			s.mirrorFailed(err)
+			return result, nil
+		}
+		s.mirror(ctx, func(ctx context.Context) error {
+			_, err := s.shadow.DeleteRange(ctx, copiedQuery)
+			return err
+		})
+	}
+	return result, err
+}
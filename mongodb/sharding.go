@@ -0,0 +1,53 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IndexHashed is the key value of a hashed index field
+const IndexHashed = "hashed"
+
+// HashedIndex returns a spec of a hashed index on field, used by hashed shard keys
+// and for equality-only lookups on high-cardinality fields
+func HashedIndex(field string) IndexSpec {
+	return IndexSpec{Keys: bson.D{{Key: field, Value: IndexHashed}}}
+}
+
+// ShardCollection shards the collection by key, e.g. bson.D{{Key: "tenant_id", Value: 1}}
+// or bson.D{{Key: "_id", Value: "hashed"}}. The index supporting key must exist (see EnsureIndexes).
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ShardCollection(ctx context.Context, key bson.D, unique bool) (err error) {
+	defer c.recoverPanic(ctx, "ShardCollection", &err)
+	log.Debug("DB DEBUG: Started admin.RunCommand(ctx, shardCollection)")
+	defer log.Debug("DB DEBUG: finished admin.RunCommand(ctx, shardCollection)")
+
+	err = c.guardDDL(ctx, "shardCollection")
+	if err != nil {
+		return err
+	}
+	ctx, cancel, _ := c.begin(ctx, opDDL)
+	defer cancel()
+
+	cmd := bson.D{
+		{Key: "shardCollection", Value: c.db.Database().Name() + "." + c.db.Name()},
+		{Key: "key", Value: key},
+	}
+	if unique {
+		cmd = append(cmd, bson.E{Key: "unique", Value: true})
+	}
+	return c.db.Database().Client().Database("admin").RunCommand(ctx, cmd).Err()
+}
+
+// ShardHashed creates the hashed index on field and shards the collection by it
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ShardHashed(ctx context.Context, field string) (err error) {
+	defer c.recoverPanic(ctx, "ShardHashed", &err)
+	err = c.EnsureIndexes(c.nested(ctx), HashedIndex(field))
+	if err != nil {
+		return err
+	}
+	return c.ShardCollection(c.nested(ctx), bson.D{{Key: field, Value: IndexHashed}}, false)
+}
@@ -0,0 +1,44 @@
+package mongodb
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// SortField is one field of a SortSpec
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// SortSpec is an ordered list of sort fields
+type SortSpec []SortField
+
+// D returns the spec as a sort document normalized by NormalizeSort
+func (s SortSpec) D() bson.D {
+	sort := make(bson.D, 0, len(s)+1)
+	for _, f := range s {
+		direction := 1
+		if f.Desc {
+			direction = -1
+		}
+		sort = append(sort, bson.E{Key: f.Field, Value: direction})
+	}
+	return NormalizeSort(sort)
+}
+
+// NormalizeSort appends an _id tie-breaker to sort unless it already orders by _id,
+// so items with equal sort keys keep a stable order and pagination neither skips nor
+// repeats them. The tie-breaker follows the direction of the last sort field.
+func NormalizeSort(sort bson.D) bson.D {
+	direction := any(1)
+	for _, e := range sort {
+		if e.Key == "_id" {
+			return sort
+		}
+		direction = e.Value
+	}
+	if _, isMeta := direction.(bson.M); isMeta {
+		direction = 1
+	}
+	normalized := make(bson.D, len(sort), len(sort)+1)
+	copy(normalized, sort)
+	return append(normalized, bson.E{Key: "_id", Value: direction})
+}
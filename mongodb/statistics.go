@@ -0,0 +1,206 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// server error codes meaning an accumulator is not available on the deployment
+var accumulatorUnsupportedCodes = []int{
+	15952, // unknown group operator
+	168,   // InvalidPipelineOperator
+}
+
+// Percentiles returns the values of numeric field at percentiles ps (in [0, 1], e.g. 0.5, 0.95, 0.99)
+// among items matched by sels, in the order of ps, by the nearest rank. It uses $percentile on
+// MongoDB 7.0 and falls back to a count and one indexed sorted lookup per percentile on older
+// servers, so an index on field keeps both fast. Non numeric values are ignored; with no values
+// the result is nil.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) Percentiles(ctx context.Context, field string, sels map[string]any, ps []float64) (_ []float64, err error) {
+	defer c.recoverPanic(ctx, "Percentiles", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $percentile)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $percentile)")
+	for _, p := range ps {
+		if p < 0 || p > 1 || math.IsNaN(p) {
+			return nil, fmt.Errorf("failed to compute percentiles: %v is not in [0, 1]", p)
+		}
+	}
+	if len(ps) == 0 {
+		return nil, nil
+	}
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+
+	filter := typedFilter(sels, field, "number")
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "values", Value: bson.M{"$percentile": bson.M{"input": "$" + field, "p": ps, "method": "approximate"}}},
+		}}},
+	}
+	var results []struct {
+		Values []float64 `bson:"values"`
+	}
+	cursor, err := c.reader().Aggregate(ctx, pipeline)
+	if err == nil {
+		err = cursor.All(ctx, &results)
+	}
+	if err != nil {
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && hasAnyCode(serverErr, accumulatorUnsupportedCodes) {
+			log.Debugf("DB DEBUG: $percentile unsupported, falling back to sorted lookups: %s", err)
+			return c.rankPercentiles(ctx, field, filter, ps)
+		}
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0].Values, nil
+}
+
+// rankPercentiles looks up the value of each nearest rank in field order
+func (c *genericObjectDBCtrl[T]) rankPercentiles(ctx context.Context, field string, filter bson.D, ps []float64) ([]float64, error) {
+	reader := c.reader()
+	n, err := reader.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	values := make([]float64, len(ps))
+	for i, p := range ps {
+		rank := int64(math.Ceil(p * float64(n)))
+		if rank < 1 {
+			rank = 1
+		}
+		opts := options.FindOne().
+			SetSort(bson.D{{Key: field, Value: 1}}).
+			SetSkip(rank - 1).
+			SetProjection(bson.D{{Key: field, Value: 1}, {Key: "_id", Value: 0}})
+		raw, err := reader.FindOne(ctx, filter, opts).Raw()
+		if err != nil {
+			return nil, err
+		}
+		values[i], err = numberAt(raw, field)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return values, nil
+}
+
+// StdDev returns the standard deviation of numeric field among items matched by sels, of the
+// population or, when sample is true, the sample estimate. It uses $stdDevPop/$stdDevSamp and
+// falls back to sums of the values and their squares where those are not available.
+// With no values (or one for a sample) the result is 0.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) StdDev(ctx context.Context, field string, sels map[string]any, sample bool) (_ float64, err error) {
+	defer c.recoverPanic(ctx, "StdDev", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $stdDevPop)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $stdDevPop)")
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+
+	op := "$stdDevPop"
+	if sample {
+		op = "$stdDevSamp"
+	}
+	filter := typedFilter(sels, field, "number")
+	var results []struct {
+		StdDev float64 `bson:"stdDev"`
+	}
+	cursor, err := c.reader().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: nil}, {Key: "stdDev", Value: bson.M{op: "$" + field}}}}},
+	})
+	if err == nil {
+		err = cursor.All(ctx, &results)
+	}
+	if err != nil {
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && hasAnyCode(serverErr, accumulatorUnsupportedCodes) {
+			log.Debugf("DB DEBUG: %s unsupported, falling back to sums: %s", op, err)
+			return c.sumsStdDev(ctx, field, filter, sample)
+		}
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	return results[0].StdDev, nil
+}
+
+// sumsStdDev computes the standard deviation from the count, sum and sum of squares of field
+func (c *genericObjectDBCtrl[T]) sumsStdDev(ctx context.Context, field string, filter bson.D, sample bool) (float64, error) {
+	var results []struct {
+		N     float64 `bson:"n"`
+		Sum   float64 `bson:"sum"`
+		SumSq float64 `bson:"sumSq"`
+	}
+	cursor, err := c.reader().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: nil},
+			{Key: "n", Value: bson.M{"$sum": 1}},
+			{Key: "sum", Value: bson.M{"$sum": "$" + field}},
+			{Key: "sumSq", Value: bson.M{"$sum": bson.M{"$multiply": bson.A{"$" + field, "$" + field}}}},
+		}}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return 0, err
+	}
+	if len(results) == 0 {
+		return 0, nil
+	}
+	r := results[0]
+	divisor := r.N
+	if sample {
+		divisor--
+	}
+	if divisor <= 0 {
+		return 0, nil
+	}
+	mean := r.Sum / r.N
+	variance := (r.SumSq - r.N*mean*mean) / divisor
+	return math.Sqrt(math.Max(variance, 0)), nil
+}
+
+// typedFilter returns the sels filter restricted to items with a value of type in field,
+// e.g. "number" or "date"
+func typedFilter(sels map[string]any, field string, typ string) bson.D {
+	typed := bson.E{Key: field, Value: bson.M{"$type": typ}}
+	if _, ok := sels[field]; ok {
+		return bson.D{{Key: "$and", Value: bson.A{filterFromSels(sels), bson.D{typed}}}}
+	}
+	return append(filterFromSels(sels), typed)
+}
+
+// numberAt returns the number at the dotted path of doc as float64
+func numberAt(doc bson.Raw, path string) (float64, error) {
+	value, err := doc.LookupErr(strings.Split(path, ".")...)
+	if err != nil {
+		return 0, err
+	}
+	if bsonTypeRank(value.Type) != 2 {
+		return 0, fmt.Errorf("failed to read %s: %s is not a number", path, value.Type)
+	}
+	return rawNumber(value), nil
+}
@@ -0,0 +1,87 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DatabaseStats is the result of the dbStats command, sizes are in bytes
+type DatabaseStats struct {
+	DB          string  `bson:"db"`
+	Collections int64   `bson:"collections"`
+	Objects     int64   `bson:"objects"`
+	AvgObjSize  float64 `bson:"avgObjSize"`
+	DataSize    int64   `bson:"dataSize"`
+	StorageSize int64   `bson:"storageSize"`
+	Indexes     int64   `bson:"indexes"`
+	IndexSize   int64   `bson:"indexSize"`
+	TotalSize   int64   `bson:"totalSize"`
+}
+
+// CollectionStats are the storage stats of a collection, sizes are in bytes
+type CollectionStats struct {
+	Count          int64            `bson:"count"`
+	Size           int64            `bson:"size"`
+	AvgObjSize     float64          `bson:"avgObjSize"`
+	StorageSize    int64            `bson:"storageSize"`
+	Indexes        int64            `bson:"nindexes"`
+	TotalIndexSize int64            `bson:"totalIndexSize"`
+	IndexSizes     map[string]int64 `bson:"indexSizes"`
+}
+
+// DBStats returns document count and storage sizes of the database for capacity dashboards
+// if some failed, return err
+func DBStats(ctx context.Context, db *mongo.Database) (*DatabaseStats, error) {
+	log.Debug("DB DEBUG: Started db.RunCommand(ctx, dbStats)")
+	defer log.Debug("DB DEBUG: finished db.RunCommand(ctx, dbStats)")
+
+	stats := &DatabaseStats{}
+	err := db.RunCommand(ctx, bson.D{{Key: "dbStats", Value: 1}}).Decode(stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// Stats returns document count, storage and index sizes of the collection
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) Stats(ctx context.Context) (_ *CollectionStats, err error) {
+	defer c.recoverPanic(ctx, "Stats", &err)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $collStats)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $collStats)")
+
+	cursor, err := c.db.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$collStats", Value: bson.M{"storageStats": bson.M{}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var results []struct {
+		StorageStats CollectionStats `bson:"storageStats"`
+	}
+	err = cursor.All(ctx, &results)
+	if err != nil {
+		return nil, err
+	}
+
+	// sharded collections report one document per shard
+	stats := &CollectionStats{IndexSizes: map[string]int64{}}
+	for _, r := range results {
+		s := r.StorageStats
+		stats.Count += s.Count
+		stats.Size += s.Size
+		stats.StorageSize += s.StorageSize
+		stats.TotalIndexSize += s.TotalIndexSize
+		stats.Indexes = s.Indexes
+		for name, size := range s.IndexSizes {
+			stats.IndexSizes[name] += size
+		}
+	}
+	if stats.Count > 0 {
+		stats.AvgObjSize = float64(stats.Size) / float64(stats.Count)
+	}
+	return stats, nil
+}
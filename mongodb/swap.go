@@ -0,0 +1,119 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SwapOption configures SwapCollections
+type SwapOption func(*swapOptions)
+
+type swapOptions struct {
+	backfill func(ctx context.Context, staging *mongo.Collection) error
+	verify   func(ctx context.Context, live *mongo.Collection, staging *mongo.Collection) error
+	keepOld  bool
+}
+
+// WithBackfill fills staging before the swap, e.g. by copying and reshaping the live items
+func WithBackfill(fn func(ctx context.Context, staging *mongo.Collection) error) SwapOption {
+	return func(o *swapOptions) {
+		o.backfill = fn
+	}
+}
+
+// WithSwapVerify replaces the default verification that staging holds as many documents as live
+func WithSwapVerify(fn func(ctx context.Context, live *mongo.Collection, staging *mongo.Collection) error) SwapOption {
+	return func(o *swapOptions) {
+		o.verify = fn
+	}
+}
+
+// WithKeepOld keeps the replaced live collection renamed to <live>_old_<unix time>.
+// The swap is then two renames and live is missing for the moment between them.
+func WithKeepOld() SwapOption {
+	return func(o *swapOptions) {
+		o.keepOld = true
+	}
+}
+
+// SwapCollections replaces live with staging for heavy reindex or reshape operations:
+// staging is backfilled (see WithBackfill), verified, and renamed over live. Indexes of staging
+// are kept, create them before the swap. Both collections must be in the same database.
+// Without WithKeepOld the replacement is atomic (renameCollection with dropTarget), so readers
+// see no downtime. Changes of live are not carried over to staging: writes to live made after
+// the backfill started are lost at the rename, so writes must be frozen (e.g. with SetReadOnly)
+// from before the backfill until SwapCollections returned.
+// if verification failed, live is left untouched and return err
+// if some failed, return the name of the kept old collection and err
+func SwapCollections(ctx context.Context, live *mongo.Collection, staging *mongo.Collection, opts ...SwapOption) (old string, err error) {
+	log.Debug("DB DEBUG: Started SwapCollections")
+	defer log.Debug("DB DEBUG: finished SwapCollections")
+
+	var o swapOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	db := live.Database()
+	if staging.Database().Name() != db.Name() {
+		return "", fmt.Errorf("failed to swap %s: staging %s is in another database", live.Name(), staging.Name())
+	}
+
+	if o.backfill != nil {
+		err = o.backfill(ctx, staging)
+		if err != nil {
+			return "", fmt.Errorf("failed to backfill %s: %s", staging.Name(), err)
+		}
+	}
+	verify := o.verify
+	if verify == nil {
+		verify = verifySameCount
+	}
+	err = verify(ctx, live, staging)
+	if err != nil {
+		return "", fmt.Errorf("failed to verify %s: %s", staging.Name(), err)
+	}
+
+	admin := db.Client().Database("admin")
+	if o.keepOld {
+		old = fmt.Sprintf("%s_old_%d", live.Name(), time.Now().Unix())
+		err = renameCollection(ctx, admin, db.Name(), live.Name(), old, false)
+		if err != nil {
+			return "", err
+		}
+		return old, renameCollection(ctx, admin, db.Name(), staging.Name(), live.Name(), false)
+	}
+	return "", renameCollection(ctx, admin, db.Name(), staging.Name(), live.Name(), true)
+}
+
+func renameCollection(ctx context.Context, admin *mongo.Database, db string, from string, to string, dropTarget bool) error {
+	err := admin.RunCommand(ctx, bson.D{
+		{Key: "renameCollection", Value: db + "." + from},
+		{Key: "to", Value: db + "." + to},
+		{Key: "dropTarget", Value: dropTarget},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to rename %s to %s: %s", from, to, err)
+	}
+	return nil
+}
+
+// verifySameCount checks that staging holds as many documents as live
+func verifySameCount(ctx context.Context, live *mongo.Collection, staging *mongo.Collection) error {
+	liveCount, err := live.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	stagingCount, err := staging.CountDocuments(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	if liveCount != stagingCount {
+		return fmt.Errorf("staging has %d documents, live has %d", stagingCount, liveCount)
+	}
+	return nil
+}
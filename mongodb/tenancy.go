@@ -0,0 +1,416 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNoTenant is returned by tenant repositories called with a context without a tenant, see WithTenant
+var ErrNoTenant = errors.New("no tenant in context")
+
+// ErrTenantMismatch is returned when an item written through a tenant repository belongs to another tenant
+var ErrTenantMismatch = errors.New("item belongs to another tenant")
+
+// tenantIDPattern restricts tenant ids used in database and collection names
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,38}$`)
+
+type tenantKey struct{}
+
+// WithTenant binds the tenant id to the returned context for tenant repositories
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant bound by WithTenant
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok && tenant != ""
+}
+
+// TenantLocation is where the items of a tenant are stored
+type TenantLocation struct {
+	Collection *mongo.Collection
+	// Field holds the tenant id when Collection is shared by tenants, empty when it holds one tenant
+	Field string
+}
+
+// TenantResolver maps the items of collection name of a tenant to their location, so the same
+// repository code works with every isolation model (see NewTenantRepository)
+type TenantResolver interface {
+	Resolve(ctx context.Context, tenant string, name string) (TenantLocation, error)
+}
+
+// TenantResolverFunc adapts a function to TenantResolver
+type TenantResolverFunc func(ctx context.Context, tenant string, name string) (TenantLocation, error)
+
+func (f TenantResolverFunc) Resolve(ctx context.Context, tenant string, name string) (TenantLocation, error) {
+	return f(ctx, tenant, name)
+}
+
+// SharedCollections stores all tenants in the collections of db, scoped by the tenant id in field
+func SharedCollections(db *mongo.Database, field string) TenantResolver {
+	return TenantResolverFunc(func(_ context.Context, _ string, name string) (TenantLocation, error) {
+		return TenantLocation{Collection: db.Collection(name), Field: field}, nil
+	})
+}
+
+// DatabasePerTenant stores every tenant in its own database of client named prefix + tenant id
+func DatabasePerTenant(client *mongo.Client, prefix string) TenantResolver {
+	return TenantResolverFunc(func(_ context.Context, tenant string, name string) (TenantLocation, error) {
+		if !tenantIDPattern.MatchString(tenant) {
+			return TenantLocation{}, fmt.Errorf("failed to resolve tenant %q: invalid id", tenant)
+		}
+		return TenantLocation{Collection: client.Database(prefix + tenant).Collection(name)}, nil
+	})
+}
+
+// CollectionPerTenant stores every tenant in its own collections of db named name + "_" + tenant id
+func CollectionPerTenant(db *mongo.Database) TenantResolver {
+	return TenantResolverFunc(func(_ context.Context, tenant string, name string) (TenantLocation, error) {
+		if !tenantIDPattern.MatchString(tenant) {
+			return TenantLocation{}, fmt.Errorf("failed to resolve tenant %q: invalid id", tenant)
+		}
+		return TenantLocation{Collection: db.Collection(name + "_" + tenant)}, nil
+	})
+}
+
+// tenantRepository resolves the location of the context tenant on every call
+type tenantRepository[T any] struct {
+	name     string
+	resolver TenantResolver
+	opts     []Option
+
+	mu sync.Mutex
+	// ctrls are the controllers by database and collection name, resolvers return new
+	// *mongo.Collection values for the same collection
+	ctrls map[string]*genericObjectDBCtrl[T]
+}
+
+// NewTenantRepository creates a Repository of the items of collection name of the tenant bound to
+// the context by WithTenant, stored where resolver places them; opts are the controller options of
+// every tenant. In shared collections queries are scoped to the tenant and created items get the
+// tenant id in the tenant field (a string field of T). Legacy returns a CRUDDBService scoped
+// the same way.
+func NewTenantRepository[T any](name string, resolver TenantResolver, opts ...Option) Repository[T] {
+	return &tenantRepository[T]{name: name, resolver: resolver, opts: opts, ctrls: map[string]*genericObjectDBCtrl[T]{}}
+}
+
+// resolveCtrl returns the controller of the context tenant, the tenant id and its tenant field
+func (r *tenantRepository[T]) resolveCtrl(ctx context.Context) (*genericObjectDBCtrl[T], string, string, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, "", "", ErrNoTenant
+	}
+	location, err := r.resolver.Resolve(ctx, tenant, r.name)
+	if err != nil {
+		return nil, "", "", err
+	}
+	key := location.Collection.Database().Name() + "." + location.Collection.Name()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ctrl, ok := r.ctrls[key]
+	if !ok {
+		ctrl = NewGenericObjectDBCtrl[T](location.Collection, r.opts...)
+		r.ctrls[key] = ctrl
+	}
+	return ctrl, tenant, location.Field, nil
+}
+
+// resolve returns the repository of the context tenant, the tenant id and its tenant field
+func (r *tenantRepository[T]) resolve(ctx context.Context) (Repository[T], string, string, error) {
+	ctrl, tenant, field, err := r.resolveCtrl(ctx)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return AsRepository(ctrl), tenant, field, nil
+}
+
+// scope adds the tenant selector to q in shared collections
+func scope(q Query, tenant string, field string) Query {
+	if field == "" {
+		return q
+	}
+	filter := make(map[string]any, len(q.Filter)+1)
+	for k, v := range q.Filter {
+		filter[k] = v
+	}
+	filter[field] = tenant
+	q.Filter = filter
+	return q
+}
+
+// stampTenant sets the tenant field of item to tenant, or checks it if it is set
+func stampTenant[T any](item *T, tenant string, field string) error {
+	if field == "" || item == nil {
+		return nil
+	}
+	for _, f := range modelFields(reflect.TypeOf(item)) {
+		if f.BSONName != field {
+			continue
+		}
+		v := fieldByIndex(reflect.ValueOf(item).Elem(), f.Index, true)
+		if !v.IsValid() || v.Kind() != reflect.String {
+			return fmt.Errorf("failed to set tenant: %s is not a string field", field)
+		}
+		if v.String() != "" && v.String() != tenant {
+			return errors.Wrapf(ErrTenantMismatch, "%s is %s", field, v.String())
+		}
+		v.SetString(tenant)
+		return nil
+	}
+	return fmt.Errorf("failed to set tenant: model has no field %s", field)
+}
+
+func (r *tenantRepository[T]) Create(ctx context.Context, item *T) (*CreateResult, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = stampTenant(item, tenant, field); err != nil {
+		return nil, err
+	}
+	return repo.Create(ctx, item)
+}
+
+func (r *tenantRepository[T]) Get(ctx context.Context, id any) (*T, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if field == "" {
+		return repo.Get(ctx, id)
+	}
+	item, err := repo.Find(ctx, scope(Query{Filter: map[string]any{"_id": id}}, tenant, field))
+	var notFound *NotFoundError
+	if errors.As(err, &notFound) {
+		notFound.ID = id
+	}
+	return item, err
+}
+
+func (r *tenantRepository[T]) Find(ctx context.Context, q Query) (*T, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.Find(ctx, scope(q, tenant, field))
+}
+
+func (r *tenantRepository[T]) List(ctx context.Context, q Query) ([]T, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.List(ctx, scope(q, tenant, field))
+}
+
+func (r *tenantRepository[T]) Count(ctx context.Context, q Query) (int64, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return repo.Count(ctx, scope(q, tenant, field))
+}
+
+func (r *tenantRepository[T]) Update(ctx context.Context, id any, item *T) (*UpdateResult, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if field != "" {
+		if err = stampTenant(item, tenant, field); err != nil {
+			return nil, err
+		}
+		// items of other tenants are reported as missing
+		count, err := repo.Count(ctx, scope(Query{Filter: map[string]any{"_id": id}}, tenant, field))
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, &NotFoundError{Collection: r.name, ID: id}
+		}
+	}
+	return repo.Update(ctx, id, item)
+}
+
+func (r *tenantRepository[T]) UpdateAttributes(ctx context.Context, q Query, attrs map[string]any) (*UpdateResult, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := attrs[field]; ok && field != "" && value != tenant {
+		return nil, errors.Wrapf(ErrTenantMismatch, "%s set to %v", field, value)
+	}
+	return repo.UpdateAttributes(ctx, scope(q, tenant, field), attrs)
+}
+
+func (r *tenantRepository[T]) Delete(ctx context.Context, id any) (*DeleteResult, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if field == "" {
+		return repo.Delete(ctx, id)
+	}
+	result, err := repo.DeleteRange(ctx, scope(Query{Filter: map[string]any{"_id": id}}, tenant, field))
+	if err != nil {
+		return nil, err
+	}
+	if result.Deleted == 0 && writeBufferFrom(ctx) == nil {
+		return nil, &NotFoundError{Collection: r.name, ID: id}
+	}
+	return result, nil
+}
+
+func (r *tenantRepository[T]) DeleteRange(ctx context.Context, q Query) (*DeleteResult, error) {
+	repo, tenant, field, err := r.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return repo.DeleteRange(ctx, scope(q, tenant, field))
+}
+
+func (r *tenantRepository[T]) Legacy() CRUDDBService[T] {
+	return &tenantLegacy[T]{r: r}
+}
+
+// scopeSels adds the tenant selector to sels in shared collections
+func scopeSels(sels map[string]any, tenant string, field string) map[string]any {
+	return scope(Query{Filter: sels}, tenant, field).Filter
+}
+
+// tenantLegacy is the CRUDDBService of a tenant repository, scoped like its Repository methods
+type tenantLegacy[T any] struct {
+	r *tenantRepository[T]
+}
+
+func (l *tenantLegacy[T]) Create(ctx context.Context, item *T) error {
+	_, err := l.r.Create(ctx, item)
+	return err
+}
+
+func (l *tenantLegacy[T]) CreateUnique(ctx context.Context, item *T, keyFields ...string) error {
+	ctrl, tenant, field, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return err
+	}
+	if err = stampTenant(item, tenant, field); err != nil {
+		return err
+	}
+	return ctrl.CreateUnique(ctx, item, keyFields...)
+}
+
+func (l *tenantLegacy[T]) Get(ctx context.Context, id any) (*T, error) {
+	ctrl, tenant, field, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if field == "" {
+		return ctrl.Get(ctx, id)
+	}
+	return ctrl.Find(ctx, scopeSels(map[string]any{"_id": id}, tenant, field))
+}
+
+func (l *tenantLegacy[T]) Update(ctx context.Context, id any, item *T) error {
+	_, err := l.r.Update(ctx, id, item)
+	var notFound *NotFoundError
+	if errors.As(err, &notFound) {
+		// the legacy update reports an unmatched id without an error
+		return nil
+	}
+	return err
+}
+
+func (l *tenantLegacy[T]) UpdateAttributes(ctx context.Context, sels map[string]any, attrs map[string]any) error {
+	_, err := l.r.UpdateAttributes(ctx, Query{Filter: sels}, attrs)
+	return err
+}
+
+func (l *tenantLegacy[T]) UpdateAttributesBatched(ctx context.Context, job string, sels map[string]any, attrs map[string]any, batchSize int, pause time.Duration, onProgress func(updated int64)) (int64, error) {
+	ctrl, tenant, field, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if value, ok := attrs[field]; ok && field != "" && value != tenant {
+		return 0, errors.Wrapf(ErrTenantMismatch, "%s set to %v", field, value)
+	}
+	return ctrl.UpdateAttributesBatched(ctx, job, scopeSels(sels, tenant, field), attrs, batchSize, pause, onProgress)
+}
+
+func (l *tenantLegacy[T]) Delete(ctx context.Context, id any) error {
+	ctrl, tenant, field, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return err
+	}
+	if field == "" {
+		return ctrl.Delete(ctx, id)
+	}
+	return ctrl.DeleteRange(ctx, scopeSels(map[string]any{"_id": id}, tenant, field))
+}
+
+func (l *tenantLegacy[T]) DeleteRange(ctx context.Context, sels map[string]any) error {
+	ctrl, tenant, field, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return err
+	}
+	return ctrl.DeleteRange(ctx, scopeSels(sels, tenant, field))
+}
+
+func (l *tenantLegacy[T]) DeleteRangeBatched(ctx context.Context, sels map[string]any, batchSize int, pause time.Duration, onProgress func(deleted int64)) (int64, error) {
+	ctrl, tenant, field, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return ctrl.DeleteRangeBatched(ctx, scopeSels(sels, tenant, field), batchSize, pause, onProgress)
+}
+
+func (l *tenantLegacy[T]) ListAll(ctx context.Context) ([]T, error) {
+	return l.List(ctx, map[string]any{})
+}
+
+func (l *tenantLegacy[T]) Find(ctx context.Context, sels map[string]any) (*T, error) {
+	ctrl, tenant, field, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ctrl.Find(ctx, scopeSels(sels, tenant, field))
+}
+
+func (l *tenantLegacy[T]) Exists(ctx context.Context, sels map[string]any) (*T, bool, error) {
+	ctrl, tenant, field, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	return ctrl.Exists(ctx, scopeSels(sels, tenant, field))
+}
+
+func (l *tenantLegacy[T]) List(ctx context.Context, sels map[string]any) ([]T, error) {
+	ctrl, tenant, field, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ctrl.List(ctx, scopeSels(sels, tenant, field))
+}
+
+func (l *tenantLegacy[T]) CreateIndex(ctx context.Context, sels map[string]int, unique bool) (string, error) {
+	ctrl, _, _, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return "", err
+	}
+	return ctrl.CreateIndex(ctx, sels, unique)
+}
+
+func (l *tenantLegacy[T]) WarmIndexes(ctx context.Context, queries ...map[string]any) error {
+	ctrl, _, _, err := l.r.resolveCtrl(ctx)
+	if err != nil {
+		return err
+	}
+	return ctrl.WarmIndexes(ctx, queries...)
+}
@@ -0,0 +1,235 @@
+package mongodb
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TenantCollection declares that documents of the collection of Source belong to the tenant
+// whose id is in Field
+type TenantCollection struct {
+	Source CollectionSource
+	Field  string
+}
+
+// ExportTenant writes the documents of tenantID from every collection to w as one archive in the
+// format of DumpDatabase, for data portability requests and moving a tenant to another database
+// (see ImportTenant). Indexes are not exported. Collections are read one after another, so stop
+// the writes of the tenant for a consistent archive.
+// if some failed, return err
+func ExportTenant(ctx context.Context, tenantID any, w io.Writer, collections ...TenantCollection) error {
+	log.Debug("DB DEBUG: Started ExportTenant")
+	defer log.Debug("DB DEBUG: finished ExportTenant")
+	t, data, err := bson.MarshalValue(tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal tenant id: %s", err)
+	}
+	tenant := bson.RawValue{Type: t, Value: data}
+
+	bw := bufio.NewWriter(w)
+	header := dumpRecord{Version: dumpFormatVersion, CreatedAt: time.Now(), Tenant: tenant}
+	if len(collections) > 0 {
+		header.Database = collections[0].Source.Collection().Database().Name()
+	}
+	err = writeRecord(bw, header)
+	if err != nil {
+		return err
+	}
+	for _, tc := range collections {
+		collection := tc.Source.Collection()
+		err = writeRecord(bw, dumpRecord{Collection: collection.Name(), Field: tc.Field})
+		if err != nil {
+			return err
+		}
+		cursor, err := collection.Find(ctx, bson.D{{Key: tc.Field, Value: tenant}})
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %s", collection.Name(), err)
+		}
+		trackCursor(cursor)
+		for cursor.Next(ctx) {
+			err = writeRecord(bw, dumpRecord{Collection: collection.Name(), Document: cursor.Current})
+			if err != nil {
+				closeCursor(cursor)
+				return err
+			}
+		}
+		err = cursorErr(ctx, cursor)
+		closeCursor(cursor)
+		if err != nil {
+			return fmt.Errorf("failed to export %s: %s", collection.Name(), err)
+		}
+	}
+	return bw.Flush()
+}
+
+// ImportTenant inserts the documents of an archive written by ExportTenant into the collections
+// of the same names in db, returns the tenant id and the number of documents imported. With
+// replace the documents of the tenant already in those collections are deleted first, otherwise
+// existing _ids fail the import. The archive is read and checked completely, spooled to a
+// temporary file, before anything is deleted or inserted, so a truncated archive, documents of
+// another tenant or _ids taken by other documents leave the collections untouched.
+// if a document of the archive belongs to another tenant or its _id is taken, return err
+// if some failed, return err
+func ImportTenant(ctx context.Context, db *mongo.Database, r io.Reader, replace bool) (_ any, _ int64, err error) {
+	log.Debug("DB DEBUG: Started ImportTenant")
+	defer log.Debug("DB DEBUG: finished ImportTenant")
+	if err = checkWritable(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	br := bufio.NewReader(r)
+	var header dumpRecord
+	err = readRecord(br, &header)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read archive header: %s", err)
+	}
+	if header.Version != dumpFormatVersion || header.Tenant.Type == 0 {
+		return nil, 0, fmt.Errorf("unsupported tenant archive version %d", header.Version)
+	}
+	var tenantID any
+	err = header.Tenant.Unmarshal(&tenantID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	spool, err := os.CreateTemp("", "tenant-import-*")
+	if err != nil {
+		return tenantID, 0, err
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+	err = checkTenantArchive(ctx, db, br, spool, header.Tenant, replace)
+	if err != nil {
+		return tenantID, 0, err
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return tenantID, 0, err
+	}
+
+	var imported int64
+	batches := map[string][]any{}
+	flush := func(name string) error {
+		if len(batches[name]) == 0 {
+			return nil
+		}
+		res, err := db.Collection(name).InsertMany(ctx, batches[name])
+		if res != nil {
+			imported += int64(len(res.InsertedIDs))
+		}
+		batches[name] = batches[name][:0]
+		return err
+	}
+
+	sr := bufio.NewReader(spool)
+	for {
+		var record dumpRecord
+		err = readRecord(sr, &record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return tenantID, imported, err
+		}
+		name := record.Collection
+		if record.Document == nil {
+			if replace {
+				_, err = db.Collection(name).DeleteMany(ctx, bson.D{{Key: record.Field, Value: header.Tenant}})
+				if err != nil {
+					return tenantID, imported, err
+				}
+			}
+			continue
+		}
+		batches[name] = append(batches[name], record.Document)
+		if len(batches[name]) >= restoreBatchSize {
+			if err = flush(name); err != nil {
+				return tenantID, imported, err
+			}
+		}
+	}
+
+	for name := range batches {
+		if err = flush(name); err != nil {
+			return tenantID, imported, err
+		}
+	}
+	return tenantID, imported, nil
+}
+
+// checkTenantArchive copies the records of the archive after the header from r to spool, checking
+// that every document belongs to tenant and that its _id is not taken by a document in db, of
+// another tenant with replace
+func checkTenantArchive(ctx context.Context, db *mongo.Database, r io.Reader, spool io.Writer, tenant bson.RawValue, replace bool) error {
+	key := refKey(tenant)
+	fields := map[string]string{}
+	ids := map[string][]any{}
+	checkIDs := func(name string) error {
+		if len(ids[name]) == 0 {
+			return nil
+		}
+		filter := bson.M{"_id": bson.M{"$in": ids[name]}}
+		if replace {
+			filter[fields[name]] = bson.M{"$ne": tenant}
+		}
+		count, err := db.Collection(name).CountDocuments(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return fmt.Errorf("failed to import %s: %d _ids are taken", name, count)
+		}
+		ids[name] = ids[name][:0]
+		return nil
+	}
+
+	w := bufio.NewWriter(spool)
+	for {
+		var record dumpRecord
+		err := readRecord(r, &record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %s", err)
+		}
+		name := record.Collection
+		if record.Document == nil {
+			fields[name] = record.Field
+		} else {
+			field, ok := fields[name]
+			if !ok {
+				return fmt.Errorf("failed to import %s: documents before the collection record", name)
+			}
+			value, err := record.Document.LookupErr(strings.Split(field, ".")...)
+			if err != nil || refKey(value) != key {
+				return fmt.Errorf("failed to import %s: document of another tenant", name)
+			}
+			ids[name] = append(ids[name], record.Document.Lookup("_id"))
+			if len(ids[name]) >= restoreBatchSize {
+				if err = checkIDs(name); err != nil {
+					return err
+				}
+			}
+		}
+		if err = writeRecord(w, record); err != nil {
+			return err
+		}
+	}
+	for name := range ids {
+		if err := checkIDs(name); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,87 @@
+package mongodb
+
+import (
+	"reflect"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var dateTimeType = reflect.TypeOf(primitive.DateTime(0))
+
+// timestampField returns the field named name (e.g. "CreatedAt") of T, also found in embedded structs,
+// when its type can hold a time: time.Time, primitive.DateTime, types convertible from time.Time
+// and pointers to them
+func timestampField[T any](name string) (modelField, bool) {
+	for _, f := range modelFields(reflect.TypeOf((*T)(nil))) {
+		if f.Name != name {
+			continue
+		}
+		t := f.Type
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t == dateTimeType || timeType.ConvertibleTo(t) {
+			return f, true
+		}
+	}
+	return modelField{}, false
+}
+
+// setTimestamp stores now into the timestamp field name of item
+func setTimestamp[T any](item *T, name string, now time.Time) {
+	f, ok := timestampField[T](name)
+	if !ok {
+		return
+	}
+	field := fieldByIndex(reflect.ValueOf(item).Elem(), f.Index, true)
+	if !field.IsValid() || !field.CanSet() {
+		return
+	}
+
+	target := field.Type()
+	if target.Kind() == reflect.Pointer {
+		value := reflect.New(target.Elem())
+		value.Elem().Set(timeValue(now, target.Elem()))
+		field.Set(value)
+		return
+	}
+	field.Set(timeValue(now, target))
+}
+
+// getTimestamp returns the value of the timestamp field name of item
+func getTimestamp[T any](item *T, name string) (time.Time, bool) {
+	f, ok := timestampField[T](name)
+	if !ok {
+		return time.Time{}, false
+	}
+	field := fieldByIndex(reflect.ValueOf(item).Elem(), f.Index, false)
+	if !field.IsValid() {
+		return time.Time{}, false
+	}
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return time.Time{}, false
+		}
+		field = field.Elem()
+	}
+	if field.Type() == dateTimeType {
+		return field.Interface().(primitive.DateTime).Time(), true
+	}
+	return field.Convert(timeType).Interface().(time.Time), true
+}
+
+func timeValue(now time.Time, t reflect.Type) reflect.Value {
+	if t == dateTimeType {
+		return reflect.ValueOf(primitive.NewDateTimeFromTime(now))
+	}
+	return reflect.ValueOf(now).Convert(t)
+}
+
+// updatedAtKey returns the key the UpdatedAt field of T is stored under, "updated_at" when T has none
+func updatedAtKey[T any]() string {
+	if f, ok := timestampField[T]("UpdatedAt"); ok {
+		return f.BSONName
+	}
+	return "updated_at"
+}
@@ -0,0 +1,137 @@
+package mongodb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+// TopologyEventKind is the kind of a cluster membership change
+type TopologyEventKind string
+
+const (
+	// ServerAdded is emitted when a server joins the topology, e.g. a new SRV record or replica set member
+	ServerAdded TopologyEventKind = "server_added"
+	// ServerRemoved is emitted when a server leaves the topology
+	ServerRemoved TopologyEventKind = "server_removed"
+	// PrimaryChanged is emitted on elections and stepdowns, Address is empty while there is no primary
+	PrimaryChanged TopologyEventKind = "primary_changed"
+)
+
+// topologyEventsBuffer is the number of events queued for slow subscribers before events are dropped
+const topologyEventsBuffer = 256
+
+// TopologyEvent is a cluster membership change observed by the driver
+type TopologyEvent struct {
+	Kind    TopologyEventKind
+	Address string
+	// Previous is the previous primary address of PrimaryChanged
+	Previous string
+	At       time.Time
+}
+
+// topologyFeed fans topology events out to subscribers outside of the driver monitor callback
+type topologyFeed struct {
+	mu          sync.Mutex
+	subscribers map[int]func(TopologyEvent)
+	nextID      int
+	events      chan TopologyEvent
+}
+
+// Subscribe registers fn to receive topology change events of the connection in order.
+// fn is called from a single dispatcher goroutine, a slow fn delays later events and
+// events beyond the buffer are dropped. Servers discovered by the client created on Reconnect
+// are reported as added.
+// Note: a ServerMonitor passed in ConnectConfig.ClientOptions replaces the one feeding the events.
+func (c *Conn) Subscribe(fn func(TopologyEvent)) (unsubscribe func()) {
+	c.topology.mu.Lock()
+	defer c.topology.mu.Unlock()
+	if c.topology.subscribers == nil {
+		c.topology.subscribers = map[int]func(TopologyEvent){}
+	}
+	id := c.topology.nextID
+	c.topology.nextID++
+	c.topology.subscribers[id] = fn
+	return func() {
+		c.topology.mu.Lock()
+		defer c.topology.mu.Unlock()
+		delete(c.topology.subscribers, id)
+	}
+}
+
+// serverMonitor returns the driver monitor translating topology descriptions into events
+func (c *Conn) serverMonitor() *event.ServerMonitor {
+	return &event.ServerMonitor{
+		TopologyDescriptionChanged: func(e *event.TopologyDescriptionChangedEvent) {
+			for _, te := range diffTopology(e.PreviousDescription, e.NewDescription) {
+				select {
+				case c.topology.events <- te:
+				default:
+					log.Warnf("DB WARN: topology event %s %s dropped", te.Kind, te.Address)
+				}
+			}
+		},
+	}
+}
+
+// dispatchTopology delivers queued events to subscribers until the connection is closed
+func (c *Conn) dispatchTopology() {
+	defer c.done.Done()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case te := <-c.topology.events:
+			c.topology.mu.Lock()
+			subscribers := make([]func(TopologyEvent), 0, len(c.topology.subscribers))
+			for _, fn := range c.topology.subscribers {
+				subscribers = append(subscribers, fn)
+			}
+			c.topology.mu.Unlock()
+			for _, fn := range subscribers {
+				fn(te)
+			}
+		}
+	}
+}
+
+// diffTopology returns the membership changes between two topology descriptions
+func diffTopology(prev, next description.Topology) []TopologyEvent {
+	now := time.Now()
+	var events []TopologyEvent
+
+	prevServers := map[string]bool{}
+	for _, s := range prev.Servers {
+		prevServers[s.Addr.String()] = true
+	}
+	nextServers := map[string]bool{}
+	for _, s := range next.Servers {
+		addr := s.Addr.String()
+		nextServers[addr] = true
+		if !prevServers[addr] {
+			events = append(events, TopologyEvent{Kind: ServerAdded, Address: addr, At: now})
+		}
+	}
+	for _, s := range prev.Servers {
+		if addr := s.Addr.String(); !nextServers[addr] {
+			events = append(events, TopologyEvent{Kind: ServerRemoved, Address: addr, At: now})
+		}
+	}
+
+	if prevPrimary, nextPrimary := primaryOf(prev), primaryOf(next); prevPrimary != nextPrimary {
+		events = append(events, TopologyEvent{Kind: PrimaryChanged, Address: nextPrimary, Previous: prevPrimary, At: now})
+	}
+	return events
+}
+
+func primaryOf(t description.Topology) string {
+	for _, s := range t.Servers {
+		if s.Kind == description.RSPrimary {
+			return s.Addr.String()
+		}
+	}
+	return ""
+}
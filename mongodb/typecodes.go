@@ -0,0 +1,193 @@
+package mongodb
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// typeCodes maps type codes to the struct types implementing an interface
+type typeCodes struct {
+	iface reflect.Type
+
+	mu     sync.RWMutex
+	byCode map[string]reflect.Type
+	byType map[reflect.Type]string
+}
+
+func newTypeCodes(iface reflect.Type) *typeCodes {
+	return &typeCodes{iface: iface, byCode: map[string]reflect.Type{}, byType: map[reflect.Type]string{}}
+}
+
+// register maps code to t, t or *t must implement the interface
+func (tc *typeCodes) register(code string, t reflect.Type) error {
+	if !t.AssignableTo(tc.iface) && !reflect.PointerTo(t).AssignableTo(tc.iface) {
+		return fmt.Errorf("failed to register %s: %s does not implement %s", code, t, tc.iface)
+	}
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if _, ok := tc.byCode[code]; ok {
+		return fmt.Errorf("failed to register %s: code already registered", code)
+	}
+	if _, ok := tc.byType[t]; ok {
+		return fmt.Errorf("failed to register %s: %s already registered", code, t)
+	}
+	tc.byCode[code] = t
+	tc.byType[t] = code
+	return nil
+}
+
+// codeOf returns the code of the type of v, pointers are dereferenced
+func (tc *typeCodes) codeOf(v any) (string, bool) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return tc.codeOfType(t)
+}
+
+func (tc *typeCodes) codeOfType(t reflect.Type) (string, bool) {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	code, ok := tc.byType[t]
+	return code, ok
+}
+
+// codes returns the registered codes
+func (tc *typeCodes) codes() []string {
+	tc.mu.RLock()
+	defer tc.mu.RUnlock()
+	codes := make([]string, 0, len(tc.byCode))
+	for code := range tc.byCode {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// newValue returns a new value of the type t of code to decode into (ptr) and its value assignable
+// to the interface, which is t when t implements it and *t otherwise
+func (tc *typeCodes) newValue(code string) (ptr reflect.Value, value reflect.Value, ok bool) {
+	tc.mu.RLock()
+	t, ok := tc.byCode[code]
+	tc.mu.RUnlock()
+	if !ok {
+		return reflect.Value{}, reflect.Value{}, false
+	}
+	ptr = reflect.New(t)
+	if t.AssignableTo(tc.iface) {
+		return ptr, ptr.Elem(), true
+	}
+	return ptr, ptr, true
+}
+
+// InterfaceTypes makes struct fields declared as interface I persistable: values are stored as
+// documents of their concrete type with a type tag field and decoded back into that type.
+// Implementations must encode to documents. Register implementations with RegisterImplementation
+// and the codec with WithInterfaceTypes or Register.
+type InterfaceTypes[I any] struct {
+	field string
+	codes *typeCodes
+}
+
+// NewInterfaceTypes creates an empty set of implementations of I tagged in field, DefaultDiscriminator when empty
+func NewInterfaceTypes[I any](field string) *InterfaceTypes[I] {
+	if field == "" {
+		field = DefaultDiscriminator
+	}
+	return &InterfaceTypes[I]{field: field, codes: newTypeCodes(reflect.TypeOf((*I)(nil)).Elem())}
+}
+
+// RegisterImplementation registers struct type V (stored with tag) as an implementation of I,
+// V or *V must implement I
+// if tag or V are already registered or V does not implement I, return err
+func RegisterImplementation[I any, V any](types *InterfaceTypes[I], tag string) error {
+	return types.codes.register(tag, reflect.TypeOf((*V)(nil)).Elem())
+}
+
+// WithInterfaceTypes registers the codec of types in the controller registry
+func WithInterfaceTypes[I any](types *InterfaceTypes[I]) Option {
+	return func(o *ctrlOptions) {
+		o.registryHooks = append(o.registryHooks, types.Register)
+	}
+}
+
+// Register registers the encoder and decoder of fields declared as I in registry
+func (it *InterfaceTypes[I]) Register(registry *bsoncodec.Registry) {
+	t := reflect.TypeOf((*I)(nil)).Elem()
+	registry.RegisterTypeEncoder(t, bsoncodec.ValueEncoderFunc(it.encodeValue))
+	registry.RegisterTypeDecoder(t, bsoncodec.ValueDecoderFunc(it.decodeValue))
+}
+
+func (it *InterfaceTypes[I]) encodeValue(ec bsoncodec.EncodeContext, vw bsonrw.ValueWriter, val reflect.Value) error {
+	if !val.IsValid() || val.IsNil() {
+		return vw.WriteNull()
+	}
+	concrete := val.Elem().Interface()
+	tag, ok := it.codes.codeOf(concrete)
+	if !ok {
+		return fmt.Errorf("failed to encode %T: implementation of %s not registered", concrete, it.codes.iface)
+	}
+	data, err := bson.MarshalWithRegistry(ec.Registry, concrete)
+	if err != nil {
+		return err
+	}
+	elements, err := bson.Raw(data).Elements()
+	if err != nil {
+		return err
+	}
+
+	dw, err := vw.WriteDocument()
+	if err != nil {
+		return err
+	}
+	tagWriter, err := dw.WriteDocumentElement(it.field)
+	if err != nil {
+		return err
+	}
+	err = tagWriter.WriteString(tag)
+	if err != nil {
+		return err
+	}
+	for _, e := range elements {
+		if e.Key() == it.field {
+			continue
+		}
+		ew, err := dw.WriteDocumentElement(e.Key())
+		if err != nil {
+			return err
+		}
+		err = bsonrw.Copier{}.CopyValueFromBytes(ew, e.Value().Type, e.Value().Value)
+		if err != nil {
+			return err
+		}
+	}
+	return dw.WriteDocumentEnd()
+}
+
+func (it *InterfaceTypes[I]) decodeValue(dc bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	if vr.Type() == bsontype.Null {
+		val.Set(reflect.Zero(val.Type()))
+		return vr.ReadNull()
+	}
+	data, err := bsonrw.Copier{}.CopyDocumentToBytes(vr)
+	if err != nil {
+		return err
+	}
+	raw := bson.Raw(data)
+	tag, _ := raw.Lookup(it.field).StringValueOK()
+	ptr, value, ok := it.codes.newValue(tag)
+	if !ok {
+		return fmt.Errorf("failed to decode %s: unknown %s %q", it.codes.iface, it.field, tag)
+	}
+	err = bson.UnmarshalWithRegistry(dc.Registry, raw, ptr.Interface())
+	if err != nil {
+		return err
+	}
+	val.Set(value)
+	return nil
+}
@@ -0,0 +1,126 @@
+package mongodb
+
+import (
+	"context"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CreateUnique creates item ensuring no other item has the same values of keyFields (natural key).
+// The unique index on keyFields is created if missing, once per controller and key. It is part
+// of the insert, so it is not subject to WithMaintenanceWindow; create it at setup with
+// CreateIndex to build it inside the window.
+// if keyFields is empty, return ErrInvalidQuery
+// if an item with the same key exists, return *AlreadyExistsError (errors.Is ErrAlreadyExists)
+// if some failed, e.g. another unique index or _id is violated, return err
+func (c *genericObjectDBCtrl[T]) CreateUnique(ctx context.Context, item *T, keyFields ...string) (err error) {
+	defer c.recoverPanic(ctx, "CreateUnique", &err)
+	log.Debug("DB DEBUG: Started c.CreateUnique")
+	defer log.Debug("DB DEBUG: finished c.CreateUnique")
+
+	if len(keyFields) == 0 {
+		return errors.Wrap(ErrInvalidQuery, "CreateUnique without key fields")
+	}
+	index, err := c.ensureUniqueIndex(ctx, keyFields)
+	if err != nil {
+		return err
+	}
+
+	err = c.Create(c.nested(ctx), item)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) && duplicateOfIndex(err, index, keyFields) {
+			return &AlreadyExistsError{Key: keyValues(item, keyFields)}
+		}
+		return err
+	}
+	return nil
+}
+
+// ensureUniqueIndex creates the unique index on keyFields unless this controller already did,
+// returns the index name
+func (c *genericObjectDBCtrl[T]) ensureUniqueIndex(ctx context.Context, keyFields []string) (string, error) {
+	key := strings.Join(keyFields, ",")
+	if name, done := c.uniqueIndexes.Load(key); done {
+		return name.(string), nil
+	}
+	keys := bson.D{}
+	for _, field := range keyFields {
+		keys = append(keys, bson.E{Key: field, Value: 1})
+	}
+	ddlCtx, cancel, _ := c.begin(ctx, opDDL)
+	defer cancel()
+	name, err := c.db.Indexes().CreateOne(ddlCtx, mongo.IndexModel{
+		Keys:    keys,
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return "", err
+	}
+	c.uniqueIndexes.Store(key, name)
+	return name, nil
+}
+
+// duplicateOfIndex reports whether the duplicate key error err violates the unique index name on
+// keyFields, by the key pattern the server reports or else by the index name in the message
+func duplicateOfIndex(err error, name string, keyFields []string) bool {
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		for _, e := range writeErr.WriteErrors {
+			if duplicateIndexMatches(e.Raw, e.Message, name, keyFields) {
+				return true
+			}
+		}
+		return false
+	}
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) {
+		return duplicateIndexMatches(cmdErr.Raw, cmdErr.Message, name, keyFields)
+	}
+	return false
+}
+
+func duplicateIndexMatches(raw bson.Raw, message string, name string, keyFields []string) bool {
+	if pattern, err := raw.LookupErr("keyPattern"); err == nil {
+		doc, ok := pattern.DocumentOK()
+		if !ok {
+			return false
+		}
+		elements, err := doc.Elements()
+		if err != nil || len(elements) != len(keyFields) {
+			return false
+		}
+		for i, e := range elements {
+			if e.Key() != keyFields[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return strings.Contains(message, " index: "+name+" dup key")
+}
+
+// keyValues extracts the values of dotted keyFields from the bson representation of item
+func keyValues(item any, keyFields []string) map[string]any {
+	key := make(map[string]any, len(keyFields))
+	raw, err := bson.Marshal(item)
+	if err != nil {
+		return key
+	}
+	for _, field := range keyFields {
+		value, err := bson.Raw(raw).LookupErr(strings.Split(field, ".")...)
+		if err != nil {
+			key[field] = nil
+			continue
+		}
+		var v any
+		if err = value.Unmarshal(&v); err == nil {
+			key[field] = v
+		}
+	}
+	return key
+}
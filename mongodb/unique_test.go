@@ -0,0 +1,54 @@
+package mongodb
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestDuplicateOfIndex(t *testing.T) {
+	writeErr := func(raw bson.D, message string) error {
+		data, err := bson.Marshal(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: message, Raw: data}}}
+	}
+	keyFields := []string{"tenant", "email"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "key pattern",
+			err:  writeErr(bson.D{{Key: "code", Value: 11000}, {Key: "keyPattern", Value: bson.D{{Key: "tenant", Value: 1}, {Key: "email", Value: 1}}}}, ""),
+			want: true,
+		},
+		{
+			name: "_id",
+			err:  writeErr(bson.D{{Key: "code", Value: 11000}, {Key: "keyPattern", Value: bson.D{{Key: "_id", Value: 1}}}}, ""),
+		},
+		{
+			name: "other index",
+			err:  writeErr(bson.D{{Key: "code", Value: 11000}, {Key: "keyPattern", Value: bson.D{{Key: "email", Value: 1}}}}, ""),
+		},
+		{
+			name: "index name in message",
+			err:  writeErr(bson.D{{Key: "code", Value: 11000}}, `E11000 duplicate key error collection: db.users index: tenant_1_email_1 dup key: { tenant: "a", email: "b" }`),
+			want: true,
+		},
+		{
+			name: "other index name in message",
+			err:  writeErr(bson.D{{Key: "code", Value: 11000}}, `E11000 duplicate key error collection: db.users index: _id_ dup key: { _id: 1 }`),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := duplicateOfIndex(tt.err, "tenant_1_email_1", keyFields); got != tt.want {
+				t.Errorf("duplicateOfIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
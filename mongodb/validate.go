@@ -0,0 +1,184 @@
+package mongodb
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Validator is implemented by models that validate themselves before writes
+type Validator interface {
+	Validate() error
+}
+
+// EnumError is returned when a field tagged with `mgenum:"a,b,c"` holds a value outside the allowed list
+type EnumError struct {
+	Field   string
+	Value   any
+	Allowed []string
+}
+
+func (e *EnumError) Error() string {
+	return fmt.Sprintf("field %s has value %v, allowed values: %s", e.Field, e.Value, strings.Join(e.Allowed, ", "))
+}
+
+// validateItem runs the write validation hook: tag checks of the model and Validator
+func validateItem(item any) error {
+	v := reflect.ValueOf(item)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return nil
+	}
+
+	for _, f := range modelFields(v.Type()) {
+		field := fieldByIndex(v.Elem(), f.Index, false)
+		if !field.IsValid() {
+			continue
+		}
+		if err := checkEnum(f, field); err != nil {
+			return err
+		}
+		if err := checkDimension(f, field); err != nil {
+			return err
+		}
+	}
+
+	if validator, ok := item.(Validator); ok {
+		return validator.Validate()
+	}
+	return nil
+}
+
+// validateAttrs checks attrs of UpdateAttributes against the tags of the model fields they address
+func validateAttrs[T any](attrs map[string]any) error {
+	fields := modelFields(reflect.TypeOf((*T)(nil)))
+	for _, f := range fields {
+		value, ok := attrs[f.BSONName]
+		if !ok || value == nil {
+			continue
+		}
+		if err := checkEnum(f, reflect.ValueOf(value)); err != nil {
+			return err
+		}
+		if err := checkDimension(f, reflect.ValueOf(value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEnum validates v against the `mgenum` tag of f, zero values are treated as unset
+func checkEnum(f modelField, v reflect.Value) error {
+	tag, ok := f.Tag.Lookup("mgenum")
+	if !ok {
+		return nil
+	}
+	allowed := strings.Split(tag, ",")
+
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			if err := checkEnumValue(f, v.Index(i), allowed); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return checkEnumValue(f, v, allowed)
+}
+
+func checkEnumValue(f modelField, v reflect.Value, allowed []string) error {
+	if v.IsZero() {
+		return nil
+	}
+	value := fmt.Sprint(v.Interface())
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return &EnumError{Field: f.BSONName, Value: v.Interface(), Allowed: allowed}
+}
+
+// ImmutableFieldError is returned when UpdateAttributes addresses a field tagged with `mgimmutable:"true"`
+type ImmutableFieldError struct {
+	Field string
+}
+
+func (e *ImmutableFieldError) Error() string {
+	return fmt.Sprintf("field %s is immutable", e.Field)
+}
+
+// immutableFields returns bson names of the fields of T tagged with `mgimmutable:"true"`
+func immutableFields[T any]() []string {
+	var names []string
+	for _, f := range modelFields(reflect.TypeOf((*T)(nil))) {
+		if f.Tag.Get("mgimmutable") == "true" {
+			names = append(names, f.BSONName)
+		}
+	}
+	return names
+}
+
+// checkImmutable rejects attrs addressing immutable fields of T, including their nested paths
+func checkImmutable[T any](attrs map[string]any) error {
+	for key := range attrs {
+		if err := checkImmutablePath[T](key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkImmutablePath rejects the dot path when writing it would change an immutable field of T,
+// i.e. it is the field, inside it or a document containing it
+func checkImmutablePath[T any](path string) error {
+	for _, name := range immutableFields[T]() {
+		if path == name || strings.HasPrefix(path, name+".") || strings.HasPrefix(name, path+".") {
+			return &ImmutableFieldError{Field: path}
+		}
+	}
+	return nil
+}
+
+// stripImmutable removes the immutable fields of T from the $set document update. A document
+// containing a nested immutable field is set field by field instead, so the field keeps its stored value.
+func stripImmutable[T any](update bson.M) {
+	for _, name := range immutableFields[T]() {
+		stripPath(update, "", strings.Split(name, "."))
+	}
+}
+
+func stripPath(update bson.M, prefix string, path []string) {
+	key := prefix + path[0]
+	if len(path) == 1 {
+		delete(update, key)
+		return
+	}
+	value, ok := update[key]
+	if ok {
+		delete(update, key)
+		var doc bson.D
+		switch v := value.(type) {
+		case bson.M:
+			for k, e := range v {
+				doc = append(doc, bson.E{Key: k, Value: e})
+			}
+		case bson.D:
+			doc = v
+		default:
+			// not a document, e.g. null: the stored one is kept
+			return
+		}
+		for _, e := range doc {
+			update[key+"."+e.Key] = e.Value
+		}
+	}
+	stripPath(update, key+".", path[1:])
+}
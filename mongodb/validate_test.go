@@ -0,0 +1,61 @@
+package mongodb
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Audit is embedded under its own key, so its immutable fields have dotted paths
+type Audit struct {
+	CreatedBy string `bson:"created_by" mgimmutable:"true"`
+	Source    string `bson:"source" mgimmutable:"true"`
+	Note      string `bson:"note"`
+}
+
+type immutableModel struct {
+	ID    string `bson:"_id" mgimmutable:"true"`
+	Name  string `bson:"name"`
+	Audit `bson:"audit"`
+}
+
+func TestStripImmutable(t *testing.T) {
+	data, err := bson.Marshal(immutableModel{ID: "1", Name: "n", Audit: Audit{CreatedBy: "x", Source: "s", Note: "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var update bson.M
+	if err = bson.Unmarshal(data, &update); err != nil {
+		t.Fatal(err)
+	}
+	stripImmutable[immutableModel](update)
+
+	want := map[string]any{"name": "n", "audit.note": "y"}
+	if !reflect.DeepEqual(map[string]any(update), want) {
+		t.Errorf("stripImmutable() = %v, want %v", update, want)
+	}
+}
+
+func TestCheckImmutablePath(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: "name"},
+		{path: "audit.note"},
+		{path: "_id", wantErr: true},
+		{path: "audit.created_by", wantErr: true},
+		{path: "audit.created_by.x", wantErr: true},
+		{path: "audit", wantErr: true},
+		{path: "audit_x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := checkImmutablePath[immutableModel](tt.path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkImmutablePath(%q) = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
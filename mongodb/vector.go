@@ -0,0 +1,169 @@
+package mongodb
+
+import (
+	"context"
+	"math"
+	"reflect"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// server error codes meaning $vectorSearch is not available on the deployment
+var vectorSearchUnsupportedCodes = []int{
+	40324, // Unrecognized pipeline stage name
+	31082, // SearchNotEnabled
+}
+
+// VectorIndexName returns the name of the vector search index CreateVectorIndex creates for field
+func VectorIndexName(field string) string {
+	return field + "_vector"
+}
+
+// CreateVectorIndex creates the Atlas vector search index for field holding vectors of dimensions
+// with similarity "cosine", "euclidean" or "dotProduct". filterFields are indexed for the
+// VectorSearch pre-filter.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) CreateVectorIndex(ctx context.Context, field string, dimensions int, similarity string, filterFields ...string) (_ string, err error) {
+	defer c.recoverPanic(ctx, "CreateVectorIndex", &err)
+	err = c.guardDDL(ctx, "createSearchIndex")
+	if err != nil {
+		return "", err
+	}
+	err = c.requireFeature(FeatureAtlasSearch)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel, _ := c.begin(ctx, opDDL)
+	defer cancel()
+	fields := bson.A{bson.M{
+		"type":          "vector",
+		"path":          field,
+		"numDimensions": dimensions,
+		"similarity":    similarity,
+	}}
+	for _, f := range filterFields {
+		fields = append(fields, bson.M{"type": "filter", "path": f})
+	}
+
+	return c.db.SearchIndexes().CreateOne(ctx, mongo.SearchIndexModel{
+		Definition: bson.M{"fields": fields},
+		Options:    options.SearchIndexes().SetName(VectorIndexName(field)).SetType("vectorSearch"),
+	})
+}
+
+// defaultVectorK is the number of items VectorSearch finds when k is not set
+const defaultVectorK = 10
+
+// VectorSearch finds k items (10 if k <= 0) nearest to queryVector in field, filtered by sels.
+// It uses $vectorSearch with the index created by CreateVectorIndex. On self-hosted deployments
+// without vector search it falls back to exact cosine similarity computed by an aggregation,
+// which scans all items matched by sels and requires field to be stored as an array.
+// Scores follow the Atlas cosine normalization (1 + cos) / 2 in both modes.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) VectorSearch(ctx context.Context, field string, queryVector []float32, k int, sels map[string]any) (_ []SearchResult[T], err error) {
+	defer c.recoverPanic(ctx, "VectorSearch", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $vectorSearch)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $vectorSearch)")
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+	if k <= 0 {
+		k = defaultVectorK
+	}
+
+	if f, ok := declaredDimension[T](field); ok {
+		if err := checkDimension(f, reflect.ValueOf(queryVector)); err != nil {
+			return nil, err
+		}
+	}
+
+	if !c.opts.compat.Supports(FeatureAtlasSearch) {
+		return c.exactVectorSearch(ctx, field, queryVector, k, sels)
+	}
+	search := bson.M{
+		"index":         VectorIndexName(field),
+		"path":          field,
+		"queryVector":   queryVector,
+		"numCandidates": k * 10,
+		"limit":         k,
+	}
+	if len(sels) > 0 {
+		search["filter"] = filterFromSels(sels)
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$vectorSearch", Value: search}},
+		{{Key: "$addFields", Value: bson.M{"_score": bson.M{"$meta": "vectorSearchScore"}}}},
+	}
+
+	cursor, err := c.reader().Aggregate(ctx, pipeline)
+	if err != nil {
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && hasAnyCode(serverErr, vectorSearchUnsupportedCodes) {
+			log.Debugf("DB DEBUG: $vectorSearch unsupported, falling back to exact search: %s", err)
+			return c.exactVectorSearch(ctx, field, queryVector, k, sels)
+		}
+		return nil, err
+	}
+	return c.decodeSearchResults(ctx, trackCursor(cursor))
+}
+
+// exactVectorSearch computes cosine similarity of every item matched by sels on the server
+func (c *genericObjectDBCtrl[T]) exactVectorSearch(ctx context.Context, field string, queryVector []float32, k int, sels map[string]any) ([]SearchResult[T], error) {
+	var queryNorm float64
+	query := make(bson.A, len(queryVector))
+	for i, x := range queryVector {
+		queryNorm += float64(x) * float64(x)
+		query[i] = x
+	}
+	queryNorm = math.Sqrt(queryNorm)
+
+	path := "$" + field
+	indexes := bson.M{"$range": bson.A{0, bson.M{"$size": path}}}
+	dot := bson.M{"$reduce": bson.M{
+		"input":        indexes,
+		"initialValue": 0,
+		"in": bson.M{"$add": bson.A{"$$value", bson.M{"$multiply": bson.A{
+			bson.M{"$arrayElemAt": bson.A{path, "$$this"}},
+			bson.M{"$arrayElemAt": bson.A{query, "$$this"}},
+		}}}},
+	}}
+	norm := bson.M{"$sqrt": bson.M{"$reduce": bson.M{
+		"input":        path,
+		"initialValue": 0,
+		"in":           bson.M{"$add": bson.A{"$$value", bson.M{"$multiply": bson.A{"$$this", "$$this"}}}},
+	}}}
+	denominator := bson.M{"$multiply": bson.A{norm, queryNorm}}
+	cosine := bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{denominator, 0}},
+		0,
+		bson.M{"$divide": bson.A{dot, denominator}},
+	}}
+
+	filter := filterFromSels(sels)
+	filter = append(filter, bson.E{Key: field, Value: bson.M{"$type": "array", "$size": len(queryVector)}})
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$addFields", Value: bson.M{"_score": bson.M{"$divide": bson.A{bson.M{"$add": bson.A{1, cosine}}, 2}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_score", Value: -1}}}},
+		{{Key: "$limit", Value: k}},
+	}
+
+	cursor, err := c.reader().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	return c.decodeSearchResults(ctx, trackCursor(cursor))
+}
+
+func hasAnyCode(err mongo.ServerError, codes []int) bool {
+	for _, code := range codes {
+		if err.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WarmIndexes touches every index of the collection to load it into the server cache,
+// then runs the representative queries once so their plans get cached.
+// Text and geo indexes can't be hinted with an arbitrary filter and are skipped.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) WarmIndexes(ctx context.Context, queries ...map[string]any) (err error) {
+	defer c.recoverPanic(ctx, "WarmIndexes", &err)
+	log.Debug("DB DEBUG: Started c.WarmIndexes(ctx)")
+	defer log.Debug("DB DEBUG: finished c.WarmIndexes(ctx)")
+	ctx, cancel, _ := c.begin(ctx, opDDL)
+	defer cancel()
+
+	cursor, err := c.db.Indexes().List(ctx)
+	if err != nil {
+		return err
+	}
+	var indexes []struct {
+		Name          string   `bson:"name"`
+		Key           bson.D   `bson:"key"`
+		PartialFilter bson.Raw `bson:"partialFilterExpression,omitempty"`
+	}
+	err = cursor.All(ctx, &indexes)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if !hintable(index.Key) {
+			log.Debugf("DB DEBUG: skip warming index %s", index.Name)
+			continue
+		}
+		var filter any = bson.D{}
+		if index.PartialFilter != nil {
+			filter = index.PartialFilter
+		}
+		_, err = c.db.CountDocuments(ctx, filter, options.Count().SetHint(index.Name))
+		if err != nil {
+			return fmt.Errorf("failed to warm index %s: %s", index.Name, err)
+		}
+	}
+
+	for _, sels := range queries {
+		cursor, err := c.db.Find(ctx, filterFromSels(sels), options.Find().SetLimit(1))
+		if err != nil {
+			return fmt.Errorf("failed to warm query %v: %s", sels, err)
+		}
+		closeCursor(cursor)
+	}
+
+	return nil
+}
+
+func hintable(keys bson.D) bool {
+	for _, key := range keys {
+		if kind, ok := key.Value.(string); ok && kind != "hashed" {
+			return false
+		}
+	}
+	return true
+}
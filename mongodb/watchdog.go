@@ -0,0 +1,97 @@
+package mongodb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// WatchdogConfig configures Conn.StartWatchdog
+type WatchdogConfig struct {
+	// Interval between pings, 10s by default
+	Interval time.Duration
+	// Timeout of a ping, Interval by default
+	Timeout time.Duration
+	// ReconnectAfter is the number of consecutive failed pings after which Reconnect is attempted, 3 by default
+	ReconnectAfter int
+	// OnChange (optional) is called on up/down transitions, err is the failure that brought the connection down
+	OnChange func(up bool, err error)
+}
+
+// StartWatchdog pings the server in the background every Interval, reports up/down transitions
+// via OnChange and re-establishes the connection after ReconnectAfter consecutive failures,
+// so broken connections are discovered before the next user request.
+// The watchdog stops with Close or when the returned stop function is called.
+func (c *Conn) StartWatchdog(cfg WatchdogConfig) (stop func()) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cfg.Interval
+	}
+	if cfg.ReconnectAfter <= 0 {
+		cfg.ReconnectAfter = 3
+	}
+
+	stopped := make(chan struct{})
+	c.done.Add(1)
+	go c.watch(cfg, stopped)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stopped) })
+	}
+}
+
+func (c *Conn) watch(cfg WatchdogConfig, stopped chan struct{}) {
+	defer c.done.Done()
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	up := true
+	failures := 0
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeout)
+		err := c.Client().Ping(ctx, nil)
+		if err != nil {
+			failures++
+			if up {
+				up = false
+				log.Warnf("DB WARN: connection is down: %s", err)
+				if cfg.OnChange != nil {
+					cfg.OnChange(false, err)
+				}
+			}
+			if failures >= cfg.ReconnectAfter {
+				failures = 0
+				if err = c.Reconnect(ctx); err != nil {
+					log.Errorf("DB ERROR: failed to reconnect: %s", err)
+				} else {
+					err = c.Client().Ping(ctx, nil)
+				}
+			}
+		}
+		cancel()
+
+		if err == nil {
+			failures = 0
+			if !up {
+				up = true
+				log.Debug("DB DEBUG: connection is up")
+				if cfg.OnChange != nil {
+					cfg.OnChange(true, nil)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// weightedKeyField holds the random key of PickWeightedN during the aggregation
+const weightedKeyField = "_weighted_key"
+
+// PickWeighted selects a random item matched by sels with a probability proportional to its
+// positive numeric weightField, e.g. for ad rotation, see PickWeightedN
+// if no item has a positive weight, return mongo.ErrNoDocuments
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) PickWeighted(ctx context.Context, weightField string, sels map[string]any) (_ *T, err error) {
+	defer c.recoverPanic(ctx, "PickWeighted", &err)
+	items, err := c.PickWeightedN(c.nested(ctx), weightField, sels, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return &items[0], nil
+}
+
+// PickWeightedN selects up to n distinct random items matched by sels, each draw proportional to
+// the positive numeric weightField of the items not drawn yet. Items without a positive weight are
+// never selected. The selection runs on the server (weighted reservoir sampling with keys
+// rand^(1/weight)), it examines every matched item but transfers only the selected ones.
+// Requires $rand, available since 4.4.2. n <= 0 selects nothing.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) PickWeightedN(ctx context.Context, weightField string, sels map[string]any, n int) (_ []T, err error) {
+	defer c.recoverPanic(ctx, "PickWeightedN", &err)
+	sels = c.internalSels(sels)
+	if n <= 0 {
+		return []T{}, nil
+	}
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, weighted pick)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, weighted pick)")
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+
+	positive := bson.E{Key: weightField, Value: bson.M{"$gt": 0}}
+	filter := append(filterFromSels(sels), positive)
+	if _, ok := sels[weightField]; ok {
+		filter = bson.D{{Key: "$and", Value: bson.A{filterFromSels(sels), bson.D{positive}}}}
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$addFields", Value: bson.M{weightedKeyField: bson.M{"$pow": bson.A{
+			bson.M{"$rand": bson.M{}},
+			bson.M{"$divide": bson.A{1, "$" + weightField}},
+		}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: weightedKeyField, Value: -1}}}},
+		{{Key: "$limit", Value: n}},
+		{{Key: "$unset", Value: weightedKeyField}},
+	}
+	cursor, err := c.reader().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+	items := []T{}
+	for cursor.Next(ctx) {
+		var item T
+		err = c.decodeItem(ctx, cursor.Current, &item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,99 @@
+package mongodb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// WildcardIndex returns a spec of a wildcard index over the subfields of path, e.g. "attrs" of a dynamic
+// attribute map, or over all fields when path is empty
+func WildcardIndex(path string) IndexSpec {
+	key := "$**"
+	if path != "" {
+		key = path + ".$**"
+	}
+	return IndexSpec{Keys: bson.D{{Key: key, Value: 1}}}
+}
+
+// dynamicFields returns bson names of the map fields of T, whose subfields are not known in advance
+func dynamicFields[T any]() []string {
+	var names []string
+	for _, f := range modelFields(reflect.TypeOf((*T)(nil))) {
+		t := f.Type
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Map {
+			names = append(names, f.BSONName)
+		}
+	}
+	return names
+}
+
+// UnindexedDynamicFields returns the keys of sels addressing subfields of map fields of T
+// that no index can serve: neither an index starting with the key nor a wildcard index covering it
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) UnindexedDynamicFields(ctx context.Context, sels map[string]any) (_ []string, err error) {
+	defer c.recoverPanic(ctx, "UnindexedDynamicFields", &err)
+	dynamic := dynamicFields[T]()
+	if len(dynamic) == 0 {
+		return nil, nil
+	}
+	var keys []string
+	for key := range sels {
+		for _, name := range dynamic {
+			if strings.HasPrefix(key, name+".") {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	indexes, err := c.listIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var unindexed []string
+	for _, key := range keys {
+		if !indexServes(indexes, key) {
+			unindexed = append(unindexed, key)
+		}
+	}
+	return unindexed, nil
+}
+
+// indexServes reports whether one of indexes can be used for a filter on key
+func indexServes(indexes []existingIndex, key string) bool {
+	for _, index := range indexes {
+		for i, k := range index.Key {
+			if k.Key == "$**" || (strings.HasSuffix(k.Key, ".$**") && strings.HasPrefix(key, strings.TrimSuffix(k.Key, "$**"))) {
+				return true
+			}
+			if i == 0 && k.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// warnUnindexedDynamic logs filters on dynamic fields without a usable index, in dev mode only
+func (c *genericObjectDBCtrl[T]) warnUnindexedDynamic(ctx context.Context, sels map[string]any) {
+	if !DevMode() || len(sels) == 0 {
+		return
+	}
+	unindexed, err := c.UnindexedDynamicFields(c.nested(ctx), sels)
+	if err != nil {
+		return
+	}
+	for _, key := range unindexed {
+		log.Warnf("DB WARN: filter on dynamic field %s of %s has no index, consider WildcardIndex", key, c.db.Name())
+	}
+}
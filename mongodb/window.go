@@ -0,0 +1,182 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WindowField is an output field computed by $setWindowFields over the partition of each item
+type WindowField struct {
+	Name string
+	// Op is the window operator document, e.g. {"$sum": "$amount"}
+	Op bson.M
+	// Window bounds the documents Op sees, e.g. {"documents": ["unbounded", "current"]},
+	// nil for operators without a window like $rank
+	Window bson.M
+	// ranked operators need exactly one sort field
+	ranked bool
+}
+
+// RunningTotal sums field over the items of the partition up to the current one
+func RunningTotal(name string, field string) WindowField {
+	return WindowField{
+		Name:   name,
+		Op:     bson.M{"$sum": "$" + field},
+		Window: bson.M{"documents": bson.A{"unbounded", "current"}},
+	}
+}
+
+// MovingAverage averages field over the current item and up to size-1 preceding items
+func MovingAverage(name string, field string, size int) WindowField {
+	return WindowField{
+		Name:   name,
+		Op:     bson.M{"$avg": "$" + field},
+		Window: bson.M{"documents": bson.A{-(size - 1), "current"}},
+	}
+}
+
+// TimeMovingAverage averages field over the items whose sort field, a date, is within period
+// before the current one, sort by that single field
+func TimeMovingAverage(name string, field string, period time.Duration) WindowField {
+	return WindowField{
+		Name:   name,
+		Op:     bson.M{"$avg": "$" + field},
+		Window: bson.M{"range": bson.A{-period.Milliseconds(), "current"}, "unit": "millisecond"},
+		ranked: true,
+	}
+}
+
+// Rank numbers the items of the partition by sort order, ties share a rank and leave gaps (1, 1, 3)
+func Rank(name string) WindowField {
+	return WindowField{Name: name, Op: bson.M{"$rank": bson.M{}}, ranked: true}
+}
+
+// DenseRank numbers the items of the partition by sort order, ties share a rank without gaps (1, 1, 2)
+func DenseRank(name string) WindowField {
+	return WindowField{Name: name, Op: bson.M{"$denseRank": bson.M{}}, ranked: true}
+}
+
+// RowNumber numbers the items of the partition by sort order from 1, ties get distinct numbers
+func RowNumber(name string) WindowField {
+	return WindowField{Name: name, Op: bson.M{"$documentNumber": bson.M{}}}
+}
+
+// Shift returns field of the item by positions after the current one in the partition
+// (negative for preceding items), or null outside the partition
+func Shift(name string, field string, by int) WindowField {
+	return WindowField{Name: name, Op: bson.M{"$shift": bson.M{"output": "$" + field, "by": by, "default": nil}}}
+}
+
+// Window computes Fields over the items partitioned by PartitionBy (all items when empty)
+// in SortBy order
+type Window struct {
+	PartitionBy []string
+	SortBy      bson.D
+	Fields      []WindowField
+}
+
+// Stage compiles the window to a $setWindowFields stage
+// if the window is invalid, return err
+func (w Window) Stage() (bson.D, error) {
+	if len(w.Fields) == 0 {
+		return nil, fmt.Errorf("failed to compile window: no fields")
+	}
+	output := bson.D{}
+	for _, f := range w.Fields {
+		if f.Name == "" || f.Op == nil {
+			return nil, fmt.Errorf("failed to compile window: field without name or operator")
+		}
+		if f.ranked && len(w.SortBy) != 1 {
+			return nil, fmt.Errorf("failed to compile window: %s needs exactly one sort field", f.Name)
+		}
+		if (f.Window != nil || f.ranked) && len(w.SortBy) == 0 {
+			return nil, fmt.Errorf("failed to compile window: %s needs a sort", f.Name)
+		}
+		spec := bson.D{}
+		for op, arg := range f.Op {
+			spec = append(spec, bson.E{Key: op, Value: arg})
+		}
+		if f.Window != nil {
+			spec = append(spec, bson.E{Key: "window", Value: f.Window})
+		}
+		output = append(output, bson.E{Key: f.Name, Value: spec})
+	}
+
+	stage := bson.D{}
+	switch len(w.PartitionBy) {
+	case 0:
+	case 1:
+		stage = append(stage, bson.E{Key: "partitionBy", Value: "$" + w.PartitionBy[0]})
+	default:
+		partition := bson.D{}
+		for _, field := range w.PartitionBy {
+			partition = append(partition, bson.E{Key: field, Value: "$" + field})
+		}
+		stage = append(stage, bson.E{Key: "partitionBy", Value: partition})
+	}
+	if len(w.SortBy) > 0 {
+		stage = append(stage, bson.E{Key: "sortBy", Value: w.SortBy})
+	}
+	stage = append(stage, bson.E{Key: "output", Value: output})
+	return bson.D{{Key: "$setWindowFields", Value: stage}}, nil
+}
+
+// WindowResult is an item with the values of the window fields computed for it
+type WindowResult[T any] struct {
+	Item   T
+	Values map[string]any
+}
+
+// ListWindow lists items by sels filter (logical AND) with the window fields of w, ordered by
+// the partition and w.SortBy. Requires MongoDB 5.0.
+// if some failed, return err
+func (c *genericObjectDBCtrl[T]) ListWindow(ctx context.Context, sels map[string]any, w Window) (_ []WindowResult[T], err error) {
+	defer c.recoverPanic(ctx, "ListWindow", &err)
+	sels = c.internalSels(sels)
+	log.Debug("DB DEBUG: Started c.db.Aggregate(ctx, $setWindowFields)")
+	defer log.Debug("DB DEBUG: finished c.db.Aggregate(ctx, $setWindowFields)")
+	stage, err := w.Stage()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel, _ := c.begin(ctx, opRead)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{}
+	if len(sels) > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filterFromSels(sels)}})
+	}
+	pipeline = append(pipeline, stage)
+	cursor, err := c.reader().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer closeCursor(trackCursor(cursor))
+
+	results := []WindowResult[T]{}
+	for cursor.Next(ctx) {
+		var result WindowResult[T]
+		err = c.decodeItem(ctx, cursor.Current, &result.Item)
+		if err != nil {
+			return nil, err
+		}
+		result.Values = make(map[string]any, len(w.Fields))
+		for _, f := range w.Fields {
+			var value any
+			if raw, err := cursor.Current.LookupErr(f.Name); err == nil {
+				_ = raw.Unmarshal(&value)
+			}
+			result.Values[f.Name] = value
+		}
+		results = append(results, result)
+	}
+	if err = cursorErr(ctx, cursor); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
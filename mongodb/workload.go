@@ -0,0 +1,84 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WithWorkload tags the find queries of the controller with a workload label in $comment,
+// e.g. the feature or job using it, see WorkloadStats. WithWorkloadLabel overrides it per call.
+func WithWorkload(label string) Option {
+	return func(o *ctrlOptions) {
+		o.workload = label
+	}
+}
+
+// WithWorkloadLabel returns a context whose controller queries are tagged with the workload label
+func WithWorkloadLabel(ctx context.Context, label string) context.Context {
+	return WithCommentField(ctx, CommentWorkload, label)
+}
+
+// WorkloadLabel returns the workload label set by WithWorkloadLabel
+func WorkloadLabel(ctx context.Context) (string, bool) {
+	label, ok := contextCommentFields(ctx)[CommentWorkload].(string)
+	return label, ok
+}
+
+// WorkloadStat is the profiler data of one workload label
+type WorkloadStat struct {
+	// Label is the workload label, empty for untagged operations
+	Label        string `bson:"_id"`
+	Ops          int64  `bson:"ops"`
+	TotalMillis  int64  `bson:"totalMillis"`
+	MaxMillis    int64  `bson:"maxMillis"`
+	KeysExamined int64  `bson:"keysExamined"`
+	DocsExamined int64  `bson:"docsExamined"`
+	NReturned    int64  `bson:"nreturned"`
+}
+
+// WorkloadStats aggregates the operations recorded by the profiler since the given time by workload
+// label, most expensive first, for per-feature DB cost attribution. Only profiled operations count,
+// see SetProfiling. Getmores are attributed by the comment of their originating command.
+// Requires MongoDB 4.2+.
+// if some failed, return err
+func WorkloadStats(ctx context.Context, db *mongo.Database, since time.Time) ([]WorkloadStat, error) {
+	log.Debug("DB DEBUG: Started system.profile.Aggregate(ctx, pipeline) workload")
+	defer log.Debug("DB DEBUG: finished system.profile.Aggregate(ctx, pipeline) workload")
+
+	comment := bson.M{"$ifNull": bson.A{"$command.comment", "$originatingCommand.comment", ""}}
+	label := bson.M{"$regexFind": bson.M{
+		"input": bson.M{"$convert": bson.M{"input": comment, "to": "string", "onError": "", "onNull": ""}},
+		"regex": `"` + CommentWorkload + `":"([^"]*)"`,
+	}}
+	capture := bson.M{"$let": bson.M{
+		"vars": bson.M{"match": label},
+		"in":   bson.M{"$arrayElemAt": bson.A{"$$match.captures", 0}},
+	}}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"ts": bson.M{"$gte": since}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":          bson.M{"$ifNull": bson.A{capture, ""}},
+			"ops":          bson.M{"$sum": 1},
+			"totalMillis":  bson.M{"$sum": "$millis"},
+			"maxMillis":    bson.M{"$max": "$millis"},
+			"keysExamined": bson.M{"$sum": "$keysExamined"},
+			"docsExamined": bson.M{"$sum": "$docsExamined"},
+			"nreturned":    bson.M{"$sum": "$nreturned"},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "totalMillis", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	cursor, err := db.Collection("system.profile").Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	stats := []WorkloadStat{}
+	err = cursor.All(ctx, &stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
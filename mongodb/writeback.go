@@ -0,0 +1,129 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaults of WithLazyWriteBack
+const (
+	defaultWriteBackRate  = 50
+	defaultWriteBackQueue = 1000
+	writeBackTimeout      = 30 * time.Second
+)
+
+// WithWriteBackRate limits lazy write-backs of migrated documents (see WithLazyWriteBack)
+// to perSecond writes, queueing up to queue documents. Documents beyond the queue are not written
+// and get migrated again on their next read, so a traffic spike over old documents
+// does not turn into a write storm.
+func WithWriteBackRate(perSecond float64, queue int) Option {
+	return func(o *ctrlOptions) {
+		o.writeBack = true
+		o.writeBackRate = perSecond
+		o.writeBackQueue = queue
+	}
+}
+
+type writeBackJob struct {
+	collection *mongo.Collection
+	filter     bson.D
+	doc        bson.M
+}
+
+// writeBackWorker stores queued documents one by one at a limited rate
+type writeBackWorker struct {
+	interval time.Duration
+	jobs     chan writeBackJob
+
+	mu sync.Mutex
+	// pending holds ids of queued documents so a hot document is queued once
+	pending map[string]bool
+	closed  bool
+	start   sync.Once
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newWriteBackWorker(perSecond float64, queue int) *writeBackWorker {
+	if perSecond <= 0 {
+		perSecond = defaultWriteBackRate
+	}
+	if queue <= 0 {
+		queue = defaultWriteBackQueue
+	}
+	return &writeBackWorker{
+		interval: time.Duration(float64(time.Second) / perSecond),
+		jobs:     make(chan writeBackJob, queue),
+		pending:  map[string]bool{},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// enqueue queues the replacement of the document matching filter with doc, dropping it when the queue
+// is full or the worker is closed
+func (w *writeBackWorker) enqueue(collection *mongo.Collection, filter bson.D, doc bson.M) {
+	key := fmt.Sprint(doc["_id"])
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed || w.pending[key] {
+		return
+	}
+	w.start.Do(func() { go w.run() })
+	select {
+	case w.jobs <- writeBackJob{collection: collection, filter: filter, doc: doc}:
+		w.pending[key] = true
+	default:
+		log.Debugf("DB DEBUG: write-back queue of %s is full, %v skipped", collection.Name(), doc["_id"])
+	}
+}
+
+// close stops the worker and waits for the write in progress, queued documents are dropped
+func (w *writeBackWorker) close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.stop)
+	w.mu.Unlock()
+	// a worker that never started has nothing to wait for
+	w.start.Do(func() { close(w.done) })
+	<-w.done
+}
+
+func (w *writeBackWorker) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		var job writeBackJob
+		select {
+		case job = <-w.jobs:
+		case <-w.stop:
+			return
+		}
+		w.mu.Lock()
+		delete(w.pending, fmt.Sprint(job.doc["_id"]))
+		w.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), writeBackTimeout)
+		_, err := job.collection.ReplaceOne(ctx, job.filter, job.doc)
+		cancel()
+		if err != nil {
+			log.Errorf("DB ERROR: failed to write back migrated item %v: %s", job.doc["_id"], err)
+		}
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		}
+	}
+}
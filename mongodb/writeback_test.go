@@ -0,0 +1,28 @@
+package mongodb
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestWriteBackWorkerClose(t *testing.T) {
+	w := newWriteBackWorker(0, 0)
+	closed := make(chan struct{})
+	go func() {
+		w.close()
+		w.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close() of a worker that never started blocks")
+	}
+
+	w.enqueue(nil, nil, bson.M{"_id": 1})
+	if len(w.jobs) != 0 || len(w.pending) != 0 {
+		t.Errorf("enqueue() after close() queued %d jobs", len(w.jobs))
+	}
+}
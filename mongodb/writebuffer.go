@@ -0,0 +1,97 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WriteBuffer collects single item writes (Create, Update, Delete) made through any controller
+// with its context and flushes them as one ordered bulk write per collection, reducing round trips
+// of chatty request handlers.
+// Note: buffered writes are not checked for concurrent modifications and their detailed results
+// are empty, failures are reported by Flush.
+type WriteBuffer struct {
+	mu          sync.Mutex
+	collections []*mongo.Collection
+	models      map[*mongo.Collection][]mongo.WriteModel
+}
+
+type writeBufferKey struct{}
+
+// WithWriteBuffer returns a context whose controller writes are collected by the returned buffer
+// until Flush, typically called at the end of a request. Updates guarded by WithConcurrencyPolicy or
+// WithCheckOutLocks are applied immediately, so their conflicts are reported.
+func WithWriteBuffer(ctx context.Context) (context.Context, *WriteBuffer) {
+	buffer := &WriteBuffer{models: map[*mongo.Collection][]mongo.WriteModel{}}
+	return context.WithValue(ctx, writeBufferKey{}, buffer), buffer
+}
+
+func writeBufferFrom(ctx context.Context) *WriteBuffer {
+	buffer, _ := ctx.Value(writeBufferKey{}).(*WriteBuffer)
+	return buffer
+}
+
+func (b *WriteBuffer) add(collection *mongo.Collection, model mongo.WriteModel) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.models[collection]; !ok {
+		b.collections = append(b.collections, collection)
+	}
+	b.models[collection] = append(b.models[collection], model)
+}
+
+// Len returns the number of buffered writes
+func (b *WriteBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for _, models := range b.models {
+		n += len(models)
+	}
+	return n
+}
+
+// Flush writes the buffered writes in the order of the collections first written to, the buffer is emptied
+// if some failed, return err (writes of the collections after the failed one are not made)
+func (b *WriteBuffer) Flush(ctx context.Context) error {
+	log.Debug("DB DEBUG: Started WriteBuffer.Flush")
+	defer log.Debug("DB DEBUG: finished WriteBuffer.Flush")
+
+	b.mu.Lock()
+	collections, models := b.collections, b.models
+	b.collections, b.models = nil, map[*mongo.Collection][]mongo.WriteModel{}
+	b.mu.Unlock()
+
+	for _, collection := range collections {
+		_, err := collection.BulkWrite(ctx, models[collection], options.BulkWrite().SetOrdered(true))
+		if err != nil {
+			return fmt.Errorf("failed to flush writes of %s: %s", collection.Name(), err)
+		}
+	}
+	return nil
+}
+
+// ensureID returns doc with an _id, generated like the driver would when missing, and the _id
+func (c *genericObjectDBCtrl[T]) ensureID(doc bson.Raw) (bson.Raw, any, error) {
+	var d bson.D
+	err := c.unmarshal(doc, &d)
+	if err != nil {
+		return nil, nil, err
+	}
+	if id, ok := idOf(d); ok {
+		return doc, id, nil
+	}
+	id := primitive.NewObjectID()
+	doc, err = c.marshal(append(bson.D{{Key: "_id", Value: id}}, d...))
+	if err != nil {
+		return nil, nil, err
+	}
+	return doc, id, nil
+}
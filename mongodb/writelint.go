@@ -0,0 +1,43 @@
+package mongodb
+
+import (
+	"context"
+
+	"github.com/labstack/gommon/log"
+)
+
+type expectedModifiedKey struct{}
+
+// WithExpectedModified returns a context whose UpdateAttributes calls expect to modify at most n
+// items, overriding WithMaxExpectedModified, e.g. for a migration meant to touch many items
+func WithExpectedModified(ctx context.Context, n int64) context.Context {
+	return context.WithValue(ctx, expectedModifiedKey{}, n)
+}
+
+// WithMaxExpectedModified makes UpdateAttributes warn in dev mode when it modifies more than n items,
+// which usually means a filter on a misspelled or missing field matched everything.
+// 0 disables the check, see WithExpectedModified.
+func WithMaxExpectedModified(n int64) Option {
+	return func(o *ctrlOptions) {
+		o.maxExpectedModified = n
+	}
+}
+
+// lintWrite logs, in dev mode only, writes by filter which matched no items or modified more items
+// than expected, catching filter bugs like a wrong field name during development
+func (c *genericObjectDBCtrl[T]) lintWrite(ctx context.Context, op string, filter any, matched int64, modified int64) {
+	if !DevMode() {
+		return
+	}
+	if matched == 0 {
+		log.Warnf("DB WARN: %s of %s matched no items, check the filter %v", op, c.db.Name(), filter)
+		return
+	}
+	expected := c.opts.maxExpectedModified
+	if n, ok := ctx.Value(expectedModifiedKey{}).(int64); ok {
+		expected = n
+	}
+	if expected > 0 && modified > expected {
+		log.Warnf("DB WARN: %s of %s modified %d items, more than the expected %d, check the filter %v", op, c.db.Name(), modified, expected, filter)
+	}
+}
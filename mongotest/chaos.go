@@ -0,0 +1,197 @@
+package mongotest
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/blocktech-kg/go-mongodb-generic/mongodb"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Fault is a failure Chaos injects into repository calls
+type Fault struct {
+	// Methods restricts the fault to these Repository methods, e.g. "Get", all methods when empty
+	Methods []string
+	// Match restricts the fault to calls it reports true for, all calls when nil
+	Match func(ctx context.Context, method string) bool
+	// Probability of the fault per matching call in (0, 1], 0 means always
+	Probability float64
+	// Latency delays the call
+	Latency time.Duration
+	// Timeout blocks the call until its context is done and returns the context error
+	Timeout bool
+	// Err is returned instead of calling the repository, see TransientError
+	Err error
+}
+
+// TransientError returns a server error labeled retryable like the one of a primary step down
+func TransientError() error {
+	return mongo.CommandError{
+		Code:    189,
+		Name:    "PrimarySteppedDown",
+		Message: "injected primary step down",
+		Labels:  []string{"RetryableWriteError", "TransientTransactionError"},
+	}
+}
+
+// Chaos is a Repository decorator injecting latency, timeouts and errors into calls, so retry and
+// circuit breaker handling can be tested without breaking a real cluster. The first matching fault
+// of a call applies.
+type Chaos[T any] struct {
+	mongodb.Repository[T]
+
+	mu      sync.Mutex
+	faults  []Fault
+	rand    *rand.Rand
+	enabled bool
+}
+
+// NewChaos decorates repo with faults, it is enabled
+func NewChaos[T any](repo mongodb.Repository[T], faults ...Fault) *Chaos[T] {
+	return &Chaos[T]{
+		Repository: repo,
+		faults:     faults,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		enabled:    true,
+	}
+}
+
+// Seed makes the fault selection deterministic
+func (c *Chaos[T]) Seed(seed int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rand = rand.New(rand.NewSource(seed))
+}
+
+// SetEnabled turns fault injection on or off
+func (c *Chaos[T]) SetEnabled(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = enabled
+}
+
+// SetFaults replaces the faults
+func (c *Chaos[T]) SetFaults(faults ...Fault) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.faults = faults
+}
+
+// pick returns the fault applying to a call of method, nil if none
+func (c *Chaos[T]) pick(ctx context.Context, method string) *Fault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.enabled {
+		return nil
+	}
+	for i := range c.faults {
+		f := &c.faults[i]
+		if len(f.Methods) > 0 && !contains(f.Methods, method) {
+			continue
+		}
+		if f.Match != nil && !f.Match(ctx, method) {
+			continue
+		}
+		if f.Probability > 0 && c.rand.Float64() >= f.Probability {
+			continue
+		}
+		return f
+	}
+	return nil
+}
+
+// inject applies the fault of a call of method, a non nil error replaces the call
+func (c *Chaos[T]) inject(ctx context.Context, method string) error {
+	f := c.pick(ctx, method)
+	if f == nil {
+		return nil
+	}
+	if f.Latency > 0 {
+		timer := time.NewTimer(f.Latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if f.Timeout {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return f.Err
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Chaos[T]) Create(ctx context.Context, item *T) (*mongodb.CreateResult, error) {
+	if err := c.inject(ctx, "Create"); err != nil {
+		return nil, err
+	}
+	return c.Repository.Create(ctx, item)
+}
+
+func (c *Chaos[T]) Get(ctx context.Context, id any) (*T, error) {
+	if err := c.inject(ctx, "Get"); err != nil {
+		return nil, err
+	}
+	return c.Repository.Get(ctx, id)
+}
+
+func (c *Chaos[T]) Find(ctx context.Context, q mongodb.Query) (*T, error) {
+	if err := c.inject(ctx, "Find"); err != nil {
+		return nil, err
+	}
+	return c.Repository.Find(ctx, q)
+}
+
+func (c *Chaos[T]) List(ctx context.Context, q mongodb.Query) ([]T, error) {
+	if err := c.inject(ctx, "List"); err != nil {
+		return nil, err
+	}
+	return c.Repository.List(ctx, q)
+}
+
+func (c *Chaos[T]) Count(ctx context.Context, q mongodb.Query) (int64, error) {
+	if err := c.inject(ctx, "Count"); err != nil {
+		return 0, err
+	}
+	return c.Repository.Count(ctx, q)
+}
+
+func (c *Chaos[T]) Update(ctx context.Context, id any, item *T) (*mongodb.UpdateResult, error) {
+	if err := c.inject(ctx, "Update"); err != nil {
+		return nil, err
+	}
+	return c.Repository.Update(ctx, id, item)
+}
+
+func (c *Chaos[T]) UpdateAttributes(ctx context.Context, q mongodb.Query, attrs map[string]any) (*mongodb.UpdateResult, error) {
+	if err := c.inject(ctx, "UpdateAttributes"); err != nil {
+		return nil, err
+	}
+	return c.Repository.UpdateAttributes(ctx, q, attrs)
+}
+
+func (c *Chaos[T]) Delete(ctx context.Context, id any) (*mongodb.DeleteResult, error) {
+	if err := c.inject(ctx, "Delete"); err != nil {
+		return nil, err
+	}
+	return c.Repository.Delete(ctx, id)
+}
+
+func (c *Chaos[T]) DeleteRange(ctx context.Context, q mongodb.Query) (*mongodb.DeleteResult, error) {
+	if err := c.inject(ctx, "DeleteRange"); err != nil {
+		return nil, err
+	}
+	return c.Repository.DeleteRange(ctx, q)
+}
@@ -0,0 +1,170 @@
+// Package mongotest contains helpers for testing code built on the mongodb package
+package mongotest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// UpdateGoldenEnv is the environment variable that makes AssertGolden (re)write golden files
+const UpdateGoldenEnv = "MONGOTEST_UPDATE_GOLDEN"
+
+// ignoredCommands are driver housekeeping commands not recorded
+var ignoredCommands = map[string]bool{
+	"hello": true, "isMaster": true, "ismaster": true, "ping": true, "buildInfo": true,
+	"saslStart": true, "saslContinue": true, "endSessions": true, "killCursors": true,
+}
+
+// volatileFields are command fields that differ between runs, they are dropped from recordings
+var volatileFields = map[string]bool{
+	"lsid": true, "$clusterTime": true, "txnNumber": true, "signature": true,
+	"$readPreference": true, "autocommit": true, "startTransaction": true,
+}
+
+// orderedFields are documents whose key order matters, their keys are not sorted
+var orderedFields = map[string]bool{
+	"sort": true, "$sort": true, "key": true, "hint": true,
+}
+
+// Recorder records the BSON commands a client sends, attach it with
+// options.Client().SetMonitor(recorder.Monitor())
+type Recorder struct {
+	mu       sync.Mutex
+	commands []bson.Raw
+}
+
+// NewRecorder creates an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Monitor returns the command monitor feeding the recorder
+func (r *Recorder) Monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, e *event.CommandStartedEvent) {
+			if ignoredCommands[e.CommandName] {
+				return
+			}
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.commands = append(r.commands, append(bson.Raw(nil), e.Command...))
+		},
+	}
+}
+
+// Reset drops the recorded commands
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands = nil
+}
+
+// Commands returns the commands recorded since the last Reset
+func (r *Recorder) Commands() []bson.Raw {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]bson.Raw(nil), r.commands...)
+}
+
+// Record resets the recorder, runs fn and returns the commands it sent
+func (r *Recorder) Record(fn func() error) ([]bson.Raw, error) {
+	r.Reset()
+	err := fn()
+	return r.Commands(), err
+}
+
+// AssertGolden compares commands with the golden file testdata/<name>.golden and fails t on a difference,
+// so refactors of the query builder can't silently change queries. Session and cluster time fields are
+// dropped, dates and ObjectIDs are replaced by placeholders and the keys of nested documents are sorted,
+// except sort and index key documents, so map ordered selectors compare stable.
+// With MONGOTEST_UPDATE_GOLDEN=1 in the environment the golden file is written instead.
+func AssertGolden(t testing.TB, name string, commands []bson.Raw) {
+	t.Helper()
+	got, err := FormatCommands(commands)
+	if err != nil {
+		t.Fatalf("failed to format commands: %s", err)
+	}
+	path := filepath.Join("testdata", name+".golden")
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err == nil {
+			err = os.WriteFile(path, got, 0o644)
+		}
+		if err != nil {
+			t.Fatalf("failed to write %s: %s", path, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s (run with %s=1 to create it): %s", path, UpdateGoldenEnv, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("commands differ from %s\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+// FormatCommands renders normalized commands as indented extended JSON, as stored in golden files
+// if some failed, return err
+func FormatCommands(commands []bson.Raw) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, command := range commands {
+		var doc bson.D
+		err := bson.Unmarshal(command, &doc)
+		if err != nil {
+			return nil, err
+		}
+		normalized := bson.D{}
+		for _, e := range doc {
+			if volatileFields[e.Key] {
+				continue
+			}
+			normalized = append(normalized, bson.E{Key: e.Key, Value: normalize(e.Key, e.Value)})
+		}
+		data, err := bson.MarshalExtJSONIndent(normalized, false, false, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to format command: %s", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// normalize replaces volatile values of v and sorts its document keys unless key is ordered
+func normalize(key string, v any) any {
+	switch v := v.(type) {
+	case primitive.DateTime:
+		return "<date>"
+	case primitive.Timestamp:
+		return "<timestamp>"
+	case primitive.ObjectID:
+		return "<objectid>"
+	case bson.D:
+		doc := make(bson.D, 0, len(v))
+		for _, e := range v {
+			doc = append(doc, bson.E{Key: e.Key, Value: normalize(e.Key, e.Value)})
+		}
+		if !orderedFields[key] {
+			sort.SliceStable(doc, func(i, j int) bool { return doc[i].Key < doc[j].Key })
+		}
+		return doc
+	case bson.A:
+		array := make(bson.A, 0, len(v))
+		for _, value := range v {
+			array = append(array, normalize(key, value))
+		}
+		return array
+	}
+	return v
+}
@@ -0,0 +1,434 @@
+package mongotest
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DefaultVersion is the pinned mongod version StartServer downloads
+const DefaultVersion = "7.0.14"
+
+// Environment variables read by StartServer
+const (
+	// MongodEnv is the path of a local mongod binary used instead of a download
+	MongodEnv = "MONGOTEST_MONGOD"
+	// URIEnv is the connection string of a running server used instead of launching one
+	URIEnv = "MONGOTEST_URI"
+)
+
+// ServerOptions configures StartServer
+type ServerOptions struct {
+	// Version of mongod to download, DefaultVersion when empty
+	Version string
+	// Distro is the download target of linux builds, "ubuntu2204" when empty
+	Distro string
+	// ReplicaSet starts a single node replica set, needed by transactions and change streams
+	ReplicaSet bool
+	// Binary is the mongod to launch, downloaded when empty (see MongodEnv)
+	Binary string
+	// CacheDir keeps downloads between runs, <user cache dir>/mongotest when empty
+	CacheDir string
+	// StartTimeout bounds download and start up, 2 minutes when 0
+	StartTimeout time.Duration
+}
+
+// maxOutput is the number of trailing bytes of mongod output kept for start up errors
+const maxOutput = 16 * 1024
+
+// Server is a mongod launched for tests
+type Server struct {
+	// URI is the connection string of the server
+	URI string
+
+	cmd *exec.Cmd
+	dir string
+	// exited is closed when the process ended
+	exited chan struct{}
+	output *outputTail
+}
+
+// StartServer launches a pinned mongod on a free local port with a temporary data directory, downloading
+// it from fastdl.mongodb.org on first use and checking the published SHA-256, for CI environments
+// without Docker. With URIEnv set the running server is used instead. A mongod exiting during
+// start up fails at once with the end of its output.
+// if some failed, return err
+func StartServer(ctx context.Context, opts ServerOptions) (*Server, error) {
+	if uri := os.Getenv(URIEnv); uri != "" {
+		return &Server{URI: uri}, nil
+	}
+	if opts.StartTimeout <= 0 {
+		opts.StartTimeout = 2 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.StartTimeout)
+	defer cancel()
+
+	binary := opts.Binary
+	if binary == "" {
+		binary = os.Getenv(MongodEnv)
+	}
+	if binary == "" {
+		var err error
+		binary, err = downloadMongod(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "mongotest-")
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"--dbpath", dir, "--port", strconv.Itoa(port), "--bind_ip", "127.0.0.1"}
+	if opts.ReplicaSet {
+		args = append(args, "--replSet", "rs0")
+	}
+	output := &outputTail{}
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err = cmd.Start()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to start %s: %s", binary, err)
+	}
+	s := &Server{
+		URI:    fmt.Sprintf("mongodb://127.0.0.1:%d/?directConnection=true", port),
+		cmd:    cmd,
+		dir:    dir,
+		exited: make(chan struct{}),
+		output: output,
+	}
+	go func() {
+		_ = cmd.Wait()
+		close(s.exited)
+	}()
+
+	err = s.waitReady(ctx, opts.ReplicaSet, port)
+	if err != nil {
+		s.Stop()
+		if tail := output.String(); tail != "" {
+			return nil, fmt.Errorf("%s, mongod output:\n%s", err, tail)
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewTestServer starts a server for t and stops it when t ends
+// if some failed, fails t
+func NewTestServer(t testing.TB, opts ServerOptions) *Server {
+	t.Helper()
+	s, err := StartServer(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("failed to start mongod: %s", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Stop(); err != nil {
+			t.Logf("failed to stop mongod: %s", err)
+		}
+	})
+	return s
+}
+
+// Connect returns a client of the server
+// if some failed, return err
+func (s *Server) Connect(ctx context.Context, opts ...*options.ClientOptions) (*mongo.Client, error) {
+	return mongo.Connect(ctx, append([]*options.ClientOptions{options.Client().ApplyURI(s.URI)}, opts...)...)
+}
+
+// Stop kills the server and removes its data directory, servers of URIEnv are left running
+// if some failed, return err
+func (s *Server) Stop() error {
+	if s.cmd == nil {
+		return nil
+	}
+	_ = s.cmd.Process.Kill()
+	<-s.exited
+	s.cmd = nil
+	return os.RemoveAll(s.dir)
+}
+
+// waitReady pings the server until it answers and initiates the replica set with the member
+// at port, the process exiting meanwhile fails at once
+func (s *Server) waitReady(ctx context.Context, replicaSet bool, port int) error {
+	client, err := s.Connect(ctx, options.Client().SetServerSelectionTimeout(time.Second))
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(context.Background())
+	admin := client.Database("admin")
+	for {
+		err = admin.RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Err()
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to wait for mongod: %s", err)
+		}
+		if err = s.sleep(); err != nil {
+			return err
+		}
+	}
+	if !replicaSet {
+		return nil
+	}
+
+	// the default member is the host name, which mongod bound to 127.0.0.1 may not answer on
+	config := bson.M{
+		"_id":     "rs0",
+		"members": bson.A{bson.M{"_id": 0, "host": fmt.Sprintf("127.0.0.1:%d", port)}},
+	}
+	err = admin.RunCommand(ctx, bson.D{{Key: "replSetInitiate", Value: config}}).Err()
+	if err != nil {
+		return fmt.Errorf("failed to initiate replica set: %s", err)
+	}
+	for {
+		var status struct {
+			IsWritablePrimary bool `bson:"isWritablePrimary"`
+		}
+		err = admin.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&status)
+		if err == nil && status.IsWritablePrimary {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to wait for primary: %s", ctx.Err())
+		}
+		if err = s.sleep(); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep waits before the next poll of waitReady
+// if the process exited, return err
+func (s *Server) sleep() error {
+	select {
+	case <-s.exited:
+		return fmt.Errorf("mongod exited: %s", s.cmd.ProcessState)
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+// outputTail keeps the last maxOutput bytes written to it
+type outputTail struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (o *outputTail) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.buf = append(o.buf, p...)
+	if len(o.buf) > maxOutput {
+		o.buf = append([]byte(nil), o.buf[len(o.buf)-maxOutput:]...)
+	}
+	return len(p), nil
+}
+
+func (o *outputTail) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return string(bytes.TrimSpace(o.buf))
+}
+
+// downloadMongod returns the cached mongod of opts, downloading it first if needed
+func downloadMongod(ctx context.Context, opts ServerOptions) (string, error) {
+	version := opts.Version
+	if version == "" {
+		version = DefaultVersion
+	}
+	url, err := mongodURL(version, opts.Distro)
+	if err != nil {
+		return "", err
+	}
+	cacheDir := opts.CacheDir
+	if cacheDir == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		cacheDir = filepath.Join(userCache, "mongotest")
+	}
+	binary := filepath.Join(cacheDir, strings.TrimSuffix(filepath.Base(url), ".tgz"), "mongod")
+	if _, err = os.Stat(binary); err == nil {
+		return binary, nil
+	}
+
+	log.Debugf("DB DEBUG: downloading %s", url)
+	sum, err := publishedSHA256(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	body, err := get(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	err = os.MkdirAll(cacheDir, 0o755)
+	if err != nil {
+		return "", err
+	}
+	// the archive is checked before anything of it is extracted and run
+	archive, err := os.CreateTemp(cacheDir, "mongodb-*.tgz")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(archive, hash), body)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %s", url, err)
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != sum {
+		return "", fmt.Errorf("failed to download %s: sha256 %s, published %s", url, got, sum)
+	}
+	_, err = archive.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	err = extractMongod(archive, binary)
+	if err != nil {
+		return "", fmt.Errorf("failed to extract %s: %s", url, err)
+	}
+	return binary, nil
+}
+
+// publishedSHA256 returns the hex SHA-256 published next to the archive at url
+func publishedSHA256(ctx context.Context, url string) (string, error) {
+	body, err := get(ctx, url+".sha256")
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, 4096))
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s.sha256: %s", url, err)
+	}
+	// "<hex>  <file name>"
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", fmt.Errorf("failed to download %s.sha256: no checksum", url)
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// get returns the body of a successful GET of url
+func get(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %s", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// mongodURL returns the download URL of the mongod archive for the current platform
+func mongodURL(version string, distro string) (string, error) {
+	arch := map[string]string{"amd64": "x86_64", "arm64": "aarch64"}[runtime.GOARCH]
+	if arch == "" {
+		return "", fmt.Errorf("failed to download mongod: unsupported architecture %s", runtime.GOARCH)
+	}
+	switch runtime.GOOS {
+	case "linux":
+		if distro == "" {
+			distro = "ubuntu2204"
+		}
+		return fmt.Sprintf("https://fastdl.mongodb.org/linux/mongodb-linux-%s-%s-%s.tgz", arch, distro, version), nil
+	case "darwin":
+		if arch == "aarch64" {
+			arch = "arm64"
+		}
+		return fmt.Sprintf("https://fastdl.mongodb.org/osx/mongodb-macos-%s-%s.tgz", arch, version), nil
+	}
+	return "", fmt.Errorf("failed to download mongod: unsupported OS %s, set %s", runtime.GOOS, MongodEnv)
+}
+
+// extractMongod writes the bin/mongod entry of the tgz archive r to binary
+func extractMongod(r io.Reader, binary string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return fmt.Errorf("no bin/mongod in archive")
+		}
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(header.Name, "/bin/mongod") {
+			continue
+		}
+		err = os.MkdirAll(filepath.Dir(binary), 0o755)
+		if err != nil {
+			return err
+		}
+		// write aside and rename, so concurrent test binaries never run a partial file
+		tmp, err := os.CreateTemp(filepath.Dir(binary), "mongod-*")
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tmp, archive)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(tmp.Name(), 0o755)
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), binary)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+		return err
+	}
+}
+
+// freePort returns a free local TCP port
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}